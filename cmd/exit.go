@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/lifecycle"
+)
+
+// The exit codes of the tool, by class of failure, so that CI can branch on them.
+const (
+	// ExitValidationFailure is the exit code of runs whose endpoints didn't all return their expected results, or
+	// couldn't be tested.
+	ExitValidationFailure = 1
+
+	// ExitDeployFailure is the exit code of runs whose sample failed to build, deploy, or start serving.
+	ExitDeployFailure = 2
+
+	// ExitConfigFailure is the exit code of runs that failed before building the sample, such as for invalid flags, a
+	// missing README or an invalid OpenAPI spec. It's also used for failures that don't fall in any other class.
+	ExitConfigFailure = 3
+
+	// ExitInterrupted is the exit code of runs interrupted by SIGINT or SIGTERM, following the shell convention of
+	// 128 plus the signal number of SIGINT.
+	ExitInterrupted = 130
+)
+
+// exitCodeHelp documents the exit codes in the tool's help text.
+const exitCodeHelp = `Exit codes:
+  0    every tested sample passed
+  1    validation failure: endpoints didn't all return their expected results
+  2    deploy failure: the sample failed to build, deploy or start serving
+  3    configuration failure: the run failed before building the sample, e.g. invalid flags, a missing README or an
+       invalid OpenAPI spec
+  130  interrupted: the run received SIGINT or SIGTERM, and cleaned up before exiting`
+
+// exitError is an error classified with the exit code it makes the tool exit with.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// validationFailure classifies the provided error as an endpoint validation failure (see ExitValidationFailure).
+func validationFailure(err error) error {
+	return &exitError{code: ExitValidationFailure, err: err}
+}
+
+// deployFailure classifies the provided error as a build or deploy failure (see ExitDeployFailure).
+func deployFailure(err error) error {
+	return &exitError{code: ExitDeployFailure, err: err}
+}
+
+// ExitCode returns the code the tool should exit with for the provided error returned by Execute: 0 if it's nil, the
+// code it was classified with, ExitDeployFailure for unclassified lifecycle.ExecErrors, or ExitConfigFailure for other
+// unclassified errors, such as lifecycle.ParseErrors. Interrupted runs exit with ExitInterrupted whatever the class of
+// the failure the interruption caused.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ExitInterrupted
+	}
+
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+
+	// a failed build and deploy command is a deploy failure wherever it's returned from
+	var execErr *lifecycle.ExecError
+	if errors.As(err, &execErr) {
+		return ExitDeployFailure
+	}
+
+	return ExitConfigFailure
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/lifecycle"
+	"testing"
+)
+
+type exitCodeTest struct {
+	err  error // error returned by Execute
+	code int   // expected result of ExitCode
+}
+
+var exitCodeTests = []exitCodeTest{
+	// success
+	{
+		err:  nil,
+		code: 0,
+	},
+
+	// validation failure
+	{
+		err:  validationFailure(fmt.Errorf("all tests did not pass")),
+		code: ExitValidationFailure,
+	},
+
+	// wrapped deploy failure
+	{
+		err:  fmt.Errorf("FAIL: %w", deployFailure(errors.New("gcloud builds submit failed"))),
+		code: ExitDeployFailure,
+	},
+
+	// deploy failure caused by an interruption
+	{
+		err:  deployFailure(fmt.Errorf("executing Lifecycle command: %w", context.Canceled)),
+		code: ExitInterrupted,
+	},
+
+	// unclassified lifecycle command failure
+	{
+		err:  fmt.Errorf("[cmd.Root] %w", &lifecycle.ExecError{Command: "false", Err: errors.New("exit status 1")}),
+		code: ExitDeployFailure,
+	},
+
+	// README parse failure
+	{
+		err:  &lifecycle.ParseError{File: "README.md", Line: 12, Err: errors.New("unexpected EOF: code block not closed")},
+		code: ExitConfigFailure,
+	},
+
+	// unclassified failure
+	{
+		err:  errors.New("unknown flag: --nope"),
+		code: ExitConfigFailure,
+	},
+}
+
+func TestExitCode(t *testing.T) {
+	for i, tc := range exitCodeTests {
+		if code := ExitCode(tc.err); code != tc.code {
+			t.Errorf("#%d: result mismatch\nwant: %d\ngot: %d", i, tc.code, code)
+		}
+	}
+}
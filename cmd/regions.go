@@ -0,0 +1,101 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/sample"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/tui"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+// deployTarget is where testSample deploys a sample to.
+type deployTarget struct {
+	// region replaces the region the sample's README deploys to, unless it's empty.
+	region string
+
+	// serviceName overrides the generated Cloud Run service name, unless it's empty.
+	serviceName string
+}
+
+// perRegionFlags are the flags that can't be used with --regions: either they conflict with it, or they name a file
+// that would be shared, and clobbered, by every region.
+var perRegionFlags = []string{"region", "recursive", "json-output", "junit-out", "har-output", "record", "replay",
+	"failure-dir"}
+
+// checkRegionsFlags returns an error if any of the perRegionFlags is set along with --regions.
+func checkRegionsFlags(cmd *cobra.Command) error {
+	for _, name := range perRegionFlags {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--%s can't be used with --regions", name)
+		}
+	}
+
+	return nil
+}
+
+// testRegions builds, deploys, tests and cleans up the sample in sampleDir in each of the regions in turn, and logs a
+// summary of the regions it passed and failed in. It returns an error if it failed in any region. If state is non-nil,
+// the sample is recorded as passed in it only if it passed in every region.
+//
+// The regions are tested one after the other rather than concurrently, since the region is passed to the README's
+// commands through process-wide environment variables.
+func testRegions(ctx context.Context, cmd *cobra.Command, sampleDir string, state *sample.RunState, progress *tui.State) error {
+	errs := make([]error, len(regions))
+	for i, r := range regions {
+		util.Infof("Testing sample in region %s (%d of %d)\n", r, i+1, len(regions))
+		errs[i] = testSample(ctx, cmd, sampleDir, deployTarget{region: r, serviceName: regionServiceName(serviceName, r)}, nil, progress)
+	}
+
+	// the run exits with the code of the most severe class of failure among the regions
+	var failed, code int
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			if c := ExitCode(err); c > code {
+				code = c
+			}
+			log.Printf("FAIL %s: %v\n", regions[i], err)
+			continue
+		}
+		log.Printf("PASS %s\n", regions[i])
+	}
+	log.Printf("Passed in %d of %d region(s)\n", len(regions)-failed, len(regions))
+
+	if state != nil {
+		if err := state.Record(sampleDir, failed == 0); err != nil {
+			log.Printf("Recording run state: %v\n", err)
+		}
+	}
+
+	if failed > 0 {
+		return &exitError{code: code, err: fmt.Errorf("[cmd.Root] failed in %d of %d region(s)", failed, len(regions))}
+	}
+	return nil
+}
+
+// regionServiceName returns the Cloud Run service name set with --service-name suffixed with the provided region, so
+// that the service deployed in each region is told apart, or the empty string to generate one if it isn't set.
+// Generated service names are already unique.
+func regionServiceName(name, region string) string {
+	if name == "" {
+		return ""
+	}
+
+	return name + "-" + region
+}
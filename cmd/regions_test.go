@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"testing"
+)
+
+type checkRegionsFlagsTest struct {
+	args []string // command line flags
+	err  bool     // whether checkRegionsFlags should return an error
+}
+
+var checkRegionsFlagsTests = []checkRegionsFlagsTest{
+	{
+		args: []string{"--service-name=my-service", "--fail-on-warning"},
+	},
+	{
+		args: []string{"--region=us-central1"},
+		err:  true,
+	},
+	{
+		args: []string{"--junit-out=results.xml"},
+		err:  true,
+	},
+}
+
+func TestCheckRegionsFlags(t *testing.T) {
+	for i, tc := range checkRegionsFlagsTests {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("fail-on-warning", false, "")
+		cmd.Flags().String("service-name", "", "")
+		for _, name := range perRegionFlags {
+			cmd.Flags().String(name, "", "")
+		}
+		if err := cmd.Flags().Parse(tc.args); err != nil {
+			t.Fatalf("#%d: cmd.Flags().Parse: %v", i, err)
+		}
+
+		err := checkRegionsFlags(cmd)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+		}
+	}
+}
+
+type regionServiceNameTest struct {
+	name   string // service name set with --service-name
+	region string // region the service is deployed to
+	want   string // expected result of regionServiceName
+}
+
+var regionServiceNameTests = []regionServiceNameTest{
+	{name: "my-service", region: "europe-west1", want: "my-service-europe-west1"},
+	{region: "europe-west1", want: ""},
+}
+
+func TestRegionServiceName(t *testing.T) {
+	for i, tc := range regionServiceNameTests {
+		if got := regionServiceName(tc.name, tc.region); got != tc.want {
+			t.Errorf("#%d: result mismatch\nwant: %q\ngot: %q", i, tc.want, got)
+		}
+	}
+}
@@ -15,85 +15,1236 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/gcloud"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/lifecycle"
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/sample"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/tui"
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"io/ioutil"
 	"log"
-	"os/exec"
+	"net/url"
+	"os"
 	"path/filepath"
+	"regexp"
+	"text/template"
+	"time"
 )
 
 var (
+	// seed makes generated resource names deterministic when set.
+	seed int64
+
+	// serviceName overrides the generated Cloud Run service name.
+	serviceName string
+
+	// serviceNameMaxLen is the maximum length of the generated Cloud Run service name.
+	serviceNameMaxLen int
+
+	// dryRun prints the build and deploy commands without executing them.
+	dryRun bool
+
+	// explain prints the transformations applied to each parsed README command without executing them.
+	explain bool
+
+	// commandRetries is the number of times a failed build or deploy command is retried.
+	commandRetries int
+
+	// commandRetryDelay is the base delay of the exponential backoff between build and deploy command retries.
+	commandRetryDelay time.Duration
+
+	// failOnWarning promotes warning-level findings to failures for the run's exit status.
+	failOnWarning bool
+
+	// scanLeaks enables scanning response bodies for leaked sensitive data.
+	scanLeaks bool
+
+	// leakPatterns are the regular expressions response bodies are scanned for. Setting them enables scanning.
+	leakPatterns []string
+
+	// httpTimeout is the timeout of each test request made to the Cloud Run service.
+	httpTimeout time.Duration
+
+	// endpointConcurrency is the number of paths validated concurrently.
+	endpointConcurrency int
+
+	// endpointRetries is the number of times a failed test request is retried.
+	endpointRetries int
+
+	// endpointRetryDelay is the base delay of the exponential backoff between test request retries.
+	endpointRetryDelay time.Duration
+
+	// maxRetryAfter caps how long a 429 response's Retry-After header can make a retry wait.
+	maxRetryAfter time.Duration
+
+	// failureDir is the directory each failed test request and its response are written to, in a file per endpoint.
+	failureDir string
+
+	// failureOutput is the name of the util.FailureVerbosity used for failed test requests' response bodies.
+	failureOutput string
+
+	// failureBodyLimit is the number of response body bytes dumped for failed test requests with truncated output.
+	failureBodyLimit int
+
+	// checkPathCase retries requests that returned a 404 with the path lowercased to diagnose case-sensitivity bugs.
+	checkPathCase bool
+
+	// checkAllow checks that each path's OPTIONS response lists exactly the methods the spec defines for it.
+	checkAllow bool
+
+	// generateBodies generates minimal JSON request bodies from request body schemas without examples.
+	generateBodies bool
+
+	// checkIdempotency sends PUT and DELETE requests twice and checks both responses are expected.
+	checkIdempotency bool
+
+	// cleanupTimeout is the time cleaning up the sample's resources may take, independently of the rest of the run.
+	cleanupTimeout time.Duration
+
+	// keepResources skips deleting the deployed Cloud Run service and its container image.
+	keepResources bool
+
+	// failureLogs is the number of recent service log entries logged when tests fail.
+	failureLogs int
+
+	// record is the directory every test request and its response are recorded to, for replaying them later.
+	record string
+
+	// replay is the directory test requests are served from, without deploying the sample.
+	replay string
+
+	// harOutput is the file an HTTP Archive of every test request and response is written to.
+	harOutput string
+
+	// assertTraffic is the expected traffic split of the deployed Cloud Run service, checked after deploying.
+	assertTraffic string
+
+	// unauthenticated makes test requests without an identity token, for publicly accessible services.
+	unauthenticated bool
+
+	// audience is the audience the identity token authenticating test requests is minted for.
+	audience string
+
+	// startupProbe is the deadline for the deployed service's root endpoint to first respond successfully.
+	startupProbe time.Duration
+
+	// readyPath is the path polled after deploying until it gets a response that isn't a 5xx.
+	readyPath string
+
+	// urlTimeout is the time the deployed service's URL is retried for while it's empty or can't be retrieved.
+	urlTimeout time.Duration
+
+	// readyTimeout is the time waited for readyPath to get a response that isn't a 5xx before validating endpoints
+	// anyway.
+	readyTimeout time.Duration
+
+	// burst is the number of concurrent requests sent to the deployed service to check it scales out.
+	burst int
+
+	// burstTimeout is the time every request of the burst must succeed within.
+	burstTimeout time.Duration
+
+	// openAPISpec is the local path or http(s) URL of the OpenAPI spec declaring the endpoints to test.
+	openAPISpec string
+
+	// imageURL replaces the container image URL derived from the gcloud default project and the sample's name.
+	imageURL string
+
+	// codeTag is the tag annotating the README code blocks holding the build and deploy commands.
+	codeTag string
+
+	// project is the Google Cloud project the sample is deployed to instead of the gcloud default project.
+	project string
+
+	// readme is the markdown file, relative to the sample's directory, that build and deploy commands are parsed from
+	// instead of README.md.
+	readme string
+
+	// region replaces the region the sample's README deploys to.
+	region string
+
+	// regions are the regions the sample is deployed to and tested in, one after the other.
+	regions []string
+
+	// resume is the run-state file recording which samples passed, used to skip them when resuming a run.
+	resume string
+
+	// fuzzBodies is the number of random schema-valid request bodies sent to each operation.
+	fuzzBodies int
+
+	// noFollowRedirects makes endpoint validation check redirect responses as they are instead of following them.
+	noFollowRedirects bool
+
+	// skipContentTypeCheck disables checking response content types against the ones declared in the OpenAPI spec.
+	skipContentTypeCheck bool
+
+	// problemDetails checks that expected error responses are RFC 7807 problem details.
+	problemDetails bool
+
+	// problemDetailsSchema is the file holding the schema error response bodies are checked against instead of the
+	// default problem details schema.
+	problemDetailsSchema string
+
+	// allowEmptySpec makes an OpenAPI spec without any paths pass trivially instead of failing the run.
+	allowEmptySpec bool
+
+	// commandTimeout is the time each build and deploy command may run for before it's killed.
+	commandTimeout time.Duration
+
+	// jsonOutput is the file the structured endpoint validation results are written to as JSON, or - for standard
+	// output.
+	jsonOutput string
+
+	// junitOut is the file the endpoint validation results are written to as a JUnit XML report.
+	junitOut string
+
+	// reportTemplate is the text/template file the structured endpoint validation results are rendered through to
+	// standard output.
+	reportTemplate string
+
+	// useTUI renders a live terminal dashboard of the run's progress in place of the scrolling log.
+	useTUI bool
+
+	// onlyTag restricts endpoint validation to operations carrying this OpenAPI tag.
+	onlyTag string
+
+	// methods restricts endpoint validation to operations of these HTTP methods.
+	methods []string
+
+	// excludeMethods skips the operations of these HTTP methods during endpoint validation.
+	excludeMethods []string
+
+	// skip lists the paths, optionally preceded by an HTTP method, whose operations are skipped during endpoint
+	// validation, on top of the ones in the sample's .sstignore file.
+	skip []string
+
+	// registryHosts are the hostnames of registries whose container image URLs in the README are replaced, on top of
+	// Container Registry and Artifact Registry ones.
+	registryHosts []string
+
+	// gcloudFlags are appended to every gcloud command of the README or sst.yaml file, e.g. --project.
+	gcloudFlags []string
+
+	// recursive tests every sample found under the directory passed as argument instead of a single sample.
+	recursive bool
+
+	// sampleConcurrency is the number of sample phases run at once with --recursive.
+	sampleConcurrency int
+
+	// quiet only logs failures and final results.
+	quiet bool
+
+	// verbose also logs the bodies of test requests and their responses.
+	verbose bool
+
+	// gcloudPath is the gcloud executable run by the tool and by the README's gcloud commands.
+	gcloudPath string
+
 	rootCmd = &cobra.Command{
-		Use:   "sst [sample-dir]",
-		Short: "An end-to-end tester for GCP samples",
-		Args:  cobra.ExactArgs(1),
+		Use:           "sst [sample-dir | sample-file | samples-dir]",
+		Short:         "An end-to-end tester for GCP samples",
+		Long:          "An end-to-end tester for GCP samples.\n\n" + exitCodeHelp,
+		Args:          cobra.ExactArgs(1),
 		SilenceErrors: true,
-		SilenceUsage: true,
+		SilenceUsage:  true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Parse sample directory from command line argument
-			sampleDir, err := filepath.Abs(filepath.Dir(args[0]))
-			if err != nil {
-				return err
+			switch {
+			case quiet && verbose:
+				return fmt.Errorf("[cmd.Root] --quiet and --verbose can't be used together")
+			case quiet:
+				util.SetLogLevel(util.LogQuiet)
+			case verbose:
+				util.SetLogLevel(util.LogVerbose)
 			}
+			util.GcloudPath = gcloudPath
 
-			log.Println("Setting up configuration values")
-			// Set up config file location
-			viper.SetConfigName("config")
-			viper.SetConfigType("yaml")
-			viper.AddConfigPath(sampleDir)
-			s, err := sample.NewSample(sampleDir)
-			if err != nil {
-				return err
+			var state *sample.RunState
+			if resume != "" {
+				var err error
+				state, err = sample.LoadRunState(resume)
+				if err != nil {
+					return fmt.Errorf("[cmd.Root] loading run state: %w", err)
+				}
 			}
 
-			log.Println("Loading test endpoints")
-			swagger := util.LoadTestEndpoints()
+			progress := tui.NewState()
+			if useTUI {
+				if tui.IsTerminal(os.Stderr) {
+					d := tui.StartDashboard(os.Stderr, progress)
+					log.SetOutput(d)
+					defer func() {
+						d.Stop()
+						log.SetOutput(os.Stderr)
+					}()
+				} else {
+					log.Println("--tui: standard error is not a terminal, falling back to plain logging")
+				}
+			}
 
-			log.Println("Building and deploying sample to Cloud Run")
-			err = s.BuildDeployLifecycle.Execute(s.Dir)
-			defer s.Service.Delete(s.Dir)
-			defer s.DeleteCloudContainerImage()
-			if err != nil {
-				return fmt.Errorf("[cmd.Root] building and deploying sample to Cloud Run: %w", err)
+			// cleanup deliberately doesn't run under this context, so that it still happens once the run is interrupted
+			ctx, stop := withInterrupt(context.Background())
+			defer stop()
+
+			if len(regions) > 0 {
+				if err := checkRegionsFlags(cmd); err != nil {
+					return fmt.Errorf("[cmd.Root] %w", err)
+				}
 			}
 
-			log.Println("Getting identity token for gcloud auhtorized account")
-			var identToken string
-			a := append(util.GcloudCommonFlags, "auth", "print-identity-token")
-			identToken, err = util.ExecCommand(exec.Command("gcloud", a...), s.Dir)
-			if err != nil {
-				return fmt.Errorf("[cmd.Root] getting identity token for gcloud auhtorized account: %w", err)
+			if recursive {
+				return testSamples(ctx, cmd, args[0], state, progress)
 			}
 
-			log.Println("Checking endpoints for expected results")
-			serviceURL, err := s.Service.URL(s.Dir)
+			// Parse sample directory from command line argument
+			sampleDir, err := sampleDirFromArg(args[0])
 			if err != nil {
-				return fmt.Errorf("[cmd.Root] getting Cloud Run service URL: %w", err)
+				return fmt.Errorf("[cmd.Root] parsing sample directory: %w", err)
 			}
 
-			log.Println("Validating Cloud Run service endpoints for expected status codes")
-			allTestsPassed, err := util.ValidateEndpoints(serviceURL, &swagger.Paths, identToken)
-			if err != nil {
-				return fmt.Errorf("[cmd.Root] validating Cloud Run service endpoints for expected status codes: %w", err)
+			if state != nil && state.Passed(sampleDir) {
+				util.Infof("Skipping %s: already passed in a previous run recorded in %s\n", sampleDir, resume)
+				return nil
 			}
 
-			if !allTestsPassed {
-				return fmt.Errorf("all tests did not pass")
+			if len(regions) > 0 {
+				return testRegions(ctx, cmd, sampleDir, state, progress)
 			}
-			return nil
+
+			return testSample(ctx, cmd, sampleDir, deployTarget{region: region, serviceName: serviceName}, state, progress)
 		},
 	}
 )
 
-// Execute executes the root command.
+// testSample builds, deploys and tests the sample in sampleDir to the provided deployTarget, then cleans it up. If
+// state is non-nil, the outcome is recorded in it, like for every sample tested with --recursive (see recordState).
+// progress is updated as the test goes through its phases. Once ctx is done, the in-flight work is cancelled and no
+// further phase is started, but the sample is still cleaned up.
+func testSample(ctx context.Context, cmd *cobra.Command, sampleDir string, target deployTarget, state *sample.RunState, progress *tui.State) error {
+	if replay != "" {
+		return replayEndpoints(sampleDir)
+	}
+
+	t := &sampleTest{ctx: ctx, cmd: cmd, sampleDir: sampleDir, target: target, progress: progress}
+
+	var err error
+	for _, p := range t.phases() {
+		if err != nil && !p.Always {
+			continue
+		}
+		if perr := p.Run(); err == nil {
+			err = perr
+		}
+	}
+
+	t.recordState(state, err)
+	return err
+}
+
+// sampleTest holds the state of testing a single sample, carried from one of its phases to the next.
+type sampleTest struct {
+	ctx       context.Context
+	cmd       *cobra.Command
+	sampleDir string
+	target    deployTarget
+	progress  *tui.State
+
+	s           *sample.Sample
+	opts        []util.ValidateOption
+	wantTraffic map[string]int
+	tmpl        *template.Template
+	swagger     *openapi3.Swagger
+
+	// deployed is whether the sample's build and deploy commands were run, so that there's something to clean up.
+	deployed bool
+
+	serviceURL string
+	report     *util.Report
+}
+
+// phases returns the phases of testing the sample, in order: building and deploying it, validating its endpoints,
+// and cleaning it up, which always runs. Splitting them lets sample.RunJobs validate one sample while deploying
+// another.
+func (t *sampleTest) phases() []sample.Phase {
+	return []sample.Phase{
+		{Name: "deploy", Run: t.deploy},
+		{Name: "validate", Run: t.validate},
+		{Name: "cleanup", Run: t.cleanUp, Always: true},
+	}
+}
+
+// job returns the sample.Job running the phases of testing the sample, which records its outcome in the provided
+// state, if non-nil, once it finishes (see recordState).
+func (t *sampleTest) job(state *sample.RunState) sample.Job {
+	return sample.Job{Name: t.sampleDir, Phases: t.phases(), Done: func(err error) {
+		t.recordState(state, err)
+	}}
+}
+
+// recordState records whether the sample passed, according to the provided error, in the provided state, if non-nil.
+// Nothing is recorded unless the sample was deployed: a sample that was only explained or dry-run wasn't tested, and
+// must still be tested when resuming.
+func (t *sampleTest) recordState(state *sample.RunState, err error) {
+	if state == nil || !t.deployed {
+		return
+	}
+
+	if rerr := state.Record(t.sampleDir, err == nil); rerr != nil {
+		log.Printf("[%s] Recording run state: %v\n", t.sampleDir, rerr)
+	}
+}
+
+// deploy sets up the sample and builds and deploys it to Cloud Run, unless only its commands are explained or
+// printed, then gets the Cloud Run service's URL.
+func (t *sampleTest) deploy() error {
+	if err := checkInterrupted(t.ctx); err != nil {
+		return err
+	}
+
+	t.progress.SetPhase("Setting up")
+	util.Infof("Setting up configuration values\n")
+	sampleOpts := []sample.Option{sample.WithServiceNameMaxLen(serviceNameMaxLen)}
+	if t.target.serviceName != "" {
+		sampleOpts = append(sampleOpts, sample.WithServiceName(t.target.serviceName))
+	}
+	if imageURL != "" {
+		sampleOpts = append(sampleOpts, sample.WithImageURL(imageURL))
+	}
+	if codeTag != "" {
+		sampleOpts = append(sampleOpts, sample.WithCodeTag(codeTag))
+	}
+	if readme != "" {
+		sampleOpts = append(sampleOpts, sample.WithREADME(readme))
+	}
+	if len(registryHosts) > 0 {
+		sampleOpts = append(sampleOpts, sample.WithRegistryHosts(registryHosts...))
+	}
+	if len(gcloudFlags) > 0 {
+		sampleOpts = append(sampleOpts, sample.WithGcloudFlags(gcloudFlags...))
+	}
+	if t.target.region != "" {
+		// The region environment variables are expanded in the README's commands and inherited by every gcloud
+		// command, so that the Cloud Run service is also described and deleted in the requested region.
+		for _, v := range lifecycle.RegionEnvVars {
+			if err := os.Setenv(v, t.target.region); err != nil {
+				return fmt.Errorf("[cmd.Root] setting %s: %w", v, err)
+			}
+		}
+		sampleOpts = append(sampleOpts, sample.WithRegion(t.target.region))
+	}
+	if project != "" {
+		// gcloud reads its default project from this environment variable, so that the README's commands and the
+		// tool's own gcloud commands all use the requested project.
+		if err := os.Setenv("CLOUDSDK_CORE_PROJECT", project); err != nil {
+			return fmt.Errorf("[cmd.Root] setting CLOUDSDK_CORE_PROJECT: %w", err)
+		}
+		sampleOpts = append(sampleOpts, sample.WithProjectID(project))
+	}
+	if t.cmd.Flags().Changed("seed") {
+		sampleOpts = append(sampleOpts, sample.WithSeed(seed))
+	}
+	if explain || dryRun {
+		// commands that are only printed can't break, so their unset variables are worth seeing rather than failing on
+		sampleOpts = append(sampleOpts, sample.WithUnsetEnvWarnings())
+	}
+
+	s, err := sample.NewSample(t.sampleDir, sampleOpts...)
+	if err != nil {
+		return err
+	}
+	t.s = s
+	util.Infof("Build and deploy plan:\n%s\n", s.BuildDeployLifecycle)
+
+	t.opts, err = validateOptions(t.sampleDir)
+	if err != nil {
+		return fmt.Errorf("[cmd.Root] configuring endpoint validation: %w", err)
+	}
+
+	if assertTraffic != "" {
+		t.wantTraffic, err = gcloud.ParseTrafficAssertion(assertTraffic)
+		if err != nil {
+			return fmt.Errorf("[cmd.Root] parsing --assert-traffic: %w", err)
+		}
+	}
+
+	if reportTemplate != "" {
+		t.tmpl, err = loadReportTemplate(reportTemplate)
+		if err != nil {
+			return fmt.Errorf("[cmd.Root] loading --report-template: %w", err)
+		}
+	}
+
+	t.progress.SetPhase("Loading test endpoints")
+	util.Infof("Loading test endpoints\n")
+	t.swagger, err = util.LoadTestEndpoints(s.Dir, openAPISpec)
+	if err != nil {
+		return fmt.Errorf("[cmd.Root] loading test endpoints: %w", err)
+	}
+	grpcService, isGRPC, err := util.GRPCHealthService(t.swagger)
+	if err != nil {
+		return fmt.Errorf("[cmd.Root] reading OpenAPI spec: %w", err)
+	}
+	if isGRPC {
+		t.opts = append(t.opts, util.WithGRPCHealthCheck(grpcService))
+	}
+
+	if explain {
+		explanations, err := s.ExplainLifecycle()
+		if err != nil {
+			return fmt.Errorf("[cmd.Root] explaining README commands: %w", err)
+		}
+		return lifecycle.WriteExplanations(os.Stdout, explanations)
+	}
+
+	if dryRun {
+		util.Infof("Dry run: printing build and deploy commands without executing them\n")
+		return s.BuildDeployLifecycle.Execute(s.Dir, lifecycle.WithDryRun(true))
+	}
+
+	t.progress.SetPhase("Building and deploying")
+	util.Infof("Building and deploying sample to Cloud Run\n")
+	t.deployed = true
+	err = s.BuildDeployLifecycle.Execute(s.Dir, lifecycle.WithRetries(commandRetries+1, commandRetryDelay),
+		lifecycle.WithCommandTimeout(commandTimeout), lifecycle.WithContext(t.ctx))
+	if err != nil {
+		return deployFailure(fmt.Errorf("[cmd.Root] building and deploying sample to Cloud Run: %w", err))
+	}
+	if err := checkInterrupted(t.ctx); err != nil {
+		return err
+	}
+
+	if t.wantTraffic != nil {
+		util.Infof("Checking Cloud Run service traffic split\n")
+		if err := s.Service.AssertTraffic(s.Dir, t.wantTraffic); err != nil {
+			return deployFailure(fmt.Errorf("[cmd.Root] asserting Cloud Run service traffic split: %w", err))
+		}
+	}
+
+	t.serviceURL, err = s.Service.WaitURL(s.Dir, gcloud.DefaultURLRetryDelay, urlTimeout)
+	if err != nil {
+		return deployFailure(fmt.Errorf("[cmd.Root] getting Cloud Run service URL: %w", err))
+	}
+	if err := checkServiceURL(t.serviceURL); err != nil {
+		return deployFailure(fmt.Errorf("[cmd.Root] checking Cloud Run service URL: %w", err))
+	}
+
+	return nil
+}
+
+// validate checks the deployed Cloud Run service's startup, readiness and endpoints for expected results. It does
+// nothing if the sample wasn't deployed, such as with --dry-run.
+func (t *sampleTest) validate() error {
+	if !t.deployed {
+		return nil
+	}
+	s := t.s
+
+	var identToken string
+	if unauthenticated {
+		util.Infof("Testing Cloud Run service without authentication\n")
+	} else {
+		util.Infof("Getting identity token for gcloud auhtorized account\n")
+		var err error
+		identToken, err = gcloud.IdentityToken(s.Dir, audience)
+		if err != nil {
+			return fmt.Errorf("[cmd.Root] getting identity token for gcloud auhtorized account: %w", err)
+		}
+	}
+
+	util.Infof("Checking endpoints for expected results\n")
+	if startupProbe > 0 {
+		t.progress.SetPhase("Probing startup")
+		util.Infof("Probing Cloud Run service startup\n")
+		probe, err := util.ProbeStartup(t.serviceURL, identToken, util.DefaultStartupProbeInterval, startupProbe)
+		if err != nil {
+			return deployFailure(fmt.Errorf("[cmd.Root] probing Cloud Run service startup: %w", err))
+		}
+		util.Infof("Cloud Run service first responded successfully after %v (%d attempt(s))\n",
+			probe.TimeToFirstSuccess, len(probe.Attempts))
+	}
+
+	if readyTimeout > 0 {
+		t.progress.SetPhase("Waiting for readiness")
+		util.Infof("Waiting for Cloud Run service to be ready\n")
+		err := util.WaitReady(t.serviceURL, readyPath, identToken, util.DefaultStartupProbeInterval, readyTimeout)
+		if err != nil {
+			// the endpoints are validated anyway: their findings are more specific than a timeout
+			log.Printf("Warning: %v\n", err)
+		}
+	}
+
+	if burst > 0 {
+		t.progress.SetPhase("Sending burst")
+		util.Infof("Checking Cloud Run service handles a burst of concurrent requests\n")
+		if _, err := util.Burst(t.serviceURL, identToken, burst, burstTimeout); err != nil {
+			return validationFailure(fmt.Errorf("[cmd.Root] sending burst of concurrent requests: %w", err))
+		}
+	}
+
+	if err := checkInterrupted(t.ctx); err != nil {
+		return err
+	}
+
+	t.progress.SetPhase("Validating endpoints")
+	util.Infof("Validating Cloud Run service endpoints for expected status codes\n")
+	opts := append(t.opts, util.WithOperationHook(t.progress.RecordEndpoint), util.WithContext(t.ctx))
+	if harOutput != "" {
+		transcript := &util.Transcript{}
+		opts = append(opts, util.WithTranscript(transcript))
+		defer writeHAR(harOutput, transcript)
+	}
+
+	report, err := util.ValidateEndpoints(t.serviceURL, &t.swagger.Paths, identToken, opts...)
+	t.report = report
+	// operations that couldn't be tested don't stop the others: report them all before failing
+	var endpointErrs util.EndpointErrors
+	if err != nil && !errors.As(err, &endpointErrs) {
+		return validationFailure(fmt.Errorf("[cmd.Root] validating Cloud Run service endpoints for expected status codes: %w", err))
+	}
+
+	for tag, n := range report.TagCounts {
+		util.Infof("Tested %d operation(s) tagged %s\n", n, tag)
+	}
+	log.Printf("%d error(s), %d warning(s)\n", report.Count(util.SeverityError), report.Count(util.SeverityWarning))
+	if !report.Passed(failOnWarning) {
+		if failureLogs > 0 {
+			logServiceLogs(s, failureLogs)
+		}
+		if endpointErrs != nil {
+			return validationFailure(fmt.Errorf("[cmd.Root] validating Cloud Run service endpoints for expected status codes: %w", endpointErrs))
+		}
+		return validationFailure(fmt.Errorf("all tests did not pass"))
+	}
+	return nil
+}
+
+// cleanUp deletes the deployed sample's resources, unless --keep-resources is set, and writes the requested reports.
+// Its error only matters if the earlier phases passed: it fails if the cleanup findings make the report fail. It does
+// nothing if the sample wasn't deployed.
+func (t *sampleTest) cleanUp() error {
+	if !t.deployed {
+		return nil
+	}
+	s := t.s
+
+	if t.report == nil {
+		t.report = &util.Report{}
+	}
+
+	if keepResources {
+		util.Infof("Keeping Cloud Run service %s and its container image for debugging\n", s.Service.Name)
+	} else {
+		t.progress.SetPhase("Cleaning up")
+		cleanUp(s)
+		verifyServiceDeleted(s, t.report)
+	}
+
+	if t.tmpl != nil {
+		writeTemplateReport(t.tmpl, t.report)
+	}
+	if junitOut != "" {
+		writeJUnitReport(junitOut, s.Name, t.report)
+	}
+	if jsonOutput != "" {
+		writeJSONReport(jsonOutput, t.report)
+	}
+
+	if !t.report.Passed(failOnWarning) {
+		return validationFailure(fmt.Errorf("all tests did not pass"))
+	}
+	return nil
+}
+
+// perSampleFlags are the flags naming a resource or file that would be shared, and clobbered, by every sample tested
+// with --recursive.
+var perSampleFlags = []string{"service-name", "image-url", "json-output", "junit-out", "har-output", "record", "replay",
+	"failure-dir"}
+
+// checkRecursiveFlags returns an error if any of the perSampleFlags is set along with --recursive.
+func checkRecursiveFlags(cmd *cobra.Command) error {
+	for _, name := range perSampleFlags {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--%s can't be used with --recursive: it would be shared by every sample", name)
+		}
+	}
+
+	return nil
+}
+
+// testSamples tests every sample found under root, up to sampleConcurrency at once, and logs a summary of the samples
+// that passed and failed. It returns an error if any sample failed. If state is non-nil, samples recorded as passed in
+// it are skipped and the outcome of the others is recorded in it.
+func testSamples(ctx context.Context, cmd *cobra.Command, root string, state *sample.RunState, progress *tui.State) error {
+	if err := checkRecursiveFlags(cmd); err != nil {
+		return fmt.Errorf("[cmd.Root] %w", err)
+	}
+
+	var parseOpts []lifecycle.ParseOption
+	if codeTag != "" {
+		parseOpts = append(parseOpts, lifecycle.WithCodeTag(codeTag))
+	}
+	if readme != "" {
+		parseOpts = append(parseOpts, lifecycle.WithREADME(readme))
+	}
+	dirs, err := lifecycle.Discover(root, parseOpts...)
+	if err != nil {
+		return fmt.Errorf("[cmd.Root] discovering samples: %w", err)
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("[cmd.Root] no samples found under %s", root)
+	}
+	util.Infof("Found %d sample(s) under %s\n", len(dirs), root)
+
+	jobs := make([]sample.Job, len(dirs))
+	for i, dir := range dirs {
+		t := &sampleTest{ctx: ctx, cmd: cmd, sampleDir: dir, target: deployTarget{region: region}, progress: progress}
+		jobs[i] = t.job(state)
+	}
+
+	var errs []error
+	if state != nil {
+		errs = state.RunJobs(jobs, sampleConcurrency)
+	} else {
+		errs = sample.RunJobs(jobs, sampleConcurrency)
+	}
+
+	// the run exits with the code of the most severe class of failure among the samples
+	var failed, code int
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			if c := ExitCode(err); c > code {
+				code = c
+			}
+			log.Printf("FAIL %s: %v\n", dirs[i], err)
+			continue
+		}
+		log.Printf("PASS %s\n", dirs[i])
+	}
+	log.Printf("%d of %d sample(s) passed\n", len(dirs)-failed, len(dirs))
+
+	if failed > 0 {
+		return &exitError{code: code, err: fmt.Errorf("[cmd.Root] %d of %d sample(s) failed", failed, len(dirs))}
+	}
+	return nil
+}
+
+// replayServiceURL is the service URL endpoints are validated against when replaying recorded responses. It doesn't
+// resolve, so that nothing reaches the network.
+const replayServiceURL = "http://replay.invalid"
+
+// replayEndpoints validates the endpoints of the sample in the provided directory against the responses recorded in
+// the --replay directory, without building, deploying or cleaning up anything.
+func replayEndpoints(sampleDir string) error {
+	opts, err := validateOptions(sampleDir)
+	if err != nil {
+		return fmt.Errorf("[cmd.Root] configuring endpoint validation: %w", err)
+	}
+	opts = append(opts, util.WithReplay(replay))
+
+	var tmpl *template.Template
+	if reportTemplate != "" {
+		tmpl, err = loadReportTemplate(reportTemplate)
+		if err != nil {
+			return fmt.Errorf("[cmd.Root] loading --report-template: %w", err)
+		}
+	}
+
+	util.Infof("Loading test endpoints\n")
+	swagger, err := util.LoadTestEndpoints(sampleDir, openAPISpec)
+	if err != nil {
+		return fmt.Errorf("[cmd.Root] loading test endpoints: %w", err)
+	}
+
+	util.Infof("Replaying endpoint responses recorded in %s\n", replay)
+	report, err := util.ValidateEndpoints(replayServiceURL, &swagger.Paths, "", opts...)
+	var endpointErrs util.EndpointErrors
+	if err != nil && !errors.As(err, &endpointErrs) {
+		return validationFailure(fmt.Errorf("[cmd.Root] validating replayed endpoints for expected status codes: %w", err))
+	}
+
+	if jsonOutput != "" {
+		writeJSONReport(jsonOutput, report)
+	}
+	if junitOut != "" {
+		writeJUnitReport(junitOut, filepath.Base(sampleDir), report)
+	}
+	if tmpl != nil {
+		writeTemplateReport(tmpl, report)
+	}
+
+	log.Printf("%d error(s), %d warning(s)\n", report.Count(util.SeverityError), report.Count(util.SeverityWarning))
+	if !report.Passed(failOnWarning) {
+		if endpointErrs != nil {
+			return validationFailure(fmt.Errorf("[cmd.Root] validating replayed endpoints for expected status codes: %w", endpointErrs))
+		}
+		return validationFailure(fmt.Errorf("all tests did not pass"))
+	}
+	return nil
+}
+
+// checkServiceURL returns an error unless the provided Cloud Run service URL is an absolute http(s) URL. The URL is
+// empty when the deployed revision doesn't serve any traffic, and endpoint URLs built from it would have no host.
+func checkServiceURL(serviceURL string) error {
+	if serviceURL == "" {
+		return fmt.Errorf("service has no URL: the deployed revision may not be serving traffic")
+	}
+
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return fmt.Errorf("url.Parse: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("service URL %q isn't an absolute http(s) URL", serviceURL)
+	}
+
+	return nil
+}
+
+// sampleDirFromArg resolves the sample directory argument into an absolute directory path. A directory is used
+// directly, while a file, such as the sample's README, resolves to the directory containing it.
+func sampleDirFromArg(arg string) (string, error) {
+	fi, err := os.Stat(arg)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("sample directory or file %s does not exist", arg)
+	}
+	if err != nil {
+		return "", fmt.Errorf("os.Stat: %w", err)
+	}
+
+	dir := arg
+	if !fi.IsDir() {
+		dir = filepath.Dir(arg)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs: %w", err)
+	}
+
+	return abs, nil
+}
+
+// cleanUp removes the sample's IAM policy bindings, container image and Cloud Run service. Every removal is attempted
+// even if an earlier one fails; failures are logged.
+func cleanUp(s *sample.Sample) {
+	ctx, cancel := newCleanupContext(cleanupTimeout)
+	defer cancel()
+
+	if err := s.RemoveIAMBindings(ctx); err != nil {
+		log.Printf("Cleaning up: %v\n", err)
+	}
+	if err := s.DeleteCloudContainerImage(ctx); err != nil {
+		log.Printf("Cleaning up: %v\n", err)
+	}
+	if err := s.Service.Delete(ctx, s.Dir); err != nil {
+		log.Printf("Cleaning up: %v\n", err)
+	}
+}
+
+// newCleanupContext returns a fresh context bounding cleanup to the provided timeout, or unbounded if it's zero. It's
+// deliberately not derived from the run's context, so that resources are still deleted after the run times out or is
+// cancelled.
+func newCleanupContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// logServiceLogs logs the last limit log entries of the sample's Cloud Run service, to help diagnose failed tests.
+// Failures are logged, since the logs are only a debugging aid.
+func logServiceLogs(s *sample.Sample, limit int) {
+	log.Printf("Reading the last %d log entries of Cloud Run service %s\n", limit, s.Service.Name)
+	lines, err := s.Service.RecentLogs(s.Dir, limit)
+	if err != nil {
+		log.Printf("Reading Cloud Run service logs: %v\n", err)
+		return
+	}
+
+	for _, l := range lines {
+		log.Printf("Service log: %s\n", l)
+	}
+}
+
+// verifyServiceDeleted confirms that the sample's Cloud Run service no longer exists after cleanup and records a
+// warning-level finding in the provided Report if it lingers or its deletion couldn't be verified.
+func verifyServiceDeleted(s *sample.Sample, report *util.Report) {
+	util.Infof("Verifying Cloud Run service was deleted\n")
+	err := s.Service.VerifyDeleted(s.Dir)
+	switch {
+	case err == nil:
+		util.Infof("Cloud Run service %s no longer exists\n", s.Service.Name)
+	case errors.Is(err, gcloud.ErrServiceExists):
+		report.AddWarning(s.Service.Name, "cleanup", "Cloud Run service still exists after cleanup and may keep incurring charges; delete it with `gcloud run services delete %s`", s.Service.Name)
+	default:
+		report.AddWarning(s.Service.Name, "cleanup", "could not verify Cloud Run service was deleted: %v", err)
+	}
+}
+
+// validateOptions builds the util.ValidateOptions for endpoint validation of the sample in sampleDir from the command
+// line flags and the sample's skip file.
+func validateOptions(sampleDir string) ([]util.ValidateOption, error) {
+	var opts []util.ValidateOption
+
+	fv, err := util.ParseFailureVerbosity(failureOutput)
+	if err != nil {
+		return nil, fmt.Errorf("--failure-output: %w", err)
+	}
+	opts = append(opts, util.WithFailureVerbosity(fv, failureBodyLimit), util.WithTimeout(httpTimeout),
+		util.WithConcurrency(endpointConcurrency))
+
+	if failureDir != "" {
+		opts = append(opts, util.WithFailureDir(failureDir))
+	}
+
+	if scanLeaks || len(leakPatterns) > 0 {
+		patterns := util.DefaultLeakPatterns
+		if len(leakPatterns) > 0 {
+			patterns = nil
+			for _, p := range leakPatterns {
+				re, err := regexp.Compile(p)
+				if err != nil {
+					return nil, fmt.Errorf("regexp.Compile: --leak-pattern %s: %w", p, err)
+				}
+				patterns = append(patterns, re)
+			}
+		}
+
+		opts = append(opts, util.WithLeakPatterns(patterns))
+	}
+
+	if endpointRetries > 0 {
+		opts = append(opts, util.WithRetries(endpointRetries+1, endpointRetryDelay), util.WithMaxRetryAfter(maxRetryAfter))
+	}
+
+	if checkPathCase {
+		opts = append(opts, util.WithCheckPathCase(true))
+	}
+
+	if checkAllow {
+		opts = append(opts, util.WithCheckAllow(true))
+	}
+
+	if generateBodies {
+		opts = append(opts, util.WithGenerateBodies(true))
+	}
+
+	if checkIdempotency {
+		opts = append(opts, util.WithCheckIdempotency(true))
+	}
+
+	if fuzzBodies > 0 {
+		opts = append(opts, util.WithFuzz(fuzzBodies, seed))
+	}
+
+	if record != "" {
+		opts = append(opts, util.WithRecord(record))
+	}
+
+	if skipContentTypeCheck {
+		opts = append(opts, util.WithCheckContentType(false))
+	}
+
+	if noFollowRedirects {
+		opts = append(opts, util.WithFollowRedirects(false))
+	}
+
+	if problemDetails || problemDetailsSchema != "" {
+		var schema *openapi3.Schema
+		if problemDetailsSchema != "" {
+			schema, err = util.LoadSchema(problemDetailsSchema)
+			if err != nil {
+				return nil, fmt.Errorf("util.LoadSchema: --problem-details-schema: %w", err)
+			}
+		}
+
+		opts = append(opts, util.WithProblemDetails(true, schema))
+	}
+
+	if onlyTag != "" {
+		opts = append(opts, util.WithOnlyTag(onlyTag))
+	}
+
+	if len(methods) > 0 {
+		m, err := util.ParseMethods(methods)
+		if err != nil {
+			return nil, fmt.Errorf("util.ParseMethods: --method: %w", err)
+		}
+
+		opts = append(opts, util.WithMethods(m...))
+	}
+
+	if len(excludeMethods) > 0 {
+		m, err := util.ParseMethods(excludeMethods)
+		if err != nil {
+			return nil, fmt.Errorf("util.ParseMethods: --exclude-method: %w", err)
+		}
+
+		opts = append(opts, util.WithExcludeMethods(m...))
+	}
+
+	rules, err := util.LoadSkipFile(sampleDir)
+	if err != nil {
+		return nil, fmt.Errorf("util.LoadSkipFile: %w", err)
+	}
+	for _, sk := range skip {
+		r, err := util.ParseSkipRule(sk)
+		if err != nil {
+			return nil, fmt.Errorf("util.ParseSkipRule: --skip: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) > 0 {
+		opts = append(opts, util.WithSkipRules(rules...))
+	}
+
+	if allowEmptySpec {
+		opts = append(opts, util.WithAllowEmptyPaths(true))
+	}
+
+	return opts, nil
+}
+
+// writeHAR writes the provided util.Transcript to the provided file as an HTTP Archive. Failures are logged, since
+// the archive is only a debugging aid.
+func writeHAR(filename string, t *util.Transcript) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Printf("Writing HTTP Archive: os.Create: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	if err := util.WriteHAR(f, t); err != nil {
+		log.Printf("Writing HTTP Archive: util.WriteHAR: %v\n", err)
+		return
+	}
+
+	util.Infof("Wrote HTTP Archive of %d request(s) to %s\n", len(t.Exchanges), filename)
+}
+
+// writeJSONReport writes the provided util.Report to the provided file as JSON, or to standard output if the file is
+// -. Failures are logged, since the report's outcome is already reflected in the exit status.
+func writeJSONReport(filename string, report *util.Report) {
+	if report == nil {
+		report = &util.Report{}
+	}
+
+	if filename == "-" {
+		if err := report.WriteJSON(os.Stdout, failOnWarning); err != nil {
+			log.Printf("Writing JSON results: util.Report.WriteJSON: %v\n", err)
+		}
+		return
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Printf("Writing JSON results: os.Create: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	if err := report.WriteJSON(f, failOnWarning); err != nil {
+		log.Printf("Writing JSON results: util.Report.WriteJSON: %v\n", err)
+		return
+	}
+
+	util.Infof("Wrote JSON results of %d test request(s) to %s\n", len(report.Results), filename)
+}
+
+// writeJUnitReport writes the provided util.Report to the provided file as a JUnit XML report whose test suite is named
+// after the sample. Failures are logged, since the report's outcome is already reflected in the exit status.
+func writeJUnitReport(filename, name string, report *util.Report) {
+	if report == nil {
+		report = &util.Report{}
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Printf("Writing JUnit report: os.Create: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	if err := report.WriteJUnit(f, name, failOnWarning); err != nil {
+		log.Printf("Writing JUnit report: util.Report.WriteJUnit: %v\n", err)
+		return
+	}
+
+	util.Infof("Wrote JUnit report of %d test request(s) to %s\n", len(report.Results), filename)
+}
+
+// loadReportTemplate reads and parses the report template in the provided file.
+func loadReportTemplate(filename string) (*template.Template, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile: %w", err)
+	}
+
+	tmpl, err := util.ParseReportTemplate(filepath.Base(filename), string(b))
+	if err != nil {
+		return nil, fmt.Errorf("util.ParseReportTemplate: %s: %w", filename, err)
+	}
+
+	return tmpl, nil
+}
+
+// writeTemplateReport renders the provided util.Report through the provided template to standard output. Failures
+// are logged, since the report's outcome is already reflected in the exit status.
+func writeTemplateReport(tmpl *template.Template, report *util.Report) {
+	if report == nil {
+		report = &util.Report{}
+	}
+
+	if err := report.WriteTemplate(os.Stdout, tmpl, failOnWarning); err != nil {
+		log.Printf("Rendering report template: util.Report.WriteTemplate: %v\n", err)
+	}
+}
+
+// Execute executes the root command. The code the tool should exit with for the returned error is given by ExitCode.
 func Execute() error {
 	return rootCmd.Execute()
 }
 
 // init initializes the tool.
 func init() {
-	// Initialization goes here
+	rootCmd.Flags().Int64Var(&seed, "seed", 0,
+		"seed for the random suffixes of generated resource names, making them reproducible across runs")
+	rootCmd.Flags().StringVar(&serviceName, "service-name", "",
+		"deploy to a Cloud Run service with this name instead of a generated one")
+	rootCmd.Flags().IntVar(&serviceNameMaxLen, "service-name-max-len", gcloud.DefaultServiceNameMaxLen,
+		"maximum length of the generated Cloud Run service name, at most 63")
+	rootCmd.Flags().StringVar(&imageURL, "image-url", "",
+		"container image URL to build, deploy and clean up instead of one derived from the gcloud default project")
+	rootCmd.Flags().StringVar(&codeTag, "code-tag", "",
+		"parse build and deploy commands from README code blocks annotated with this tag instead of {sst-run-unix}")
+	rootCmd.Flags().StringVar(&project, "project", "",
+		"Google Cloud project to deploy to, replacing the README's project ID placeholders, instead of the gcloud default project")
+	rootCmd.Flags().StringVar(&readme, "readme", "",
+		"parse build and deploy commands from this markdown file, relative to the sample's directory, e.g. RUNNING.md, instead of README.md")
+	rootCmd.Flags().StringVar(&region, "region", "",
+		"deploy to this region, replacing the README's --region flag values and region environment variables")
+	rootCmd.Flags().StringSliceVar(&regions, "regions", nil,
+		"deploy and test the sample in each of these comma-separated regions in turn, like --region, and summarize the results")
+	rootCmd.Flags().DurationVar(&cleanupTimeout, "cleanup-timeout", 10*time.Minute,
+		"time cleaning up the deployed resources may take, independently of the rest of the run; 0 disables the timeout")
+	rootCmd.Flags().BoolVar(&keepResources, "keep-resources", false,
+		"don't delete the deployed Cloud Run service, its container image or IAM policy bindings, for post-mortem debugging")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"print the resolved build and deploy commands without executing them")
+	rootCmd.Flags().BoolVar(&explain, "explain", false,
+		"print each parsed README command with the transformations applied to it, then exit without executing anything")
+	rootCmd.Flags().StringVar(&assertTraffic, "assert-traffic", "",
+		"after deploying, check the service's traffic split matches KEY=PERCENT,... where each KEY is a revision name, tag or LATEST")
+	rootCmd.Flags().BoolVar(&unauthenticated, "unauthenticated", false,
+		"make test requests without an identity token, for services deployed with --allow-unauthenticated")
+	rootCmd.Flags().StringVar(&audience, "audience", "",
+		"mint the identity token authenticating test requests for this audience, e.g. for IAP-fronted services")
+	rootCmd.Flags().DurationVar(&startupProbe, "startup-probe", 0,
+		"after deploying, probe the service's root endpoint until it first succeeds, failing if it doesn't within this deadline")
+	rootCmd.Flags().StringVar(&readyPath, "ready-path", "/",
+		"after deploying, poll this path until it gets a response that isn't a 5xx before validating endpoints")
+	rootCmd.Flags().DurationVar(&urlTimeout, "url-timeout", time.Minute,
+		"time to keep retrying, with exponential backoff, to get the deployed service's URL while it's empty or can't be retrieved; 0 disables retries")
+	rootCmd.Flags().DurationVar(&readyTimeout, "ready-timeout", 2*time.Minute,
+		"time to wait for --ready-path before validating endpoints anyway; 0 disables the wait")
+	rootCmd.Flags().IntVar(&burst, "burst", 0,
+		"after deploying, send this many concurrent requests to the service's root endpoint and fail unless all succeed")
+	rootCmd.Flags().DurationVar(&burstTimeout, "burst-timeout", 30*time.Second,
+		"time every request of the --burst must succeed within")
+	rootCmd.Flags().StringVar(&resume, "resume", "",
+		"record each sample's outcome in this run-state file and skip samples it records as passed")
+	rootCmd.Flags().IntVar(&commandRetries, "command-retries", 0,
+		"number of times to retry a failed build or deploy command")
+	rootCmd.Flags().DurationVar(&commandRetryDelay, "command-retry-delay", 10*time.Second,
+		"base delay of the exponential backoff between build and deploy command retries")
+	rootCmd.Flags().DurationVar(&commandTimeout, "command-timeout", lifecycle.DefaultCommandTimeout,
+		"time each build and deploy command may run for before it's killed; 0 disables the timeout")
+	rootCmd.Flags().BoolVar(&failOnWarning, "fail-on-warning", false,
+		"treat warning-level findings as failures for the run's exit status")
+	rootCmd.Flags().BoolVar(&scanLeaks, "scan-leaks", false,
+		"fail endpoints whose response bodies match the default leak patterns (stack traces, private keys, etc.)")
+	rootCmd.Flags().StringArrayVar(&leakPatterns, "leak-pattern", nil,
+		"fail endpoints whose response bodies match this regular expression, replacing the default leak patterns (repeatable)")
+	rootCmd.Flags().DurationVar(&httpTimeout, "http-timeout", 10*time.Second,
+		"timeout of each test request made to the Cloud Run service; raise it for slow-starting containers")
+	rootCmd.Flags().IntVar(&endpointConcurrency, "endpoint-concurrency", 4,
+		"number of paths validated concurrently")
+	rootCmd.Flags().IntVar(&endpointRetries, "endpoint-retries", 0,
+		"number of times to retry test requests that fail with a transport error or an unexpected 429 or 5xx status code")
+	rootCmd.Flags().DurationVar(&endpointRetryDelay, "endpoint-retry-delay", time.Second,
+		"base delay of the exponential backoff between test request retries")
+	rootCmd.Flags().DurationVar(&maxRetryAfter, "max-retry-after", 30*time.Second,
+		"maximum time a 429 response's Retry-After header can make a retry wait")
+	rootCmd.Flags().StringVar(&failureOutput, "failure-output", "truncated",
+		"how much of a failed test request's response body to dump: summary, truncated, or full")
+	rootCmd.Flags().IntVar(&failureBodyLimit, "failure-body-limit", 1024,
+		"number of response body bytes to dump for failed test requests with --failure-output=truncated")
+	rootCmd.Flags().StringVar(&failureDir, "failure-dir", "",
+		"write each failed test request and its response, with headers and bodies, to a file per endpoint in this directory")
+	rootCmd.Flags().BoolVar(&checkPathCase, "check-path-case", false,
+		"when a test request returns a 404, retry it with the path lowercased and report which form worked")
+	rootCmd.Flags().BoolVar(&checkAllow, "check-allow", false,
+		"send OPTIONS to each path and check its Allow header lists exactly the methods the OpenAPI spec defines")
+	rootCmd.Flags().BoolVar(&generateBodies, "generate-bodies", false,
+		"generate a minimal JSON request body from the request body schema when no example is declared")
+	rootCmd.Flags().BoolVar(&checkIdempotency, "check-idempotency", false,
+		"send PUT and DELETE requests twice and check the second response also has an expected status code")
+	rootCmd.Flags().IntVar(&fuzzBodies, "fuzz", 0,
+		"send this many random request bodies valid against the request body schema to each operation and fail on 5xx responses")
+	rootCmd.Flags().IntVar(&failureLogs, "failure-logs", 50,
+		"number of recent Cloud Run service log entries to print when tests fail; 0 disables it")
+	rootCmd.Flags().StringVar(&record, "record", "",
+		"record every test request and its response to this directory, for replaying them with --replay")
+	rootCmd.Flags().StringVar(&replay, "replay", "",
+		"validate endpoints against the responses recorded in this directory with --record, without deploying anything")
+	rootCmd.Flags().StringVar(&harOutput, "har-output", "",
+		"write every test request and response to this file as an HTTP Archive (HAR 1.2)")
+	rootCmd.Flags().StringVar(&jsonOutput, "json-output", "",
+		"write the per-endpoint, per-method test results and findings to this file as JSON, or to standard output if -")
+	rootCmd.Flags().StringVar(&junitOut, "junit-out", "",
+		"write a JUnit XML report with a test case per endpoint and method to this file")
+	rootCmd.Flags().StringVar(&reportTemplate, "report-template", "",
+		"render the structured results through this Go text/template file to standard output")
+	rootCmd.Flags().StringVar(&openAPISpec, "openapi-spec", "",
+		"local path or http(s) URL of the OpenAPI spec declaring the endpoints to test, instead of the sample's own")
+	rootCmd.Flags().BoolVar(&skipContentTypeCheck, "skip-content-type-check", false,
+		"don't check response content types against the ones the OpenAPI spec declares")
+	rootCmd.Flags().BoolVar(&noFollowRedirects, "no-follow-redirects", false,
+		"don't follow redirects: check their status code and Location header against the OpenAPI spec instead")
+	rootCmd.Flags().BoolVar(&problemDetails, "problem-details", false,
+		"check that expected error responses are application/problem+json bodies with type, title and status")
+	rootCmd.Flags().StringVar(&problemDetailsSchema, "problem-details-schema", "",
+		"check expected error response bodies against the schema in this YAML or JSON file; implies --problem-details")
+	rootCmd.Flags().BoolVar(&allowEmptySpec, "allow-empty-spec", false,
+		"pass trivially instead of failing when the OpenAPI spec defines no paths")
+	rootCmd.Flags().StringVar(&onlyTag, "only-tag", "",
+		"only validate operations carrying this OpenAPI tag")
+	rootCmd.Flags().StringArrayVar(&methods, "method", nil,
+		"only validate operations of this HTTP method, e.g. GET; can be repeated")
+	rootCmd.Flags().StringArrayVar(&excludeMethods, "exclude-method", nil,
+		"skip operations of this HTTP method, e.g. TRACE, even if the OpenAPI spec defines them; can be repeated")
+	rootCmd.Flags().StringArrayVar(&skip, "skip", nil,
+		"skip the operations of this OpenAPI path, optionally preceded by an HTTP method, e.g. \"DELETE /items/{id}\"; can be repeated")
+	rootCmd.Flags().BoolVar(&useTUI, "tui", false,
+		"render a live dashboard of the run's phase, elapsed time and endpoint results instead of the scrolling log")
+	rootCmd.Flags().StringArrayVar(&registryHosts, "registry-host", nil,
+		"also replace the README's container image URLs in the registry with this hostname; can be repeated")
+	rootCmd.Flags().StringArrayVar(&gcloudFlags, "gcloud-flag", nil,
+		"append this flag, e.g. --impersonate-service-account=SA, to every gcloud command of the README or sst.yaml file; can be repeated")
+	rootCmd.Flags().BoolVar(&recursive, "recursive", false,
+		"test every sample found under the directory passed as argument, i.e. every directory with an sst.yaml file or an annotated README")
+	rootCmd.Flags().IntVar(&sampleConcurrency, "sample-concurrency", 1,
+		"maximum number of sample phases (deploy, validate or cleanup) run at once with --recursive")
+	rootCmd.Flags().BoolVar(&quiet, "quiet", false,
+		"only log failures and the final result")
+	rootCmd.Flags().BoolVar(&verbose, "verbose", false,
+		"also log the body of every test request and its response")
+	rootCmd.Flags().StringVar(&gcloudPath, "gcloud-path", util.GcloudPath,
+		"gcloud executable to run, as a name looked up in the PATH or a path, e.g. gcloud.cmd or /opt/google-cloud-sdk/bin/gcloud")
 }
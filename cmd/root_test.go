@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/sample"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type sampleDirFromArgTest struct {
+	arg string // sample directory argument, relative to a temporary directory
+	dir string // expected sample directory, relative to the temporary directory
+	err bool   // whether an error is expected
+}
+
+var sampleDirFromArgTests = []sampleDirFromArgTest{
+	// directory argument
+	{
+		arg: "sample",
+		dir: "sample",
+	},
+
+	// file argument
+	{
+		arg: "sample/README.md",
+		dir: "sample",
+	},
+
+	// missing path
+	{
+		arg: "missing",
+		err: true,
+	},
+}
+
+func TestSampleDirFromArg(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "sst")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := os.Mkdir(filepath.Join(tmp, "sample"), 0755); err != nil {
+		t.Fatalf("os.Mkdir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "sample", "README.md"), nil, 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	for i, tc := range sampleDirFromArgTests {
+		dir, err := sampleDirFromArg(filepath.Join(tmp, tc.arg))
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if tc.err {
+			continue
+		}
+
+		if want := filepath.Join(tmp, tc.dir); dir != want {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, want, dir)
+		}
+	}
+}
+
+func TestCleanupContextOutlivesRunContext(t *testing.T) {
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	cancelRun()
+	if runCtx.Err() == nil {
+		t.Fatalf("run context not cancelled")
+	}
+
+	ctx, cancel := newCleanupContext(time.Minute)
+	defer cancel()
+
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("cleanup context not live after run context was cancelled: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("cleanup context deadline mismatch\nwant: within %v\ngot: %v, %t", time.Minute, deadline, ok)
+	}
+
+	// a cleanup command still runs to completion
+	if _, err := util.ExecCommandContext(ctx, exec.Command("true"), os.TempDir()); err != nil {
+		t.Errorf("util.ExecCommandContext: %v", err)
+	}
+}
+
+func TestCleanupContextWithoutTimeout(t *testing.T) {
+	ctx, cancel := newCleanupContext(0)
+	defer cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("cleanup context has a deadline despite a zero timeout")
+	}
+}
+
+type checkRecursiveFlagsTest struct {
+	args []string // flags passed on the command line
+	err  bool     // whether an error is expected
+}
+
+var checkRecursiveFlagsTests = []checkRecursiveFlagsTest{
+	// no flags
+	{
+		args: nil,
+	},
+	// flags that can be shared by every sample
+	{
+		args: []string{"--fail-on-warning", "--region=europe-west1"},
+	},
+	// per-sample flags
+	{
+		args: []string{"--json-output=results.json"},
+		err:  true,
+	},
+	{
+		args: []string{"--service-name", "my-service"},
+		err:  true,
+	},
+}
+
+func TestCheckRecursiveFlags(t *testing.T) {
+	for i, tc := range checkRecursiveFlagsTests {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("fail-on-warning", false, "")
+		cmd.Flags().String("region", "", "")
+		for _, name := range perSampleFlags {
+			cmd.Flags().String(name, "", "")
+		}
+		if err := cmd.Flags().Parse(tc.args); err != nil {
+			t.Fatalf("#%d: cmd.Flags().Parse: %v", i, err)
+		}
+
+		err := checkRecursiveFlags(cmd)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+		}
+	}
+}
+
+func TestSampleTestPhases(t *testing.T) {
+	st := &sampleTest{}
+	phases := st.phases()
+
+	var names []string
+	for _, p := range phases {
+		names = append(names, p.Name)
+	}
+	if want := []string{"deploy", "validate", "cleanup"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("phases mismatch\nwant: %v\ngot: %v", want, names)
+	}
+
+	// cleanup must run even once deploy or validate failed
+	if !phases[2].Always {
+		t.Errorf("cleanup phase doesn't always run")
+	}
+
+	// nothing was deployed, so there's nothing to validate or clean up
+	for _, p := range phases[1:] {
+		if err := p.Run(); err != nil {
+			t.Errorf("%s phase of an undeployed sample: %v", p.Name, err)
+		}
+	}
+}
+
+func TestSampleTestJobSkipsRecordingDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmd")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	state, err := sample.LoadRunState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatalf("sample.LoadRunState: %v", err)
+	}
+
+	// a --dry-run or --explain deploy phase returns before deploying, and the later phases then do nothing
+	st := &sampleTest{sampleDir: "dry-run"}
+	job := st.job(state)
+	job.Phases = job.Phases[1:]
+
+	if errs := state.RunJobs([]sample.Job{job}, 1); errs[0] != nil {
+		t.Fatalf("sample.RunState.RunJobs: %v", errs[0])
+	}
+	if state.Passed(st.sampleDir) {
+		t.Errorf("dry-run sample recorded as passed")
+	}
+}
+
+type recordStateTest struct {
+	deployed bool   // whether the sample was deployed
+	err      error  // error the sample test failed with
+	want     string // expected outcome recorded for the sample, if any
+}
+
+var recordStateTests = []recordStateTest{
+	// deployed sample that passed
+	{
+		deployed: true,
+		want:     "passed",
+	},
+
+	// deployed sample that failed
+	{
+		deployed: true,
+		err:      errors.New("validation failed"),
+		want:     "failed",
+	},
+
+	// sample only explained or dry-run
+	{},
+
+	// sample that failed before deploying
+	{
+		err: errors.New("parsing README failed"),
+	},
+}
+
+func TestSampleTestRecordState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmd")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, tc := range recordStateTests {
+		// a single sample records its outcome directly, while --recursive records it from its sample.Job
+		paths := map[string]func(st *sampleTest, state *sample.RunState){
+			"single": func(st *sampleTest, state *sample.RunState) {
+				st.recordState(state, tc.err)
+			},
+			"recursive": func(st *sampleTest, state *sample.RunState) {
+				job := st.job(state)
+				job.Phases = []sample.Phase{{Name: "deploy", Run: func() error { return tc.err }}}
+				state.RunJobs([]sample.Job{job}, 1)
+			},
+		}
+
+		for name, record := range paths {
+			state, err := sample.LoadRunState(filepath.Join(dir, fmt.Sprintf("%d-%s.json", i, name)))
+			if err != nil {
+				t.Fatalf("sample.LoadRunState: %v", err)
+			}
+
+			st := &sampleTest{sampleDir: "sample", deployed: tc.deployed}
+			record(st, state)
+			if got := state.Samples[st.sampleDir]; got != tc.want {
+				t.Errorf("#%d %s: recorded outcome mismatch\nwant: %q\ngot: %q", i, name, tc.want, got)
+			}
+		}
+	}
+}
+
+type checkServiceURLTest struct {
+	url string // service URL returned by gcloud
+	err bool   // whether an error is expected
+}
+
+var checkServiceURLTests = []checkServiceURLTest{
+	// Cloud Run service URL
+	{
+		url: "https://hello-abc123-uc.a.run.app",
+	},
+	// plain http
+	{
+		url: "http://localhost:8080",
+	},
+	// revision without traffic
+	{
+		url: "",
+		err: true,
+	},
+	// relative URL
+	{
+		url: "/foo",
+		err: true,
+	},
+	// missing scheme
+	{
+		url: "hello-abc123-uc.a.run.app",
+		err: true,
+	},
+	// unsupported scheme
+	{
+		url: "ftp://hello-abc123-uc.a.run.app",
+		err: true,
+	},
+}
+
+func TestCheckServiceURL(t *testing.T) {
+	for i, tc := range checkServiceURLTests {
+		err := checkServiceURL(tc.url)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptSignals are the signals that interrupt a run: the in-flight work is cancelled, then the Cloud Run service
+// and container image are still cleaned up before the tool exits.
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// withInterrupt returns a copy of parent that's cancelled when the process receives one of interruptSignals, and a
+// function that stops relaying the signals and cancels it. Once the first signal is received, the signals regain their
+// default behavior, so that a second one kills the tool without waiting for cleanup.
+func withInterrupt(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, interruptSignals...)
+	go func() {
+		select {
+		case sig := <-c:
+			signal.Stop(c)
+			log.Printf("Received %v: cancelling the run and cleaning up, send it again to exit immediately\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(c)
+		cancel()
+	}
+}
+
+// checkInterrupted returns an error if the run was interrupted, so that no further phase of it is started.
+func checkInterrupted(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("[cmd.Root] interrupted: %w", err)
+	}
+
+	return nil
+}
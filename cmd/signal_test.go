@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithInterrupt(t *testing.T) {
+	ctx, stop := withInterrupt(context.Background())
+	defer stop()
+
+	if err := checkInterrupted(ctx); err != nil {
+		t.Fatalf("checkInterrupted before the signal: %v", err)
+	}
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("os.FindProcess: %v", err)
+	}
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("os.Process.Signal: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("context not cancelled after SIGTERM")
+	}
+
+	if err := checkInterrupted(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", context.Canceled, err)
+	}
+}
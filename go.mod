@@ -4,6 +4,7 @@ go 1.14
 
 require (
 	github.com/getkin/kin-openapi v0.18.0
+	github.com/ghodss/yaml v1.0.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.1
 )
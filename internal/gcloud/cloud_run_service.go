@@ -15,18 +15,58 @@
 package gcloud
 
 import (
-	"crypto/rand"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"io"
 	"os/exec"
+	"regexp"
 	"strings"
-	"unicode"
+	"time"
 )
 
 const (
-	maxCloudRunServiceNameLen        = 53
+	// maxCloudRunServiceNameLen is the maximum length of a Cloud Run service name allowed by Cloud Run.
+	maxCloudRunServiceNameLen = 63
+
+	// DefaultServiceNameMaxLen is the default maximum length of generated Cloud Run service names. It's shorter than
+	// Cloud Run's limit to leave room for the revision suffix Cloud Run appends to the service name.
+	DefaultServiceNameMaxLen = 53
+
 	cloudRunServiceNameRandSuffixLen = 10
+
+	// DefaultURLRetryDelay is the default delay before the first retry of CloudRunService.WaitURL, which doubles after
+	// each attempt.
+	DefaultURLRetryDelay = time.Second
+)
+
+// ErrServiceNotFound is returned when a Cloud Run service doesn't exist.
+var ErrServiceNotFound = errors.New("Cloud Run service not found")
+
+// ErrServiceExists is returned when a Cloud Run service still exists after it was deleted.
+var ErrServiceExists = errors.New("Cloud Run service still exists after deletion")
+
+// serviceNotFoundRegexp matches gcloud's output when describing a Cloud Run service that doesn't exist.
+var serviceNotFoundRegexp = regexp.MustCompile(`Cannot find service|could not be found|NOT_FOUND`)
+
+// execCommand executes the external gcloud commands used to inspect Cloud Run services. It's replaced in tests.
+var execCommand = util.ExecCommand
+
+// errInvalidServiceName is returned when no valid Cloud Run service name can be generated for a sample.
+var errInvalidServiceName = errors.New("cannot generate a valid Cloud Run service name")
+
+var (
+	// invalidServiceNameCharsRegexp matches runs of characters not allowed in Cloud Run service names.
+	invalidServiceNameCharsRegexp = regexp.MustCompile(`[^a-z0-9-]+`)
+
+	// repeatedHyphensRegexp matches runs of more than one hyphen.
+	repeatedHyphensRegexp = regexp.MustCompile(`--+`)
+
+	// serviceNameRegexp matches valid Cloud Run service names: lowercase letters, digits and hyphens, starting with a
+	// letter and not ending with a hyphen.
+	serviceNameRegexp = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
 )
 
 // CloudRunService represents a Cloud Run service and stores its parameters.
@@ -36,9 +76,10 @@ type CloudRunService struct {
 }
 
 // Delete calls the external gcloud SDK and deletes the Cloud Run Service associated with the current cloudRunService.
-func (s CloudRunService) Delete(sampleDir string) error {
+// The deletion is killed if the provided context is done first.
+func (s CloudRunService) Delete(ctx context.Context, sampleDir string) error {
 	a := append(util.GcloudCommonFlags, "run", "services", "delete", s.Name, "--platform=managed")
-	_, err := util.ExecCommand(exec.Command("gcloud", a...), sampleDir)
+	_, err := util.ExecCommandContext(ctx, exec.Command(util.GcloudPath, a...), sampleDir)
 
 	if err != nil {
 		return fmt.Errorf("deleting Cloud Run Service: %w", err)
@@ -47,6 +88,37 @@ func (s CloudRunService) Delete(sampleDir string) error {
 	return nil
 }
 
+// Describe calls the external gcloud SDK and describes the Cloud Run Service associated with the current
+// CloudRunService in YAML. Returns an error wrapping ErrServiceNotFound if the service doesn't exist.
+func (s CloudRunService) Describe(sampleDir string) (string, error) {
+	a := append(util.GcloudCommonFlags, "run", "--platform=managed", "services", "describe", s.Name, "--format=yaml")
+	out, err := execCommand(exec.Command(util.GcloudPath, a...), sampleDir)
+
+	if err != nil {
+		if serviceNotFoundRegexp.MatchString(err.Error()) {
+			return "", fmt.Errorf("%w: %s", ErrServiceNotFound, s.Name)
+		}
+		return "", fmt.Errorf("describing Cloud Run Service: %w", err)
+	}
+
+	return out, nil
+}
+
+// VerifyDeleted confirms that the Cloud Run Service associated with the current CloudRunService no longer exists,
+// so that nothing, such as min-instances, keeps running and incurring charges after cleanup. Returns an error wrapping
+// ErrServiceExists if the service lingers.
+func (s CloudRunService) VerifyDeleted(sampleDir string) error {
+	_, err := s.Describe(sampleDir)
+	if errors.Is(err, ErrServiceNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("verifying Cloud Run Service deletion: %w", err)
+	}
+
+	return fmt.Errorf("%w: %s", ErrServiceExists, s.Name)
+}
+
 // URL calls the external gcloud SDK and gets the root URL of the Cloud Run Service associated with the current
 // CloudRunService.
 func (s *CloudRunService) URL(sampleDir string) (string, error) {
@@ -56,7 +128,7 @@ func (s *CloudRunService) URL(sampleDir string) (string, error) {
 
 	a := append(util.GcloudCommonFlags, "run", "--platform=managed", "services", "describe", s.Name,
 		"--format=value(status.url)")
-	url, err := util.ExecCommand(exec.Command("gcloud", a...), sampleDir)
+	url, err := execCommand(exec.Command(util.GcloudPath, a...), sampleDir)
 
 	if err != nil {
 		return "", fmt.Errorf("getting Cloud Run Service URL: %w", err)
@@ -66,23 +138,107 @@ func (s *CloudRunService) URL(sampleDir string) (string, error) {
 	return url, err
 }
 
-// ServiceName generates a Cloud Run service name for the provided sample. It concatenates the sample's name with a
-// random alphanumeric string.
-func ServiceName(sampleName string) (string, error) {
+// WaitURL gets the root URL of the Cloud Run Service like URL, retrying with exponential backoff starting at
+// baseDelay while gcloud fails or returns an empty URL, as it may right after a deploy before the revision's URL is
+// populated. Once timeout has elapsed, it returns the result of the last attempt, which may be an empty URL. A timeout
+// of zero makes a single attempt.
+func (s *CloudRunService) WaitURL(sampleDir string, baseDelay, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		url, err := s.URL(sampleDir)
+		if err == nil && url != "" {
+			return url, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return url, err
+		}
+
+		delay := baseDelay * time.Duration(1<<uint(attempt-1))
+		if delay > remaining {
+			delay = remaining
+		}
+
+		if err != nil {
+			util.Infof("Getting Cloud Run service URL failed, retrying in %v: %v\n", delay, err)
+		} else {
+			util.Infof("Cloud Run service URL not populated yet, retrying in %v\n", delay)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// ServiceName generates a Cloud Run service name for the provided sample. It concatenates the sample's name,
+// sanitized by sanitizeServiceName, with a random alphanumeric string read from the provided source of randomness.
+// The generated name is at most maxLen characters long. Passing a seeded source makes the generated name
+// deterministic.
+func ServiceName(sampleName string, maxLen int, randSource io.Reader) (string, error) {
+	if maxLen > maxCloudRunServiceNameLen {
+		return "", fmt.Errorf("%w: maximum length %d exceeds Cloud Run's limit of %d", errInvalidServiceName, maxLen, maxCloudRunServiceNameLen)
+	}
+
 	randBytes := make([]byte, cloudRunServiceNameRandSuffixLen/2)
 
-	_, err := rand.Read(randBytes)
+	_, err := io.ReadFull(randSource, randBytes)
 	if err != nil {
-		return "", fmt.Errorf("crypto/rand.Read: %w", err)
+		return "", fmt.Errorf("io.ReadFull: reading random service name suffix: %w", err)
 	}
 
 	randSuffix := hex.EncodeToString(randBytes)
 
-	l := maxCloudRunServiceNameLen - len(randSuffix) - 1
-	sampleName = sampleName[len(sampleName)-l:]
-	sampleName = strings.TrimFunc(sampleName, func(r rune) bool {
-		return !unicode.IsLetter(r)
+	l := maxLen - len(randSuffix) - 1
+	if l < 1 {
+		return "", fmt.Errorf("%w: maximum length %d leaves no room for the sample name", errInvalidServiceName, maxLen)
+	}
+
+	sampleName, err = sanitizeServiceName(sampleName, l)
+	if err != nil {
+		return "", err
+	}
+
+	name := sampleName + "-" + randSuffix
+	if err := ValidateServiceName(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// ValidateServiceName returns an error wrapping errInvalidServiceName if the provided name isn't a valid Cloud Run
+// service name: at most 63 lowercase letters, digits and hyphens, starting with a letter and not ending with a hyphen.
+func ValidateServiceName(name string) error {
+	if len(name) > maxCloudRunServiceNameLen {
+		return fmt.Errorf("%w: %s is longer than %d characters", errInvalidServiceName, name, maxCloudRunServiceNameLen)
+	}
+
+	if !serviceNameRegexp.MatchString(name) {
+		return fmt.Errorf("%w: %s must consist of lowercase letters, digits and hyphens, start with a letter and not end with a hyphen", errInvalidServiceName, name)
+	}
+
+	return nil
+}
+
+// sanitizeServiceName transforms the provided sample name into a valid Cloud Run service name of at most maxLen
+// characters: it's lowercased, each run of characters other than letters, digits and hyphens is replaced with a
+// single hyphen, it's truncated to its last maxLen characters, and leading characters other than letters and trailing
+// hyphens are trimmed. Returns an error wrapping errInvalidServiceName if nothing is left.
+func sanitizeServiceName(sampleName string, maxLen int) (string, error) {
+	n := strings.ToLower(sampleName)
+	n = invalidServiceNameCharsRegexp.ReplaceAllString(n, "-")
+	n = repeatedHyphensRegexp.ReplaceAllString(n, "-")
+
+	if len(n) > maxLen {
+		n = n[len(n)-maxLen:]
+	}
+	n = strings.TrimLeftFunc(n, func(r rune) bool {
+		return r < 'a' || r > 'z'
 	})
+	n = strings.TrimRight(n, "-")
+
+	if n == "" {
+		return "", fmt.Errorf("%w: sample name %q has no letters to start it with", errInvalidServiceName, sampleName)
+	}
 
-	return sampleName + "-" + randSuffix, nil
+	return n, nil
 }
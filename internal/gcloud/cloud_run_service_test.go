@@ -0,0 +1,338 @@
+package gcloud
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleName is the sample name Cloud Run service names are generated for in these tests.
+const sampleName = "-home-user-samples-run-helloworld"
+
+func TestServiceNameDeterministicWithSeed(t *testing.T) {
+	n1, err := ServiceName(sampleName, DefaultServiceNameMaxLen, rand.New(rand.NewSource(42)))
+	if err != nil {
+		t.Fatalf("ServiceName: %v", err)
+	}
+
+	n2, err := ServiceName(sampleName, DefaultServiceNameMaxLen, rand.New(rand.NewSource(42)))
+	if err != nil {
+		t.Fatalf("ServiceName: %v", err)
+	}
+
+	if n1 != n2 {
+		t.Errorf("service names generated with the same seed differ: %s, %s", n1, n2)
+	}
+
+	n3, err := ServiceName(sampleName, DefaultServiceNameMaxLen, rand.New(rand.NewSource(43)))
+	if err != nil {
+		t.Fatalf("ServiceName: %v", err)
+	}
+
+	if n1 == n3 {
+		t.Errorf("service names generated with different seeds are identical: %s", n1)
+	}
+}
+
+type sanitizeServiceNameTest struct {
+	in     string // sample name
+	maxLen int    // maximum length of the sanitized name
+	out    string // expected sanitized name
+	err    error  // expected error
+}
+
+var sanitizeServiceNameTests = []sanitizeServiceNameTest{
+	// already valid
+	{
+		in:     "helloworld",
+		maxLen: 42,
+		out:    "helloworld",
+	},
+
+	// uppercase letters
+	{
+		in:     "Run-HelloWorld",
+		maxLen: 42,
+		out:    "run-helloworld",
+	},
+
+	// invalid characters replaced with a single hyphen
+	{
+		in:     "-home-user-my_samples-run.hello world",
+		maxLen: 42,
+		out:    "home-user-my-samples-run-hello-world",
+	},
+
+	// non-ASCII letters replaced
+	{
+		in:     "café-sample",
+		maxLen: 42,
+		out:    "caf-sample",
+	},
+
+	// leading digits trimmed
+	{
+		in:     "2020-samples",
+		maxLen: 42,
+		out:    "samples",
+	},
+
+	// truncated to the last characters, then trimmed
+	{
+		in:     "-home-user-samples-run-helloworld",
+		maxLen: 15,
+		out:    "run-helloworld",
+	},
+
+	// trailing hyphens trimmed
+	{
+		in:     "sample__",
+		maxLen: 42,
+		out:    "sample",
+	},
+
+	// no letters
+	{
+		in:     "-2020_01-",
+		maxLen: 42,
+		err:    errInvalidServiceName,
+	},
+}
+
+func TestSanitizeServiceName(t *testing.T) {
+	for i, tc := range sanitizeServiceNameTests {
+		out, err := sanitizeServiceName(tc.in, tc.maxLen)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if out != tc.out {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.out, out)
+		}
+	}
+}
+
+type serviceNameMaxLenTest struct {
+	maxLen int   // maximum length of the generated name
+	err    error // expected error
+}
+
+var serviceNameMaxLenTests = []serviceNameMaxLenTest{
+	// default maximum length
+	{
+		maxLen: DefaultServiceNameMaxLen,
+	},
+
+	// Cloud Run's limit
+	{
+		maxLen: 63,
+	},
+
+	// short maximum length
+	{
+		maxLen: 15,
+	},
+
+	// longer than Cloud Run's limit
+	{
+		maxLen: 64,
+		err:    errInvalidServiceName,
+	},
+
+	// no room for the sample name
+	{
+		maxLen: 11,
+		err:    errInvalidServiceName,
+	},
+}
+
+func TestServiceNameMaxLen(t *testing.T) {
+	long := strings.Repeat("-home-user-samples", 10)
+	for i, tc := range serviceNameMaxLenTests {
+		n, err := ServiceName(long, tc.maxLen, rand.New(rand.NewSource(42)))
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && (len(n) > tc.maxLen || !serviceNameRegexp.MatchString(n)) {
+			t.Errorf("#%d: invalid service name for maximum length %d: %s", i, tc.maxLen, n)
+		}
+	}
+}
+
+type verifyDeletedTest struct {
+	out  string // output of the mocked describe command
+	err  error  // error returned by the mocked describe command
+	want error  // expected error
+}
+
+var verifyDeletedTests = []verifyDeletedTest{
+	// service not found
+	{
+		err:  errors.New("ERROR: (gcloud.run.services.describe) Cannot find service [run-helloworld-0123456789]"),
+		want: nil,
+	},
+
+	// service still present
+	{
+		out:  "apiVersion: serving.knative.dev/v1\nkind: Service",
+		want: ErrServiceExists,
+	},
+}
+
+func TestVerifyDeleted(t *testing.T) {
+	defer func(f func(*exec.Cmd, string) (string, error)) { execCommand = f }(execCommand)
+
+	for i, tc := range verifyDeletedTests {
+		execCommand = func(*exec.Cmd, string) (string, error) {
+			return tc.out, tc.err
+		}
+
+		err := CloudRunService{Name: "run-helloworld-0123456789"}.VerifyDeleted("")
+		if !errors.Is(err, tc.want) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.want, err)
+		}
+	}
+
+	// describe failing for another reason is neither a confirmed deletion nor a lingering service
+	execCommand = func(*exec.Cmd, string) (string, error) {
+		return "", fmt.Errorf("exec.Cmd.Run: permission denied")
+	}
+
+	err := CloudRunService{Name: "run-helloworld-0123456789"}.VerifyDeleted("")
+	if err == nil || errors.Is(err, ErrServiceExists) {
+		t.Errorf("unexpected error for failed describe: %v", err)
+	}
+}
+
+type waitURLTest struct {
+	outs    []string      // gcloud output of each attempt, an error if prefixed with "error: "
+	timeout time.Duration // timeout passed to WaitURL
+	url     string        // expected URL returned by WaitURL
+	err     bool          // whether WaitURL should return an error
+	calls   int           // expected number of gcloud calls
+}
+
+var waitURLTests = []waitURLTest{
+	// URL right away
+	{
+		outs:    []string{"https://hello-abc-uc.a.run.app"},
+		timeout: time.Second,
+		url:     "https://hello-abc-uc.a.run.app",
+		calls:   1,
+	},
+
+	// empty URL, then transient error, then URL
+	{
+		outs:    []string{"", "error: transient", "https://hello-abc-uc.a.run.app"},
+		timeout: time.Second,
+		url:     "https://hello-abc-uc.a.run.app",
+		calls:   3,
+	},
+
+	// URL never populated
+	{
+		outs:    []string{""},
+		timeout: 20 * time.Millisecond,
+		url:     "",
+	},
+
+	// no retries
+	{
+		outs:  []string{"error: permission denied", "https://hello-abc-uc.a.run.app"},
+		err:   true,
+		calls: 1,
+	},
+}
+
+func TestWaitURL(t *testing.T) {
+	defer func(f func(*exec.Cmd, string) (string, error)) { execCommand = f }(execCommand)
+
+	for i, tc := range waitURLTests {
+		calls := 0
+		execCommand = func(*exec.Cmd, string) (string, error) {
+			out := tc.outs[len(tc.outs)-1]
+			if calls < len(tc.outs) {
+				out = tc.outs[calls]
+			}
+			calls++
+
+			if strings.HasPrefix(out, "error: ") {
+				return "", errors.New(out)
+			}
+			return out, nil
+		}
+
+		s := CloudRunService{Name: "hello"}
+		url, err := s.WaitURL("", time.Millisecond, tc.timeout)
+
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+		}
+		if url != tc.url {
+			t.Errorf("#%d: result mismatch\nwant: %q\ngot: %q", i, tc.url, url)
+		}
+		if tc.calls > 0 && calls != tc.calls {
+			t.Errorf("#%d: gcloud call count mismatch\nwant: %d\ngot: %d", i, tc.calls, calls)
+		}
+	}
+}
+
+type validateServiceNameTest struct {
+	name  string // service name
+	valid bool   // whether the name is expected to be valid
+}
+
+var validateServiceNameTests = []validateServiceNameTest{
+	// valid name
+	{
+		name:  "run-helloworld",
+		valid: true,
+	},
+
+	// single letter
+	{
+		name:  "a",
+		valid: true,
+	},
+
+	// uppercase letters
+	{
+		name: "Run-HelloWorld",
+	},
+
+	// leading digit
+	{
+		name: "1-helloworld",
+	},
+
+	// trailing hyphen
+	{
+		name: "helloworld-",
+	},
+
+	// invalid character
+	{
+		name: "hello_world",
+	},
+
+	// too long
+	{
+		name: strings.Repeat("a", 64),
+	},
+}
+
+func TestValidateServiceName(t *testing.T) {
+	for i, tc := range validateServiceNameTests {
+		err := ValidateServiceName(tc.name)
+		if (err == nil) != tc.valid {
+			t.Errorf("#%d: %s: validity mismatch\nwant valid: %t\ngot: %v", i, tc.name, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	errInvalidImageURL = errors.New("invalid container image URL")
+
+	// imageURLRegexp matches plausible container image references: a registry host with a domain (or localhost) and
+	// optional port, followed by one or more lowercase path components and an optional tag or digest, such as
+	// gcr.io/project/image or us-docker.pkg.dev/project/repository/image:tag.
+	imageURLRegexp = regexp.MustCompile(`^(localhost|[a-z0-9-]+(\.[a-z0-9-]+)+)(:[0-9]+)?` +
+		`(/[a-z0-9]+([._-][a-z0-9]+)*)+` +
+		`(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+)
+
+// ValidateImageURL returns an error wrapping errInvalidImageURL if the provided URL isn't a plausible container image
+// reference in a registry, such as gcr.io/project/image or us-docker.pkg.dev/project/repository/image:tag.
+func ValidateImageURL(url string) error {
+	if !imageURLRegexp.MatchString(url) {
+		return fmt.Errorf("%w: %s must be a registry host followed by a lowercase image path and an optional tag or digest", errInvalidImageURL, url)
+	}
+
+	return nil
+}
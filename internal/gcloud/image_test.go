@@ -0,0 +1,52 @@
+package gcloud
+
+import (
+	"errors"
+	"testing"
+)
+
+type validateImageURLTest struct {
+	url   string // input image URL
+	valid bool   // whether the URL is expected to be valid
+}
+
+var validateImageURLTests = []validateImageURLTest{
+	// Container Registry
+	{url: "gcr.io/my-project/run-helloworld", valid: true},
+
+	// Artifact Registry with a tag
+	{url: "us-central1-docker.pkg.dev/my-project/samples/run-helloworld:v1.2", valid: true},
+
+	// digest
+	{url: "gcr.io/my-project/hello@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", valid: true},
+
+	// local registry with a port
+	{url: "localhost:5000/hello", valid: true},
+
+	// missing registry host
+	{url: "my-project/hello"},
+
+	// missing image path
+	{url: "gcr.io"},
+
+	// uppercase path
+	{url: "gcr.io/my-project/Hello"},
+
+	// whitespace
+	{url: "gcr.io/my-project/hello world"},
+
+	// scheme
+	{url: "https://gcr.io/my-project/hello"},
+}
+
+func TestValidateImageURL(t *testing.T) {
+	for i, tc := range validateImageURLTests {
+		err := ValidateImageURL(tc.url)
+		if tc.valid && err != nil {
+			t.Errorf("#%d: unexpected error for %s: %v", i, tc.url, err)
+		}
+		if !tc.valid && !errors.Is(err, errInvalidImageURL) {
+			t.Errorf("#%d: error mismatch for %s\nwant: %v\ngot: %v", i, tc.url, errInvalidImageURL, err)
+		}
+	}
+}
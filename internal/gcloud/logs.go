@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"os/exec"
+	"strings"
+)
+
+// logEntry is the subset of a Cloud Logging entry, as printed by `gcloud logging read --format=json`, used to
+// summarize it.
+type logEntry struct {
+	Timestamp   string `json:"timestamp"`
+	Severity    string `json:"severity"`
+	TextPayload string `json:"textPayload"`
+	JSONPayload struct {
+		Message string `json:"message"`
+	} `json:"jsonPayload"`
+	HTTPRequest *struct {
+		RequestMethod string `json:"requestMethod"`
+		RequestURL    string `json:"requestUrl"`
+		Status        int    `json:"status"`
+	} `json:"httpRequest"`
+}
+
+// String summarizes the log entry on a single line: its timestamp, severity, and message or HTTP request.
+func (e logEntry) String() string {
+	msg := e.TextPayload
+	if msg == "" {
+		msg = e.JSONPayload.Message
+	}
+	if msg == "" && e.HTTPRequest != nil {
+		msg = fmt.Sprintf("%s %s %d", e.HTTPRequest.RequestMethod, e.HTTPRequest.RequestURL, e.HTTPRequest.Status)
+	}
+
+	severity := e.Severity
+	if severity == "" {
+		severity = "DEFAULT"
+	}
+
+	return fmt.Sprintf("%s %s %s", e.Timestamp, severity, strings.TrimSpace(msg))
+}
+
+// RecentLogs calls the external gcloud SDK and reads the last limit log entries written by the revisions of the Cloud
+// Run Service associated with the current CloudRunService, such as to diagnose failed tests. Each entry is summarized
+// on a single line, oldest first.
+func (s CloudRunService) RecentLogs(sampleDir string, limit int) ([]string, error) {
+	filter := fmt.Sprintf(`resource.type="cloud_run_revision" AND resource.labels.service_name="%s"`, s.Name)
+	a := append(util.GcloudCommonFlags, "logging", "read", filter, fmt.Sprintf("--limit=%d", limit), "--format=json")
+	out, err := execCommand(exec.Command(util.GcloudPath, a...), sampleDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading Cloud Run Service logs: %w", err)
+	}
+
+	var entries []logEntry
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	// entries are read newest first
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[len(entries)-1-i] = e.String()
+	}
+
+	return lines, nil
+}
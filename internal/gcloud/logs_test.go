@@ -0,0 +1,57 @@
+package gcloud
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recentLogs are log entries of a Cloud Run service, newest first, as printed by `gcloud logging read --format=json`.
+const recentLogs = `[
+  {
+    "timestamp": "2020-07-01T10:00:03Z",
+    "severity": "ERROR",
+    "jsonPayload": {"message": "database connection refused"}
+  },
+  {
+    "timestamp": "2020-07-01T10:00:02Z",
+    "severity": "WARNING",
+    "httpRequest": {"requestMethod": "GET", "requestUrl": "https://hello.a.run.app/", "status": 500}
+  },
+  {
+    "timestamp": "2020-07-01T10:00:01Z",
+    "textPayload": "Listening on port 8080\n"
+  }
+]`
+
+func TestRecentLogs(t *testing.T) {
+	var args []string
+	defer func(f func(*exec.Cmd, string) (string, error)) { execCommand = f }(execCommand)
+	execCommand = func(c *exec.Cmd, _ string) (string, error) {
+		args = c.Args
+		return recentLogs, nil
+	}
+
+	s := CloudRunService{Name: "run-helloworld-0123456789"}
+	lines, err := s.RecentLogs("", 3)
+	if err != nil {
+		t.Fatalf("CloudRunService.RecentLogs: %v", err)
+	}
+
+	want := []string{
+		"2020-07-01T10:00:01Z DEFAULT Listening on port 8080",
+		"2020-07-01T10:00:02Z WARNING GET https://hello.a.run.app/ 500",
+		"2020-07-01T10:00:03Z ERROR database connection refused",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("result mismatch\nwant: %q\ngot: %q", want, lines)
+	}
+
+	cmd := strings.Join(args, " ")
+	for _, w := range []string{"logging read", `resource.labels.service_name="run-helloworld-0123456789"`, "--limit=3"} {
+		if !strings.Contains(cmd, w) {
+			t.Errorf("command %q missing %q", cmd, w)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"os/exec"
+)
+
+// DefaultProject calls the external gcloud SDK and gets the ID of the gcloud default project, set by the core/project
+// property or the CLOUDSDK_CORE_PROJECT environment variable. It returns an error if no default project is set.
+func DefaultProject(sampleDir string) (string, error) {
+	a := append(util.GcloudCommonFlags, "config", "get-value", "core/project")
+	projectID, err := execCommand(exec.Command(util.GcloudPath, a...), sampleDir)
+	if err != nil {
+		return "", fmt.Errorf("getting gcloud default project: %w", err)
+	}
+	if projectID == "" {
+		return "", fmt.Errorf("getting gcloud default project: the core/project property isn't set")
+	}
+
+	return projectID, nil
+}
@@ -0,0 +1,52 @@
+package gcloud
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+type defaultProjectTest struct {
+	out     string // gcloud output
+	err     error  // gcloud error
+	project string // expected result of DefaultProject
+	fail    bool   // whether DefaultProject should return an error
+}
+
+var defaultProjectTests = []defaultProjectTest{
+	// default project set
+	{
+		out:     "my-project",
+		project: "my-project",
+	},
+
+	// no default project
+	{
+		out:  "",
+		fail: true,
+	},
+
+	// gcloud failure
+	{
+		err:  errors.New("exec.Cmd.Run: gcloud not found"),
+		fail: true,
+	},
+}
+
+func TestDefaultProject(t *testing.T) {
+	defer func(f func(*exec.Cmd, string) (string, error)) { execCommand = f }(execCommand)
+
+	for i, tc := range defaultProjectTests {
+		execCommand = func(*exec.Cmd, string) (string, error) {
+			return tc.out, tc.err
+		}
+
+		project, err := DefaultProject("")
+		if (err != nil) != tc.fail {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.fail, err)
+		}
+		if project != tc.project {
+			t.Errorf("#%d: result mismatch\nwant: %q\ngot: %q", i, tc.project, project)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"os/exec"
+	"time"
+)
+
+// identityTokenAttempts is the number of times IdentityToken tries printing an identity token, since gcloud may fail
+// transiently, e.g. when the metadata server it gets credentials from in CI is briefly unavailable.
+const identityTokenAttempts = 3
+
+// identityTokenRetryDelay is the delay before the first retry of IdentityToken, which doubles after each attempt. It's
+// shortened in tests.
+var identityTokenRetryDelay = 500 * time.Millisecond
+
+// IdentityToken calls the external gcloud SDK and prints an identity token for the gcloud authorized account, to
+// authenticate test requests made to Cloud Run services. If audience isn't empty, the token is minted for it instead
+// of the default audience, such as for services behind Identity-Aware Proxy or a load balancer with a custom domain,
+// whose expected audience differs from the service URL. Custom audiences require a service account. Failures are
+// retried up to identityTokenAttempts times in total, with exponential backoff.
+func IdentityToken(sampleDir, audience string) (string, error) {
+	a := append(util.GcloudCommonFlags, "auth", "print-identity-token")
+	if audience != "" {
+		a = append(a, "--audiences="+audience)
+	}
+
+	var err error
+	for attempt := 1; attempt <= identityTokenAttempts; attempt++ {
+		var token string
+		token, err = execCommand(exec.Command(util.GcloudPath, a...), sampleDir)
+		if err == nil {
+			return token, nil
+		}
+
+		if attempt < identityTokenAttempts {
+			delay := identityTokenRetryDelay * time.Duration(1<<uint(attempt-1))
+			util.Infof("Printing identity token failed, retrying in %v: %v\n", delay, err)
+			time.Sleep(delay)
+		}
+	}
+
+	return "", fmt.Errorf("printing identity token: %w", err)
+}
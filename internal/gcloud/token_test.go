@@ -0,0 +1,118 @@
+package gcloud
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type identityTokenTest struct {
+	audience string   // input audience
+	args     []string // expected gcloud arguments
+}
+
+var identityTokenTests = []identityTokenTest{
+	// default audience
+	{
+		args: []string{"gcloud", "--quiet", "auth", "print-identity-token"},
+	},
+
+	// custom audience
+	{
+		audience: "/projects/123/global/backendServices/456",
+		args:     []string{"gcloud", "--quiet", "auth", "print-identity-token", "--audiences=/projects/123/global/backendServices/456"},
+	},
+}
+
+func TestIdentityToken(t *testing.T) {
+	defer func(f func(*exec.Cmd, string) (string, error)) { execCommand = f }(execCommand)
+
+	for i, tc := range identityTokenTests {
+		var args []string
+		execCommand = func(c *exec.Cmd, _ string) (string, error) {
+			args = c.Args
+			return "token", nil
+		}
+
+		token, err := IdentityToken("", tc.audience)
+		if err != nil {
+			t.Errorf("#%d: IdentityToken: %v", i, err)
+			continue
+		}
+
+		if token != "token" {
+			t.Errorf("#%d: token mismatch\nwant: token\ngot: %s", i, token)
+		}
+		if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("#%d: arguments mismatch\nwant: %q\ngot: %q", i, tc.args, args)
+		}
+	}
+}
+
+type identityTokenRetryTest struct {
+	failures int  // number of gcloud calls failing before one succeeds
+	err      bool // whether IdentityToken should return an error
+	calls    int  // expected number of gcloud calls
+}
+
+var identityTokenRetryTests = []identityTokenRetryTest{
+	// success right away
+	{
+		calls: 1,
+	},
+
+	// transient failures, then success
+	{
+		failures: identityTokenAttempts - 1,
+		calls:    identityTokenAttempts,
+	},
+
+	// every attempt fails
+	{
+		failures: identityTokenAttempts,
+		err:      true,
+		calls:    identityTokenAttempts,
+	},
+}
+
+func TestIdentityTokenRetries(t *testing.T) {
+	defer func(f func(*exec.Cmd, string) (string, error)) { execCommand = f }(execCommand)
+	defer func(d time.Duration) { identityTokenRetryDelay = d }(identityTokenRetryDelay)
+	identityTokenRetryDelay = time.Millisecond
+
+	errMetadata := errors.New("metadata server unavailable")
+	for i, tc := range identityTokenRetryTests {
+		calls := 0
+		failures := tc.failures
+		execCommand = func(*exec.Cmd, string) (string, error) {
+			calls++
+			if calls <= failures {
+				return "", errMetadata
+			}
+			return "token", nil
+		}
+
+		token, err := IdentityToken("", "")
+		if calls != tc.calls {
+			t.Errorf("#%d: call count mismatch\nwant: %d\ngot: %d", i, tc.calls, calls)
+		}
+
+		if tc.err {
+			if !errors.Is(err, errMetadata) || !strings.HasPrefix(err.Error(), "printing identity token: ") {
+				t.Errorf("#%d: error mismatch\nwant: printing identity token: %v\ngot: %v", i, errMetadata, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("#%d: IdentityToken: %v", i, err)
+			continue
+		}
+		if token != "token" {
+			t.Errorf("#%d: token mismatch\nwant: token\ngot: %s", i, token)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// latestRevisionKey is the traffic assertion key that matches the traffic target following the latest ready
+// revision, like the LATEST keyword of `gcloud run services update-traffic --to-revisions`.
+const latestRevisionKey = "LATEST"
+
+// ErrTrafficMismatch is returned when a Cloud Run service's traffic split doesn't match the expected one.
+var ErrTrafficMismatch = errors.New("Cloud Run service traffic split mismatch")
+
+// TrafficTarget is an entry of a Cloud Run service's traffic split, as reported in the service's status.
+type TrafficTarget struct {
+	RevisionName   string `json:"revisionName"`
+	Tag            string `json:"tag"`
+	Percent        int    `json:"percent"`
+	LatestRevision bool   `json:"latestRevision"`
+}
+
+// matches reports whether the traffic target is identified by the provided traffic assertion key: its revision name,
+// its tag, or LATEST if it follows the latest ready revision.
+func (t TrafficTarget) matches(key string) bool {
+	return key == t.RevisionName || key == t.Tag || (key == latestRevisionKey && t.LatestRevision)
+}
+
+// Traffic calls the external gcloud SDK and gets the live traffic split across revisions of the Cloud Run Service
+// associated with the current CloudRunService.
+func (s CloudRunService) Traffic(sampleDir string) ([]TrafficTarget, error) {
+	a := append(util.GcloudCommonFlags, "run", "--platform=managed", "services", "describe", s.Name, "--format=json")
+	out, err := execCommand(exec.Command(util.GcloudPath, a...), sampleDir)
+	if err != nil {
+		return nil, fmt.Errorf("getting Cloud Run Service traffic: %w", err)
+	}
+
+	var service struct {
+		Status struct {
+			Traffic []TrafficTarget `json:"traffic"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(out), &service); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: parsing Cloud Run Service description: %w", err)
+	}
+
+	return service.Status.Traffic, nil
+}
+
+// AssertTraffic checks that the live traffic split of the Cloud Run Service associated with the current
+// CloudRunService matches the provided one, as parsed by ParseTrafficAssertion. Each key's expected percentage is
+// compared with the sum of the percentages of the traffic targets it matches: targets with that revision name or tag,
+// or the target following the latest ready revision for LATEST. Targets not matched by any key aren't checked. Returns
+// an error wrapping ErrTrafficMismatch listing every mismatch.
+func (s CloudRunService) AssertTraffic(sampleDir string, want map[string]int) error {
+	targets, err := s.Traffic(sampleDir)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var mismatches []string
+	for _, k := range keys {
+		got := 0
+		for _, t := range targets {
+			if t.matches(k) {
+				got += t.Percent
+			}
+		}
+
+		if got != want[k] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: want %d%%, got %d%%", k, want[k], got))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%w: %s", ErrTrafficMismatch, strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
+
+// ParseTrafficAssertion parses an expected traffic split in the form KEY=PERCENT,KEY=PERCENT..., where each KEY is a
+// revision name, a revision tag, or LATEST, like the arguments of `gcloud run services update-traffic --to-revisions`
+// and `--to-tags`. Percentages must be between 0 and 100 and add up to at most 100.
+func ParseTrafficAssertion(s string) (map[string]int, error) {
+	want := make(map[string]int)
+	total := 0
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.LastIndex(pair, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid traffic assertion %q: expecting KEY=PERCENT", pair)
+		}
+
+		key := strings.TrimSpace(pair[:i])
+		percent, err := strconv.Atoi(strings.TrimSpace(pair[i+1:]))
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid traffic assertion %q: percentage must be an integer between 0 and 100", pair)
+		}
+
+		if _, ok := want[key]; ok {
+			return nil, fmt.Errorf("invalid traffic assertion %q: %s listed more than once", pair, key)
+		}
+
+		want[key] = percent
+		total += percent
+	}
+
+	if total > 100 {
+		return nil, fmt.Errorf("invalid traffic assertion %q: percentages add up to %d%%", s, total)
+	}
+
+	return want, nil
+}
@@ -0,0 +1,127 @@
+package gcloud
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+// canaryDescription is the JSON description of a Cloud Run service splitting traffic between a stable revision and a
+// tagged canary revision, as printed by `gcloud run services describe --format=json`.
+const canaryDescription = `{
+  "metadata": {"name": "run-helloworld-0123456789"},
+  "status": {
+    "traffic": [
+      {"revisionName": "run-helloworld-0123456789-00001-abc", "percent": 90},
+      {"revisionName": "run-helloworld-0123456789-00002-def", "percent": 10, "tag": "canary", "latestRevision": true},
+      {"revisionName": "run-helloworld-0123456789-00002-def", "tag": "preview"}
+    ]
+  }
+}`
+
+type assertTrafficTest struct {
+	want map[string]int // expected traffic split
+	err  error          // expected error
+}
+
+var assertTrafficTests = []assertTrafficTest{
+	// split by revision name
+	{
+		want: map[string]int{"run-helloworld-0123456789-00001-abc": 90, "run-helloworld-0123456789-00002-def": 10},
+	},
+
+	// split by tag and latest revision
+	{
+		want: map[string]int{"canary": 10, latestRevisionKey: 10},
+	},
+
+	// tag without traffic
+	{
+		want: map[string]int{"preview": 0},
+	},
+
+	// unexpected canary percentage
+	{
+		want: map[string]int{"canary": 50},
+		err:  ErrTrafficMismatch,
+	},
+
+	// unknown revision
+	{
+		want: map[string]int{"run-helloworld-0123456789-00003-ghi": 100},
+		err:  ErrTrafficMismatch,
+	},
+}
+
+func TestAssertTraffic(t *testing.T) {
+	defer func(f func(*exec.Cmd, string) (string, error)) { execCommand = f }(execCommand)
+	execCommand = func(*exec.Cmd, string) (string, error) {
+		return canaryDescription, nil
+	}
+
+	for i, tc := range assertTrafficTests {
+		err := CloudRunService{Name: "run-helloworld-0123456789"}.AssertTraffic("", tc.want)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+		}
+	}
+}
+
+type parseTrafficAssertionTest struct {
+	in   string         // traffic assertion
+	want map[string]int // expected traffic split
+	err  bool           // whether an error is expected
+}
+
+var parseTrafficAssertionTests = []parseTrafficAssertionTest{
+	// revisions and tags
+	{
+		in:   "run-helloworld-00001-abc=90,canary=10",
+		want: map[string]int{"run-helloworld-00001-abc": 90, "canary": 10},
+	},
+
+	// latest revision with surrounding spaces
+	{
+		in:   "LATEST = 100",
+		want: map[string]int{"LATEST": 100},
+	},
+
+	// missing percentage
+	{
+		in:  "canary",
+		err: true,
+	},
+
+	// percentage out of range
+	{
+		in:  "canary=101",
+		err: true,
+	},
+
+	// repeated key
+	{
+		in:  "canary=10,canary=20",
+		err: true,
+	},
+
+	// percentages over 100 in total
+	{
+		in:  "stable=90,canary=20",
+		err: true,
+	},
+}
+
+func TestParseTrafficAssertion(t *testing.T) {
+	for i, tc := range parseTrafficAssertionTests {
+		got, err := ParseTrafficAssertion(tc.in)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("#%d: result mismatch\nwant: %v\ngot: %v", i, tc.want, got)
+		}
+	}
+}
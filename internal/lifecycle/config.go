@@ -0,0 +1,63 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghodss/yaml"
+	"io/ioutil"
+)
+
+// ConfigFileName is the name of the optional file in a sample's directory that declares its build and deploy commands
+// directly, instead of them being parsed from its README.
+const ConfigFileName = "sst.yaml"
+
+var errNoConfigCommands = errors.New("no commands declared")
+
+// config is the content of a sample's ConfigFileName file.
+type config struct {
+	// Commands are the sample's build and deploy commands, in order. Each one is written like a single line of a README
+	// code block.
+	Commands []string `json:"commands"`
+}
+
+// loadConfig loads the build and deploy commands declared in the config file with the provided name into a
+// Lifecycle. The commands are parsed the same way as the lines of a README code block, along with their environment
+// variable expansion and service name and Container Registry URL substitution. The environment variables in the
+// provided service name and Container Registry URL are expanded too.
+func loadConfig(filename, serviceName, gcrURL string, o *parseOptions) (Lifecycle, []Explanation, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ioutil.ReadFile: %w", err)
+	}
+
+	var c config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, nil, fmt.Errorf("yaml.Unmarshal: %w", err)
+	}
+
+	if len(c.Commands) == 0 {
+		return nil, nil, errNoConfigCommands
+	}
+
+	cmds, explanations, err := codeBlock(c.Commands).toExplainedCommands(expandEnv(serviceName), expandEnv(gcrURL), o)
+	if err != nil {
+		return nil, nil, fmt.Errorf("codeBlock.toCommands: %w", err)
+	}
+
+	warnStaleServiceNames(explanations)
+	return cmds, explanations, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Discover returns the absolute paths of the sample directories under root, root included. A directory is a sample if
+// it has a ConfigFileName file or if its README holds a code block annotated by the code tag. The directories inside a
+// sample belong to it and aren't searched, nor are hidden directories such as .git.
+func Discover(root string, opts ...ParseOption) ([]string, error) {
+	o := newParseOptions(opts)
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs: %w", err)
+	}
+
+	var dirs []string
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		ok, err := isSample(path, o)
+		if err != nil {
+			return err
+		}
+		if ok {
+			dirs = append(dirs, path)
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Walk: %w", err)
+	}
+
+	return dirs, nil
+}
+
+// isSample reports whether dir has a ConfigFileName file or a README containing the options' code tag.
+func isSample(dir string, o *parseOptions) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, ConfigFileName)); err == nil {
+		return true, nil
+	}
+
+	readmePath, _ := readmeLocation(dir, o.readme)
+	b, err := ioutil.ReadFile(readmePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ioutil.ReadFile: %w", err)
+	}
+
+	return bytes.Contains(b, []byte(o.codeTag)), nil
+}
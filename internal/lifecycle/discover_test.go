@@ -0,0 +1,70 @@
+package lifecycle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	root, err := ioutil.TempDir("", "discover")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	annotated := "[//]: # (" + codeTagForOS(runtime.GOOS) + ")\n```\necho hi\n```\n"
+	files := map[string]string{
+		// annotated README
+		"a/README.md": annotated,
+		// config file without a README
+		"b/" + ConfigFileName: "commands: [echo hi]\n",
+		// README without annotated code blocks
+		"c/README.md": "```\necho hi\n```\n",
+		// sample nested in a directory that isn't one
+		"c/d/README.md": annotated,
+		// README at the location set in config.yaml
+		"e/config.yaml":    "readme: docs/README.md\n",
+		"e/docs/README.md": "no commands here\n",
+		"f/config.yaml":    "readme: docs/README.md\n",
+		"f/docs/README.md": annotated,
+		// directories inside a sample aren't searched
+		"a/nested/README.md": annotated,
+		// hidden directories aren't searched
+		".git/README.md": annotated,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+
+	dirs, err := Discover(root)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+
+	var want []string
+	for _, d := range []string{"a", "b", "c/d", "f"} {
+		want = append(want, filepath.Join(root, d))
+	}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("result mismatch\nwant: %q\ngot: %q", want, dirs)
+	}
+
+	// a custom code tag
+	dirs, err = Discover(root, WithCodeTag("{sst-run-custom}"))
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if want := []string{filepath.Join(root, "b")}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("result mismatch\nwant: %q\ngot: %q", want, dirs)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ParseError is returned when a sample's build and deploy commands can't be read or parsed out of its README or
+// ConfigFileName file, so that callers can tell it apart from an ExecError. It wraps the underlying error, so that
+// errors.Is still matches the sentinel errors it holds.
+type ParseError struct {
+	// File is the path of the README or ConfigFileName file, or empty if the error was returned before the file was
+	// known, like by extractCodeBlocks.
+	File string
+
+	// Line is the 1-based number of the line of File where parsing failed, or 0 if it isn't known.
+	Line int
+
+	// Text is the offending line, if any.
+	Text string
+
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	loc := "parse error"
+	if e.File != "" {
+		loc += " in " + e.File
+	}
+	if e.Line > 0 {
+		loc += fmt.Sprintf(" at line %d", e.Line)
+	}
+
+	if e.Text != "" {
+		return fmt.Sprintf("%s: %v: %q", loc, e.Err, e.Text)
+	}
+
+	return fmt.Sprintf("%s: %v", loc, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseErrorIn returns err as a ParseError of the provided file: if err already wraps a ParseError without a file,
+// like the ones extractCodeBlocks returns, that ParseError is given the file, so that its line number is kept.
+// Otherwise, err is wrapped in a new ParseError.
+func parseErrorIn(file string, err error) error {
+	var pe *ParseError
+	if errors.As(err, &pe) && pe.File == "" {
+		pe.File = file
+		return err
+	}
+
+	return &ParseError{File: file, Err: err}
+}
+
+// ExecError is returned by Lifecycle.Execute when one of the lifecycle's commands fails, so that callers can tell it
+// apart from a ParseError. It wraps the command's error, so that errors.Is still matches ErrCommandTimeout or the
+// error of the context Execute was cancelled with.
+type ExecError struct {
+	// Command is the failed command, rendered as a shell-escaped command line like in Lifecycle.String.
+	Command string
+
+	Err error
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("executing Lifecycle command: %v", e.Err)
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
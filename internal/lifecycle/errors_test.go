@@ -0,0 +1,106 @@
+package lifecycle
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLifecycleParseError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	readme := filepath.Join(dir, "README.md")
+	content := "[//]: # ({sst-run-unix})\n```\necho unclosed\n"
+	if err := ioutil.WriteFile(readme, []byte(content), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	_, err = NewLifecycle(dir, "hello", uniqueGCRURL)
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("error mismatch\nwant: *ParseError\ngot: %v", err)
+	}
+	if parseErr.File != readme {
+		t.Errorf("file mismatch\nwant: %s\ngot: %s", readme, parseErr.File)
+	}
+	if parseErr.Line != 2 {
+		t.Errorf("line mismatch\nwant: 2\ngot: %d", parseErr.Line)
+	}
+	if !errors.Is(err, errCodeBlockNotClosed) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", errCodeBlockNotClosed, err)
+	}
+	var execErr *ExecError
+	if errors.As(err, &execErr) {
+		t.Errorf("parse error reported as an execution error: %v", err)
+	}
+}
+
+type parseErrorTest struct {
+	err  *ParseError // input ParseError
+	want string      // expected result of Error
+}
+
+var parseErrorTests = []parseErrorTest{
+	// file and line
+	{
+		err:  &ParseError{File: "README.md", Line: 12, Err: errCodeBlockNotClosed},
+		want: "parse error in README.md at line 12: unexpected EOF: code block not closed",
+	},
+
+	// file, line and offending text
+	{
+		err:  &ParseError{File: "README.md", Line: 3, Text: "not a fence", Err: errCodeBlockStartNotFound},
+		want: `parse error in README.md at line 3: expecting start of code block immediately after code tag: "not a fence"`,
+	},
+
+	// line without file
+	{
+		err:  &ParseError{Line: 3, Err: errEOFAfterCodeTag},
+		want: "parse error at line 3: unexpected EOF: file ended immediately after code tag",
+	},
+
+	// file without line
+	{
+		err:  &ParseError{File: ".sst.yaml", Err: errors.New("bad yaml")},
+		want: "parse error in .sst.yaml: bad yaml",
+	},
+}
+
+func TestParseErrorError(t *testing.T) {
+	for i, tc := range parseErrorTests {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.want, got)
+		}
+	}
+}
+
+func TestExecuteExecError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := Lifecycle{{Cmd: exec.Command("sh", "-c", "exit 3")}}
+	err = l.Execute(dir)
+
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("error mismatch\nwant: *ExecError\ngot: %v", err)
+	}
+	if want := "sh -c 'exit 3'"; execErr.Command != want {
+		t.Errorf("command mismatch\nwant: %s\ngot: %s", want, execErr.Command)
+	}
+	if !strings.HasPrefix(err.Error(), "executing Lifecycle command: ") {
+		t.Errorf("message mismatch\nwant prefix: executing Lifecycle command: \ngot: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kinds of Transformations applied to a README command while it's parsed.
+const (
+	TransformProjectID      = "project ID replacement"
+	TransformEnvExpansion   = "environment variable expansion"
+	TransformTildeExpansion = "tilde expansion"
+	TransformImageURL       = "container image URL replacement"
+	TransformServiceName    = "service name replacement"
+	TransformRegion         = "region replacement"
+	TransformQuietInjected  = "gcloud --quiet injection"
+	TransformGcloudFlags    = "gcloud flag injection"
+)
+
+// Transformation is a single change applied to a README command while it's parsed, with the values before and after.
+type Transformation struct {
+	Kind   string
+	Before string
+	After  string
+}
+
+// Explanation describes how a README command was turned into the command that would be executed.
+type Explanation struct {
+	// Source is the command as written in the README, with line continuations joined.
+	Source string
+
+	// Command is the fully resolved command.
+	Command string
+
+	Transformations []Transformation
+}
+
+// add records a Transformation if it changed anything.
+func (e *Explanation) add(kind, before, after string) {
+	if before == after {
+		return
+	}
+
+	e.Transformations = append(e.Transformations, Transformation{Kind: kind, Before: before, After: after})
+}
+
+// WriteExplanations writes the provided Explanations to the provided writer in a human-readable form.
+func WriteExplanations(w io.Writer, explanations []Explanation) error {
+	for _, e := range explanations {
+		var b strings.Builder
+		fmt.Fprintf(&b, "README:   %s\n", e.Source)
+		fmt.Fprintf(&b, "Resolved: %s\n", e.Command)
+		if len(e.Transformations) == 0 {
+			b.WriteString("  (no transformations)\n")
+		}
+		for _, t := range e.Transformations {
+			fmt.Fprintf(&b, "  %s: %q -> %q\n", t.Kind, t.Before, t.After)
+		}
+		b.WriteString("\n")
+
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
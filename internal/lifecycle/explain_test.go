@@ -0,0 +1,70 @@
+package lifecycle
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExplainDeployCommand(t *testing.T) {
+	env := map[string]string{"GOOGLE_CLOUD_PROJECT": "my-project"}
+	if err := setEnv(env); err != nil {
+		t.Fatalf("setEnv: %v", err)
+	}
+	defer unsetEnv(env)
+	os.Unsetenv("SST_EXPLAIN_SERVICE")
+
+	cb := codeBlock{
+		"gcloud run deploy ${SST_EXPLAIN_SERVICE:-run-mysql} \\",
+		"--image gcr.io/${GOOGLE_CLOUD_PROJECT}/run-mysql",
+	}
+
+	_, explanations, err := cb.toExplainedCommands(uniqueServiceName, uniqueGCRURL, newParseOptions(nil))
+	if err != nil {
+		t.Fatalf("codeBlock.toExplainedCommands: %v", err)
+	}
+
+	want := []Explanation{
+		{
+			Source:  "gcloud run deploy ${SST_EXPLAIN_SERVICE:-run-mysql} --image gcr.io/${GOOGLE_CLOUD_PROJECT}/run-mysql",
+			Command: "gcloud --quiet run deploy unique_service_name --image gcr.io/unique/tag",
+			Transformations: []Transformation{
+				{
+					Kind:   TransformEnvExpansion,
+					Before: "gcloud run deploy ${SST_EXPLAIN_SERVICE:-run-mysql} --image gcr.io/${GOOGLE_CLOUD_PROJECT}/run-mysql",
+					After:  "gcloud run deploy run-mysql --image gcr.io/my-project/run-mysql",
+				},
+				{
+					Kind:   TransformImageURL,
+					Before: "gcr.io/my-project/run-mysql",
+					After:  "gcr.io/unique/tag",
+				},
+				{
+					Kind:   TransformServiceName,
+					Before: "run-mysql",
+					After:  "unique_service_name",
+				},
+				{
+					Kind:   TransformQuietInjected,
+					Before: "gcloud run deploy unique_service_name --image gcr.io/unique/tag",
+					After:  "gcloud --quiet run deploy unique_service_name --image gcr.io/unique/tag",
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(explanations, want) {
+		t.Errorf("explanation mismatch\nwant: %+v\ngot: %+v", want, explanations)
+	}
+}
+
+func TestExplainUntransformedCommand(t *testing.T) {
+	_, explanations, err := codeBlock{"echo hello world"}.toExplainedCommands(uniqueServiceName, uniqueGCRURL, newParseOptions(nil))
+	if err != nil {
+		t.Fatalf("codeBlock.toExplainedCommands: %v", err)
+	}
+
+	if len(explanations) != 1 || len(explanations[0].Transformations) != 0 {
+		t.Errorf("unexpected transformations for untransformed command: %+v", explanations)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"os/exec"
+)
+
+const (
+	// The gcloud command that adds an IAM policy binding to a resource, e.g. to allow unauthenticated access to a
+	// Cloud Run service with `gcloud run services add-iam-policy-binding`.
+	iamAddBindingCommand = "add-iam-policy-binding"
+
+	// The gcloud command that removes an IAM policy binding added by iamAddBindingCommand.
+	iamRemoveBindingCommand = "remove-iam-policy-binding"
+)
+
+// IAMBindingCleanup returns a Lifecycle that removes the Cloud Run service IAM policy bindings added by the commands of
+// the current Lifecycle. Only bindings on Cloud Run services are tracked, since those services are created by this
+// program. Bindings on other resources, like projects, may have existed beforehand and are left alone.
+func (l Lifecycle) IAMBindingCleanup() Lifecycle {
+	var cleanup Lifecycle
+	for _, st := range l {
+		if st.Cmd == nil {
+			continue
+		}
+
+		if r := iamRemoveBindingCmd(st.Cmd); r != nil {
+			cleanup = append(cleanup, Step{Cmd: r})
+		}
+	}
+
+	return cleanup
+}
+
+// iamRemoveBindingCmd returns the command that removes the IAM policy binding added by the provided
+// `gcloud run services add-iam-policy-binding` command. It returns nil if the provided command isn't one.
+func iamRemoveBindingCmd(c *exec.Cmd) *exec.Cmd {
+	if len(c.Args) == 0 || !util.IsGcloud(c.Args[0]) {
+		return nil
+	}
+
+	var run, services bool
+	for i, a := range c.Args[1:] {
+		switch a {
+		case "run":
+			run = true
+		case "services":
+			services = run
+		case iamAddBindingCommand:
+			if !services {
+				return nil
+			}
+
+			args := append([]string{}, c.Args[1:]...)
+			args[i] = iamRemoveBindingCommand
+
+			r := exec.Command(c.Args[0], args...)
+			r.Env = c.Env
+			return r
+		}
+	}
+
+	return nil
+}
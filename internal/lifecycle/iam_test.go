@@ -0,0 +1,52 @@
+package lifecycle
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+type iamBindingCleanupTest struct {
+	lifecycle Lifecycle // input Lifecycle
+	cleanup   Lifecycle // expected result of Lifecycle.IAMBindingCleanup
+}
+
+var iamBindingCleanupTests = []iamBindingCleanupTest{
+	// Cloud Run service binding is tracked for removal
+	{
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag="+uniqueGCRURL)},
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--image="+uniqueGCRURL)},
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "add-iam-policy-binding", uniqueServiceName, "--member=allUsers", "--role=roles/run.invoker")},
+		},
+		cleanup: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "remove-iam-policy-binding", uniqueServiceName, "--member=allUsers", "--role=roles/run.invoker")},
+		},
+	},
+
+	// project binding isn't tracked for removal
+	{
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "projects", "add-iam-policy-binding", "my-project", "--member=allUsers", "--role=roles/viewer")},
+		},
+		cleanup: nil,
+	},
+
+	// no bindings
+	{
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("echo", "add-iam-policy-binding")},
+			{},
+		},
+		cleanup: nil,
+	},
+}
+
+func TestIAMBindingCleanup(t *testing.T) {
+	for i, tc := range iamBindingCleanupTests {
+		cleanup := tc.lifecycle.IAMBindingCleanup()
+		if !reflect.DeepEqual(cleanup, tc.cleanup) {
+			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.cleanup, cleanup)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package lifecycle
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
@@ -23,57 +24,381 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
 )
 
-// Lifecycle is a list of ordered exec.Cmd that should be run to execute a certain process.
-type Lifecycle []*exec.Cmd
+// DefaultCommandTimeout is the default time a single Lifecycle command, such as `gcloud builds submit`, may run for
+// before it's killed.
+const DefaultCommandTimeout = 15 * time.Minute
 
-// Execute executes the commands of a lifecycle in the provided directory.
-func (l Lifecycle) Execute(commandsDir string) error {
-	for _, c := range l {
-		if c == nil {
+// RegionEnvVars are the environment variables commonly used to hold a sample's region, which are replaced along with
+// `--region` flags when parsing a README with WithRegion.
+var RegionEnvVars = []string{"REGION", "GCLOUD_REGION", "GOOGLE_CLOUD_REGION", "CLOUDSDK_RUN_REGION"}
+
+// projectIDEnvVars are the environment variables commonly used to hold the project ID in READMEs, which expand to the
+// project ID set with WithProjectID when they're unset.
+var projectIDEnvVars = []string{"PROJECT_ID", "GOOGLE_CLOUD_PROJECT"}
+
+// ErrCommandTimeout is returned when a Lifecycle command is killed for running longer than its timeout.
+var ErrCommandTimeout = errors.New("command timed out")
+
+// ErrREADMENotFound is returned by CheckREADME when a sample's README doesn't exist and nothing else provides its build
+// and deploy commands.
+var ErrREADMENotFound = errors.New("README not found")
+
+// Lifecycle is a list of ordered Steps that should be run to execute a certain process.
+type Lifecycle []Step
+
+// Step is a single command of a Lifecycle, along with how its failure is handled.
+type Step struct {
+	Cmd *exec.Cmd
+
+	// Upstream holds the commands piped into Cmd, first to last, if Cmd is the last command of a pipeline, like
+	// `b | c` in `b | c | Cmd`.
+	Upstream []*exec.Cmd
+
+	// IgnoreFailure is set for commands followed by `;` in a README: if the command, or the `&&` list it ends, fails,
+	// the lifecycle goes on, like in a shell without `set -e`.
+	IgnoreFailure bool
+
+	// AndNext is set for commands followed by `&&` in a README: if the command fails, the rest of its `&&` list is
+	// skipped too.
+	AndNext bool
+}
+
+// commands returns the commands of the Step's pipeline, first to last, ending with its Cmd.
+func (st Step) commands() []*exec.Cmd {
+	return append(append([]*exec.Cmd(nil), st.Upstream...), st.Cmd)
+}
+
+// String returns the lifecycle's commands, one per line, as shell-escaped command lines that can be pasted into a
+// terminal. The commands are rendered fully resolved, after environment variable expansion and service name and
+// container image URL substitution, so it shows exactly what Execute would run. Commands end with the ` &&` or ` ;`
+// they're followed by in the README, if any.
+func (l Lifecycle) String() string {
+	var lines []string
+	for _, st := range l {
+		if st.Cmd == nil {
 			continue
 		}
 
-		_, err := util.ExecCommand(c, commandsDir)
-		if err != nil {
+		line := pipelineCommandLine(st)
+		switch {
+		case st.AndNext:
+			line += " &&"
+		case st.IgnoreFailure:
+			line += " ;"
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// DeploysFromSource reports whether any command of the lifecycle is a `gcloud run deploy --source` command, which
+// builds and pushes a container image of its own rather than the one at the container image URL the lifecycle was
+// parsed with.
+func (l Lifecycle) DeploysFromSource() bool {
+	for _, st := range l {
+		if st.Cmd != nil && isSourceDeploy(st.Cmd.Args) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExecuteOption configures optional behavior of Lifecycle.Execute.
+type ExecuteOption func(*executeOptions)
+
+// executeOptions holds the configuration set by the ExecuteOptions passed to Lifecycle.Execute.
+type executeOptions struct {
+	attempts  int
+	baseDelay time.Duration
+	dryRun    bool
+	timeout   time.Duration
+	ctx       context.Context
+}
+
+// WithRetries makes Lifecycle.Execute re-run a failed command up to attempts times in total, waiting an exponentially
+// increasing delay starting at baseDelay between attempts. Commands are only run once by default.
+func WithRetries(attempts int, baseDelay time.Duration) ExecuteOption {
+	return func(o *executeOptions) {
+		o.attempts = attempts
+		o.baseDelay = baseDelay
+	}
+}
+
+// WithCommandTimeout sets the time each attempt of a command may run for before it's killed and fails with an error
+// wrapping ErrCommandTimeout, so that a hung command can't block the run indefinitely. A timeout of zero disables it.
+// Defaults to DefaultCommandTimeout.
+func WithCommandTimeout(timeout time.Duration) ExecuteOption {
+	return func(o *executeOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithContext sets the context Lifecycle.Execute runs under: once it's done, the running command is killed, no further
+// command or retry is started, and Execute returns an error wrapping the context's error. Defaults to
+// context.Background().
+func WithContext(ctx context.Context) ExecuteOption {
+	return func(o *executeOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithDryRun makes Lifecycle.Execute log each fully resolved command -- after environment variable expansion and
+// service name and Container Registry URL substitution -- without executing it.
+func WithDryRun(dryRun bool) ExecuteOption {
+	return func(o *executeOptions) {
+		o.dryRun = dryRun
+	}
+}
+
+// Execute executes the commands of a lifecycle in the provided directory. It stops at the first command that fails,
+// unless the `&&` list the command belongs to is followed by `;` in the README, like `a && b ; c`: then the rest of
+// that list is skipped, and the lifecycle goes on after it.
+func (l Lifecycle) Execute(commandsDir string, opts ...ExecuteOption) error {
+	o := &executeOptions{attempts: 1, timeout: DefaultCommandTimeout, ctx: context.Background()}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	for i := 0; i < len(l); i++ {
+		st := l[i]
+		if st.Cmd == nil {
+			continue
+		}
+
+		if err := o.ctx.Err(); err != nil {
 			return fmt.Errorf("executing Lifecycle command: %w", err)
 		}
+
+		if o.dryRun {
+			log.Printf("Dry run: would execute %s\n", pipelineString(st))
+			continue
+		}
+
+		err := o.execWithRetries(st, commandsDir)
+		if err == nil {
+			continue
+		}
+
+		end := l.listEnd(i)
+		if l[end].IgnoreFailure {
+			log.Printf("Command failed, continuing since it's followed by `;`: %v\n", err)
+			i = end
+			continue
+		}
+
+		log.Printf("Command failed: %v\n", err)
+		return &ExecError{Command: pipelineCommandLine(st), Err: err}
 	}
 
 	return nil
 }
 
-// NewLifecycle tries to parse the different options provided for build and deploy command configuration. If none of
-// those options are set up, it falls back to reasonable defaults based on whether the sample is java-based
-// (has a pom.xml) that doesn't have a Dockerfile or isn't.
-func NewLifecycle(sampleDir, serviceName, gcrURL string) (Lifecycle, error) {
-	var readmePath string
-	// Searching for config file
-	if err := viper.ReadInConfig(); err == nil {
-		log.Println("Config file found, using specified location for README")
-		readmePath, _ = filepath.Abs(filepath.Join(sampleDir, viper.GetString("readme")))
-	} else {
-		log.Println("No config file found, using root directory for README location")
-		readmePath = filepath.Join(sampleDir, "README.md")
+// listEnd returns the index of the last Step of the `&&` list the Step at index i belongs to.
+func (l Lifecycle) listEnd(i int) int {
+	for i < len(l)-1 && l[i].AndNext {
+		i++
+	}
+
+	return i
+}
+
+// execWithRetries executes the provided Step's pipeline in the provided directory, retrying it with exponential
+// backoff according to the options. Each attempt runs a copy of the pipeline that's killed once it exceeds the options'
+// timeout. The returned error is the one from the last attempt, which holds the command's output.
+func (o *executeOptions) execWithRetries(st Step, commandsDir string) error {
+	for attempt := 1; ; attempt++ {
+		err := o.exec(st, commandsDir)
+		if err == nil || attempt >= o.attempts || o.ctx.Err() != nil {
+			return err
+		}
+
+		delay := o.baseDelay * time.Duration(1<<uint(attempt-1))
+		log.Printf("Command failed: %v\n", err)
+		util.Infof("Retrying in %v (attempt %d of %d)\n", delay, attempt+1, o.attempts)
+		select {
+		case <-time.After(delay):
+		case <-o.ctx.Done():
+			return fmt.Errorf("%w: %v", o.ctx.Err(), err)
+		}
+	}
+}
+
+// exec executes a copy of the provided Step's pipeline in the provided directory, killing it if it runs longer than
+// the options' timeout or once the options' context is done.
+func (o *executeOptions) exec(st Step, commandsDir string) error {
+	ctx := o.ctx
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	err := execPipeline(cloneStep(ctx, st), commandsDir)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w after %v: %v", ErrCommandTimeout, o.timeout, err)
+	}
+	if err != nil && o.ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", o.ctx.Err(), err)
 	}
 
+	return err
+}
+
+// ParseOption configures optional behavior of NewLifecycle and ExplainREADME.
+type ParseOption func(*parseOptions)
+
+// parseOptions holds the configuration set by the ParseOptions passed to NewLifecycle and ExplainREADME.
+type parseOptions struct {
+	codeTag       string
+	readme        string
+	projectID     string
+	region        string
+	registryHosts []string
+	gcloudFlags   []string
+
+	// unsetEnvWarnings logs the unset environment variables referenced by the README's commands instead of failing.
+	unsetEnvWarnings bool
+
+	// imageURLRegexp matches the container image URLs in the registries in registryHosts and defaultRegistryHosts.
+	imageURLRegexp *regexp.Regexp
+}
+
+// WithCodeTag sets the tag that should appear immediately before code blocks in a README to indicate that the enclosed
+// commands are to be used for building and deploying the sample, such as {run-and-test}, for docs that already use
+// their own comment markers. It replaces the default tag for the current platform, e.g. {sst-run-unix}.
+func WithCodeTag(tag string) ParseOption {
+	return func(o *parseOptions) {
+		o.codeTag = tag
+	}
+}
+
+// WithREADME parses the build and deploy commands from the provided markdown file, such as RUNNING.md or
+// docs/quickstart.md, instead of the sample's README.md. A relative path is relative to the sample's directory. It
+// takes precedence over the README location set in the sample's config file.
+func WithREADME(name string) ParseOption {
+	return func(o *parseOptions) {
+		o.readme = name
+	}
+}
+
+// WithProjectID replaces the project ID placeholders of the README's commands with the provided project ID: the
+// `$(gcloud config get-value project)` command substitution, which isn't supported otherwise, and the PROJECT_ID,
+// YOUR_PROJECT_ID, [PROJECT_ID] and <PROJECT_ID> placeholder words. References to a PROJECT_ID environment variable,
+// such as ${PROJECT_ID}, and assignments to it are left to environment variable expansion, but references to the
+// PROJECT_ID or GOOGLE_CLOUD_PROJECT environment variables expand to the provided project ID when they're unset. The
+// placeholders are left untouched by default.
+func WithProjectID(id string) ParseOption {
+	return func(o *parseOptions) {
+		o.projectID = id
+	}
+}
+
+// WithRegion replaces the region of the README's commands with the provided one, such as for testing a sample in
+// another region than the one it hardcodes: the values of `--region` flags, and of leading assignments to the
+// environment variables in RegionEnvVars. The README's regions are left untouched by default.
+func WithRegion(region string) ParseOption {
+	return func(o *parseOptions) {
+		o.region = region
+	}
+}
+
+// WithRegistryHosts recognizes container image URLs in the registries with the provided hostnames, such as
+// registry.example.com, on top of Container Registry and Artifact Registry, so that they're replaced with the sample's
+// container image URL too.
+func WithRegistryHosts(hosts ...string) ParseOption {
+	return func(o *parseOptions) {
+		o.registryHosts = append(o.registryHosts, hosts...)
+	}
+}
+
+// WithGcloudFlags appends the provided flags, such as --impersonate-service-account=SA, to every gcloud command of the
+// README or ConfigFileName file, right after the injected --quiet flag. Other commands are left untouched.
+func WithGcloudFlags(flags ...string) ParseOption {
+	return func(o *parseOptions) {
+		o.gcloudFlags = append(o.gcloudFlags, flags...)
+	}
+}
+
+// WithUnsetEnvWarnings logs a warning listing the unset environment variables referenced by the README's commands,
+// which expand to the empty string, instead of failing, such as when the commands are only printed or explained rather
+// than run.
+func WithUnsetEnvWarnings() ParseOption {
+	return func(o *parseOptions) {
+		o.unsetEnvWarnings = true
+	}
+}
+
+// newParseOptions applies the provided ParseOptions to the default configuration.
+func newParseOptions(opts []ParseOption) *parseOptions {
+	o := &parseOptions{codeTag: codeTagForOS(runtime.GOOS)}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.imageURLRegexp = imageURLRegexp(o.registryHosts)
+
+	return o
+}
+
+// lookupEnv looks up the value of the environment variable with the provided name like os.LookupEnv, except that the
+// projectIDEnvVars are set to the options' project ID, if any, when they're unset.
+func (o *parseOptions) lookupEnv(name string) (string, bool) {
+	if v, ok := os.LookupEnv(name); ok || o.projectID == "" {
+		return v, ok
+	}
+
+	for _, n := range projectIDEnvVars {
+		if n == name {
+			return o.projectID, true
+		}
+	}
+
+	return "", false
+}
+
+// NewLifecycle tries to parse the different options provided for build and deploy command configuration: the commands
+// declared in the sample's ConfigFileName file, then the ones in its README. If none of those options are set up, it
+// falls back to reasonable defaults based on whether the sample is java-based (has a pom.xml) that doesn't have a
+// Dockerfile or isn't.
+func NewLifecycle(sampleDir, serviceName, gcrURL string, opts ...ParseOption) (Lifecycle, error) {
+	o := newParseOptions(opts)
+
+	configPath := filepath.Join(sampleDir, ConfigFileName)
+	if _, err := os.Stat(configPath); err == nil {
+		lifecycle, _, err := loadConfig(configPath, serviceName, gcrURL, o)
+		if err != nil {
+			return nil, fmt.Errorf("lifecycle.loadConfig: %w", parseErrorIn(configPath, err))
+		}
+
+		util.Infof("Using build and deploy commands declared in %s\n", ConfigFileName)
+		return lifecycle, nil
+	}
+
+	readmePath := findREADME(sampleDir, o)
+	readmeName := filepath.Base(readmePath)
 	if _, err := os.Stat(readmePath); err == nil {
-		lifecycle, err := parseREADME(readmePath, serviceName, gcrURL)
+		lifecycle, _, err := parseExplainedREADME(readmePath, serviceName, gcrURL, o)
 		// Show README location
-		log.Println("README.md location: " + readmePath)
+		util.Infof("%s location: %s\n", readmeName, readmePath)
 		if err == nil {
-			log.Println("Using build and deploy commands found in README.md")
+			util.Infof("Using build and deploy commands found in %s\n", readmeName)
 			return lifecycle, nil
 		}
 
 		if !errors.Is(err, errNoReadmeCodeBlocksFound) {
-			return nil, fmt.Errorf("lifecycle.parseREADME: %s: %w", readmePath, err)
+			return nil, fmt.Errorf("lifecycle.parseREADME: %w", parseErrorIn(readmePath, err))
 		}
 
-		log.Printf("No code blocks immediately preceded by %s found in README.md\n", codeTag)
+		util.Infof("No code blocks immediately preceded by %s found in %s\n", o.codeTag, readmeName)
 	} else {
-		log.Println("No README.md found")
+		util.Infof("No %s found\n", readmeName)
 	}
 
 	pomPath := filepath.Join(sampleDir, "pom.xml")
@@ -86,14 +411,125 @@ func NewLifecycle(sampleDir, serviceName, gcrURL string) (Lifecycle, error) {
 	dockerfileE := err == nil
 
 	if pomE && !dockerfileE {
-		log.Println("Using default build and deploy commands for java samples without a Dockerfile")
+		util.Infof("Using default build and deploy commands for java samples without a Dockerfile\n")
 		return buildDefaultJavaLifecycle(serviceName, gcrURL), nil
 	}
 
-	log.Println("Using default build and deploy commands for non-java samples or java samples with a Dockerfile")
+	util.Infof("Using default build and deploy commands for non-java samples or java samples with a Dockerfile\n")
 	return buildDefaultLifecycle(serviceName, gcrURL), nil
 }
 
+// findREADME returns the path of the sample's README: the file set with WithREADME, if any, else the location specified
+// in the sample's config file, if any, or README.md in the sample's directory.
+func findREADME(sampleDir string, o *parseOptions) string {
+	readmePath, configured := readmeLocation(sampleDir, o.readme)
+	switch {
+	case o.readme != "":
+		util.Infof("Using specified README file %s\n", o.readme)
+	case configured:
+		util.Infof("Config file found, using specified location for README\n")
+	default:
+		util.Infof("No config file found, using root directory for README location\n")
+	}
+
+	return readmePath
+}
+
+// CheckREADME returns an error if the sample in the provided directory has no usable source of build and deploy
+// commands, so that a wrong sample directory is reported before anything runs rather than deep inside README parsing.
+// That's the case if its README exists but can't be read, if the README set with WithREADME or in its config file
+// doesn't exist, or if it has no README at all and neither a ConfigFileName file, a Dockerfile nor a pom.xml to fall
+// back on. The error wraps ErrREADMENotFound in the latter cases.
+func CheckREADME(sampleDir string, opts ...ParseOption) error {
+	if _, err := os.Stat(filepath.Join(sampleDir, ConfigFileName)); err == nil {
+		return nil
+	}
+
+	o := newParseOptions(opts)
+	readmePath, configured := readmeLocation(sampleDir, o.readme)
+	f, err := os.Open(readmePath)
+	if err == nil {
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("README can't be read: %w", err)
+		}
+		if fi.IsDir() {
+			return fmt.Errorf("README %s is a directory", readmePath)
+		}
+
+		return nil
+	}
+
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("README can't be read: %w", err)
+	}
+
+	if configured {
+		return fmt.Errorf("%w: %s, the specified README location", ErrREADMENotFound, readmePath)
+	}
+
+	for _, name := range []string{"Dockerfile", "pom.xml"} {
+		if _, err := os.Stat(filepath.Join(sampleDir, name)); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s, and there's no %s, Dockerfile or pom.xml to fall back on; is %s the sample's directory?",
+		ErrREADMENotFound, readmePath, ConfigFileName, sampleDir)
+}
+
+// readmeLocation returns the path of the sample's README like findREADME, without logging, and whether it was
+// specified, either as the provided file name, relative to the sample's directory, or in the sample's config file.
+// Each call reads the config file with its own viper instance so that several samples can be looked up at once.
+func readmeLocation(sampleDir, readme string) (string, bool) {
+	if readme != "" {
+		if !filepath.IsAbs(readme) {
+			readme = filepath.Join(sampleDir, readme)
+		}
+
+		return readme, true
+	}
+
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+	v.AddConfigPath(sampleDir)
+	if err := v.ReadInConfig(); err == nil {
+		readmePath, _ := filepath.Abs(filepath.Join(sampleDir, v.GetString("readme")))
+		return readmePath, true
+	}
+
+	return filepath.Join(sampleDir, "README.md"), false
+}
+
+// ExplainREADME parses the build and deploy commands in the sample's README, or in its ConfigFileName file if it has
+// one, the same way NewLifecycle does and returns an Explanation of the transformations applied to each command. It
+// returns an error if the README doesn't exist or holds no annotated code blocks, in which case NewLifecycle falls back
+// to default commands.
+func ExplainREADME(sampleDir, serviceName, gcrURL string, opts ...ParseOption) ([]Explanation, error) {
+	o := newParseOptions(opts)
+
+	configPath := filepath.Join(sampleDir, ConfigFileName)
+	if _, err := os.Stat(configPath); err == nil {
+		_, explanations, err := loadConfig(configPath, serviceName, gcrURL, o)
+		if err != nil {
+			return nil, fmt.Errorf("lifecycle.loadConfig: %w", parseErrorIn(configPath, err))
+		}
+
+		return explanations, nil
+	}
+
+	readmePath := findREADME(sampleDir, o)
+	_, explanations, err := parseExplainedREADME(readmePath, serviceName, gcrURL, o)
+	if err != nil {
+		return nil, fmt.Errorf("lifecycle.parseExplainedREADME: %w", parseErrorIn(readmePath, err))
+	}
+
+	return explanations, nil
+}
+
 // buildDefaultLifecycle builds a build and deploy command lifecycle with reasonable defaults for a non-Java
 // project. It uses `gcloud builds submit` for building the samples container image and submitting it to the container
 // and `gcloud run deploy` for deploying it to Cloud Run.
@@ -103,8 +539,8 @@ func buildDefaultLifecycle(serviceName, gcrURL string) Lifecycle {
 		"--platform=managed")
 
 	return Lifecycle{
-		exec.Command("gcloud", a0...),
-		exec.Command("gcloud", a1...),
+		{Cmd: exec.Command(util.GcloudPath, a0...)},
+		{Cmd: exec.Command(util.GcloudPath, a1...)},
 	}
 }
 
@@ -114,7 +550,7 @@ func buildDefaultLifecycle(serviceName, gcrURL string) Lifecycle {
 func buildDefaultJavaLifecycle(serviceName, gcrURL string) Lifecycle {
 	l := buildDefaultLifecycle(serviceName, gcrURL)
 
-	l[0] = exec.Command("mvn",
+	l[0].Cmd = exec.Command("mvn",
 		"compile",
 		"com.google.cloud.tools:jib-maven-plugin:2.0.0:build",
 		fmt.Sprintf("-Dimage=%s", gcrURL),
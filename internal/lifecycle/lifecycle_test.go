@@ -0,0 +1,622 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyCommand returns a command that fails with the provided output on its first run in a directory and succeeds
+// on every run after that.
+func flakyCommand(output string) *exec.Cmd {
+	return exec.Command("sh", "-c", "test -f ran && exit 0; touch ran; echo "+output+" >&2; exit 1")
+}
+
+type executeRetriesTest struct {
+	attempts int    // attempts passed to WithRetries
+	err      string // expected string contained in return error of Lifecycle.Execute
+}
+
+var executeRetriesTests = []executeRetriesTest{
+	// flaky command succeeds on retry
+	{
+		attempts: 2,
+	},
+
+	// flaky command fails without retries, error holds the command's output
+	{
+		attempts: 1,
+		err:      "transient quota error",
+	},
+}
+
+func TestExecuteRetries(t *testing.T) {
+	for i, tc := range executeRetriesTests {
+		dir, err := ioutil.TempDir("", "lifecycle")
+		if err != nil {
+			t.Fatalf("ioutil.TempDir: %v", err)
+		}
+
+		l := Lifecycle{{Cmd: flakyCommand("transient quota error")}}
+		err = l.Execute(dir, WithRetries(tc.attempts, time.Millisecond))
+		os.RemoveAll(dir)
+
+		var errorMatch bool
+		if err == nil {
+			errorMatch = tc.err == ""
+		} else {
+			errorMatch = tc.err != "" && strings.Contains(err.Error(), tc.err)
+		}
+
+		if !errorMatch {
+			t.Errorf("#%d: error mismatch\nwant: %s\ngot: %v", i, tc.err, err)
+		}
+	}
+}
+
+type executePipelineTest struct {
+	cmds   []*exec.Cmd // commands of the pipeline
+	output string      // expected content of the file written by the pipeline
+	err    string      // expected string contained in return error of Lifecycle.Execute
+}
+
+var executePipelineTests = []executePipelineTest{
+	// two commands
+	{
+		cmds: []*exec.Cmd{
+			exec.Command("echo", "hello"),
+			exec.Command("sh", "-c", "tr a-z A-Z > out"),
+		},
+		output: "HELLO\n",
+	},
+
+	// three commands
+	{
+		cmds: []*exec.Cmd{
+			exec.Command("printf", "b\\na\\n"),
+			exec.Command("sort"),
+			exec.Command("sh", "-c", "cat > out"),
+		},
+		output: "a\nb\n",
+	},
+
+	// failing middle command fails the pipeline even though the last command succeeds, error holds its output
+	{
+		cmds: []*exec.Cmd{
+			exec.Command("echo", "hello"),
+			exec.Command("sh", "-c", "cat; echo middle failed >&2; exit 3"),
+			exec.Command("sh", "-c", "cat > out"),
+		},
+		output: "hello\n",
+		err:    "middle failed",
+	},
+
+	// failing first command whose output isn't read fails the pipeline
+	{
+		cmds: []*exec.Cmd{
+			exec.Command("sh", "-c", "echo first failed >&2; exit 2"),
+			exec.Command("sh", "-c", "echo ok > out"),
+		},
+		output: "ok\n",
+		err:    "first failed",
+	},
+
+	// first command that exits after the last one is waited for
+	{
+		cmds: []*exec.Cmd{
+			exec.Command("sh", "-c", "exec >&-; sleep 0.2; echo waited > out"),
+			exec.Command("true"),
+		},
+		output: "waited\n",
+	},
+
+	// last command that exits before reading all of its input
+	{
+		cmds: []*exec.Cmd{
+			exec.Command("yes"),
+			exec.Command("sh", "-c", "head -n 1 > out"),
+		},
+		output: "y\n",
+	},
+
+	// failing last command
+	{
+		cmds: []*exec.Cmd{
+			exec.Command("echo", "hello"),
+			exec.Command("sh", "-c", "cat > out; exit 1"),
+		},
+		output: "hello\n",
+		err:    "exit status 1",
+	},
+}
+
+func TestExecutePipeline(t *testing.T) {
+	for i, tc := range executePipelineTests {
+		dir, err := ioutil.TempDir("", "lifecycle")
+		if err != nil {
+			t.Fatalf("ioutil.TempDir: %v", err)
+		}
+
+		l := Lifecycle{pipeline(tc.cmds...)}
+		err = l.Execute(dir)
+		out, _ := ioutil.ReadFile(filepath.Join(dir, "out"))
+		os.RemoveAll(dir)
+
+		var errorMatch bool
+		if err == nil {
+			errorMatch = tc.err == ""
+		} else {
+			errorMatch = tc.err != "" && strings.Contains(err.Error(), tc.err)
+		}
+
+		if !errorMatch {
+			t.Errorf("#%d: error mismatch\nwant: %s\ngot: %v", i, tc.err, err)
+		}
+
+		if string(out) != tc.output {
+			t.Errorf("#%d: output mismatch\nwant: %q\ngot: %q", i, tc.output, out)
+		}
+	}
+}
+
+func TestExecutePipelineRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := Lifecycle{pipeline(flakyCommand("transient quota error"), exec.Command("cat"))}
+	if err := l.Execute(dir, WithRetries(2, time.Millisecond)); err != nil {
+		t.Errorf("Lifecycle.Execute: %v", err)
+	}
+}
+
+type executeListTest struct {
+	l   Lifecycle // input Lifecycle, run in an empty directory
+	err bool      // whether Lifecycle.Execute should return an error
+	ran []string  // files expected to be touched by the commands that ran
+}
+
+var executeListTests = []executeListTest{
+	// `false && touch a`: `&&` stops at the failing command
+	{
+		l: Lifecycle{
+			{Cmd: exec.Command("false"), AndNext: true},
+			{Cmd: exec.Command("touch", "a")},
+		},
+		err: true,
+	},
+
+	// `false ; touch a`: `;` runs the next command anyway
+	{
+		l: Lifecycle{
+			{Cmd: exec.Command("false"), IgnoreFailure: true},
+			{Cmd: exec.Command("touch", "a")},
+		},
+		ran: []string{"a"},
+	},
+
+	// `false && touch a ; touch b`: the rest of the failed `&&` list is skipped, the command after `;` runs
+	{
+		l: Lifecycle{
+			{Cmd: exec.Command("false"), AndNext: true},
+			{Cmd: exec.Command("touch", "a"), IgnoreFailure: true},
+			{Cmd: exec.Command("touch", "b")},
+		},
+		ran: []string{"b"},
+	},
+
+	// `touch a ; false && touch b` followed by `touch c`: a failed `&&` list that doesn't end with `;` aborts
+	{
+		l: Lifecycle{
+			{Cmd: exec.Command("touch", "a"), IgnoreFailure: true},
+			{Cmd: exec.Command("false"), AndNext: true},
+			{Cmd: exec.Command("touch", "b")},
+			{Cmd: exec.Command("touch", "c")},
+		},
+		err: true,
+		ran: []string{"a"},
+	},
+}
+
+func TestExecuteCommandList(t *testing.T) {
+	for i, tc := range executeListTests {
+		dir, err := ioutil.TempDir("", "lifecycle")
+		if err != nil {
+			t.Fatalf("ioutil.TempDir: %v", err)
+		}
+
+		err = tc.l.Execute(dir)
+		files, readErr := ioutil.ReadDir(dir)
+		os.RemoveAll(dir)
+		if readErr != nil {
+			t.Fatalf("ioutil.ReadDir: %v", readErr)
+		}
+
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+		}
+
+		var ran []string
+		for _, f := range files {
+			ran = append(ran, f.Name())
+		}
+		if !reflect.DeepEqual(ran, tc.ran) {
+			t.Errorf("#%d: commands ran mismatch\nwant: %v\ngot: %v", i, tc.ran, ran)
+		}
+	}
+}
+
+func TestExecuteLogsFailureOutput(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	l := Lifecycle{{Cmd: exec.Command("sh", "-c", "echo 'ERROR: (gcloud.builds.submit) build failed' >&2; exit 1")}}
+	err := l.Execute(os.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "build failed") {
+		t.Errorf("error missing command output: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "build failed") {
+		t.Errorf("log missing command output:\n%s", buf.String())
+	}
+}
+
+func TestExecuteCommandTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the shell replaces itself with sleep, so the recorded PID is the hung command's
+	l := Lifecycle{{Cmd: exec.Command("sh", "-c", "echo $$ > pid; exec sleep 30")}}
+
+	start := time.Now()
+	err = l.Execute(dir, WithCommandTimeout(200*time.Millisecond))
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", ErrCommandTimeout, err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Lifecycle.Execute returned after %v, command not killed", d)
+	}
+
+	pid, err := ioutil.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	if exec.Command("kill", "-0", strings.TrimSpace(string(pid))).Run() == nil {
+		t.Errorf("timed out command %s is still running", pid)
+	}
+}
+
+func TestExecuteContextCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	l := Lifecycle{{Cmd: exec.Command("sleep", "30")}, {Cmd: exec.Command("touch", "ran")}}
+
+	start := time.Now()
+	err = l.Execute(dir, WithContext(ctx), WithRetries(3, time.Minute))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", context.Canceled, err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Lifecycle.Execute returned after %v, command not killed", d)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+		t.Errorf("command after the cancellation ran")
+	}
+}
+
+func TestExecuteDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	l := Lifecycle{
+		{Cmd: exec.Command("false")},
+		{},
+		{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--image="+uniqueGCRURL)},
+		pipeline(exec.Command("echo", "hello"), exec.Command("grep", "hello")),
+	}
+
+	if err := l.Execute(os.TempDir(), WithDryRun(true)); err != nil {
+		t.Fatalf("Lifecycle.Execute: %v", err)
+	}
+
+	for _, want := range []string{"false", "run deploy " + uniqueServiceName + " --image=" + uniqueGCRURL, "echo hello | "} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("dry run output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestLifecycleString(t *testing.T) {
+	l := Lifecycle{
+		{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag="+uniqueGCRURL)},
+		{},
+		failureIgnoredCommand(exec.Command("echo", "a b")),
+		andNextCommand(exec.Command("true")),
+		pipeline(commandWithEnv(exec.Command("echo", "it's"), "FOO=bar baz"), exec.Command("grep", "it")),
+	}
+
+	want := "gcloud --quiet builds submit --tag=" + uniqueGCRURL + "\n" +
+		"echo 'a b' ;\n" +
+		"true &&\n" +
+		`FOO='bar baz' echo 'it'\''s' | grep it`
+	if got := l.String(); got != want {
+		t.Errorf("result mismatch\nwant: %s\ngot: %s", want, got)
+	}
+}
+
+func TestLifecycleDeploysFromSource(t *testing.T) {
+	image := Lifecycle{
+		{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag="+uniqueGCRURL)},
+		{},
+		{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--image="+uniqueGCRURL)},
+	}
+	if image.DeploysFromSource() {
+		t.Errorf("lifecycle deploying an image reported as deploying from source")
+	}
+
+	deploy := exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--source", ".")
+	source := append(image, Step{Cmd: deploy})
+	if !source.DeploysFromSource() {
+		t.Errorf("lifecycle deploying from source not reported as such")
+	}
+}
+
+type codeTagTest struct {
+	opts []ParseOption // options passed to NewLifecycle
+	cmds Lifecycle     // expected result of NewLifecycle
+}
+
+var codeTagTests = []codeTagTest{
+	// custom code tag
+	{
+		opts: []ParseOption{WithCodeTag("{run-and-test}")},
+		cmds: Lifecycle{{Cmd: exec.Command("echo", "custom")}},
+	},
+
+	// default code tag
+	{
+		cmds: Lifecycle{{Cmd: exec.Command("echo", "default")}},
+	},
+}
+
+func TestNewLifecycleCodeTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	readme := "[//]: # ({run-and-test})\n```\necho custom\n```\n\n" +
+		"[//]: # (" + codeTagForOS(runtime.GOOS) + ")\n```\necho default\n```\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte(readme), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	for i, tc := range codeTagTests {
+		l, err := NewLifecycle(dir, uniqueServiceName, uniqueGCRURL, tc.opts...)
+		if err != nil {
+			t.Errorf("#%d: NewLifecycle: %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(l, tc.cmds) {
+			t.Errorf("#%d: result mismatch\nwant: %v\ngot: %v", i, tc.cmds, l)
+		}
+	}
+}
+
+type configTest struct {
+	config string    // content of the sample's config file
+	cmds   Lifecycle // expected result of NewLifecycle
+	err    error     // expected error wrapped by NewLifecycle's error
+}
+
+var configTests = []configTest{
+	// commands take precedence over the README's
+	{
+		config: "commands:\n  - gcloud builds submit --tag=gcr.io/project/sample\n  - gcloud run deploy sample --image=gcr.io/project/sample\n",
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag="+uniqueGCRURL)},
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--image="+uniqueGCRURL)},
+		},
+	},
+
+	// no commands
+	{
+		config: "commands: []\n",
+		err:    errNoConfigCommands,
+	},
+}
+
+func TestNewLifecycleConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	readme := "[//]: # (" + codeTagForOS(runtime.GOOS) + ")\n```\necho readme\n```\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte(readme), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	for i, tc := range configTests {
+		if err := ioutil.WriteFile(filepath.Join(dir, ConfigFileName), []byte(tc.config), 0644); err != nil {
+			t.Fatalf("#%d: ioutil.WriteFile: %v", i, err)
+		}
+
+		l, err := NewLifecycle(dir, uniqueServiceName, uniqueGCRURL)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(l, tc.cmds) {
+			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.cmds, l)
+		}
+	}
+
+	// without a config file, the README's commands are used again
+	if err := os.Remove(filepath.Join(dir, ConfigFileName)); err != nil {
+		t.Fatalf("os.Remove: %v", err)
+	}
+
+	l, err := NewLifecycle(dir, uniqueServiceName, uniqueGCRURL)
+	if err != nil {
+		t.Fatalf("NewLifecycle: %v", err)
+	}
+	if want := (Lifecycle{{Cmd: exec.Command("echo", "readme")}}); !reflect.DeepEqual(l, want) {
+		t.Errorf("result mismatch\nwant: %#+v\ngot: %#+v", want, l)
+	}
+}
+
+type checkREADMETest struct {
+	files map[string]string // files of the sample's directory, by path relative to it
+	dirs  []string          // directories of the sample's directory, relative to it
+	opts  []ParseOption     // options passed to CheckREADME
+	err   error             // expected error wrapped by CheckREADME's error
+	fail  bool              // whether CheckREADME should return an error
+}
+
+var checkREADMETests = []checkREADMETest{
+	// README
+	{
+		files: map[string]string{"README.md": "# Sample\n"},
+	},
+
+	// config file instead of a README
+	{
+		files: map[string]string{ConfigFileName: "commands: []\n"},
+	},
+
+	// Dockerfile to fall back on
+	{
+		files: map[string]string{"Dockerfile": "FROM scratch\n"},
+	},
+
+	// nothing at all
+	{
+		err:  ErrREADMENotFound,
+		fail: true,
+	},
+
+	// README location set in config.yaml
+	{
+		files: map[string]string{"config.yaml": "readme: docs/README.md\n", "docs/README.md": "# Sample\n"},
+	},
+
+	// missing README location set in config.yaml, even with a Dockerfile
+	{
+		files: map[string]string{"config.yaml": "readme: docs/README.md\n", "Dockerfile": "FROM scratch\n"},
+		err:   ErrREADMENotFound,
+		fail:  true,
+	},
+
+	// README that's a directory
+	{
+		dirs: []string{"README.md"},
+		fail: true,
+	},
+
+	// README set with WithREADME
+	{
+		files: map[string]string{"RUNNING.md": "# Running\n"},
+		opts:  []ParseOption{WithREADME("RUNNING.md")},
+	},
+
+	// missing README set with WithREADME, even with a README.md
+	{
+		files: map[string]string{"README.md": "# Sample\n"},
+		opts:  []ParseOption{WithREADME("docs/quickstart.md")},
+		err:   ErrREADMENotFound,
+		fail:  true,
+	},
+}
+
+func TestCheckREADME(t *testing.T) {
+	for i, tc := range checkREADMETests {
+		dir, err := ioutil.TempDir("", "lifecycle")
+		if err != nil {
+			t.Fatalf("ioutil.TempDir: %v", err)
+		}
+
+		for _, d := range tc.dirs {
+			if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+				t.Fatalf("os.MkdirAll: %v", err)
+			}
+		}
+		for name, content := range tc.files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("os.MkdirAll: %v", err)
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("ioutil.WriteFile: %v", err)
+			}
+		}
+
+		err = CheckREADME(dir, tc.opts...)
+		os.RemoveAll(dir)
+
+		if (err != nil) != tc.fail || (tc.err != nil && !errors.Is(err, tc.err)) {
+			t.Errorf("#%d: error mismatch\nwant: %v (fail: %t)\ngot: %v", i, tc.err, tc.fail, err)
+		}
+	}
+}
+
+func TestNewLifecycleREADMEOption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tag := codeTagForOS(runtime.GOOS)
+	files := map[string]string{
+		"README.md":          "[//]: # (" + tag + ")\n```\necho readme\n```\n",
+		"docs/quickstart.md": "[//]: # (" + tag + ")\n```\necho quickstart\n```\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+
+	l, err := NewLifecycle(dir, uniqueServiceName, uniqueGCRURL, WithREADME("docs/quickstart.md"))
+	if err != nil {
+		t.Fatalf("NewLifecycle: %v", err)
+	}
+
+	want := Lifecycle{{Cmd: exec.Command("echo", "quickstart")}}
+	if !reflect.DeepEqual(l, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, l)
+	}
+}
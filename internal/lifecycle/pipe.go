@@ -0,0 +1,181 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// execPipeline executes the pipeline of the provided Step in the provided directory, like util.ExecCommand does for a
+// single command: each upstream command's standard output is connected to the standard input of the command after it
+// through an os.Pipe, like a `|` in a shell. Every upstream command is started before the Step's command runs and
+// waited for once it exits, so none is left behind. Like in a shell with `set -o pipefail`, a failing command anywhere
+// in the pipeline fails it, even if the commands after it succeed; the error of the Step's command is returned first.
+// An upstream command killed by SIGPIPE because the commands after it exited before reading all of its output, like
+// `yes` in `yes | head -1`, isn't a failure.
+func execPipeline(st Step, dir string) error {
+	if len(st.Upstream) == 0 {
+		_, err := util.ExecCommand(st.Cmd, dir)
+		return err
+	}
+
+	stderrs := make([]bytes.Buffer, len(st.Upstream))
+	var started []*exec.Cmd
+	var stdin *os.File
+	for i, c := range st.Upstream {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeFile(stdin)
+			killPipeline(started)
+			return fmt.Errorf("os.Pipe: %w", err)
+		}
+
+		c.Dir = dir
+		c.Stdout = w
+		c.Stderr = &stderrs[i]
+		if stdin != nil {
+			c.Stdin = stdin
+		}
+
+		err = c.Start()
+		w.Close()
+		closeFile(stdin)
+		stdin = r
+		if err != nil {
+			closeFile(stdin)
+			killPipeline(started)
+			return fmt.Errorf("exec.Cmd.Start: %v: %w", c, err)
+		}
+		started = append(started, c)
+	}
+
+	st.Cmd.Stdin = stdin
+	_, err := util.ExecCommand(st.Cmd, dir)
+	closeFile(stdin)
+
+	for i, c := range started {
+		werr := c.Wait()
+		if werr == nil || err != nil || killedBySIGPIPE(werr) {
+			continue
+		}
+
+		stderr := util.TailLines(strings.TrimSpace(stderrs[i].String()), util.CommandOutputTailLines)
+		err = fmt.Errorf("pipeline command %v:\n%s\n%w", c, stderr, werr)
+	}
+
+	return err
+}
+
+// closeFile closes the provided file, if any.
+func closeFile(f *os.File) {
+	if f != nil {
+		f.Close()
+	}
+}
+
+// killPipeline kills the provided started commands and waits for them to exit.
+func killPipeline(cmds []*exec.Cmd) {
+	for _, c := range cmds {
+		c.Process.Kill()
+		c.Wait()
+	}
+}
+
+// killedBySIGPIPE reports whether the provided exec.Cmd.Wait error is that of a command killed by SIGPIPE.
+func killedBySIGPIPE(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGPIPE
+}
+
+// pipelineString returns the commands of the pipeline of the provided Step, separated by ` | `.
+func pipelineString(st Step) string {
+	var commands []string
+	for _, c := range st.commands() {
+		commands = append(commands, c.String())
+	}
+
+	return strings.Join(commands, " | ")
+}
+
+// pipelineCommandLine returns the pipeline of the provided Step as a shell-escaped command line that can be pasted into
+// a terminal, including the leading environment variable assignments of each command.
+func pipelineCommandLine(st Step) string {
+	var lines []string
+	for _, c := range st.commands() {
+		lines = append(lines, commandLine(c))
+	}
+
+	return strings.Join(lines, " | ")
+}
+
+// commandLine returns the provided command as a shell-escaped command line, prefixed with its environment variable
+// assignments that aren't part of the program's environment.
+func commandLine(c *exec.Cmd) string {
+	inherited := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		inherited[kv] = true
+	}
+
+	var words []string
+	for _, kv := range c.Env {
+		if inherited[kv] {
+			continue
+		}
+
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			words = append(words, kv[:i+1]+quoteWord(kv[i+1:]))
+		}
+	}
+	for _, arg := range c.Args {
+		words = append(words, quoteWord(arg))
+	}
+
+	return strings.Join(words, " ")
+}
+
+// cloneStep returns a copy of the provided Step whose commands, including the upstream commands of its pipeline, are
+// unstarted copies that are killed once the provided context is done. An exec.Cmd can't be reused once it has run.
+func cloneStep(ctx context.Context, st Step) Step {
+	clone := st
+	clone.Cmd = cloneCommand(ctx, st.Cmd)
+	clone.Upstream = nil
+	for _, c := range st.Upstream {
+		clone.Upstream = append(clone.Upstream, cloneCommand(ctx, c))
+	}
+
+	return clone
+}
+
+// cloneCommand returns an unstarted copy of the provided command that's killed once the provided context is done.
+func cloneCommand(ctx context.Context, c *exec.Cmd) *exec.Cmd {
+	clone := exec.CommandContext(ctx, c.Path)
+	clone.Args = c.Args
+	clone.Env = c.Env
+
+	return clone
+}
@@ -18,50 +18,90 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"log"
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
 )
 
 const (
 	// The tag that should appear immediately before code blocks in a README to indicate that the enclosed commands
-	// are to be used by this program for building and deploying the sample.
-	codeTag = "{sst-run-unix}"
+	// are to be used by this program for building and deploying the sample on platforms without an entry in codeTags.
+	defaultCodeTag = "{sst-run-unix}"
 
 	// A non-quoted backslash in bash at the end of a line indicates a line continuation from the current line to the
 	// next line.
 	bashLineContChar = '\\'
+
+	// A line starting with this character is a comment.
+	commentChar = '#'
 )
 
+// codeTags maps runtime.GOOS values to the tag that should appear immediately before code blocks in a README to
+// indicate that the enclosed commands are to be used by this program for building and deploying the sample on that
+// platform. This lets a single README carry command variants for several platforms.
+var codeTags = map[string]string{
+	"windows": "{sst-run-windows}",
+}
+
 var (
-	gcloudCommandRegexp   = regexp.MustCompile(`^gcloud\b`)
-	cloudRunCommandRegexp = regexp.MustCompile(`\brun\b`)
+	// projectIDCommandRegexp matches the `$(gcloud config get-value project)` command substitution, which prints the
+	// gcloud default project.
+	projectIDCommandRegexp = regexp.MustCompile(`\$\(\s*gcloud\s+config\s+get-value\s+(core/)?project\s*\)`)
 
-	gcrURLRegexp = regexp.MustCompile(`gcr.io/.+/\S+`)
+	// projectIDPlaceholderRegexp matches the words commonly used as project ID placeholders in READMEs.
+	projectIDPlaceholderRegexp = regexp.MustCompile(`\[(YOUR_)?PROJECT_ID\]|<(YOUR_)?PROJECT_ID>|\b(YOUR_)?PROJECT_ID\b`)
 
+	// defaultRegistryHosts match the hosts of Container Registry, e.g. gcr.io and us.gcr.io, and of Artifact Registry,
+	// e.g. us-docker.pkg.dev and europe-west1-docker.pkg.dev.
+	defaultRegistryHosts = []string{`([a-z0-9-]+\.)?gcr\.io`, `[a-z0-9-]+-docker\.pkg\.dev`}
+
+	// mdCodeFenceStartRegexp matches the opening fence of a code block: three or more backticks, optionally followed by
+	// a language info string such as bash or sh.
 	mdCodeFenceStartRegexp = regexp.MustCompile("^\\w*`{3,}[^`]*$")
 
-	errNoReadmeCodeBlocksFound   = fmt.Errorf("lifecycle.extractCodeBlocks: no code blocks immediately preceded by %s found", codeTag)
+	envAssignmentRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+	envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	errNoReadmeCodeBlocksFound   = fmt.Errorf("lifecycle.extractCodeBlocks: no code blocks immediately preceded by code tag found")
 	errCodeBlockNotClosed        = fmt.Errorf("unexpected EOF: code block not closed")
 	errCodeBlockStartNotFound    = fmt.Errorf("expecting start of code block immediately after code tag")
 	errEOFAfterCodeTag           = fmt.Errorf("unexpected EOF: file ended immediately after code tag")
-	errCodeBlockEndAfterLineCont = "end of code block: expecting command line continuation"
+	errEmptyAnnotatedBlock       = fmt.Errorf("code block immediately preceded by code tag holds no commands")
+	errUnsetEnvVars              = fmt.Errorf("code blocks reference unset environment variables")
+	errCodeBlockEndAfterLineCont = fmt.Errorf("end of code block: expecting command line continuation")
+	errCommentAfterLineCont      = fmt.Errorf("comment line: expecting command line continuation")
 )
 
 // codeBlock is a slice of strings containing terminal commands. codeBlocks, for example, could be used to hold the
 // terminal commands inside of a Markdown code block.
 type codeBlock []string
 
-// toCommands extracts the terminal commands contained within the current codeBlock. It handles the expansion of
-// environment variables and line continuations. It also detects Cloud Run service names Google Container Registry
-// container image URLs and replaces them with the ones provided.
-func (cb codeBlock) toCommands(serviceName, gcrURL string) ([]*exec.Cmd, error) {
-	var cmds []*exec.Cmd
+// toCommands extracts the terminal commands contained within the current codeBlock, skipping blank lines and comment
+// lines starting with `#`. It handles the expansion of environment variables, line continuations, shell-like quoting
+// (see splitWords), and leading `NAME=value` environment variable assignments, which are only applied to the command
+// they precede. Commands separated by `|` are chained into a pipeline, which is returned as a single Step. Commands
+// separated by `&&` or `;` on a single line are returned as separate Steps, marked with the separator that follows them
+// (see Step). It also detects Cloud Run service names and Container Registry or Artifact Registry container image URLs
+// and replaces them with the ones provided.
+func (cb codeBlock) toCommands(serviceName, gcrURL string) (Lifecycle, error) {
+	cmds, _, err := cb.toExplainedCommands(serviceName, gcrURL, newParseOptions(nil))
+	return cmds, err
+}
+
+// toExplainedCommands does the same as toCommands according to the provided parseOptions, and also returns an
+// Explanation of the transformations applied to each command. If a region is set, the commands' regions are replaced
+// with it (see replaceRegion).
+func (cb codeBlock) toExplainedCommands(serviceName, gcrURL string, o *parseOptions) (Lifecycle, []Explanation, error) {
+	var cmds Lifecycle
+	var explanations []Explanation
 
 	for i := 0; i < len(cb); i++ {
 		line := cb[i]
-		if line == "" {
+		if line == "" || line[0] == commentChar {
 			continue
 		}
 
@@ -72,7 +112,7 @@ func (cb codeBlock) toCommands(serviceName, gcrURL string) ([]*exec.Cmd, error)
 
 			i++
 			if i >= len(cb) {
-				return nil, fmt.Errorf("%s; code block dump:\n%s", errCodeBlockEndAfterLineCont, strings.Join(cb, "\n"))
+				return nil, nil, fmt.Errorf("%w; code block dump:\n%s", errCodeBlockEndAfterLineCont, strings.Join(cb, "\n"))
 			}
 
 			l := cb[i]
@@ -80,75 +120,445 @@ func (cb codeBlock) toCommands(serviceName, gcrURL string) ([]*exec.Cmd, error)
 				break
 			}
 
+			// A comment line is never consumed as a continuation. Bash would end the command at the comment, silently
+			// dropping any continued lines after it, so this is most likely a mistake in the README.
+			if l[0] == commentChar {
+				return nil, nil, fmt.Errorf("%w; code block dump:\n%s", errCommentAfterLineCont, strings.Join(cb, "\n"))
+			}
+
 			line = line + l
 		}
 
-		line = os.ExpandEnv(line)
-		line = gcrURLRegexp.ReplaceAllString(line, gcrURL)
-		line = replaceServiceName(line, serviceName)
-		sp := strings.Split(line, " ")
+		list, err := splitCommandList(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", err, line)
+		}
+
+		for _, lc := range list {
+			st, e, err := toListCommand(strings.TrimSpace(lc.line), serviceName, gcrURL, o)
+			if err != nil {
+				return nil, nil, err
+			}
+			if st.Cmd == nil {
+				continue
+			}
+
+			st.IgnoreFailure, st.AndNext = lc.ignoreFailure, lc.andNext
+			cmds = append(cmds, st)
+			explanations = append(explanations, e)
+		}
+	}
+
+	return cmds, explanations, nil
+}
+
+// toListCommand builds the Step for a single command of a code block line's command list (see splitCommandList),
+// which may be a pipeline, along with an Explanation of the transformations applied to it. It returns a Step with a nil
+// Cmd if the line holds no words.
+func toListCommand(line, serviceName, gcrURL string, o *parseOptions) (Step, Explanation, error) {
+	e := Explanation{Source: line}
+
+	if o.projectID != "" {
+		replaced := replaceProjectID(line, o.projectID)
+		e.add(TransformProjectID, line, replaced)
+		line = replaced
+	}
+
+	expanded := expandLineEnv(line, o.lookupEnv)
+	e.add(TransformEnvExpansion, line, expanded)
+	line = expanded
+
+	stages, err := splitPipeline(line)
+	if err != nil {
+		return Step{}, e, fmt.Errorf("%w: %s", err, line)
+	}
+
+	if len(stages) == 1 && len(stages[0]) == 0 {
+		return Step{}, e, nil
+	}
 
-		var cmd *exec.Cmd
-		if sp[0] == "gcloud" {
-			a := append(util.GcloudCommonFlags, sp[1:]...)
-			cmd = exec.Command("gcloud", a...)
-		} else {
-			cmd = exec.Command(sp[0], sp[1:]...)
+	var st Step
+	var commands []string
+	for _, args := range stages {
+		c, command := toCommand(args, serviceName, gcrURL, o, &e)
+		if st.Cmd != nil {
+			st.Upstream = append(st.Upstream, st.Cmd)
 		}
 
-		cmds = append(cmds, cmd)
+		st.Cmd = c
+		commands = append(commands, command)
 	}
+	e.Command = strings.Join(commands, " | ")
 
-	return cmds, nil
+	return st, e, nil
+}
+
+// toCommand builds the exec.Cmd for a single command of a code block line from its words, recording the
+// transformations applied to it in the provided Explanation. It returns the command along with its explained form.
+func toCommand(args []string, serviceName, gcrURL string, o *parseOptions, e *Explanation) (*exec.Cmd, string) {
+	var env []string
+	env, args = splitEnvAssignments(args)
+
+	if o.region != "" {
+		before := strings.Join(append(append([]string(nil), env...), args...), " ")
+		env, args = replaceRegion(env, args, o.region)
+		e.add(TransformRegion, before, strings.Join(append(append([]string(nil), env...), args...), " "))
+	}
+
+	for j, a := range args {
+		args[j] = expandTilde(a)
+		e.add(TransformTildeExpansion, a, args[j])
+	}
+
+	// source deploys build their own container image, so any registry URL in them isn't the sample's image
+	if !isSourceDeploy(args) {
+		for j, a := range args {
+			args[j] = o.imageURLRegexp.ReplaceAllLiteralString(a, gcrURL)
+			e.add(TransformImageURL, a, args[j])
+		}
+	}
+
+	before := append([]string(nil), args...)
+	args = replaceServiceName(args, serviceName)
+	for j := range args {
+		e.add(TransformServiceName, before[j], args[j])
+	}
+
+	var cmd *exec.Cmd
+	if util.IsGcloud(args[0]) {
+		a := append(append([]string(nil), util.GcloudCommonFlags...), args[1:]...)
+		quieted := strings.Join(append([]string{util.GcloudPath}, a...), " ")
+		e.add(TransformQuietInjected, strings.Join(args, " "), quieted)
+
+		if len(o.gcloudFlags) > 0 {
+			n := len(util.GcloudCommonFlags)
+			a = append(append(append([]string(nil), a[:n]...), o.gcloudFlags...), a[n:]...)
+			e.add(TransformGcloudFlags, quieted, strings.Join(append([]string{util.GcloudPath}, a...), " "))
+		}
+
+		cmd = exec.Command(util.GcloudPath, a...)
+	} else {
+		cmd = exec.Command(args[0], args[1:]...)
+	}
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	return cmd, strings.Join(append(append([]string(nil), env...), cmd.Args...), " ")
+}
+
+// expandEnv replaces ${var} or $var in the provided string according to the values of the current environment
+// variables, like os.ExpandEnv. It also supports the POSIX parameter expansion forms ${var:-default}, which expands to
+// default if var is unset or empty, and ${var:+alt}, which expands to alt if var is set and not empty. Unset variables
+// expand to the empty string.
+func expandEnv(s string) string {
+	return os.Expand(s, func(param string) string {
+		return envValue(param, os.LookupEnv)
+	})
+}
+
+// envValue returns the value the provided parameter of an environment variable reference, such as FOO or FOO:-default
+// in ${FOO:-default}, expands to (see expandEnv), looking up the variables' values with the provided function.
+func envValue(param string, lookup func(string) (string, bool)) string {
+	if i := strings.Index(param, ":-"); i >= 0 {
+		if v, _ := lookup(param[:i]); v != "" {
+			return v
+		}
+		return param[i+2:]
+	}
+
+	if i := strings.Index(param, ":+"); i >= 0 {
+		if v, _ := lookup(param[:i]); v != "" {
+			return param[i+2:]
+		}
+		return ""
+	}
+
+	v, _ := lookup(param)
+	return v
+}
+
+// replaceProjectID replaces the project ID placeholders in the provided terminal command line with the provided project
+// ID (see WithProjectID). A placeholder word isn't replaced if it's part of an environment variable reference, such as
+// $PROJECT_ID or ${PROJECT_ID:-default}, or followed by `=`, as in an assignment.
+func replaceProjectID(line, projectID string) string {
+	line = projectIDCommandRegexp.ReplaceAllLiteralString(line, projectID)
+
+	var b strings.Builder
+	last := 0
+	for _, m := range projectIDPlaceholderRegexp.FindAllStringIndex(line, -1) {
+		if m[0] > 0 && strings.IndexByte("${", line[m[0]-1]) >= 0 {
+			continue
+		}
+		if m[1] < len(line) && line[m[1]] == '=' {
+			continue
+		}
+
+		b.WriteString(line[last:m[0]])
+		b.WriteString(projectID)
+		last = m[1]
+	}
+	b.WriteString(line[last:])
+
+	return b.String()
+}
+
+// expandLineEnv expands the environment variables of a terminal command line like expandEnv, except where a shell
+// wouldn't: inside single quotes, such as `'${FOO}'`, or after a backslash, as in `\$FOO`, variable references are left
+// as they are, to be passed to the command literally. References outside of quotes or inside double quotes, such as
+// `"${FOO}"`, are expanded, looking up the variables' values with the provided function. Like in a shell, the expanded
+// values are never parsed as shell syntax when the line is split into words later: their quotes, backslashes, `|`, `&&`
+// and `;` are escaped (see escapeEnvValue). Only the spaces and tabs of values expanded outside of quotes still
+// separate words.
+func expandLineEnv(line string, lookup func(string) (string, bool)) string {
+	return mapLineEnv(line, func(s string, quoted bool) string {
+		return os.Expand(s, func(param string) string {
+			return escapeEnvValue(envValue(param, lookup), quoted)
+		})
+	})
+}
+
+// escapeEnvValue escapes the provided value of an environment variable expanded in a terminal command line with
+// backslashes, so that splitWords and splitPipeline keep its characters literally. Inside double quotes, only the
+// characters a backslash escapes there are escaped. Outside of quotes, every character but spaces and tabs that
+// isn't one of the shellSafeChars is.
+func escapeEnvValue(v string, quoted bool) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case quoted && strings.IndexByte(doubleQuoteEscapable, c) >= 0,
+			!quoted && c != ' ' && c != '\t' && strings.IndexByte(shellSafeChars, c) < 0:
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// mapLineEnv replaces the parts of a terminal command line where a shell would expand environment variables -- outside
+// of single quotes and not escaped by a backslash -- by the result of calling expand on them, along with whether they
+// are inside double quotes. The other parts are left as they are.
+func mapLineEnv(line string, expand func(s string, quoted bool) string) string {
+	var out, seg strings.Builder
+	inDouble := false
+	flush := func() {
+		out.WriteString(expand(seg.String(), inDouble))
+		seg.Reset()
+	}
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line):
+			flush()
+			out.WriteString(line[i : i+2])
+			i++
+
+		case c == '\'' && !inDouble:
+			flush()
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				// left for splitWords to report the unterminated quote
+				out.WriteString(line[i:])
+				return out.String()
+			}
+			out.WriteString(line[i : i+end+2])
+			i += end + 1
+
+		case c == '"':
+			flush()
+			inDouble = !inDouble
+			out.WriteByte(c)
+
+		default:
+			seg.WriteByte(c)
+		}
+	}
+	flush()
+
+	return out.String()
+}
+
+// unsetEnvReferences returns the sorted names of the unset environment variables referenced by the commands of the
+// provided code blocks, where they would expand to the empty string and most likely produce broken commands. The
+// commands are checked the way they're parsed according to the provided parseOptions: after their project ID
+// placeholders are replaced, and with the projectIDEnvVars set to the project ID (see WithProjectID). References with a
+// default value, like ${FOO:-default}, or an alternate value, like ${FOO:+alt}, are fine unset, as are references left
+// unexpanded in single quotes or after a backslash, those in comment lines, and those inside container image URLs,
+// which are replaced with the sample's own.
+func unsetEnvReferences(blocks []codeBlock, o *parseOptions) []string {
+	unset := map[string]bool{}
+	find := func(s string, quoted bool) string {
+		os.Expand(s, func(param string) string {
+			if envNameRegexp.MatchString(param) {
+				if _, ok := o.lookupEnv(param); !ok {
+					unset[param] = true
+				}
+			}
+			return ""
+		})
+		return s
+	}
+
+	for _, b := range blocks {
+		for i := 0; i < len(b); i++ {
+			line := b[i]
+			if line == "" || line[0] == commentChar {
+				continue
+			}
+
+			// continued lines are joined, so that a source deploy's image URL is recognized as such
+			for line[len(line)-1] == bashLineContChar && i+1 < len(b) && b[i+1] != "" && b[i+1][0] != commentChar {
+				i++
+				line = line[:len(line)-1] + b[i]
+			}
+
+			if o.projectID != "" {
+				line = replaceProjectID(line, o.projectID)
+			}
+			if !isSourceDeploy(strings.Fields(line)) {
+				// escaped, the references are skipped like those a shell wouldn't expand
+				line = o.imageURLRegexp.ReplaceAllStringFunc(line, func(url string) string {
+					return strings.ReplaceAll(url, "$", `\$`)
+				})
+			}
+
+			mapLineEnv(line, find)
+		}
+	}
+
+	names := make([]string, 0, len(unset))
+	for name := range unset {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// expandTilde replaces a leading `~` in the provided word, if it's the whole word or followed by a `/`, with the
+// current user's home directory, like a shell does. The `~user` form, which refers to another user's home directory,
+// isn't supported and is left untouched, as is the word if the home directory can't be determined.
+func expandTilde(word string) string {
+	if word != "~" && !strings.HasPrefix(word, "~/") {
+		return word
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return word
+	}
+
+	return home + word[1:]
+}
+
+// splitEnvAssignments splits the leading `NAME=value` environment variable assignments off of a terminal command's
+// arguments, the way a shell does for assignments that should only apply to a single command. It returns the
+// assignments and the remaining arguments.
+func splitEnvAssignments(args []string) ([]string, []string) {
+	i := 0
+	for i < len(args)-1 && envAssignmentRegexp.MatchString(args[i]) {
+		i++
+	}
+
+	return args[:i], args[i:]
+}
+
+// codeTagForOS returns the code tag that annotates code blocks with commands for the provided runtime.GOOS value.
+func codeTagForOS(goos string) string {
+	if t, ok := codeTags[goos]; ok {
+		return t
+	}
+
+	return defaultCodeTag
 }
 
 // parseREADME parses a README file with the given name. It parses terminal commands in code blocks annotated by the
-// codeTag and loads them into a Lifecycle. In the process, it replaces the Cloud Run service name and Container
-// Registry tag with the provided inputs. It also expands environment variables and supports bash-style line
-// continuations.
+// code tag for the current platform and loads them into a Lifecycle. In the process, it replaces the Cloud Run service
+// name and Container Registry tag with the provided inputs, whose environment variables are expanded like those of
+// commands. It also expands environment variables and supports bash-style line continuations.
 func parseREADME(filename, serviceName, gcrURL string) (Lifecycle, error) {
+	l, _, err := parseExplainedREADME(filename, serviceName, gcrURL, newParseOptions(nil))
+	return l, err
+}
+
+// parseExplainedREADME does the same as parseREADME according to the provided parseOptions, and also returns an
+// Explanation of the transformations applied to each command.
+func parseExplainedREADME(filename, serviceName, gcrURL string, o *parseOptions) (Lifecycle, []Explanation, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return nil, fmt.Errorf("os.Open: %w", err)
+		return nil, nil, fmt.Errorf("os.Open: %w", err)
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 
-	return extractLifecycle(scanner, serviceName, gcrURL)
+	return extractExplainedLifecycle(scanner, serviceName, gcrURL, o)
 }
 
 // extractLifecycle is a helper function for parseREADME. It takes a scanner that reads from a Markdown file and parses
-// terminal commands in code blocks annotated by the codeTag and loads them into a Lifecycle. In the process, it
-// replaces the Cloud Run service name and Container Registry tag with the provided inputs. It also expands environment
-// variables and supports bash-style line continuations.
+// terminal commands in code blocks annotated by the code tag for the current platform (see codeTagForOS) and loads
+// them into a Lifecycle. Code blocks annotated for other platforms are ignored. In the process, it
+// replaces the Cloud Run service name and Container Registry tag with the provided inputs, after expanding the
+// environment variables in them the same way as in commands. It also expands environment variables and supports
+// bash-style line continuations.
 func extractLifecycle(scanner *bufio.Scanner, serviceName, gcrURL string) (Lifecycle, error) {
-	codeBlocks, err := extractCodeBlocks(scanner)
+	l, _, err := extractExplainedLifecycle(scanner, serviceName, gcrURL, newParseOptions(nil))
+	return l, err
+}
+
+// extractExplainedLifecycle does the same as extractLifecycle according to the provided parseOptions, and also returns
+// an Explanation of the transformations applied to each command.
+func extractExplainedLifecycle(scanner *bufio.Scanner, serviceName, gcrURL string, o *parseOptions) (Lifecycle, []Explanation, error) {
+	serviceName, gcrURL = expandEnv(serviceName), expandEnv(gcrURL)
+
+	codeBlocks, err := extractCodeBlocks(scanner, o.codeTag)
 	if err != nil {
-		return nil, fmt.Errorf("lifecycle.extractCodeBlocks: %w", err)
+		return nil, nil, fmt.Errorf("lifecycle.extractCodeBlocks: %w", err)
 	}
 
 	if len(codeBlocks) == 0 {
-		return nil, errNoReadmeCodeBlocksFound
+		return nil, nil, fmt.Errorf("%w: %s", errNoReadmeCodeBlocksFound, o.codeTag)
+	}
+
+	// caught before anything is deployed, rather than through the broken commands they would expand to
+	if unset := unsetEnvReferences(codeBlocks, o); len(unset) > 0 {
+		err := fmt.Errorf("%w: %s: set them, or give them a default like ${VAR:-default}", errUnsetEnvVars,
+			strings.Join(unset, ", "))
+		if !o.unsetEnvWarnings {
+			return nil, nil, err
+		}
+		log.Printf("Warning: %v\n", err)
 	}
 
 	var l Lifecycle
-	for _, b := range codeBlocks {
-		cmds, err := b.toCommands(serviceName, gcrURL)
+	var explanations []Explanation
+	for i, b := range codeBlocks {
+		cmds, e, err := b.toExplainedCommands(serviceName, gcrURL, o)
 		if err != nil {
-			return l, fmt.Errorf("codeBlock.toCommands: %w", err)
+			return l, explanations, fmt.Errorf("codeBlock.toCommands: %w", err)
+		}
+
+		// an annotated block without commands is most likely misformatted, and would silently skip a build step
+		if len(cmds) == 0 {
+			return l, explanations, fmt.Errorf("code block #%d: %w", i+1, errEmptyAnnotatedBlock)
 		}
 
 		l = append(l, cmds...)
+		explanations = append(explanations, e...)
 	}
 
-	return l, nil
+	warnStaleServiceNames(explanations)
+	return l, explanations, nil
 }
 
 // codeBlocks extracts code blocks out of a bufio.Scanner that's reading from a Markdown file immediately prefaced with
-// a line containing codeTag. It returns an 2d slice of code blocks, each containing an array of lines contained within
-// that code block.
-func extractCodeBlocks(scanner *bufio.Scanner) ([]codeBlock, error) {
+// a line containing the provided code tag. It returns an 2d slice of code blocks, each containing an array of lines
+// contained within that code block. Lines may end with either LF or CRLF. Its errors are ParseErrors carrying the
+// number and text of the offending line.
+func extractCodeBlocks(scanner *bufio.Scanner, tag string) ([]codeBlock, error) {
 	var blocks []codeBlock
 
 	lineNum := 0
@@ -156,23 +566,25 @@ func extractCodeBlocks(scanner *bufio.Scanner) ([]codeBlock, error) {
 		lineNum++
 		line := scanner.Text()
 
-		if strings.Contains(line, codeTag) {
+		if strings.Contains(line, tag) {
 			if s := scanner.Scan(); !s {
 				if err := scanner.Err(); err != nil {
-					return nil, fmt.Errorf("line %d: bufio.Scanner.Scan: %w", lineNum, err)
+					return nil, &ParseError{Line: lineNum, Err: fmt.Errorf("bufio.Scanner.Scan: %w", err)}
 				}
-				return nil, errEOFAfterCodeTag
+				return nil, &ParseError{Line: lineNum, Text: line, Err: errEOFAfterCodeTag}
 			}
 			lineNum++
 
 			startCodeBlockLine := scanner.Text()
 			m := mdCodeFenceStartRegexp.MatchString(startCodeBlockLine)
 			if !m {
-				return nil, fmt.Errorf("line %d: %w", lineNum, errCodeBlockStartNotFound)
+				return nil, &ParseError{Line: lineNum, Text: startCodeBlockLine, Err: errCodeBlockStartNotFound}
 			}
 
+			startLineNum := lineNum
+			// the closing fence is bare backticks, at least as many as the opening fence's
 			c := strings.Count(startCodeBlockLine, "`")
-			mdCodeFenceEndRegexp := regexp.MustCompile(fmt.Sprintf("^\\w*`{%d,}\\w*$", c))
+			mdCodeFenceEndRegexp := regexp.MustCompile(fmt.Sprintf("^`{%d,}$", c))
 
 			var block codeBlock
 			var blockClosed bool
@@ -188,11 +600,11 @@ func extractCodeBlocks(scanner *bufio.Scanner) ([]codeBlock, error) {
 			}
 
 			if err := scanner.Err(); err != nil {
-				return nil, fmt.Errorf("line %d: bufio.Scanner.Scan: %w", lineNum, err)
+				return nil, &ParseError{Line: lineNum, Err: fmt.Errorf("bufio.Scanner.Scan: %w", err)}
 			}
 
 			if !blockClosed {
-				return nil, errCodeBlockNotClosed
+				return nil, &ParseError{Line: startLineNum, Text: startCodeBlockLine, Err: errCodeBlockNotClosed}
 			}
 
 			blocks = append(blocks, block)
@@ -200,45 +612,174 @@ func extractCodeBlocks(scanner *bufio.Scanner) ([]codeBlock, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("line %d: bufio.Scanner.Scan: %w", lineNum, err)
+		return nil, &ParseError{Line: lineNum, Err: fmt.Errorf("bufio.Scanner.Scan: %w", err)}
 	}
 
 	return blocks, nil
 }
 
-// replaceServiceName takes a terminal command string as input and replaces the Cloud Run service name, if any.
-// If the user specified the service name in $CLOUD_RUN_SERVICE_NAME, it replaces that. Otherwise, as a failsafe,
-// it detects whether the command is a gcloud run command and replaces the last argument that isn't a flag
-// with the input service name.
-func replaceServiceName(command, serviceName string) string {
-	if !(gcloudCommandRegexp.MatchString(command) && cloudRunCommandRegexp.MatchString(command)) {
-		return command
+// replaceRegion takes a terminal command's leading environment variable assignments and arguments as input and
+// replaces the region they set, if any, with the provided region: the values of `--region` flags, in both the
+// `--region=value` and `--region value` forms, and of assignments to the variables in RegionEnvVars.
+func replaceRegion(env, args []string, region string) ([]string, []string) {
+	for i, a := range env {
+		for _, v := range RegionEnvVars {
+			if strings.HasPrefix(a, v+"=") {
+				env[i] = v + "=" + region
+			}
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "--region=") {
+			args[i] = "--region=" + region
+		} else if args[i] == "--region" && i+1 < len(args) {
+			i++
+			args[i] = region
+		}
 	}
 
-	sp := strings.Split(command, " ")
+	return env, args
+}
+
+// replaceServiceName takes a terminal command's arguments as input and replaces the Cloud Run service name, or the
+// Cloud Functions function name, if any. If the user specified the service name in $CLOUD_RUN_SERVICE_NAME, it
+// replaces that. Otherwise, it replaces the argument after a deploy, update or add-iam-policy-binding command, or the
+// function name of any other gcloud functions command (see functionNameIndex). As a failsafe for other gcloud run
+// commands, it replaces the last argument that isn't a flag with the input service name.
+func replaceServiceName(args []string, serviceName string) []string {
+	if !(util.IsGcloud(args[0]) && (containsWord(args, "run") || containsWord(args, "functions"))) {
+		return args
+	}
 
 	// Detects if the user specified the Cloud Run service name in an environment variable
-	for i := 0; i < len(sp); i++ {
-		if sp[i] == os.ExpandEnv("$CLOUD_RUN_SERVICE_NAME") {
-			sp[i] = serviceName
-			return strings.Join(sp, " ")
+	if n := os.Getenv("CLOUD_RUN_SERVICE_NAME"); n != "" {
+		for i := 0; i < len(args); i++ {
+			if args[i] == n {
+				args[i] = serviceName
+				return args
+			}
 		}
 	}
 
 	// Searches for specific gcloud keywords and takes service name from them
-	for i := 0; i < len(sp)-1; i++ {
-		if sp[i] == "deploy" || sp[i] == "update" {
-			sp[i+1] = serviceName
-			return strings.Join(sp, " ")
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "deploy" || args[i] == "update" || args[i] == iamAddBindingCommand {
+			args[i+1] = serviceName
+			return args
+		}
+	}
+
+	// Function names are found by position, as functions commands like `call NAME --data '{}'` end with flag values
+	if containsWord(args, "functions") {
+		if i := functionNameIndex(args); i >= 0 {
+			args[i] = serviceName
 		}
+		return args
 	}
 
 	// Provides a failsafe if neither of the above options work
-	for i := len(sp) - 1; i >= 0; i-- {
-		if !strings.Contains(sp[i], "--") {
-			sp[i] = serviceName
+	for i := len(args) - 1; i >= 0; i-- {
+		if !strings.Contains(args[i], "--") {
+			args[i] = serviceName
 			break
 		}
 	}
-	return strings.Join(sp, " ")
+	return args
+}
+
+// functionNameIndex returns the index of the function name in the provided gcloud functions command's arguments: the
+// argument right after the command, like NAME in `gcloud functions call NAME --data '{}'` or `gcloud functions logs
+// read NAME --limit 5`. It returns -1 if the command isn't followed by a function name.
+func functionNameIndex(args []string) int {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] != "functions" {
+			continue
+		}
+
+		name := i + 2
+		if args[i+1] == "logs" {
+			name++
+		}
+		if name < len(args) && !strings.HasPrefix(args[name], "-") {
+			return name
+		}
+		return -1
+	}
+
+	return -1
+}
+
+// staleServiceNames returns a warning for each command that still refers to a service name replaced elsewhere, such as
+// the hello_world in `--set-env-vars=SERVICE=hello_world` once `gcloud run deploy hello_world` is replaced. Such a
+// reference is left pointing at the README's service instead of the deployed one.
+func staleServiceNames(explanations []Explanation) []string {
+	seen := make(map[string]bool)
+	var placeholders []string
+	for _, e := range explanations {
+		for _, t := range e.Transformations {
+			if t.Kind == TransformServiceName && t.Before != "" && !seen[t.Before] {
+				seen[t.Before] = true
+				placeholders = append(placeholders, t.Before)
+			}
+		}
+	}
+
+	var warnings []string
+	for _, p := range placeholders {
+		re := regexp.MustCompile(`(^|[^A-Za-z0-9_-])` + regexp.QuoteMeta(p) + `($|[^A-Za-z0-9_-])`)
+		for _, e := range explanations {
+			if re.MatchString(e.Command) {
+				warnings = append(warnings, fmt.Sprintf("%s still refers to the replaced service name %s", e.Command, p))
+			}
+		}
+	}
+
+	return warnings
+}
+
+// warnStaleServiceNames logs the warnings returned by staleServiceNames.
+func warnStaleServiceNames(explanations []Explanation) {
+	for _, w := range staleServiceNames(explanations) {
+		log.Printf("Warning: %s\n", w)
+	}
+}
+
+// imageURLRegexp returns a regexp matching the container image URLs, with at least two path components, in the
+// registries with the provided hostnames or the defaultRegistryHosts. The first path component may be empty, as when
+// it's an unset environment variable, such as the project ID in gcr.io/${GOOGLE_CLOUD_PROJECT}/hello.
+func imageURLRegexp(hosts []string) *regexp.Regexp {
+	patterns := append([]string(nil), defaultRegistryHosts...)
+	for _, h := range hosts {
+		patterns = append(patterns, regexp.QuoteMeta(h))
+	}
+
+	return regexp.MustCompile(`\b(` + strings.Join(patterns, "|") + `)/\S*/\S+`)
+}
+
+// isSourceDeploy reports whether the provided terminal command arguments are a `gcloud run deploy` command deploying
+// from source with --source, which builds the container image itself instead of deploying an existing one.
+func isSourceDeploy(args []string) bool {
+	if len(args) == 0 || !util.IsGcloud(args[0]) || !containsWord(args, "run") || !containsWord(args, "deploy") {
+		return false
+	}
+
+	for _, a := range args {
+		if a == "--source" || strings.HasPrefix(a, "--source=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsWord reports whether any of the provided arguments is exactly the provided word.
+func containsWord(args []string, word string) bool {
+	for _, a := range args {
+		if a == word {
+			return true
+		}
+	}
+
+	return false
 }
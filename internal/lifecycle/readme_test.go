@@ -3,9 +3,11 @@ package lifecycle
 import (
 	"bufio"
 	"errors"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
 	"os"
 	"os/exec"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -31,6 +33,29 @@ func unsetEnv(e map[string]string) error {
 	return nil
 }
 
+// commandWithEnv sets the environment of the provided exec.Cmd to the program's environment plus the provided
+// `NAME=value` assignments and returns it.
+func commandWithEnv(cmd *exec.Cmd, env ...string) *exec.Cmd {
+	cmd.Env = append(os.Environ(), env...)
+	return cmd
+}
+
+// pipeline returns the Step of the pipeline of the provided commands.
+func pipeline(cmds ...*exec.Cmd) Step {
+	last := len(cmds) - 1
+	return Step{Cmd: cmds[last], Upstream: cmds[:last]}
+}
+
+// failureIgnoredCommand returns the Step of the provided command followed by `;`.
+func failureIgnoredCommand(cmd *exec.Cmd) Step {
+	return Step{Cmd: cmd, IgnoreFailure: true}
+}
+
+// andNextCommand returns the Step of the provided command followed by `&&`.
+func andNextCommand(cmd *exec.Cmd) Step {
+	return Step{Cmd: cmd, AndNext: true}
+}
+
 // uniqueServiceName is the Cloud Run Service name that will replace the existing service names in each codeBlock test.
 const uniqueServiceName = "unique_service_name"
 
@@ -39,7 +64,7 @@ const uniqueGCRURL = "gcr.io/unique/tag"
 
 type toCommandsTest struct {
 	codeBlock codeBlock         // input code block
-	cmds      []*exec.Cmd       // expected result of codeBlock.toCommands
+	cmds      Lifecycle         // expected result of codeBlock.toCommands
 	err       string            // expected string contained in return error of codeBlock.toCommands
 	env       map[string]string // map of environment variables to values for this test
 }
@@ -50,8 +75,8 @@ var toCommandsTests = []toCommandsTest{
 		codeBlock: codeBlock{
 			"echo hello world",
 		},
-		cmds: []*exec.Cmd{
-			exec.Command("echo", "hello", "world"),
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "hello", "world")},
 		},
 	},
 
@@ -61,9 +86,9 @@ var toCommandsTests = []toCommandsTest{
 			"echo line one",
 			"echo line two",
 		},
-		cmds: []*exec.Cmd{
-			exec.Command("echo", "line", "one"),
-			exec.Command("echo", "line", "two"),
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "line", "one")},
+			{Cmd: exec.Command("echo", "line", "two")},
 		},
 	},
 
@@ -73,8 +98,8 @@ var toCommandsTests = []toCommandsTest{
 			"echo multi \\",
 			"line command",
 		},
-		cmds: []*exec.Cmd{
-			exec.Command("echo", "multi", "line", "command"),
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "multi", "line", "command")},
 		},
 	},
 
@@ -84,7 +109,69 @@ var toCommandsTests = []toCommandsTest{
 			"echo multi \\",
 		},
 		cmds: nil,
-		err:  errCodeBlockEndAfterLineCont,
+		err:  errCodeBlockEndAfterLineCont.Error(),
+	},
+
+	// comment and blank lines
+	{
+		codeBlock: codeBlock{
+			"# build the container image",
+			"echo line one",
+			"",
+			"#echo commented out",
+			"echo line two",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "line", "one")},
+			{Cmd: exec.Command("echo", "line", "two")},
+		},
+	},
+
+	// comment lines around a multiline command
+	{
+		codeBlock: codeBlock{
+			"# deploy the service",
+			"echo multi \\",
+			"line # not a comment \\",
+			"command",
+			"# done",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "multi", "line", "#", "not", "a", "comment", "command")},
+		},
+	},
+
+	// line cont char followed by a comment line
+	{
+		codeBlock: codeBlock{
+			"echo multi \\",
+			"# comment",
+			"line command",
+		},
+		cmds: nil,
+		err:  errCommentAfterLineCont.Error(),
+	},
+
+	// line cont char followed by a comment line ending with a line cont char
+	{
+		codeBlock: codeBlock{
+			"echo multi \\",
+			"# comment \\",
+			"line command",
+		},
+		cmds: nil,
+		err:  errCommentAfterLineCont.Error(),
+	},
+
+	// continued line starting with an escaped comment char
+	{
+		codeBlock: codeBlock{
+			"echo multi \\",
+			"\\#line command",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "multi", "#line", "command")},
+		},
 	},
 
 	// expand environment variable test
@@ -92,21 +179,97 @@ var toCommandsTests = []toCommandsTest{
 		codeBlock: codeBlock{
 			"echo ${TEST_ENV}",
 		},
-		cmds: []*exec.Cmd{
-			exec.Command("echo", "hello", "world"),
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "hello", "world")},
 		},
 		env: map[string]string{
 			"TEST_ENV": "hello world",
 		},
 	},
 
+	// expanded values aren't parsed as shell syntax test
+	{
+		codeBlock: codeBlock{
+			`echo ${TEST_SHELL_VALUE} "${TEST_SHELL_VALUE}" | cat`,
+		},
+		cmds: Lifecycle{
+			pipeline(
+				exec.Command("echo", "a", "|", `"b"`, "&&", "c;", `a | "b" && c;`),
+				exec.Command("cat"),
+			),
+		},
+		env: map[string]string{
+			"TEST_SHELL_VALUE": `a | "b" && c;`,
+		},
+	},
+
 	// replace Cloud Run service name with provided name test
 	{
 		codeBlock: codeBlock{
 			"gcloud run services deploy hello_world",
 		},
-		cmds: []*exec.Cmd{
-			exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName),
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName)},
+		},
+	},
+
+	// replace Cloud Functions function name with provided name test
+	{
+		codeBlock: codeBlock{
+			"gcloud functions deploy hello_http --gen2 --runtime=go113 --trigger-http",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "functions", "deploy", uniqueServiceName, "--gen2", "--runtime=go113", "--trigger-http")},
+		},
+	},
+
+	// replace Cloud Functions function name in a follow-up functions command test
+	{
+		codeBlock: codeBlock{
+			"gcloud functions describe hello_http --format=value(url)",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "functions", "describe", uniqueServiceName, "--format=value(url)")},
+		},
+	},
+
+	// replace Cloud Functions function name, not flag values, in a functions call command test
+	{
+		codeBlock: codeBlock{
+			"gcloud functions call hello_http --data '{}'",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "functions", "call", uniqueServiceName, "--data", "{}")},
+		},
+	},
+
+	// replace Cloud Functions function name, not flag values, in a functions logs command test
+	{
+		codeBlock: codeBlock{
+			"gcloud functions logs read hello_http --limit 5",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "functions", "logs", "read", uniqueServiceName, "--limit", "5")},
+		},
+	},
+
+	// leave flag values of a functions command without a function name untouched test
+	{
+		codeBlock: codeBlock{
+			"gcloud functions logs read --limit 5",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "functions", "logs", "read", "--limit", "5")},
+		},
+	},
+
+	// leave other gcloud commands untouched test
+	{
+		codeBlock: codeBlock{
+			"gcloud pubsub topics create hello",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "pubsub", "topics", "create", "hello")},
 		},
 	},
 
@@ -115,8 +278,8 @@ var toCommandsTests = []toCommandsTest{
 		codeBlock: codeBlock{
 			"gcloud builds submit --tag=gcr.io/hello/world",
 		},
-		cmds: []*exec.Cmd{
-			exec.Command("gcloud", "--quiet", "builds", "submit", "--tag="+uniqueGCRURL),
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag="+uniqueGCRURL)},
 		},
 	},
 
@@ -126,211 +289,1039 @@ var toCommandsTests = []toCommandsTest{
 			"gcloud builds submit --tag=gcr.io/hello/\\",
 			"world",
 		},
-		cmds: []*exec.Cmd{
-			exec.Command("gcloud", "--quiet", "builds", "submit", "--tag="+uniqueGCRURL),
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag="+uniqueGCRURL)},
+		},
+	},
+
+	// replace Cloud Run service name and GCR URL with provided inputs test
+	{
+		codeBlock: codeBlock{
+			"gcloud run services deploy hello_world --image=gcr.io/hello/world",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName, "--image="+uniqueGCRURL)},
+		},
+	},
+
+	// replace Cloud Run service name and GCR URL with `--image url` syntax test
+	{
+		codeBlock: codeBlock{
+			"gcloud run services deploy hello_world --image gcr.io/hello/world",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName, "--image", uniqueGCRURL)},
+		},
+	},
+	{
+		codeBlock: codeBlock{
+			"gcloud run services deploy hello_world --image=gcr.io/hello/world --add-cloudsql-instances=${TEST_CLOUD_SQL_CONNECTION}",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName, "--image="+uniqueGCRURL, "--add-cloudsql-instances=project:region:instance")},
+		},
+		env: map[string]string{
+			"TEST_CLOUD_SQL_CONNECTION": "project:region:instance",
+		},
+	},
+
+	// replace Cloud Run service name provided name in command with multiline arguments test
+	{
+		codeBlock: codeBlock{
+			"gcloud run services update hello_world --add-cloudsql-instances=\\",
+			"project:region:instance",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "update", uniqueServiceName, "--add-cloudsql-instances=project:region:instance")},
+		},
+	},
+
+	// replace Cloud Run service name provided name and expand environment variables in command with multiline arguments test
+	{
+		codeBlock: codeBlock{
+			"gcloud run services update hello_world --add-cloudsql-instances=\\",
+			"${TEST_CLOUD_SQL_CONNECTION}",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "update", uniqueServiceName, "--add-cloudsql-instances=project:region:instance")},
+		},
+		env: map[string]string{
+			"TEST_CLOUD_SQL_CONNECTION": "project:region:instance",
+		},
+	},
+
+	// replace Cloud Run service name in IAM policy binding command test
+	{
+		codeBlock: codeBlock{
+			"gcloud run services add-iam-policy-binding hello_world --member allUsers --role roles/run.invoker",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "services", "add-iam-policy-binding", uniqueServiceName, "--member", "allUsers", "--role", "roles/run.invoker")},
+		},
+	},
+
+	// expand environment variable with default value when unset test
+	{
+		codeBlock: codeBlock{
+			"echo --region=${TEST_REGION:-us-central1}",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "--region=us-central1")},
+		},
+	},
+
+	// expand environment variable with default value when set test
+	{
+		codeBlock: codeBlock{
+			"echo --region=${TEST_REGION:-us-central1}",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "--region=europe-west1")},
+		},
+		env: map[string]string{
+			"TEST_REGION": "europe-west1",
+		},
+	},
+
+	// expand environment variable with default value when empty test
+	{
+		codeBlock: codeBlock{
+			"echo --region=${TEST_REGION:-us-central1}",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "--region=us-central1")},
+		},
+		env: map[string]string{
+			"TEST_REGION": "",
+		},
+	},
+
+	// expand environment variable with alternate value when set test
+	{
+		codeBlock: codeBlock{
+			"echo ${TEST_VERBOSE:+--verbosity=debug} done",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "--verbosity=debug", "done")},
+		},
+		env: map[string]string{
+			"TEST_VERBOSE": "1",
+		},
+	},
+
+	// expand environment variable with alternate value when unset test
+	{
+		codeBlock: codeBlock{
+			"echo ${TEST_VERBOSE:+--verbosity=debug} done",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "done")},
+		},
+	},
+
+	// expand unset environment variable without default test
+	{
+		codeBlock: codeBlock{
+			"echo ${TEST_UNSET} done",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "done")},
+		},
+	},
+
+	// quoted argument with embedded spaces test
+	{
+		codeBlock: codeBlock{
+			`gcloud run deploy hello_world --set-env-vars="FOO=a b,BAR=c"`,
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--set-env-vars=FOO=a b,BAR=c")},
+		},
+	},
+
+	// deploy from source test: the service name is replaced, but there's no image URL to replace
+	{
+		codeBlock: codeBlock{
+			"gcloud run deploy hello_world --source .",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--source", ".")},
+		},
+	},
+
+	// deploy from source test: a registry URL passed along --source isn't the sample's image
+	{
+		codeBlock: codeBlock{
+			"gcloud run deploy hello_world --source=. --image=gcr.io/my-project/hello",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--source=.", "--image=gcr.io/my-project/hello")},
+		},
+	},
+
+	// single-quoted argument with escaped double quotes test
+	{
+		codeBlock: codeBlock{
+			`echo 'say "hi"' "say \"bye\""`,
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", `say "hi"`, `say "bye"`)},
+		},
+	},
+
+	// quoted argument spanning a line continuation test
+	{
+		codeBlock: codeBlock{
+			`gcloud run deploy hello_world --set-env-vars="FOO=a b,\`,
+			`BAR=c d"`,
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--set-env-vars=FOO=a b,BAR=c d")},
+		},
+	},
+
+	// unterminated quote test
+	{
+		codeBlock: codeBlock{
+			`echo "hello world`,
+		},
+		cmds: nil,
+		err:  errUnterminatedQuote.Error(),
+	},
+
+	// single leading environment variable assignment test
+	{
+		codeBlock: codeBlock{
+			"FOO=bar echo hello world",
+		},
+		cmds: Lifecycle{
+			{Cmd: commandWithEnv(exec.Command("echo", "hello", "world"), "FOO=bar")},
+		},
+	},
+
+	// multiple leading environment variable assignments only apply to their own command test
+	{
+		codeBlock: codeBlock{
+			"FOO=bar BAZ=qux gcloud run services deploy hello_world",
+			"echo hello world",
+		},
+		cmds: Lifecycle{
+			{Cmd: commandWithEnv(exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName), "FOO=bar", "BAZ=qux")},
+			{Cmd: exec.Command("echo", "hello", "world")},
+		},
+	},
+
+	// environment variable assignment that isn't leading is left as an argument test
+	{
+		codeBlock: codeBlock{
+			"echo FOO=bar",
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "FOO=bar")},
+		},
+	},
+
+	// pipeline test
+	{
+		codeBlock: codeBlock{
+			"gcloud run services describe hello_world --format=json | FOO=bar grep url",
+		},
+		cmds: Lifecycle{
+			pipeline(
+				exec.Command("gcloud", "--quiet", "run", "services", "describe", uniqueServiceName, "--format=json"),
+				commandWithEnv(exec.Command("grep", "url"), "FOO=bar"),
+			),
+		},
+	},
+
+	// environment variable in double quotes is expanded test
+	{
+		codeBlock: codeBlock{
+			`echo "${TEST_QUOTED_VAR}" "a $TEST_QUOTED_VAR"`,
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "b c", "a b c")},
+		},
+		env: map[string]string{
+			"TEST_QUOTED_VAR": "b c",
 		},
 	},
 
-	// replace Cloud Run service name and GCR URL with provided inputs test
+	// environment variable in single quotes is left literal test
+	{
+		codeBlock: codeBlock{
+			`echo '${TEST_QUOTED_VAR}' --set-env-vars='URL=https://$TEST_QUOTED_VAR' "it's ${TEST_QUOTED_VAR}"`,
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "${TEST_QUOTED_VAR}", "--set-env-vars=URL=https://$TEST_QUOTED_VAR", "it's b")},
+		},
+		env: map[string]string{
+			"TEST_QUOTED_VAR": "b",
+		},
+	},
+
+	// escaped environment variable is left literal test
+	{
+		codeBlock: codeBlock{
+			`echo \$TEST_QUOTED_VAR "\${TEST_QUOTED_VAR}" $TEST_QUOTED_VAR`,
+		},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("echo", "$TEST_QUOTED_VAR", "${TEST_QUOTED_VAR}", "b")},
+		},
+		env: map[string]string{
+			"TEST_QUOTED_VAR": "b",
+		},
+	},
+
+	// commands joined by && test
+	{
+		codeBlock: codeBlock{
+			"echo a && echo b",
+		},
+		cmds: Lifecycle{
+			andNextCommand(exec.Command("echo", "a")),
+			{Cmd: exec.Command("echo", "b")},
+		},
+	},
+
+	// commands joined by ; test
+	{
+		codeBlock: codeBlock{
+			"echo a; echo 'b;c'",
+		},
+		cmds: Lifecycle{
+			failureIgnoredCommand(exec.Command("echo", "a")),
+			{Cmd: exec.Command("echo", "b;c")},
+		},
+	},
+
+	// && without a command test
+	{
+		codeBlock: codeBlock{
+			"echo a &&",
+		},
+		err: errEmptyListCommand.Error(),
+	},
+
+	// pipeline with a missing command test
+	{
+		codeBlock: codeBlock{
+			"echo hello |",
+		},
+		err: errEmptyPipelineStage.Error(),
+	},
+}
+
+func TestToCommands(t *testing.T) {
+	for i, tc := range toCommandsTests {
+		if len(tc.codeBlock) == 0 {
+			continue
+		}
+
+		if err := setEnv(tc.env); err != nil {
+			t.Errorf("#%d: setEnv: %v", i, err)
+
+			if err = unsetEnv(tc.env); err != nil {
+				t.Errorf("#%d: unsetEnv: %v", i, err)
+			}
+
+			continue
+		}
+
+		cmds, err := tc.codeBlock.toCommands(uniqueServiceName, uniqueGCRURL)
+
+		var errorMatch bool
+		if err == nil {
+			errorMatch = tc.err == ""
+		} else {
+			errorMatch = strings.Contains(err.Error(), tc.err)
+		}
+
+		if !errorMatch {
+			t.Errorf("#%d: error mismatch\nwant: %s\ngot: %v", i, tc.err, err)
+		}
+
+		if (errorMatch && err == nil) && !reflect.DeepEqual(cmds, tc.cmds) {
+			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.cmds, cmds)
+		}
+
+		if err := unsetEnv(tc.env); err != nil {
+			t.Errorf("#%d: unsetEnv: %v", i, err)
+		}
+	}
+}
+
+func TestToCommandsGcloudPath(t *testing.T) {
+	defer func(path string) { util.GcloudPath = path }(util.GcloudPath)
+	util.GcloudPath = "/bin/sh"
+
+	cb := codeBlock{
+		"gcloud.cmd run deploy hello --image=gcr.io/project/hello",
+		"/usr/lib/google-cloud-sdk/bin/gcloud builds list",
+		"echo gcloud",
+	}
+
+	cmds, err := cb.toCommands(uniqueServiceName, uniqueGCRURL)
+	if err != nil {
+		t.Fatalf("codeBlock.toCommands: %v", err)
+	}
+
+	want := Lifecycle{
+		{Cmd: exec.Command("/bin/sh", "--quiet", "run", "deploy", uniqueServiceName, "--image="+uniqueGCRURL)},
+		{Cmd: exec.Command("/bin/sh", "--quiet", "builds", "list")},
+		{Cmd: exec.Command("echo", "gcloud")},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, cmds)
+	}
+}
+
+func TestToCommandsGcloudFlags(t *testing.T) {
+	cb := codeBlock{
+		"gcloud run deploy hello --image=gcr.io/project/hello",
+		"echo gcloud",
+	}
+
+	o := newParseOptions([]ParseOption{WithGcloudFlags("--project=other", "--impersonate-service-account=sa@example.com")})
+	cmds, explanations, err := cb.toExplainedCommands(uniqueServiceName, uniqueGCRURL, o)
+	if err != nil {
+		t.Fatalf("codeBlock.toExplainedCommands: %v", err)
+	}
+
+	want := Lifecycle{
+		{Cmd: exec.Command("gcloud", "--quiet", "--project=other", "--impersonate-service-account=sa@example.com", "run",
+			"deploy", uniqueServiceName, "--image="+uniqueGCRURL)},
+		{Cmd: exec.Command("echo", "gcloud")},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, cmds)
+	}
+
+	if n := len(explanations[0].Transformations); n == 0 ||
+		explanations[0].Transformations[n-1].Kind != TransformGcloudFlags {
+		t.Errorf("explanation mismatch\nwant last transformation: %s\ngot: %+v", TransformGcloudFlags,
+			explanations[0].Transformations)
+	}
+}
+
+type parseREADMETest struct {
+	inFileName string    // input Markdown file
+	lifecycle  Lifecycle // expected result of parseREADME
+	err        error     // expected parseREADME return error
+}
+
+var parseREADMETests = []parseREADMETest{
+	// three code blocks, only two with comment code tags. one with one command, the other with two commands
+	{
+		inFileName: "readme_test.md",
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("echo", "hello", "world")},
+			{Cmd: exec.Command("echo", "line", "one")},
+			{Cmd: exec.Command("echo", "line", "two")},
+		},
+	},
+}
+
+func TestParseREADME(t *testing.T) {
+	for i, tc := range parseREADMETests {
+		if tc.inFileName == "" {
+			continue
+		}
+
+		// Cloud Run Service name and Container Registry URL tag replacement will be tested in TestToCommands
+		lifecycle, err := parseREADME(tc.inFileName, "", "")
+
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(lifecycle, tc.lifecycle) {
+			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.lifecycle, lifecycle)
+			continue
+		}
+	}
+}
+
+// currentPlatform is the platform whose code blocks extractLifecycle selects when running these tests.
+var currentPlatform = map[bool]string{true: "windows", false: "unix"}[runtime.GOOS == "windows"]
+
+type extractLifecycleTest struct {
+	in        string    // input Markdown string
+	lifecycle Lifecycle // expected results of extractLifecycle on in
+	err       error     // expected error
+}
+
+var extractLifecycleTests = []extractLifecycleTest{
+	// single code block
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"echo hello world\n" +
+			"```\n",
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("echo", "hello", "world")},
+		},
+	},
+
+	// two code blocks with markdown text in the middle
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"echo build command\n" +
+			"```\n" +
+			"markdown instructions\n" +
+			"[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"echo deploy command\n" +
+			"```\n",
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("echo", "build", "command")},
+			{Cmd: exec.Command("echo", "deploy", "command")},
+		},
+	},
+
+	// unix and windows code blocks, only the current platform's are selected
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"echo unix\n" +
+			"```\n" +
+			"[//]: # ({sst-run-windows})\n" +
+			"```\n" +
+			"echo windows\n" +
+			"```\n",
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("echo", currentPlatform)},
+		},
+	},
+
+	// empty annotated code block
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"echo build command\n" +
+			"```\n" +
+			"[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"```\n",
+		err: errEmptyAnnotatedBlock,
+	},
+
+	// annotated code block holding only comments and blank lines
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"# deploy the service\n" +
+			"\n" +
+			"```\n",
+		err: errEmptyAnnotatedBlock,
+	},
+}
+
+func TestExtractLifecycle(t *testing.T) {
+	for i, tc := range extractLifecycleTests {
+		if tc.in == "" {
+			continue
+		}
+
+		s := bufio.NewScanner(strings.NewReader(tc.in))
+
+		// Cloud Run Service name and Container Registry URL tag replacement will be tested in TestToCommands
+		lifecycle, err := extractLifecycle(s, "", "")
+
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(lifecycle, tc.lifecycle) {
+			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.lifecycle, lifecycle)
+		}
+	}
+}
+
+type expandArgsTest struct {
+	serviceName string    // service name passed to extractLifecycle
+	gcrURL      string    // Container Registry URL passed to extractLifecycle
+	lifecycle   Lifecycle // expected result
+}
+
+var expandArgsTests = []expandArgsTest{
+	// literal arguments
+	{
+		serviceName: "sst-literal",
+		gcrURL:      "gcr.io/my-project/app",
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag=gcr.io/my-project/app")},
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", "sst-literal", "--image=gcr.io/my-project/app")},
+		},
+	},
+	// environment variables in arguments
+	{
+		serviceName: "sst-$TEST_BUILD_ID",
+		gcrURL:      "gcr.io/${TEST_PROJECT}/app",
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag=gcr.io/my-project/app")},
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", "sst-42", "--image=gcr.io/my-project/app")},
+		},
+	},
+	// unset environment variables expand to the empty string, like in commands
+	{
+		serviceName: "sst${TEST_UNSET}",
+		gcrURL:      "gcr.io/${TEST_PROJECT}/app${TEST_UNSET}",
+		lifecycle: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "builds", "submit", "--tag=gcr.io/my-project/app")},
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", "sst", "--image=gcr.io/my-project/app")},
+		},
+	},
+}
+
+func TestExtractLifecycleExpandsArgs(t *testing.T) {
+	env := map[string]string{"TEST_BUILD_ID": "42", "TEST_PROJECT": "my-project"}
+	if err := setEnv(env); err != nil {
+		t.Fatalf("setting env: %v", err)
+	}
+	defer unsetEnv(env)
+	os.Unsetenv("TEST_UNSET")
+
+	in := "[//]: # ({sst-run-unix})\n" +
+		"```\n" +
+		"gcloud builds submit --tag=gcr.io/my-sample-project/hello\n" +
+		"gcloud run deploy hello --image=gcr.io/my-sample-project/hello\n" +
+		"```\n"
+
+	for i, tc := range expandArgsTests {
+		s := bufio.NewScanner(strings.NewReader(in))
+		lifecycle, err := extractLifecycle(s, tc.serviceName, tc.gcrURL)
+		if err != nil {
+			t.Errorf("#%d: extractLifecycle: %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(lifecycle, tc.lifecycle) {
+			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.lifecycle, lifecycle)
+		}
+	}
+}
+
+type unsetEnvReferencesTest struct {
+	lines []string      // lines of the code block
+	opts  []ParseOption // options the code block is parsed with
+	unset []string      // expected unset environment variables
+}
+
+var unsetEnvReferencesTests = []unsetEnvReferencesTest{
+	// set and unset references, each unset variable listed once, sorted
+	{
+		lines: []string{"gcloud sql connect ${TEST_UNSET_B} --project=$TEST_SET", "echo ${TEST_UNSET_A} $TEST_UNSET_B"},
+		unset: []string{"TEST_UNSET_A", "TEST_UNSET_B"},
+	},
+
+	// set to the empty string
+	{
+		lines: []string{"echo ${TEST_EMPTY}"},
+	},
+
+	// default and alternate values
+	{
+		lines: []string{"echo ${TEST_UNSET_A:-default} ${TEST_UNSET_B:+alt}"},
+	},
+
+	// single-quoted and escaped references aren't expanded
+	{
+		lines: []string{"echo '${TEST_UNSET_A}' \\$TEST_UNSET_B \"${TEST_UNSET_C}\""},
+		unset: []string{"TEST_UNSET_C"},
+	},
+
+	// comment lines and special parameters
+	{
+		lines: []string{"# export TEST_UNSET_A=${TEST_UNSET_B}", "echo $1 $$"},
+	},
+
+	// references inside container image URLs, which are replaced
+	{
+		lines: []string{
+			"gcloud builds submit --tag gcr.io/${TEST_UNSET_A}/hello",
+			"gcloud run deploy hello \\",
+			"  \"--image=us-docker.pkg.dev/$TEST_UNSET_A/repo/hello\" --set-env-vars=FOO=$TEST_UNSET_B",
+		},
+		unset: []string{"TEST_UNSET_B"},
+	},
+
+	// source deploys' container image URLs aren't replaced
+	{
+		lines: []string{"gcloud run deploy hello \\", "  --source . --image gcr.io/${TEST_UNSET_A}/hello"},
+		unset: []string{"TEST_UNSET_A"},
+	},
+
+	// project ID environment variables without a project ID
+	{
+		lines: []string{"gcloud sql connect db --project=$PROJECT_ID", "echo ${GOOGLE_CLOUD_PROJECT}"},
+		unset: []string{"GOOGLE_CLOUD_PROJECT", "PROJECT_ID"},
+	},
+
+	// project ID environment variables with a project ID
+	{
+		lines: []string{"gcloud sql connect db --project=$PROJECT_ID", "echo ${GOOGLE_CLOUD_PROJECT} $TEST_UNSET_A"},
+		opts:  []ParseOption{WithProjectID("my-project")},
+		unset: []string{"TEST_UNSET_A"},
+	},
+}
+
+func TestUnsetEnvReferences(t *testing.T) {
+	env := map[string]string{"TEST_SET": "my-project", "TEST_EMPTY": ""}
+	if err := setEnv(env); err != nil {
+		t.Fatalf("setting env: %v", err)
+	}
+	defer unsetEnv(env)
+	unsetEnv(map[string]string{"TEST_UNSET_A": "", "TEST_UNSET_B": "", "TEST_UNSET_C": "", "PROJECT_ID": "",
+		"GOOGLE_CLOUD_PROJECT": ""})
+
+	for i, tc := range unsetEnvReferencesTests {
+		unset := unsetEnvReferences([]codeBlock{tc.lines}, newParseOptions(tc.opts))
+		if len(unset) == 0 && len(tc.unset) == 0 {
+			continue
+		}
+
+		if !reflect.DeepEqual(unset, tc.unset) {
+			t.Errorf("#%d: result mismatch\nwant: %v\ngot: %v", i, tc.unset, unset)
+		}
+	}
+}
+
+func TestExtractLifecycleUnsetEnv(t *testing.T) {
+	os.Unsetenv("TEST_CLOUD_SQL_CONNECTION")
+
+	in := "[//]: # ({sst-run-unix})\n" +
+		"```\n" +
+		"gcloud run deploy hello --add-cloudsql-instances=${TEST_CLOUD_SQL_CONNECTION}\n" +
+		"```\n"
+
+	_, err := extractLifecycle(bufio.NewScanner(strings.NewReader(in)), "hello", uniqueGCRURL)
+	if !errors.Is(err, errUnsetEnvVars) || !strings.Contains(err.Error(), "TEST_CLOUD_SQL_CONNECTION") {
+		t.Errorf("error mismatch\nwant: %v: TEST_CLOUD_SQL_CONNECTION\ngot: %v", errUnsetEnvVars, err)
+	}
+}
+
+func TestExtractLifecycleUnsetEnvWarnings(t *testing.T) {
+	os.Unsetenv("TEST_CLOUD_SQL_CONNECTION")
+
+	in := "[//]: # ({sst-run-unix})\n" +
+		"```\n" +
+		"gcloud run deploy hello --add-cloudsql-instances=${TEST_CLOUD_SQL_CONNECTION}\n" +
+		"```\n"
+
+	o := newParseOptions([]ParseOption{WithUnsetEnvWarnings()})
+	l, _, err := extractExplainedLifecycle(bufio.NewScanner(strings.NewReader(in)), "hello", uniqueGCRURL, o)
+	if err != nil {
+		t.Fatalf("extractExplainedLifecycle: %v", err)
+	}
+
+	want := Lifecycle{{Cmd: exec.Command(util.GcloudPath, append(util.GcloudCommonFlags, "run", "deploy", "hello",
+		"--add-cloudsql-instances=")...)}}
+	if !reflect.DeepEqual(l, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, l)
+	}
+}
+
+func TestExtractLifecycleUnsetEnvImageURL(t *testing.T) {
+	os.Unsetenv("GOOGLE_CLOUD_PROJECT")
+
+	in := "[//]: # ({sst-run-unix})\n" +
+		"```\n" +
+		"gcloud builds submit --tag gcr.io/${GOOGLE_CLOUD_PROJECT}/hello\n" +
+		"```\n"
+
+	l, err := extractLifecycle(bufio.NewScanner(strings.NewReader(in)), "hello", uniqueGCRURL)
+	if err != nil {
+		t.Fatalf("extractLifecycle: %v", err)
+	}
+
+	want := Lifecycle{{Cmd: exec.Command(util.GcloudPath, append(util.GcloudCommonFlags, "builds", "submit", "--tag",
+		uniqueGCRURL)...)}}
+	if !reflect.DeepEqual(l, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, l)
+	}
+}
+
+func TestExtractLifecycleUnsetEnvProjectID(t *testing.T) {
+	os.Unsetenv("PROJECT_ID")
+
+	in := "[//]: # ({sst-run-unix})\n" +
+		"```\n" +
+		"gcloud sql instances describe db --project=$PROJECT_ID\n" +
+		"```\n"
+
+	o := newParseOptions([]ParseOption{WithProjectID("my-project")})
+	l, _, err := extractExplainedLifecycle(bufio.NewScanner(strings.NewReader(in)), "hello", uniqueGCRURL, o)
+	if err != nil {
+		t.Fatalf("extractExplainedLifecycle: %v", err)
+	}
+
+	want := Lifecycle{{Cmd: exec.Command(util.GcloudPath, append(util.GcloudCommonFlags, "sql", "instances", "describe",
+		"db", "--project=my-project")...)}}
+	if !reflect.DeepEqual(l, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, l)
+	}
+}
+
+func TestExtractLifecycleCRLF(t *testing.T) {
+	in := "[//]: # ({sst-run-unix})\n" +
+		"```\n" +
+		"gcloud builds submit \\\n" +
+		"  --tag=gcr.io/project/hello\n" +
+		"gcloud run deploy hello --image=gcr.io/project/hello\n" +
+		"```\n"
+
+	want, err := extractLifecycle(bufio.NewScanner(strings.NewReader(in)), "hello", uniqueGCRURL)
+	if err != nil {
+		t.Fatalf("extractLifecycle: LF: %v", err)
+	}
+
+	crlf := strings.ReplaceAll(in, "\n", "\r\n")
+	got, err := extractLifecycle(bufio.NewScanner(strings.NewReader(crlf)), "hello", uniqueGCRURL)
+	if err != nil {
+		t.Fatalf("extractLifecycle: CRLF: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, got)
+	}
+}
+
+type imageURLTest struct {
+	hosts []string // hosts passed to WithRegistryHosts
+	arg   string   // input command argument
+	want  string   // expected argument after image URL replacement
+}
+
+var imageURLTests = []imageURLTest{
+	// Container Registry
+	{arg: "gcr.io/my-project/hello", want: uniqueGCRURL},
+	{arg: "--image=us.gcr.io/my-project/hello:v1", want: "--image=" + uniqueGCRURL},
+	// Artifact Registry
+	{arg: "us-docker.pkg.dev/my-project/repo/hello", want: uniqueGCRURL},
+	{arg: "--tag=europe-west1-docker.pkg.dev/my-project/repo/hello", want: "--tag=" + uniqueGCRURL},
+	// other registries are left untouched unless configured
+	{arg: "registry.example.com/team/hello", want: "registry.example.com/team/hello"},
+	{hosts: []string{"registry.example.com"}, arg: "registry.example.com/team/hello", want: uniqueGCRURL},
+	// hosts merely ending like a registry host aren't registries
+	{arg: "notgcr.io/my-project/hello", want: "notgcr.io/my-project/hello"},
+	// a single path component isn't an image URL
+	{arg: "gcr.io/hello", want: "gcr.io/hello"},
+}
+
+func TestImageURLReplacement(t *testing.T) {
+	for i, tc := range imageURLTests {
+		o := newParseOptions([]ParseOption{WithRegistryHosts(tc.hosts...)})
+		cmds, _, err := codeBlock{"echo " + tc.arg}.toExplainedCommands(uniqueServiceName, uniqueGCRURL, o)
+		if err != nil {
+			t.Errorf("#%d: codeBlock.toExplainedCommands: %v", i, err)
+			continue
+		}
+
+		if got := cmds[0].Cmd.Args[1]; got != tc.want {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.want, got)
+		}
+	}
+}
+
+type staleServiceNamesTest struct {
+	codeBlock codeBlock // input code block
+	warnings  int       // expected number of warnings
+}
+
+var staleServiceNamesTests = []staleServiceNamesTest{
+	// every reference replaced
 	{
 		codeBlock: codeBlock{
-			"gcloud run services deploy hello_world --image=gcr.io/hello/world",
-		},
-		cmds: []*exec.Cmd{
-			exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName, "--image="+uniqueGCRURL),
+			"gcloud run deploy hello_world --image=gcr.io/my-sample-project/hello",
+			"gcloud run services describe hello_world",
 		},
 	},
-
-	// replace Cloud Run service name and GCR URL with `--image url` syntax test
-	// this test breaks right now (issue #3)
-	//{
-	//	codeBlock: codeBlock{
-	//		"gcloud run services deploy hello_world --image gcr.io/hello/world",
-	//	},
-	//	cmds: []*exec.Cmd{
-	//		exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName, "--image", uniqueGCRURL),
-	//	},
-	//	serviceName: "unique_service_name",
-	//	gcrURL: "gcr.io/unique/tag",
-	//},
+	// stale reference in an environment variable value
 	{
 		codeBlock: codeBlock{
-			"gcloud run services deploy hello_world --image=gcr.io/hello/world --add-cloudsql-instances=${TEST_CLOUD_SQL_CONNECTION}",
-		},
-		cmds: []*exec.Cmd{
-			exec.Command("gcloud", "--quiet", "run", "services", "deploy", uniqueServiceName, "--image="+uniqueGCRURL, "--add-cloudsql-instances=project:region:instance"),
-		},
-		env: map[string]string{
-			"TEST_CLOUD_SQL_CONNECTION": "project:region:instance",
+			"gcloud run deploy hello_world --set-env-vars=SERVICE=hello_world",
 		},
+		warnings: 1,
 	},
-
-	// replace Cloud Run service name provided name in command with multiline arguments test
+	// stale reference in a later command
 	{
 		codeBlock: codeBlock{
-			"gcloud run services update hello_world --add-cloudsql-instances=\\",
-			"project:region:instance",
-		},
-		cmds: []*exec.Cmd{
-			exec.Command("gcloud", "--quiet", "run", "services", "update", uniqueServiceName, "--add-cloudsql-instances=project:region:instance"),
+			"gcloud run deploy hello_world",
+			"echo hello_world",
 		},
+		warnings: 1,
 	},
-
-	// replace Cloud Run service name provided name and expand environment variables in command with multiline arguments test
+	// names merely containing the replaced name aren't references
 	{
 		codeBlock: codeBlock{
-			"gcloud run services update hello_world --add-cloudsql-instances=\\",
-			"${TEST_CLOUD_SQL_CONNECTION}",
-		},
-		cmds: []*exec.Cmd{
-			exec.Command("gcloud", "--quiet", "run", "services", "update", uniqueServiceName, "--add-cloudsql-instances=project:region:instance"),
-		},
-		env: map[string]string{
-			"TEST_CLOUD_SQL_CONNECTION": "project:region:instance",
+			"gcloud run deploy hello",
+			"echo hello-world hello_sample",
 		},
 	},
 }
 
-func TestToCommands(t *testing.T) {
-	for i, tc := range toCommandsTests {
-		if len(tc.codeBlock) == 0 {
-			continue
-		}
-
-		if err := setEnv(tc.env); err != nil {
-			t.Errorf("#%d: setEnv: %v", i, err)
-
-			if err = unsetEnv(tc.env); err != nil {
-				t.Errorf("#%d: unsetEnv: %v", i, err)
-			}
-
+func TestStaleServiceNames(t *testing.T) {
+	for i, tc := range staleServiceNamesTests {
+		_, explanations, err := tc.codeBlock.toExplainedCommands(uniqueServiceName, uniqueGCRURL, newParseOptions(nil))
+		if err != nil {
+			t.Errorf("#%d: codeBlock.toExplainedCommands: %v", i, err)
 			continue
 		}
 
-		cmds, err := tc.codeBlock.toCommands(uniqueServiceName, uniqueGCRURL)
-
-		var errorMatch bool
-		if err == nil {
-			errorMatch = tc.err == ""
-		} else {
-			errorMatch = strings.Contains(err.Error(), tc.err)
+		warnings := staleServiceNames(explanations)
+		if len(warnings) != tc.warnings {
+			t.Errorf("#%d: warning count mismatch\nwant: %d\ngot: %d: %q", i, tc.warnings, len(warnings), warnings)
 		}
+	}
+}
 
-		if !errorMatch {
-			t.Errorf("#%d: error mismatch\nwant: %s\ngot: %v", i, tc.err, err)
-		}
+type codeTagForOSTest struct {
+	goos string // input runtime.GOOS value
+	tag  string // expected result of codeTagForOS
+}
 
-		if (errorMatch && err == nil) && !reflect.DeepEqual(cmds, tc.cmds) {
-			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.cmds, cmds)
-		}
+var codeTagForOSTests = []codeTagForOSTest{
+	{goos: "linux", tag: "{sst-run-unix}"},
+	{goos: "darwin", tag: "{sst-run-unix}"},
+	{goos: "windows", tag: "{sst-run-windows}"},
+}
 
-		if err := unsetEnv(tc.env); err != nil {
-			t.Errorf("#%d: unsetEnv: %v", i, err)
+func TestCodeTagForOS(t *testing.T) {
+	for i, tc := range codeTagForOSTests {
+		if tag := codeTagForOS(tc.goos); tag != tc.tag {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.tag, tag)
 		}
 	}
 }
 
-type parseREADMETest struct {
-	inFileName string    // input Markdown file
-	lifecycle  Lifecycle // expected result of parseREADME
-	err        error     // expected parseREADME return error
+type expandTildeTest struct {
+	in   string // input word
+	want string // expected result of expandTilde, with {home} standing for the home directory
 }
 
-var parseREADMETests = []parseREADMETest{
-	// three code blocks, only two with comment code tags. one with one command, the other with two commands
-	{
-		inFileName: "readme_test.md",
-		lifecycle: Lifecycle{
-			exec.Command("echo", "hello", "world"),
-			exec.Command("echo", "line", "one"),
-			exec.Command("echo", "line", "two"),
-		},
-	},
+var expandTildeTests = []expandTildeTest{
+	// bare tilde
+	{in: "~", want: "{home}"},
+
+	// tilde followed by a path
+	{in: "~/samples/run", want: "{home}/samples/run"},
+
+	// unsupported ~user form
+	{in: "~user/samples", want: "~user/samples"},
+
+	// tilde not at the start of the word
+	{in: "--source=~/samples", want: "--source=~/samples"},
+
+	// no tilde
+	{in: "samples", want: "samples"},
 }
 
-func TestParseREADME(t *testing.T) {
-	for i, tc := range parseREADMETests {
-		if tc.inFileName == "" {
-			continue
+func TestExpandTilde(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("os.UserHomeDir: %v", err)
+	}
+
+	for i, tc := range expandTildeTests {
+		want := strings.Replace(tc.want, "{home}", home, 1)
+		if got := expandTilde(tc.in); got != want {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, want, got)
 		}
+	}
+}
 
-		// Cloud Run Service name and Container Registry URL tag replacement will be tested in TestToCommands
-		lifecycle, err := parseREADME(tc.inFileName, "", "")
+func TestToCommandsTildeExpansion(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("os.UserHomeDir: %v", err)
+	}
 
-		if !errors.Is(err, tc.err) {
-			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
-			continue
-		}
+	// tilde expansion is applied after environment variable expansion
+	if err := os.Setenv("TEST_TILDE_DIR", "~/from-env"); err != nil {
+		t.Fatalf("os.Setenv: %v", err)
+	}
+	defer os.Unsetenv("TEST_TILDE_DIR")
 
-		if err == nil && !reflect.DeepEqual(lifecycle, tc.lifecycle) {
-			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.lifecycle, lifecycle)
-			continue
-		}
+	cb := codeBlock{"ls ~/samples ~ ${TEST_TILDE_DIR} ~user"}
+	cmds, err := cb.toCommands(uniqueServiceName, uniqueGCRURL)
+	if err != nil {
+		t.Fatalf("codeBlock.toCommands: %v", err)
+	}
+
+	want := Lifecycle{{Cmd: exec.Command("ls", home+"/samples", home, home+"/from-env", "~user")}}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("result mismatch\nwant: %#+v\ngot: %#+v", want, cmds)
 	}
 }
 
-type extractLifecycleTest struct {
-	in        string    // input Markdown string
-	lifecycle Lifecycle // expected results of extractLifecycle on in
-	err       error     // expected error
+type replaceRegionTest struct {
+	codeBlock codeBlock // input code block
+	region    string    // input region
+	cmds      Lifecycle // expected result of codeBlock.toExplainedCommands
 }
 
-var extractLifecycleTests = []extractLifecycleTest{
-	// single code block
+var replaceRegionTests = []replaceRegionTest{
+	// --region=value flag
 	{
-		in: "[//]: # ({sst-run-unix})\n" +
-			"```\n" +
-			"echo hello world\n" +
-			"```\n",
-		lifecycle: Lifecycle{
-			exec.Command("echo", "hello", "world"),
+		codeBlock: codeBlock{"gcloud run deploy hello --image=img --region=us-central1"},
+		region:    "europe-west1",
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--image=img", "--region=europe-west1")},
 		},
 	},
 
-	// two code blocks with markdown text in the middle
+	// --region value flag
 	{
-		in: "[//]: # ({sst-run-unix})\n" +
-			"```\n" +
-			"echo build command\n" +
-			"```\n" +
-			"markdown instructions\n" +
-			"[//]: # ({sst-run-unix})\n" +
-			"```\n" +
-			"echo deploy command\n" +
-			"```\n",
-		lifecycle: Lifecycle{
-			exec.Command("echo", "build", "command"),
-			exec.Command("echo", "deploy", "command"),
+		codeBlock: codeBlock{"gcloud run deploy hello --region us-central1 --image=img"},
+		region:    "europe-west1",
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--region", "europe-west1", "--image=img")},
 		},
 	},
-}
-
-func TestExtractLifecycle(t *testing.T) {
-	for i, tc := range extractLifecycleTests {
-		if tc.in == "" {
-			continue
-		}
 
-		s := bufio.NewScanner(strings.NewReader(tc.in))
+	// region environment variable assignment
+	{
+		codeBlock: codeBlock{"GCLOUD_REGION=us-central1 OTHER=us-central1 ./deploy.sh"},
+		region:    "europe-west1",
+		cmds: Lifecycle{
+			{Cmd: commandWithEnv(exec.Command("./deploy.sh"), "GCLOUD_REGION=europe-west1", "OTHER=us-central1")},
+		},
+	},
 
-		// Cloud Run Service name and Container Registry URL tag replacement will be tested in TestToCommands
-		lifecycle, err := extractLifecycle(s, "", "")
+	// no region override
+	{
+		codeBlock: codeBlock{"gcloud run deploy hello --image=img --region=us-central1"},
+		cmds: Lifecycle{
+			{Cmd: exec.Command("gcloud", "--quiet", "run", "deploy", uniqueServiceName, "--image=img", "--region=us-central1")},
+		},
+	},
+}
 
-		if !errors.Is(err, tc.err) {
-			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+func TestReplaceRegion(t *testing.T) {
+	for i, tc := range replaceRegionTests {
+		cmds, _, err := tc.codeBlock.toExplainedCommands(uniqueServiceName, uniqueGCRURL, newParseOptions([]ParseOption{WithRegion(tc.region)}))
+		if err != nil {
+			t.Errorf("#%d: codeBlock.toExplainedCommands: %v", i, err)
 			continue
 		}
 
-		if err == nil && !reflect.DeepEqual(lifecycle, tc.lifecycle) {
-			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.lifecycle, lifecycle)
+		if !reflect.DeepEqual(cmds, tc.cmds) {
+			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.cmds, cmds)
 		}
 	}
 }
 
 type extractCodeBlocksTest struct {
 	in         string      // input Markdown string
+	tag        string      // code tag to extract code blocks for; defaults to defaultCodeTag
 	codeBlocks []codeBlock // expected result of extractCodeBlocks
 	err        error       // expected return error of extractCodeBlocks
+	line       int         // expected line number carried by the error, if any
+	text       string      // expected offending line carried by the error, if any
 }
 
 var extractCodeBlocksTests = []extractCodeBlocksTest{
@@ -354,6 +1345,8 @@ var extractCodeBlocksTests = []extractCodeBlocksTest{
 			"echo hello world\n",
 		codeBlocks: nil,
 		err:        errCodeBlockNotClosed,
+		line:       2,
+		text:       "```",
 	},
 
 	// code block doesn't start immediately after code tag
@@ -365,6 +1358,91 @@ var extractCodeBlocksTests = []extractCodeBlocksTest{
 			"```\n",
 		codeBlocks: nil,
 		err:        errCodeBlockStartNotFound,
+		line:       2,
+		text:       "not start of code block",
+	},
+
+	// bash info string
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```bash\n" +
+			"echo hello world\n" +
+			"```\n",
+		codeBlocks: []codeBlock{
+			[]string{
+				"echo hello world",
+			},
+		},
+	},
+
+	// sh info string
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```sh\n" +
+			"echo hello world\n" +
+			"```\n",
+		codeBlocks: []codeBlock{
+			[]string{
+				"echo hello world",
+			},
+		},
+	},
+
+	// bare fence
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"echo hello world\n" +
+			"```\n",
+		codeBlocks: []codeBlock{
+			[]string{
+				"echo hello world",
+			},
+		},
+	},
+
+	// fence with an info string doesn't close a code block
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"````bash\n" +
+			"echo hello world\n" +
+			"```bash\n" +
+			"````\n",
+		codeBlocks: []codeBlock{
+			[]string{
+				"echo hello world",
+				"```bash",
+			},
+		},
+	},
+
+	// CRLF line endings
+	{
+		in: "[//]: # ({sst-run-unix})\r\n" +
+			"```\r\n" +
+			"echo hello world\r\n" +
+			"```\r\n",
+		codeBlocks: []codeBlock{
+			[]string{
+				"echo hello world",
+			},
+		},
+	},
+
+	// CRLF line endings, two lines and no trailing line ending
+	{
+		in: "instructions\r\n" +
+			"[//]: # ({sst-run-unix})\r\n" +
+			"````\r\n" +
+			"echo line one \\\r\n" +
+			"  --flag\r\n" +
+			"````",
+		codeBlocks: []codeBlock{
+			[]string{
+				"echo line one \\",
+				"--flag",
+			},
+		},
 	},
 
 	// EOF immediately after code tag
@@ -373,6 +1451,8 @@ var extractCodeBlocksTests = []extractCodeBlocksTest{
 			"[//]: # ({sst-run-unix})\n",
 		codeBlocks: nil,
 		err:        errEOFAfterCodeTag,
+		line:       2,
+		text:       "[//]: # ({sst-run-unix})",
 	},
 
 	// single code block, two lines
@@ -435,6 +1515,41 @@ var extractCodeBlocksTests = []extractCodeBlocksTest{
 			"```\n",
 		codeBlocks: nil,
 	},
+
+	// unix and windows code blocks, extracting unix
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"echo unix command\n" +
+			"```\n" +
+			"[//]: # ({sst-run-windows})\n" +
+			"```\n" +
+			"echo windows command\n" +
+			"```\n",
+		codeBlocks: []codeBlock{
+			[]string{
+				"echo unix command",
+			},
+		},
+	},
+
+	// unix and windows code blocks, extracting windows
+	{
+		in: "[//]: # ({sst-run-unix})\n" +
+			"```\n" +
+			"echo unix command\n" +
+			"```\n" +
+			"[//]: # ({sst-run-windows})\n" +
+			"```\n" +
+			"echo windows command\n" +
+			"```\n",
+		tag: "{sst-run-windows}",
+		codeBlocks: []codeBlock{
+			[]string{
+				"echo windows command",
+			},
+		},
+	},
 }
 
 func TestExtractCodeBlocks(t *testing.T) {
@@ -444,15 +1559,82 @@ func TestExtractCodeBlocks(t *testing.T) {
 		}
 
 		s := bufio.NewScanner(strings.NewReader(tc.in))
-		codeBlocks, err := extractCodeBlocks(s)
+		tag := tc.tag
+		if tag == "" {
+			tag = defaultCodeTag
+		}
+
+		codeBlocks, err := extractCodeBlocks(s, tag)
 
 		if !errors.Is(err, tc.err) {
 			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
 			continue
 		}
 
+		var parseErr *ParseError
+		if err != nil && errors.As(err, &parseErr) && (parseErr.Line != tc.line || parseErr.Text != tc.text) {
+			t.Errorf("#%d: location mismatch\nwant: line %d, %q\ngot: line %d, %q", i, tc.line, tc.text, parseErr.Line,
+				parseErr.Text)
+		}
+
 		if err == nil && !reflect.DeepEqual(codeBlocks, tc.codeBlocks) {
 			t.Errorf("#%d: result mismatch\nwant: %#+v\ngot: %#+v", i, tc.codeBlocks, codeBlocks)
 		}
 	}
 }
+
+type replaceProjectIDTest struct {
+	line string // input command line
+	want string // expected result of replaceProjectID
+}
+
+var replaceProjectIDTests = []replaceProjectIDTest{
+	// command substitution
+	{
+		line: "gcloud builds submit --tag=gcr.io/$(gcloud config get-value project)/hello",
+		want: "gcloud builds submit --tag=gcr.io/my-project/hello",
+	},
+	{
+		line: `echo "$( gcloud config get-value core/project )"`,
+		want: `echo "my-project"`,
+	},
+
+	// placeholder words
+	{
+		line: "gcloud run deploy --image gcr.io/PROJECT_ID/hello --project=[YOUR_PROJECT_ID] <PROJECT_ID>",
+		want: "gcloud run deploy --image gcr.io/my-project/hello --project=my-project my-project",
+	},
+
+	// environment variable references and assignments are left alone
+	{
+		line: "PROJECT_ID=other echo $PROJECT_ID ${PROJECT_ID} ${PROJECT_ID:-x} MY_PROJECT_ID",
+		want: "PROJECT_ID=other echo $PROJECT_ID ${PROJECT_ID} ${PROJECT_ID:-x} MY_PROJECT_ID",
+	},
+}
+
+func TestReplaceProjectID(t *testing.T) {
+	for i, tc := range replaceProjectIDTests {
+		if got := replaceProjectID(tc.line, "my-project"); got != tc.want {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.want, got)
+		}
+	}
+}
+
+func TestToCommandsProjectID(t *testing.T) {
+	cb := codeBlock{"gcloud config set project PROJECT_ID"}
+	cmds, explanations, err := cb.toExplainedCommands(uniqueServiceName, uniqueGCRURL,
+		newParseOptions([]ParseOption{WithProjectID("my-project")}))
+	if err != nil {
+		t.Fatalf("codeBlock.toExplainedCommands: %v", err)
+	}
+
+	want := Lifecycle{{Cmd: exec.Command("gcloud", "--quiet", "config", "set", "project", "my-project")}}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, cmds)
+	}
+
+	if len(explanations) != 1 || len(explanations[0].Transformations) == 0 ||
+		explanations[0].Transformations[0].Kind != TransformProjectID {
+		t.Errorf("explanation missing project ID replacement: %+v", explanations)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// doubleQuoteEscapable holds the characters a backslash escapes inside double quotes. Inside double quotes, a backslash
+// followed by any other character is kept literally.
+const doubleQuoteEscapable = "\"\\$`"
+
+// shellSafeChars are the characters that never need quoting in a shell word.
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-"
+
+var (
+	errUnterminatedQuote  = fmt.Errorf("unexpected end of command: quote not closed")
+	errEmptyPipelineStage = fmt.Errorf("pipeline stage without a command")
+	errEmptyListCommand   = fmt.Errorf("`&&` or `;` without a command")
+)
+
+// listCommand is one of the commands of a command line separated by `&&` or `;`.
+type listCommand struct {
+	// line is the command's part of the command line.
+	line string
+
+	// ignoreFailure is set if the command is followed by `;`, so that the commands after it run even if it fails.
+	ignoreFailure bool
+
+	// andNext is set if the command is followed by `&&`, so that the rest of its `&&` list is skipped if it fails.
+	andNext bool
+}
+
+// splitWords splits a terminal command line into words the way a POSIX shell does. Words are separated by unquoted
+// spaces and tabs. Single quotes preserve the literal value of every character they enclose. Double quotes do too,
+// except that a backslash escapes a following `"`, `\`, `$`, or backtick. Outside of quotes, a backslash preserves
+// the literal value of the character that follows it. Quotes don't end a word, so `--flag="a b"` is the single word
+// `--flag=a b`. A `|` is kept as part of the word it appears in.
+func splitWords(line string) ([]string, error) {
+	stages, err := scanWords(line, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return stages[0], nil
+}
+
+// splitPipeline splits a terminal command line into the words of each command of a pipeline. Commands are separated by
+// unquoted `|` characters, which don't need to be surrounded by spaces, and their words are split like splitWords
+// does. It returns errEmptyPipelineStage if a `|` isn't both preceded and followed by a command.
+func splitPipeline(line string) ([][]string, error) {
+	stages, err := scanWords(line, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stages) > 1 {
+		for _, s := range stages {
+			if len(s) == 0 {
+				return nil, errEmptyPipelineStage
+			}
+		}
+	}
+
+	return stages, nil
+}
+
+// splitCommandList splits a terminal command line into the commands separated by unquoted `&&` and `;`, like a shell's
+// command list. A command followed by `;` has ignoreFailure set, while one followed by `&&` has andNext set. Quotes and
+// backslash escapes are kept as they are, for the commands to be split into words later. A single trailing `;` is
+// allowed; it returns errEmptyListCommand for any other separator not both preceded and followed by a command.
+func splitCommandList(line string) ([]listCommand, error) {
+	var cmds []listCommand
+	start := 0
+	add := func(end int, ignoreFailure, andNext bool) error {
+		part := line[start:end]
+		if strings.TrimSpace(part) == "" {
+			return errEmptyListCommand
+		}
+
+		cmds = append(cmds, listCommand{line: part, ignoreFailure: ignoreFailure, andNext: andNext})
+		return nil
+	}
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errUnterminatedQuote
+			}
+			i += end + 1
+
+		case c == '"':
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(line) {
+				return nil, errUnterminatedQuote
+			}
+
+		case c == ';':
+			if err := add(i, true, false); err != nil {
+				return nil, err
+			}
+			start = i + 1
+
+		case c == '&' && i+1 < len(line) && line[i+1] == '&':
+			if err := add(i, false, true); err != nil {
+				return nil, err
+			}
+			i++
+			start = i + 1
+		}
+	}
+
+	if len(cmds) == 0 {
+		return []listCommand{{line: line}}, nil
+	}
+
+	// a trailing `;` only ends the last command
+	last := &cmds[len(cmds)-1]
+	if strings.TrimSpace(line[start:]) == "" && last.ignoreFailure {
+		last.ignoreFailure = false
+		return cmds, nil
+	}
+
+	if err := add(len(line), false, false); err != nil {
+		return nil, err
+	}
+	return cmds, nil
+}
+
+// quoteWord returns the provided word quoted for a POSIX shell, so that splitWords splits it back into the same single
+// word. Words made only of characters that are never special to a shell are returned as they are, while others are
+// enclosed in single quotes.
+func quoteWord(w string) string {
+	if w != "" && strings.Trim(w, shellSafeChars) == "" {
+		return w
+	}
+
+	return "'" + strings.Replace(w, "'", `'\''`, -1) + "'"
+}
+
+// scanWords is a helper function for splitWords and splitPipeline. It splits a terminal command line into words,
+// grouped into a new command at each unquoted `|` if pipes is true. It always returns at least one, possibly empty,
+// command.
+func scanWords(line string, pipes bool) ([][]string, error) {
+	var stages [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+
+		case c == '|' && pipes:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+
+			stages = append(stages, words)
+			words = nil
+
+		case c == '\\':
+			inWord = true
+			if i+1 < len(line) {
+				i++
+			}
+			word.WriteByte(line[i])
+
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errUnterminatedQuote
+			}
+
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(line); i++ {
+				c = line[i]
+				if c == '"' {
+					closed = true
+					break
+				}
+
+				if c == '\\' && i+1 < len(line) && strings.IndexByte(doubleQuoteEscapable, line[i+1]) >= 0 {
+					i++
+					c = line[i]
+				}
+				word.WriteByte(c)
+			}
+
+			if !closed {
+				return nil, errUnterminatedQuote
+			}
+
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return append(stages, words), nil
+}
@@ -0,0 +1,304 @@
+package lifecycle
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type splitWordsTest struct {
+	line  string   // input command line
+	words []string // expected result of splitWords
+	err   error    // expected return error of splitWords
+}
+
+var splitWordsTests = []splitWordsTest{
+	// unquoted words
+	{
+		line:  "echo hello world",
+		words: []string{"echo", "hello", "world"},
+	},
+
+	// repeated and leading whitespace
+	{
+		line:  "  echo \thello   world ",
+		words: []string{"echo", "hello", "world"},
+	},
+
+	// double quotes with embedded spaces
+	{
+		line:  `gcloud run deploy svc --set-env-vars="FOO=a b,BAR=c"`,
+		words: []string{"gcloud", "run", "deploy", "svc", "--set-env-vars=FOO=a b,BAR=c"},
+	},
+
+	// single quotes with embedded spaces
+	{
+		line:  `echo 'hello world'`,
+		words: []string{"echo", "hello world"},
+	},
+
+	// escaped quotes inside double quotes
+	{
+		line:  `echo "say \"hi\" \\ \n"`,
+		words: []string{"echo", `say "hi" \ \n`},
+	},
+
+	// backslashes inside single quotes are literal
+	{
+		line:  `echo 'a\"b'`,
+		words: []string{"echo", `a\"b`},
+	},
+
+	// escaped space outside quotes
+	{
+		line:  `echo hello\ world`,
+		words: []string{"echo", "hello world"},
+	},
+
+	// empty quoted word
+	{
+		line:  `echo ""`,
+		words: []string{"echo", ""},
+	},
+
+	// adjacent quoted and unquoted parts form a single word
+	{
+		line:  `echo a"b c"'d e'f`,
+		words: []string{"echo", "ab cd ef"},
+	},
+
+	// unterminated double quote
+	{
+		line: `echo "hello`,
+		err:  errUnterminatedQuote,
+	},
+
+	// unterminated single quote
+	{
+		line: `echo 'hello`,
+		err:  errUnterminatedQuote,
+	},
+
+	// pipes are literal
+	{
+		line:  `echo a|b | c`,
+		words: []string{"echo", "a|b", "|", "c"},
+	},
+}
+
+func TestSplitWords(t *testing.T) {
+	for i, tc := range splitWordsTests {
+		words, err := splitWords(tc.line)
+
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(words, tc.words) {
+			t.Errorf("#%d: result mismatch\nwant: %q\ngot: %q", i, tc.words, words)
+		}
+	}
+}
+
+type splitPipelineTest struct {
+	line   string     // input command line
+	stages [][]string // expected result of splitPipeline
+	err    error      // expected return error of splitPipeline
+}
+
+var splitPipelineTests = []splitPipelineTest{
+	// single command
+	{
+		line:   "echo hello world",
+		stages: [][]string{{"echo", "hello", "world"}},
+	},
+
+	// two commands
+	{
+		line:   "gcloud run services list | grep hello",
+		stages: [][]string{{"gcloud", "run", "services", "list"}, {"grep", "hello"}},
+	},
+
+	// three commands, pipes without surrounding spaces
+	{
+		line:   "echo hello|tr a-z A-Z|cat",
+		stages: [][]string{{"echo", "hello"}, {"tr", "a-z", "A-Z"}, {"cat"}},
+	},
+
+	// quoted and escaped pipes are literal
+	{
+		line:   `echo "a|b" 'c|d' e\|f`,
+		stages: [][]string{{"echo", "a|b", "c|d", "e|f"}},
+	},
+
+	// empty line
+	{
+		line:   "",
+		stages: [][]string{nil},
+	},
+
+	// pipe without a following command
+	{
+		line: "echo hello |",
+		err:  errEmptyPipelineStage,
+	},
+
+	// pipe without a preceding command
+	{
+		line: "| cat",
+		err:  errEmptyPipelineStage,
+	},
+
+	// consecutive pipes
+	{
+		line: "echo hello | | cat",
+		err:  errEmptyPipelineStage,
+	},
+}
+
+func TestSplitPipeline(t *testing.T) {
+	for i, tc := range splitPipelineTests {
+		stages, err := splitPipeline(tc.line)
+
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(stages, tc.stages) {
+			t.Errorf("#%d: result mismatch\nwant: %q\ngot: %q", i, tc.stages, stages)
+		}
+	}
+}
+
+type splitCommandListTest struct {
+	line string        // input command line
+	cmds []listCommand // expected result of splitCommandList
+	err  error         // expected return error of splitCommandList
+}
+
+var splitCommandListTests = []splitCommandListTest{
+	// single command
+	{
+		line: "echo hello",
+		cmds: []listCommand{{line: "echo hello"}},
+	},
+
+	// `&&`
+	{
+		line: "echo a && echo b",
+		cmds: []listCommand{{line: "echo a ", andNext: true}, {line: " echo b"}},
+	},
+
+	// `;`
+	{
+		line: "echo a; echo b",
+		cmds: []listCommand{{line: "echo a", ignoreFailure: true}, {line: " echo b"}},
+	},
+
+	// mix of both
+	{
+		line: "echo a && echo b; echo c",
+		cmds: []listCommand{
+			{line: "echo a ", andNext: true},
+			{line: " echo b", ignoreFailure: true},
+			{line: " echo c"},
+		},
+	},
+
+	// trailing `;`
+	{
+		line: "echo a;",
+		cmds: []listCommand{{line: "echo a"}},
+	},
+
+	// quoted and escaped separators
+	{
+		line: `echo "a && b" 'c; d' e\;f`,
+		cmds: []listCommand{{line: `echo "a && b" 'c; d' e\;f`}},
+	},
+
+	// escaped quote inside double quotes
+	{
+		line: `echo "a \" ; b" ; echo c`,
+		cmds: []listCommand{{line: `echo "a \" ; b" `, ignoreFailure: true}, {line: " echo c"}},
+	},
+
+	// a single `&` isn't a separator
+	{
+		line: "echo a & echo b",
+		cmds: []listCommand{{line: "echo a & echo b"}},
+	},
+
+	// missing commands
+	{
+		line: "&& echo a",
+		err:  errEmptyListCommand,
+	},
+	{
+		line: "echo a &&",
+		err:  errEmptyListCommand,
+	},
+	{
+		line: "echo a ;; echo b",
+		err:  errEmptyListCommand,
+	},
+
+	// unterminated quote
+	{
+		line: `echo "a ; b`,
+		err:  errUnterminatedQuote,
+	},
+}
+
+func TestSplitCommandList(t *testing.T) {
+	for i, tc := range splitCommandListTests {
+		cmds, err := splitCommandList(tc.line)
+
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(cmds, tc.cmds) {
+			t.Errorf("#%d: result mismatch\nwant: %+v\ngot: %+v", i, tc.cmds, cmds)
+		}
+	}
+}
+
+type quoteWordTest struct {
+	word   string // input word
+	quoted string // expected result of quoteWord
+}
+
+var quoteWordTests = []quoteWordTest{
+	// safe word
+	{word: "--image=gcr.io/project/hello", quoted: "--image=gcr.io/project/hello"},
+
+	// empty word
+	{word: "", quoted: "''"},
+
+	// spaces
+	{word: "FOO=a b", quoted: "'FOO=a b'"},
+
+	// shell special characters
+	{word: "$HOME;|&*", quoted: "'$HOME;|&*'"},
+
+	// single quote
+	{word: "it's", quoted: `'it'\''s'`},
+}
+
+func TestQuoteWord(t *testing.T) {
+	for i, tc := range quoteWordTests {
+		quoted := quoteWord(tc.word)
+		if quoted != tc.quoted {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.quoted, quoted)
+		}
+
+		words, err := splitWords(quoted)
+		if err != nil || !reflect.DeepEqual(words, []string{tc.word}) {
+			t.Errorf("#%d: round trip mismatch\nwant: %q\ngot: %q (%v)", i, []string{tc.word}, words, err)
+		}
+	}
+}
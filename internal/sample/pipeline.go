@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sample
+
+import (
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"sync"
+)
+
+// Phase is a named step in testing a sample, such as building and deploying it or validating its endpoints.
+type Phase struct {
+	Name string
+	Run  func() error
+
+	// Always makes the Phase run even once an earlier Phase of its Job failed, such as for cleaning up.
+	Always bool
+}
+
+// Job is the ordered list of Phases needed to test a single sample.
+type Job struct {
+	Name   string
+	Phases []Phase
+
+	// Done, if set, is called with the error the Job failed with, if any, once all of its Phases ran, such as to
+	// record its outcome.
+	Done func(err error)
+}
+
+// RunJobs runs the provided Jobs concurrently. Each Job's Phases run in order and a Job stops at its first failing
+// Phase, except for the Phases that always run. Phases of different Jobs may overlap -- one sample's endpoints can be
+// validated while another sample is being deployed -- but no more than concurrency Phases run at any one time. It
+// returns the error each Job failed with, if any, indexed the same way as jobs.
+func RunJobs(jobs []Job, concurrency int) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	errs := make([]error, len(jobs))
+
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, j Job) {
+			defer wg.Done()
+			errs[i] = runJob(j, sem)
+		}(i, j)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// runJob runs the Phases of a single Job in order, holding a slot of the provided semaphore while each Phase runs, then
+// calls its Done function. It returns the error of the first failing Phase.
+func runJob(j Job, sem chan struct{}) error {
+	var err error
+	for _, p := range j.Phases {
+		if err != nil && !p.Always {
+			continue
+		}
+
+		sem <- struct{}{}
+		util.Infof("[%s] Starting %s phase\n", j.Name, p.Name)
+		perr := p.Run()
+		<-sem
+
+		if perr != nil && err == nil {
+			err = fmt.Errorf("%s phase: %w", p.Name, perr)
+		}
+	}
+
+	if j.Done != nil {
+		j.Done(err)
+	}
+
+	return err
+}
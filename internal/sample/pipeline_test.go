@@ -0,0 +1,197 @@
+package sample
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// phaseTracker records how many fake Phases are running at once and the order Phases start in.
+type phaseTracker struct {
+	mu      sync.Mutex
+	running int
+	max     int
+	started []string
+}
+
+// phase returns a fake Phase that records itself in the tracker, waits on the provided channel if it isn't nil, and
+// returns the provided error.
+func (pt *phaseTracker) phase(name string, wait <-chan struct{}, err error) Phase {
+	return pt.run(name, func() error {
+		if wait != nil {
+			<-wait
+		}
+		return err
+	})
+}
+
+// rendezvous returns a fake Phase that closes the provided channel once the tracker has counted it as running, then
+// waits on the other one, so that two rendezvous Phases only finish once both were counted as running at once.
+func (pt *phaseTracker) rendezvous(name string, c chan struct{}, other <-chan struct{}) Phase {
+	return pt.run(name, func() error {
+		close(c)
+		<-other
+		return nil
+	})
+}
+
+// run returns a fake Phase that records itself in the tracker and counts as running while the provided body runs.
+func (pt *phaseTracker) run(name string, body func() error) Phase {
+	return Phase{
+		Name: name,
+		Run: func() error {
+			pt.mu.Lock()
+			pt.running++
+			if pt.running > pt.max {
+				pt.max = pt.running
+			}
+			pt.started = append(pt.started, name)
+			pt.mu.Unlock()
+
+			err := body()
+
+			pt.mu.Lock()
+			pt.running--
+			pt.mu.Unlock()
+			return err
+		},
+	}
+}
+
+// runJobsWithTimeout runs RunJobs and fails the test if it doesn't return in time.
+func runJobsWithTimeout(t *testing.T, jobs []Job, concurrency int) []error {
+	done := make(chan []error)
+	go func() {
+		done <- RunJobs(jobs, concurrency)
+	}()
+
+	select {
+	case errs := <-done:
+		return errs
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunJobs did not return: phases of different jobs did not overlap")
+		return nil
+	}
+}
+
+func TestRunJobsOverlapsPhases(t *testing.T) {
+	pt := &phaseTracker{}
+	aValidating, bDeploying := make(chan struct{}), make(chan struct{})
+
+	// a's validate phase and b's deploy phase can only finish once both are running, so the jobs only complete if a
+	// sample can be validated while another is still deploying.
+	jobs := []Job{
+		{Name: "a", Phases: []Phase{pt.phase("a-deploy", nil, nil), pt.rendezvous("a-validate", aValidating, bDeploying)}},
+		{Name: "b", Phases: []Phase{pt.rendezvous("b-deploy", bDeploying, aValidating), pt.phase("b-validate", nil, nil)}},
+	}
+
+	errs := runJobsWithTimeout(t, jobs, 2)
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+
+	if pt.max != 2 {
+		t.Errorf("max concurrency mismatch\nwant: %d\ngot: %d", 2, pt.max)
+	}
+}
+
+func TestRunJobsBoundsConcurrency(t *testing.T) {
+	pt := &phaseTracker{}
+
+	var jobs []Job
+	for _, n := range []string{"a", "b", "c", "d"} {
+		jobs = append(jobs, Job{Name: n, Phases: []Phase{pt.phase(n+"-deploy", nil, nil), pt.phase(n+"-validate", nil, nil)}})
+	}
+
+	runJobsWithTimeout(t, jobs, 1)
+	if pt.max != 1 {
+		t.Errorf("max concurrency mismatch\nwant: %d\ngot: %d", 1, pt.max)
+	}
+
+	// each job's phases must start in order
+	seen := make(map[string]bool)
+	for _, s := range pt.started {
+		seen[s] = true
+		if n := s[:1]; s == n+"-validate" && !seen[n+"-deploy"] {
+			t.Errorf("%s started before %s-deploy", s, n)
+		}
+	}
+}
+
+func TestRunJobsStopsAtFailingPhase(t *testing.T) {
+	pt := &phaseTracker{}
+	errDeploy := errors.New("deploy failed")
+
+	jobs := []Job{
+		{Name: "a", Phases: []Phase{pt.phase("a-deploy", nil, errDeploy), pt.phase("a-validate", nil, nil)}},
+		{Name: "b", Phases: []Phase{pt.phase("b-deploy", nil, nil), pt.phase("b-validate", nil, nil)}},
+	}
+
+	errs := runJobsWithTimeout(t, jobs, 2)
+	if !errors.Is(errs[0], errDeploy) {
+		t.Errorf("#0: error mismatch\nwant: %v\ngot: %v", errDeploy, errs[0])
+	}
+	if errs[1] != nil {
+		t.Errorf("#1: unexpected error: %v", errs[1])
+	}
+
+	for _, s := range pt.started {
+		if s == "a-validate" {
+			t.Errorf("a-validate started after a-deploy failed")
+		}
+	}
+}
+
+func TestRunJobsRunsAlwaysPhases(t *testing.T) {
+	pt := &phaseTracker{}
+	errDeploy := errors.New("deploy failed")
+	errCleanup := errors.New("cleanup failed")
+
+	cleanup := pt.phase("a-cleanup", nil, errCleanup)
+	cleanup.Always = true
+	jobs := []Job{
+		{Name: "a", Phases: []Phase{pt.phase("a-deploy", nil, errDeploy), pt.phase("a-validate", nil, nil), cleanup}},
+	}
+
+	errs := runJobsWithTimeout(t, jobs, 1)
+	if !errors.Is(errs[0], errDeploy) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", errDeploy, errs[0])
+	}
+
+	want := []string{"a-deploy", "a-cleanup"}
+	if !reflect.DeepEqual(pt.started, want) {
+		t.Errorf("started phases mismatch\nwant: %v\ngot: %v", want, pt.started)
+	}
+}
+
+func TestRunJobsCallsDone(t *testing.T) {
+	pt := &phaseTracker{}
+	errDeploy := errors.New("deploy failed")
+
+	var mu sync.Mutex
+	done := make(map[string]error)
+	record := func(name string) func(error) {
+		return func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			done[name] = err
+		}
+	}
+
+	jobs := []Job{
+		{Name: "a", Phases: []Phase{pt.phase("a-deploy", nil, errDeploy)}, Done: record("a")},
+		{Name: "b", Phases: []Phase{pt.phase("b-deploy", nil, nil)}, Done: record("b")},
+	}
+
+	runJobsWithTimeout(t, jobs, 2)
+	if err, ok := done["a"]; !ok || !errors.Is(err, errDeploy) {
+		t.Errorf("a: Done error mismatch\nwant: %v\ngot: %v (called: %t)", errDeploy, err, ok)
+	}
+	if err, ok := done["b"]; !ok || err != nil {
+		t.Errorf("b: Done error mismatch\nwant: <nil>\ngot: %v (called: %t)", err, ok)
+	}
+}
@@ -15,10 +15,15 @@
 package sample
 
 import (
+	"context"
+	crand "crypto/rand"
 	"fmt"
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/gcloud"
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/lifecycle"
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"io"
+	"log"
+	"math/rand"
 	"os/exec"
 	"strings"
 	"unicode"
@@ -41,32 +46,198 @@ type Sample struct {
 
 	// The URL location of this sample's build container image in the GCP Container Registry.
 	cloudContainerImageURL string
+
+	// The options the sample's README is parsed with.
+	parseOpts []lifecycle.ParseOption
+}
+
+// Option configures optional behavior of NewSample.
+type Option func(*options)
+
+// options holds the configuration set by the Options passed to NewSample.
+type options struct {
+	randSource        io.Reader
+	serviceNameMaxLen int
+	serviceName       string
+	codeTag           string
+	readme            string
+	projectID         string
+	region            string
+	imageURL          string
+	registryHosts     []string
+	gcloudFlags       []string
+	unsetEnvWarnings  bool
+}
+
+// WithSeed makes the random parts of the sample's generated resource names deterministic by deriving them from the
+// provided seed. Two samples created from the same directory with the same seed get identical service names and
+// substituted commands.
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.randSource = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithServiceNameMaxLen sets the maximum length of the sample's generated Cloud Run service name, which can be at
+// most 63 characters. Defaults to gcloud.DefaultServiceNameMaxLen.
+func WithServiceNameMaxLen(n int) Option {
+	return func(o *options) {
+		o.serviceNameMaxLen = n
+	}
+}
+
+// WithServiceName deploys the sample to a Cloud Run service with the provided name instead of a generated one. The
+// README's service name is replaced with it.
+func WithServiceName(name string) Option {
+	return func(o *options) {
+		o.serviceName = name
+	}
+}
+
+// WithCodeTag parses build and deploy commands from README code blocks annotated with the provided tag instead of the
+// default one (see lifecycle.WithCodeTag).
+func WithCodeTag(tag string) Option {
+	return func(o *options) {
+		o.codeTag = tag
+	}
+}
+
+// WithREADME parses build and deploy commands from the provided markdown file instead of the sample's README.md (see
+// lifecycle.WithREADME).
+func WithREADME(name string) Option {
+	return func(o *options) {
+		o.readme = name
+	}
+}
+
+// WithProjectID uses the provided project ID instead of the gcloud default project for the sample's default container
+// image URL, and for the project ID placeholders of the README's build and deploy commands (see
+// lifecycle.WithProjectID).
+func WithProjectID(id string) Option {
+	return func(o *options) {
+		o.projectID = id
+	}
+}
+
+// WithRegion replaces the region of the README's build and deploy commands with the provided one (see
+// lifecycle.WithRegion).
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// WithImageURL uses the provided container image URL, such as one in a shared Artifact Registry repository, instead of
+// one derived from the gcloud default project and the sample's name. The README's container image URLs are replaced
+// with it, and it's the image deleted during cleanup.
+func WithImageURL(url string) Option {
+	return func(o *options) {
+		o.imageURL = url
+	}
+}
+
+// WithRegistryHosts replaces the README's container image URLs in the registries with the provided hostnames too, on
+// top of Container Registry and Artifact Registry ones (see lifecycle.WithRegistryHosts).
+func WithRegistryHosts(hosts ...string) Option {
+	return func(o *options) {
+		o.registryHosts = append(o.registryHosts, hosts...)
+	}
+}
+
+// WithGcloudFlags appends the provided flags to every gcloud command of the README or config file (see
+// lifecycle.WithGcloudFlags).
+func WithGcloudFlags(flags ...string) Option {
+	return func(o *options) {
+		o.gcloudFlags = append(o.gcloudFlags, flags...)
+	}
+}
+
+// WithUnsetEnvWarnings warns about the unset environment variables referenced by the README's build and deploy
+// commands instead of failing (see lifecycle.WithUnsetEnvWarnings).
+func WithUnsetEnvWarnings() Option {
+	return func(o *options) {
+		o.unsetEnvWarnings = true
+	}
 }
 
 // NewSample creates a new sample object for the sample located in the provided local directory.
-func NewSample(dir string) (*Sample, error) {
-	name := sampleName(dir)
+func NewSample(dir string, opts ...Option) (*Sample, error) {
+	o := &options{
+		randSource:        crand.Reader,
+		serviceNameMaxLen: gcloud.DefaultServiceNameMaxLen,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
 
-	containerTag, err := cloudContainerImageTag(name, dir)
-	if err != nil {
-		return nil, fmt.Errorf("sample.cloudContainerImageTag: %s %s: %w", name, dir, err)
+	var parseOpts []lifecycle.ParseOption
+	if o.codeTag != "" {
+		parseOpts = append(parseOpts, lifecycle.WithCodeTag(o.codeTag))
+	}
+	if o.readme != "" {
+		parseOpts = append(parseOpts, lifecycle.WithREADME(o.readme))
+	}
+	if o.region != "" {
+		parseOpts = append(parseOpts, lifecycle.WithRegion(o.region))
+	}
+	if len(o.registryHosts) > 0 {
+		parseOpts = append(parseOpts, lifecycle.WithRegistryHosts(o.registryHosts...))
+	}
+	if len(o.gcloudFlags) > 0 {
+		parseOpts = append(parseOpts, lifecycle.WithGcloudFlags(o.gcloudFlags...))
+	}
+	if o.unsetEnvWarnings {
+		parseOpts = append(parseOpts, lifecycle.WithUnsetEnvWarnings())
 	}
 
-	a := append(util.GcloudCommonFlags, "config", "get-value", "core/project")
-	projectID, err := util.ExecCommand(exec.Command("gcloud", a...), dir)
+	if err := lifecycle.CheckREADME(dir, parseOpts...); err != nil {
+		return nil, fmt.Errorf("lifecycle.CheckREADME: %w", err)
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("getting gcloud default project: %w", err)
+	name := sampleName(dir)
+
+	var err error
+	projectID := o.projectID
+	if projectID == "" {
+		projectID, err = gcloud.DefaultProject(dir)
+		if err != nil && o.imageURL == "" {
+			return nil, fmt.Errorf("gcloud.DefaultProject: %w", err)
+		}
+		if err != nil {
+			// the project is only needed for the README's placeholders then
+			log.Printf("Warning: project ID placeholders in build and deploy commands won't be replaced: %v\n", err)
+		}
+	}
+	if projectID != "" {
+		parseOpts = append(parseOpts, lifecycle.WithProjectID(projectID))
 	}
-	cloudContainerImageURL := fmt.Sprintf("gcr.io/%s/%s", projectID, containerTag)
 
-	serviceName, err := gcloud.ServiceName(name)
-	if err != nil {
-		return nil, fmt.Errorf("gcloud.ServiceName: %s sample: %w", name, err)
+	cloudContainerImageURL := o.imageURL
+	if cloudContainerImageURL != "" {
+		if err := gcloud.ValidateImageURL(cloudContainerImageURL); err != nil {
+			return nil, fmt.Errorf("gcloud.ValidateImageURL: %w", err)
+		}
+	} else {
+		cloudContainerImageURL, err = defaultCloudContainerImageURL(name, dir, projectID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	serviceName := o.serviceName
+	if serviceName != "" {
+		if err := gcloud.ValidateServiceName(serviceName); err != nil {
+			return nil, fmt.Errorf("gcloud.ValidateServiceName: %w", err)
+		}
+	} else {
+		serviceName, err = gcloud.ServiceName(name, o.serviceNameMaxLen, o.randSource)
+		if err != nil {
+			return nil, fmt.Errorf("gcloud.ServiceName: %s sample: %w", name, err)
+		}
 	}
 	service := gcloud.CloudRunService{Name: serviceName}
 
-	buildDeployLifecycle, err := lifecycle.NewLifecycle(dir, service.Name, cloudContainerImageURL)
+	buildDeployLifecycle, err := lifecycle.NewLifecycle(dir, service.Name, cloudContainerImageURL, parseOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("lifecycle.NewLifecycle: %w", err)
 	}
@@ -77,10 +248,22 @@ func NewSample(dir string) (*Sample, error) {
 		Service:                service,
 		BuildDeployLifecycle:   buildDeployLifecycle,
 		cloudContainerImageURL: cloudContainerImageURL,
+		parseOpts:              parseOpts,
 	}
 	return s, nil
 }
 
+// defaultCloudContainerImageURL derives the URL of the sample's container image in the Container Registry of the
+// provided project from the sample's name and the HEAD commit of its repository.
+func defaultCloudContainerImageURL(name, dir, projectID string) (string, error) {
+	containerTag, err := cloudContainerImageTag(name, dir)
+	if err != nil {
+		return "", fmt.Errorf("sample.cloudContainerImageTag: %s %s: %w", name, dir, err)
+	}
+
+	return fmt.Sprintf("gcr.io/%s/%s", projectID, containerTag), nil
+}
+
 // sampleName computes a sample name for a sample object. Right now, it's defined as a shortened version of the sample's
 // local directory. Its length is flexible based on the provided length of a suffix that will be appended to the end of
 // the name.
@@ -89,10 +272,22 @@ func sampleName(dir string) string {
 	return strings.ToLower(n)
 }
 
-// DeleteCloudContainerImage deletes the sample's container image off of the Container Registry.
-func (s *Sample) DeleteCloudContainerImage() error {
+// ExplainLifecycle explains how each build and deploy command in the sample's README was transformed while parsing it.
+func (s *Sample) ExplainLifecycle() ([]lifecycle.Explanation, error) {
+	return lifecycle.ExplainREADME(s.Dir, s.Service.Name, s.cloudContainerImageURL, s.parseOpts...)
+}
+
+// DeleteCloudContainerImage deletes the sample's container image off of the Container Registry. The deletion is
+// killed if the provided context is done first. Samples deployed from source never push that image, so there's nothing
+// to delete for them.
+func (s *Sample) DeleteCloudContainerImage(ctx context.Context) error {
+	if s.BuildDeployLifecycle.DeploysFromSource() {
+		util.Infof("Sample deployed from source: no container image to delete\n")
+		return nil
+	}
+
 	a := append(util.GcloudCommonFlags, "container", "images", "delete", s.cloudContainerImageURL)
-	_, err := util.ExecCommand(exec.Command("gcloud", a...), s.Dir)
+	_, err := util.ExecCommandContext(ctx, exec.Command(util.GcloudPath, a...), s.Dir)
 
 	if err != nil {
 		return fmt.Errorf("deleting Container Registry container image: %w", err)
@@ -101,6 +296,24 @@ func (s *Sample) DeleteCloudContainerImage() error {
 	return nil
 }
 
+// RemoveIAMBindings removes the Cloud Run service IAM policy bindings added by the sample's build and deploy
+// lifecycle. Every binding removal is attempted even if an earlier one fails, until the provided context is done.
+func (s *Sample) RemoveIAMBindings(ctx context.Context) error {
+	var failed int
+	for _, st := range s.BuildDeployLifecycle.IAMBindingCleanup() {
+		if _, err := util.ExecCommandContext(ctx, st.Cmd, s.Dir); err != nil {
+			log.Printf("Removing IAM policy binding: %v\n", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("removing %d IAM policy binding(s) failed", failed)
+	}
+
+	return nil
+}
+
 // cloudContainerImageTag creates a container image tag for the provided sample. It concatenates the sample's name
 // with a short SHA of the sample repository's HEAD commit.
 func cloudContainerImageTag(sampleName string, sampleDir string) (string, error) {
@@ -110,7 +323,9 @@ func cloudContainerImageTag(sampleName string, sampleDir string) (string, error)
 	}
 
 	l := maxCloudContainerImageTagLen - len(sha) - 1
-	sampleName = sampleName[len(sampleName)-l:]
+	if len(sampleName) > l {
+		sampleName = sampleName[len(sampleName)-l:]
+	}
 	sampleName = strings.TrimFunc(sampleName, func(r rune) bool {
 		return !unicode.IsLetter(r)
 	})
@@ -0,0 +1,129 @@
+package sample
+
+import (
+	"bytes"
+	"errors"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/lifecycle"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithSeedDeterministic(t *testing.T) {
+	read := func(seed int64) []byte {
+		o := &options{}
+		WithSeed(seed)(o)
+
+		b := make([]byte, 16)
+		if _, err := io.ReadFull(o.randSource, b); err != nil {
+			t.Fatalf("io.ReadFull: %v", err)
+		}
+		return b
+	}
+
+	if a, b := read(7), read(7); !bytes.Equal(a, b) {
+		t.Errorf("random sources with the same seed differ: %x, %x", a, b)
+	}
+
+	if a, b := read(7), read(8); bytes.Equal(a, b) {
+		t.Errorf("random sources with different seeds are identical: %x", a)
+	}
+}
+
+func TestNewSampleImageURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	readme := "[//]: # ({sst-run-unix})\n```\n" +
+		"gcloud builds submit --tag=gcr.io/my-project/hello\n" +
+		"gcloud run deploy hello --image=gcr.io/my-project/hello\n```\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte(readme), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	const imageURL = "us-central1-docker.pkg.dev/shared-project/samples/hello:v1"
+	s, err := NewSample(dir, WithImageURL(imageURL), WithServiceName("hello-test"), WithCodeTag("{sst-run-unix}"))
+	if err != nil {
+		t.Fatalf("NewSample: %v", err)
+	}
+
+	if s.cloudContainerImageURL != imageURL {
+		t.Errorf("cleanup image URL mismatch\nwant: %s\ngot: %s", imageURL, s.cloudContainerImageURL)
+	}
+
+	want := [][]string{
+		{"gcloud", "--quiet", "builds", "submit", "--tag=" + imageURL},
+		{"gcloud", "--quiet", "run", "deploy", "hello-test", "--image=" + imageURL},
+	}
+	var got [][]string
+	for _, c := range s.BuildDeployLifecycle {
+		got = append(got, c.Cmd.Args)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("command mismatch\nwant: %q\ngot: %q", want, got)
+	}
+}
+
+func TestNewSampleInvalidImageURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	if _, err := NewSample(dir, WithImageURL("not an image")); err == nil {
+		t.Errorf("NewSample accepted an invalid image URL")
+	}
+}
+
+func TestNewSampleMissingREADME(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewSample(dir, WithImageURL("gcr.io/project/hello"), WithServiceName("hello-test"))
+	if !errors.Is(err, lifecycle.ErrREADMENotFound) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", lifecycle.ErrREADMENotFound, err)
+	}
+	if err != nil && !strings.Contains(err.Error(), filepath.Join(dir, "README.md")) {
+		t.Errorf("error missing the checked README path: %v", err)
+	}
+}
+
+func TestNewSampleProjectID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	readme := "[//]: # ({sst-run-unix})\n```\n" +
+		"gcloud config set project $(gcloud config get-value project)\n```\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte(readme), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	s, err := NewSample(dir, WithProjectID("my-project"), WithImageURL("gcr.io/my-project/hello"),
+		WithServiceName("hello-test"), WithCodeTag("{sst-run-unix}"))
+	if err != nil {
+		t.Fatalf("NewSample: %v", err)
+	}
+
+	want := []string{"gcloud", "--quiet", "config", "set", "project", "my-project"}
+	if len(s.BuildDeployLifecycle) != 1 || !reflect.DeepEqual(s.BuildDeployLifecycle[0].Cmd.Args, want) {
+		t.Errorf("command mismatch\nwant: %q\ngot: %v", want, s.BuildDeployLifecycle)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sample
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/GoogleCloudPlatform/serverless-sample-tester/internal/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Sample outcomes recorded in a RunState.
+const (
+	statePassed = "passed"
+	stateFailed = "failed"
+)
+
+// RunState records which samples of a run passed and which failed, so that a run interrupted by a failing sample can be
+// resumed without re-testing the samples that already passed. It's persisted as a JSON file and is safe for concurrent
+// use.
+type RunState struct {
+	mu   sync.Mutex
+	path string
+
+	// Samples maps each sample's key, such as its directory, to its outcome.
+	Samples map[string]string `json:"samples"`
+}
+
+// LoadRunState loads the RunState persisted in the provided file. A missing file yields an empty RunState that's saved
+// to that file.
+func LoadRunState(path string) (*RunState, error) {
+	r := &RunState{path: path, Samples: make(map[string]string)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile: %w", err)
+	}
+
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %s: %w", path, err)
+	}
+	if r.Samples == nil {
+		r.Samples = make(map[string]string)
+	}
+
+	return r, nil
+}
+
+// Passed reports whether the sample with the provided key is recorded as passed.
+func (r *RunState) Passed(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.Samples[key] == statePassed
+}
+
+// Record records the outcome of the sample with the provided key and saves the RunState, so that the outcome survives
+// the run being interrupted.
+func (r *RunState) Record(key string, passed bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Samples[key] = stateFailed
+	if passed {
+		r.Samples[key] = statePassed
+	}
+
+	return r.save()
+}
+
+// save writes the RunState to its file. The file is replaced atomically so that an interrupted write can't corrupt
+// it. The caller must hold r.mu.
+func (r *RunState) save() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("ioutil.TempFile: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("os.File.Write: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("os.File.Close: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	return nil
+}
+
+// RunJobs runs the provided Jobs like the RunJobs function, skipping the Jobs whose Name is recorded as passed. It
+// doesn't record the outcome of the Jobs it runs, since only the Job knows whether its outcome counts, e.g. a sample
+// that was only explained or dry-run wasn't tested: Jobs record it themselves, such as from their Done function, as
+// soon as they finish, so that they're skipped when resuming even if the run is interrupted. It returns the error each
+// Job failed with, if any, indexed the same way as jobs; skipped Jobs have no error.
+func (r *RunState) RunJobs(jobs []Job, concurrency int) []error {
+	var pending []Job
+	var indexes []int
+	for i, j := range jobs {
+		if r.Passed(j.Name) {
+			util.Infof("[%s] Skipping: already passed in a previous run\n", j.Name)
+			continue
+		}
+
+		pending = append(pending, j)
+		indexes = append(indexes, i)
+	}
+
+	errs := make([]error, len(jobs))
+	for k, err := range RunJobs(pending, concurrency) {
+		errs[indexes[k]] = err
+	}
+
+	return errs
+}
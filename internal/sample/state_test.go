@@ -0,0 +1,135 @@
+package sample
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newTestRunState creates a RunState persisted in a temporary directory, with the provided outcomes recorded.
+func newTestRunState(t *testing.T, outcomes map[string]bool) (*RunState, func()) {
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+
+	r, err := LoadRunState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatalf("LoadRunState: %v", err)
+	}
+
+	for key, passed := range outcomes {
+		if err := r.Record(key, passed); err != nil {
+			t.Fatalf("RunState.Record: %v", err)
+		}
+	}
+
+	return r, func() { os.RemoveAll(dir) }
+}
+
+// recordDone returns a Job.Done function recording the Job's outcome in the provided RunState under the provided key.
+func recordDone(t *testing.T, r *RunState, key string) func(error) {
+	return func(err error) {
+		if rerr := r.Record(key, err == nil); rerr != nil {
+			t.Errorf("RunState.Record: %v", rerr)
+		}
+	}
+}
+
+func TestRunStateResumeSkipsPassedSamples(t *testing.T) {
+	r, cleanup := newTestRunState(t, map[string]bool{"passed": true, "failed": false})
+	defer cleanup()
+
+	// resume from the persisted file, like a new run would
+	r, err := LoadRunState(r.path)
+	if err != nil {
+		t.Fatalf("LoadRunState: %v", err)
+	}
+
+	pt := &phaseTracker{}
+	jobs := []Job{
+		{Name: "passed", Phases: []Phase{pt.phase("passed", nil, nil)}, Done: recordDone(t, r, "passed")},
+		{Name: "failed", Phases: []Phase{pt.phase("failed", nil, nil)}, Done: recordDone(t, r, "failed")},
+		{
+			Name:   "new",
+			Phases: []Phase{pt.phase("new", nil, errors.New("deploy failed"))},
+			Done:   recordDone(t, r, "new"),
+		},
+	}
+
+	errs := r.RunJobs(jobs, 2)
+
+	sort.Strings(pt.started)
+	if want := []string{"failed", "new"}; !reflect.DeepEqual(pt.started, want) {
+		t.Errorf("started phases mismatch\nwant: %v\ngot: %v", want, pt.started)
+	}
+
+	if errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Errorf("errors mismatch\nwant: [<nil> <nil> deploy failed]\ngot: %v", errs)
+	}
+
+	// the outcomes were persisted: the previously failed sample now passed, the new one failed
+	r, err = LoadRunState(r.path)
+	if err != nil {
+		t.Fatalf("LoadRunState: %v", err)
+	}
+
+	want := map[string]string{"passed": statePassed, "failed": statePassed, "new": stateFailed}
+	if !reflect.DeepEqual(r.Samples, want) {
+		t.Errorf("run state mismatch\nwant: %v\ngot: %v", want, r.Samples)
+	}
+}
+
+func TestRunStateRerunsFailedSamples(t *testing.T) {
+	r, cleanup := newTestRunState(t, map[string]bool{"flaky": false})
+	defer cleanup()
+
+	pt := &phaseTracker{}
+	jobs := []Job{
+		{Name: "flaky", Phases: []Phase{pt.phase("flaky", nil, errors.New("still failing"))}, Done: recordDone(t, r, "flaky")},
+	}
+
+	for run := 0; run < 2; run++ {
+		r.RunJobs(jobs, 1)
+	}
+
+	if want := []string{"flaky", "flaky"}; !reflect.DeepEqual(pt.started, want) {
+		t.Errorf("started phases mismatch\nwant: %v\ngot: %v", want, pt.started)
+	}
+
+	if r.Passed("flaky") {
+		t.Errorf("failed sample recorded as passed")
+	}
+}
+
+func TestRunStateRunJobsLeavesRecordingToJobs(t *testing.T) {
+	r, cleanup := newTestRunState(t, nil)
+	defer cleanup()
+
+	// like a sample that was only dry-run: its phases pass, but it decides not to record anything
+	pt := &phaseTracker{}
+	jobs := []Job{{Name: "dry-run", Phases: []Phase{pt.phase("dry-run", nil, nil)}, Done: func(error) {}}}
+
+	if errs := r.RunJobs(jobs, 1); errs[0] != nil {
+		t.Fatalf("RunState.RunJobs: %v", errs[0])
+	}
+
+	if r.Passed("dry-run") {
+		t.Errorf("sample recorded as passed without recording it")
+	}
+}
+
+func TestLoadRunStateMissingFile(t *testing.T) {
+	r, err := LoadRunState(filepath.Join(os.TempDir(), "sst-missing-run-state.json"))
+	if err != nil {
+		t.Fatalf("LoadRunState: %v", err)
+	}
+
+	if len(r.Samples) != 0 {
+		t.Errorf("unexpected samples in new run state: %v", r.Samples)
+	}
+}
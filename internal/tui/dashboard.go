@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshInterval is how often the Dashboard is redrawn.
+const refreshInterval = 200 * time.Millisecond
+
+// Dashboard periodically renders a State as a compact, in-place terminal display. It's also an io.Writer, so the
+// standard logger can be pointed at it while it runs: logged lines are shown as the State's last line instead of
+// scrolling the display away.
+type Dashboard struct {
+	out   io.Writer
+	state *State
+
+	mu    sync.Mutex
+	lines int
+	buf   bytes.Buffer
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// IsTerminal reports whether the provided file is a terminal, in which case a Dashboard can be rendered to it.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// StartDashboard starts rendering the provided State to the provided writer until Stop is called.
+func StartDashboard(out io.Writer, s *State) *Dashboard {
+	d := &Dashboard{
+		out:   out,
+		state: s,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go d.run()
+	return d
+}
+
+// run redraws the Dashboard every refreshInterval until it's stopped, then draws it one final time.
+func (d *Dashboard) run() {
+	defer close(d.done)
+
+	t := time.NewTicker(refreshInterval)
+	defer t.Stop()
+
+	for {
+		d.render()
+		select {
+		case <-t.C:
+		case <-d.stop:
+			d.render()
+			return
+		}
+	}
+}
+
+// Stop stops rendering the Dashboard, leaving its final state on screen.
+func (d *Dashboard) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+// Write records the last complete line written as the State's last line.
+func (d *Dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.buf.Write(p)
+	for {
+		line, err := d.buf.ReadString('\n')
+		if err != nil {
+			// put back the incomplete line until the rest of it is written
+			rest := line
+			d.buf.Reset()
+			d.buf.WriteString(rest)
+			break
+		}
+
+		d.state.setLast(strings.TrimRight(line, "\n"))
+	}
+
+	return len(p), nil
+}
+
+// render redraws the Dashboard in place of its previous rendering.
+func (d *Dashboard) render() {
+	s := d.state.Snapshot()
+	lines := []string{
+		fmt.Sprintf("Phase:     %s (%s)", s.Phase, s.PhaseElapsed.Round(time.Second)),
+		fmt.Sprintf("Elapsed:   %s", s.Elapsed.Round(time.Second)),
+		fmt.Sprintf("Endpoints: %d passed, %d failed", s.Passed, s.Failed),
+		fmt.Sprintf("Last:      %s", s.Last),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	if d.lines > 0 {
+		// move the cursor back to the start of the previous rendering
+		fmt.Fprintf(&b, "\033[%dA", d.lines)
+	}
+	for _, l := range lines {
+		// clear each line before redrawing it
+		fmt.Fprintf(&b, "\r\033[K%s\n", l)
+	}
+
+	io.WriteString(d.out, b.String())
+	d.lines = len(lines)
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tui
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the progress of a run that backs the terminal dashboard: the current phase, how long the run and phase
+// have been going, and how many endpoints passed and failed. It's safe for concurrent use.
+type State struct {
+	mu sync.Mutex
+
+	now          func() time.Time
+	started      time.Time
+	phase        string
+	phaseStarted time.Time
+	passed       int
+	failed       int
+	last         string
+}
+
+// Snapshot is a point-in-time copy of a State.
+type Snapshot struct {
+	Phase        string
+	Elapsed      time.Duration
+	PhaseElapsed time.Duration
+	Passed       int
+	Failed       int
+
+	// Last is the last line logged during the run.
+	Last string
+}
+
+// NewState creates a State for a run starting now.
+func NewState() *State {
+	return newState(time.Now)
+}
+
+// newState creates a State that reads the current time from the provided clock.
+func newState(now func() time.Time) *State {
+	t := now()
+	return &State{
+		now:          now,
+		started:      t,
+		phaseStarted: t,
+	}
+}
+
+// SetPhase marks the start of the named phase.
+func (s *State) SetPhase(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.phase = name
+	s.phaseStarted = s.now()
+}
+
+// RecordEndpoint counts a tested endpoint operation as passed or failed. Its signature matches the hook accepted by
+// util.WithOperationHook.
+func (s *State) RecordEndpoint(endpoint, method string, passed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if passed {
+		s.passed++
+	} else {
+		s.failed++
+	}
+}
+
+// setLast records the last line logged during the run.
+func (s *State) setLast(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last = line
+}
+
+// Snapshot returns a copy of the State as of now.
+func (s *State) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	return Snapshot{
+		Phase:        s.phase,
+		Elapsed:      now.Sub(s.started),
+		PhaseElapsed: now.Sub(s.phaseStarted),
+		Passed:       s.passed,
+		Failed:       s.failed,
+		Last:         s.last,
+	}
+}
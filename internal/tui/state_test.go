@@ -0,0 +1,90 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for State tests.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestState(t *testing.T) {
+	c := &fakeClock{t: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)}
+	s := newState(c.now)
+
+	s.SetPhase("deploy")
+	c.advance(90 * time.Second)
+	s.SetPhase("validate")
+	c.advance(5 * time.Second)
+
+	s.RecordEndpoint("/", "GET", true)
+	s.RecordEndpoint("/", "POST", false)
+	s.RecordEndpoint("/items", "GET", true)
+
+	want := Snapshot{
+		Phase:        "validate",
+		Elapsed:      95 * time.Second,
+		PhaseElapsed: 5 * time.Second,
+		Passed:       2,
+		Failed:       1,
+	}
+	if got := s.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot mismatch\nwant: %+v\ngot: %+v", want, got)
+	}
+}
+
+type dashboardWriteTest struct {
+	writes []string // successive writes to the Dashboard
+	last   string   // expected last line of the State
+}
+
+var dashboardWriteTests = []dashboardWriteTest{
+	// single complete line
+	{
+		writes: []string{"2020/07/01 00:00:00 Building\n"},
+		last:   "2020/07/01 00:00:00 Building",
+	},
+
+	// multiple lines in one write
+	{
+		writes: []string{"first\nsecond\n"},
+		last:   "second",
+	},
+
+	// line split across writes
+	{
+		writes: []string{"first\nsec", "ond\n"},
+		last:   "second",
+	},
+
+	// incomplete line isn't shown yet
+	{
+		writes: []string{"first\nsec"},
+		last:   "first",
+	},
+}
+
+func TestDashboardWrite(t *testing.T) {
+	for i, tc := range dashboardWriteTests {
+		s := NewState()
+		d := &Dashboard{state: s}
+		for _, w := range tc.writes {
+			d.Write([]byte(w))
+		}
+
+		if got := s.Snapshot().Last; got != tc.last {
+			t.Errorf("#%d: last line mismatch\nwant: %q\ngot: %q", i, tc.last, got)
+		}
+	}
+}
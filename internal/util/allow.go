@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// validateAllow sends an OPTIONS request to the provided endpoint and compares the methods listed in the response's
+// Allow header against the methods the OpenAPI spec defines operations for on that path. OPTIONS itself is always
+// considered allowed, since the server just answered it. Missing and undocumented methods are recorded as error-level
+// findings in the validator's Report.
+func (v *validator) validateAllow(endpointURL string, tests []test) error {
+	want := map[string]bool{http.MethodOptions: true}
+	for _, t := range tests {
+		if t.operation != nil {
+			want[t.httpMethod] = true
+		}
+	}
+
+	v.logf("Checking Allow header: %s %s\n", http.MethodOptions, endpointURL)
+	resp, _, err := v.sendTestRequest(endpointURL, http.MethodOptions, "", nil, strings.NewReader(""))
+	if err != nil {
+		return err
+	}
+
+	values := resp.Header.Values("Allow")
+	if len(values) == 0 {
+		v.report.AddError(endpointURL, http.MethodOptions, "Allow header missing from %d response", resp.StatusCode)
+		return nil
+	}
+
+	got := parseAllow(values)
+	got[http.MethodOptions] = true
+	if missing := methodDifference(want, got); len(missing) > 0 {
+		v.report.AddError(endpointURL, http.MethodOptions, "Allow header missing documented method(s): %s", strings.Join(missing, ", "))
+	}
+	if extra := methodDifference(got, want); len(extra) > 0 {
+		v.report.AddError(endpointURL, http.MethodOptions, "Allow header lists undocumented method(s): %s", strings.Join(extra, ", "))
+	}
+
+	return nil
+}
+
+// parseAllow parses the values of an Allow header into a set of uppercased HTTP methods.
+func parseAllow(values []string) map[string]bool {
+	methods := make(map[string]bool)
+	for _, v := range values {
+		for _, m := range strings.Split(v, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				methods[strings.ToUpper(m)] = true
+			}
+		}
+	}
+
+	return methods
+}
+
+// methodDifference returns the sorted HTTP methods in a that aren't in b.
+func methodDifference(a, b map[string]bool) []string {
+	var diff []string
+	for m := range a {
+		if !b[m] {
+			diff = append(diff, m)
+		}
+	}
+	sort.Strings(diff)
+
+	return diff
+}
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type validateAllowTest struct {
+	allow  string // Allow header returned by the test server
+	errors int    // expected number of error-level findings
+}
+
+var validateAllowTests = []validateAllowTest{
+	// Allow header lists exactly the documented methods
+	{
+		allow: "GET, POST, OPTIONS",
+	},
+
+	// OPTIONS is implicitly allowed and method case is ignored
+	{
+		allow: "post,get",
+	},
+
+	// Allow header missing a documented method
+	{
+		allow:  "GET, OPTIONS",
+		errors: 1,
+	},
+
+	// Allow header listing an undocumented method
+	{
+		allow:  "GET, POST, DELETE, OPTIONS",
+		errors: 1,
+	},
+
+	// Allow header missing a documented method and listing an undocumented one
+	{
+		allow:  "GET, PUT",
+		errors: 2,
+	},
+
+	// no Allow header
+	{
+		errors: 1,
+	},
+}
+
+func TestValidateAllow(t *testing.T) {
+	for i, tc := range validateAllowTests {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions && tc.allow != "" {
+				w.Header().Set("Allow", tc.allow)
+			}
+		}))
+
+		paths := &openapi3.Paths{
+			"/": &openapi3.PathItem{Get: newTestOperation("200"), Post: newTestOperation("200")},
+		}
+
+		r, err := ValidateEndpoints(s.URL, paths, "", WithCheckAllow(true))
+		s.Close()
+
+		if err != nil {
+			t.Errorf("#%d: ValidateEndpoints: %v", i, err)
+			continue
+		}
+
+		if n := r.Count(SeverityError); n != tc.errors {
+			t.Errorf("#%d: error count mismatch\nwant: %d\ngot: %d", i, tc.errors, n)
+		}
+	}
+}
+
+type parseAllowTest struct {
+	values  []string        // Allow header values
+	methods map[string]bool // expected set of methods
+}
+
+var parseAllowTests = []parseAllowTest{
+	// single header value
+	{
+		values:  []string{"GET, HEAD"},
+		methods: map[string]bool{"GET": true, "HEAD": true},
+	},
+
+	// multiple header values, lowercase methods and empty elements
+	{
+		values:  []string{"get,", " post ", ""},
+		methods: map[string]bool{"GET": true, "POST": true},
+	},
+}
+
+func TestParseAllow(t *testing.T) {
+	for i, tc := range parseAllowTests {
+		got := parseAllow(tc.values)
+		if !reflect.DeepEqual(got, tc.methods) {
+			t.Errorf("#%d: result mismatch\nwant: %v\ngot: %v", i, tc.methods, got)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"sort"
+	"strings"
+)
+
+// maxGeneratedBodyDepth bounds how deeply nested objects and arrays are generated, so recursive schemas terminate.
+const maxGeneratedBodyDepth = 8
+
+// errNoRequestBodyExample is returned when a request body has no example and none can be generated.
+var errNoRequestBodyExample = errors.New("no example request body declared")
+
+// formatExamples maps string formats to example values that satisfy them.
+var formatExamples = map[string]string{
+	"date":      "2020-01-01",
+	"date-time": "2020-01-01T00:00:00Z",
+	"email":     "user@example.com",
+	"uri":       "https://example.com",
+	"uuid":      "00000000-0000-0000-0000-000000000000",
+}
+
+// namedBody is a request body to send, labeled with the name of the example it comes from, if any.
+type namedBody struct {
+	name string
+	body string
+}
+
+// requestBodies returns the request bodies to send for the provided media type: one per named example, in order of
+// name, if it declares any, or else the single body returned by requestBody.
+func (v *validator) requestBodies(mimeType string, mediaType *openapi3.MediaType) ([]namedBody, error) {
+	if mediaType == nil || len(mediaType.Examples) == 0 {
+		body, err := v.requestBody(mimeType, mediaType)
+		if err != nil {
+			return nil, err
+		}
+
+		return []namedBody{{body: body}}, nil
+	}
+
+	names := make([]string, 0, len(mediaType.Examples))
+	for name := range mediaType.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bodies := make([]namedBody, len(names))
+	for i, name := range names {
+		ex := mediaType.Examples[name]
+		if ex == nil || ex.Value == nil || ex.Value.Value == nil {
+			return nil, fmt.Errorf("%w: example %s has no value", errNoRequestBodyExample, name)
+		}
+
+		body, ok := ex.Value.Value.(string)
+		if !ok {
+			var err error
+			if body, err = marshalBody(ex.Value.Value); err != nil {
+				return nil, fmt.Errorf("example %s: %w", name, err)
+			}
+		}
+		bodies[i] = namedBody{name: name, body: body}
+	}
+
+	return bodies, nil
+}
+
+// requestBody returns the request body to send for the provided media type: its example, marshaled to JSON if it
+// isn't a string, or, if the validator generates bodies, a minimal body generated from its schema.
+func (v *validator) requestBody(mimeType string, mediaType *openapi3.MediaType) (string, error) {
+	if mediaType == nil {
+		return "", errNoRequestBodyExample
+	}
+
+	if mediaType.Example != nil {
+		if s, ok := mediaType.Example.(string); ok {
+			return s, nil
+		}
+		return marshalBody(mediaType.Example)
+	}
+
+	if !v.generateBodies || mediaType.Schema == nil || mediaType.Schema.Value == nil {
+		return "", errNoRequestBodyExample
+	}
+
+	if !strings.Contains(mimeType, "json") {
+		return "", fmt.Errorf("%w: can only generate JSON request bodies", errNoRequestBodyExample)
+	}
+
+	body, err := marshalBody(generateValue(mediaType.Schema.Value, 0))
+	if err != nil {
+		return "", err
+	}
+
+	v.logf("Generated %s request body from schema\n", mimeType)
+	return body, nil
+}
+
+// marshalBody marshals the provided example or generated value into a JSON request body.
+func marshalBody(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: request body: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// generateValue synthesizes a minimal value that's valid against the provided openapi3.Schema: the schema's example,
+// default or first enum value if it declares one, otherwise an object with only its required properties, an array
+// with its minimum number of items, or a type-appropriate zero value respecting the schema's minimums and format.
+func generateValue(schema *openapi3.Schema, depth int) interface{} {
+	if schema.Example != nil {
+		return schema.Example
+	}
+	if schema.Default != nil {
+		return schema.Default
+	}
+	if len(schema.Enum) > 0 {
+		return schema.Enum[0]
+	}
+
+	if depth > maxGeneratedBodyDepth {
+		return nil
+	}
+
+	if len(schema.AllOf) > 0 {
+		merged := make(map[string]interface{})
+		for _, s := range schema.AllOf {
+			if s == nil || s.Value == nil {
+				continue
+			}
+			if obj, ok := generateValue(s.Value, depth+1).(map[string]interface{}); ok {
+				for k, v := range obj {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+
+	for _, alternatives := range [][]*openapi3.SchemaRef{schema.OneOf, schema.AnyOf} {
+		if len(alternatives) > 0 && alternatives[0] != nil && alternatives[0].Value != nil {
+			return generateValue(alternatives[0].Value, depth+1)
+		}
+	}
+
+	switch schema.Type {
+	case "object":
+		obj := make(map[string]interface{})
+		for _, name := range schema.Required {
+			p, ok := schema.Properties[name]
+			if !ok || p == nil || p.Value == nil {
+				obj[name] = ""
+				continue
+			}
+			obj[name] = generateValue(p.Value, depth+1)
+		}
+		return obj
+	case "array":
+		items := make([]interface{}, 0, schema.MinItems)
+		for i := uint64(0); i < schema.MinItems && schema.Items != nil && schema.Items.Value != nil; i++ {
+			items = append(items, generateValue(schema.Items.Value, depth+1))
+		}
+		return items
+	case "string":
+		if e, ok := formatExamples[schema.Format]; ok {
+			return e
+		}
+		return strings.Repeat("a", int(schema.MinLength))
+	case "integer":
+		if schema.Min != nil {
+			return int64(*schema.Min)
+		}
+		return 0
+	case "number":
+		if schema.Min != nil {
+			return *schema.Min
+		}
+		return 0
+	case "boolean":
+		return false
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,246 @@
+package util
+
+import (
+	"errors"
+	"github.com/getkin/kin-openapi/openapi3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// petSchema is a simple object schema with required and optional properties of various types.
+var petSchema = &openapi3.Schema{
+	Type:     "object",
+	Required: []string{"name", "age", "tags", "owner", "kind"},
+	Properties: map[string]*openapi3.SchemaRef{
+		"name":  openapi3.NewSchemaRef("", openapi3.NewStringSchema().WithMinLength(3)),
+		"age":   openapi3.NewSchemaRef("", openapi3.NewIntegerSchema().WithMin(1)),
+		"tags":  openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())),
+		"kind":  openapi3.NewSchemaRef("", openapi3.NewStringSchema().WithEnum("cat", "dog")),
+		"notes": openapi3.NewSchemaRef("", openapi3.NewStringSchema()),
+		"owner": openapi3.NewSchemaRef("", &openapi3.Schema{
+			Type:     "object",
+			Required: []string{"email", "verified"},
+			Properties: map[string]*openapi3.SchemaRef{
+				"email":    openapi3.NewSchemaRef("", openapi3.NewStringSchema().WithFormat("email")),
+				"verified": openapi3.NewSchemaRef("", openapi3.NewBoolSchema()),
+			},
+		}),
+	},
+}
+
+type requestBodyTest struct {
+	mimeType  string              // request body media type
+	mediaType *openapi3.MediaType // request body declared in the spec
+	generate  bool                // whether request bodies are generated
+	body      string              // expected request body
+	err       error               // expected error
+}
+
+var requestBodyTests = []requestBodyTest{
+	// string example
+	{
+		mimeType:  "text/plain",
+		mediaType: &openapi3.MediaType{Example: "hello"},
+		body:      "hello",
+	},
+
+	// object example marshaled to JSON
+	{
+		mimeType:  "application/json",
+		mediaType: &openapi3.MediaType{Example: map[string]interface{}{"name": "rex"}},
+		body:      `{"name":"rex"}`,
+	},
+
+	// generated from simple object schema
+	{
+		mimeType:  "application/json",
+		mediaType: &openapi3.MediaType{Schema: openapi3.NewSchemaRef("", petSchema)},
+		generate:  true,
+		body:      `{"age":1,"kind":"cat","name":"aaa","owner":{"email":"user@example.com","verified":false},"tags":[]}`,
+	},
+
+	// example preferred over generation
+	{
+		mimeType:  "application/json",
+		mediaType: &openapi3.MediaType{Example: `{"name":"rex"}`, Schema: openapi3.NewSchemaRef("", petSchema)},
+		generate:  true,
+		body:      `{"name":"rex"}`,
+	},
+
+	// no example and generation disabled
+	{
+		mimeType:  "application/json",
+		mediaType: &openapi3.MediaType{Schema: openapi3.NewSchemaRef("", petSchema)},
+		err:       errNoRequestBodyExample,
+	},
+
+	// no example and non-JSON media type
+	{
+		mimeType:  "application/x-www-form-urlencoded",
+		mediaType: &openapi3.MediaType{Schema: openapi3.NewSchemaRef("", petSchema)},
+		generate:  true,
+		err:       errNoRequestBodyExample,
+	},
+}
+
+func TestRequestBody(t *testing.T) {
+	for i, tc := range requestBodyTests {
+		v := newValidator("", WithGenerateBodies(tc.generate))
+		body, err := v.requestBody(tc.mimeType, tc.mediaType)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if body != tc.body {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.body, body)
+		}
+	}
+}
+
+func TestGenerateBodies(t *testing.T) {
+	var got string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		got = string(b)
+	}))
+	defer s.Close()
+
+	op := newTestOperation("200")
+	op.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().WithJSONSchema(&openapi3.Schema{
+			Type:       "object",
+			Required:   []string{"id"},
+			Properties: map[string]*openapi3.SchemaRef{"id": openapi3.NewSchemaRef("", openapi3.NewIntegerSchema())},
+		}),
+	}
+	paths := &openapi3.Paths{"/": &openapi3.PathItem{Post: op}}
+
+	r, err := ValidateEndpoints(s.URL, paths, "")
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+	if n := r.Count(SeverityError); n != 1 {
+		t.Errorf("error count mismatch without generated bodies\nwant: %d\ngot: %d", 1, n)
+	}
+
+	r, err = ValidateEndpoints(s.URL, paths, "", WithGenerateBodies(true))
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+	if n := r.Count(SeverityError); n != 0 {
+		t.Errorf("error count mismatch with generated bodies\nwant: %d\ngot: %d", 0, n)
+	}
+
+	if want := `{"id":0}`; got != want {
+		t.Errorf("request body mismatch\nwant: %s\ngot: %s", want, got)
+	}
+}
+
+// examples returns openapi3.Examples holding the provided values, keyed by name.
+func examples(values map[string]interface{}) map[string]*openapi3.ExampleRef {
+	ex := make(map[string]*openapi3.ExampleRef)
+	for name, v := range values {
+		ex[name] = &openapi3.ExampleRef{Value: openapi3.NewExample(v)}
+	}
+	return ex
+}
+
+type requestBodiesTest struct {
+	mediaType *openapi3.MediaType // input media type
+	bodies    []namedBody         // expected request bodies
+	err       error               // expected error
+}
+
+var requestBodiesTests = []requestBodiesTest{
+	// single example
+	{
+		mediaType: &openapi3.MediaType{Example: `{"name":"rex"}`},
+		bodies:    []namedBody{{body: `{"name":"rex"}`}},
+	},
+	// named examples, in order of name
+	{
+		mediaType: &openapi3.MediaType{Examples: examples(map[string]interface{}{
+			"minimal": `{"name":"rex"}`,
+			"empty":   map[string]interface{}{},
+			"full":    map[string]interface{}{"name": "rex", "age": 3},
+		})},
+		bodies: []namedBody{
+			{name: "empty", body: `{}`},
+			{name: "full", body: `{"age":3,"name":"rex"}`},
+			{name: "minimal", body: `{"name":"rex"}`},
+		},
+	},
+	// named examples take precedence over the single example
+	{
+		mediaType: &openapi3.MediaType{
+			Example:  `{"name":"rex"}`,
+			Examples: examples(map[string]interface{}{"other": `{"name":"fido"}`}),
+		},
+		bodies: []namedBody{{name: "other", body: `{"name":"fido"}`}},
+	},
+	// named example without a value
+	{
+		mediaType: &openapi3.MediaType{Examples: map[string]*openapi3.ExampleRef{"remote": {Value: &openapi3.Example{}}}},
+		err:       errNoRequestBodyExample,
+	},
+}
+
+func TestRequestBodies(t *testing.T) {
+	for i, tc := range requestBodiesTests {
+		v := newValidator("")
+		bodies, err := v.requestBodies("application/json", tc.mediaType)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(bodies, tc.bodies) {
+			t.Errorf("#%d: result mismatch\nwant: %+v\ngot: %+v", i, tc.bodies, bodies)
+		}
+	}
+}
+
+func TestNamedExamples(t *testing.T) {
+	var got []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		got = append(got, string(b))
+		if string(b) == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer s.Close()
+
+	op := newTestOperation("200")
+	op.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithJSONSchema(openapi3.NewStringSchema())}
+	op.RequestBody.Value.Content.Get("application/json").Examples = examples(map[string]interface{}{
+		"a": "first",
+		"b": "second",
+	})
+	paths := &openapi3.Paths{"/": &openapi3.PathItem{Post: op}}
+
+	r, err := ValidateEndpoints(s.URL, paths, "")
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("request bodies mismatch\nwant: %q\ngot: %q", want, got)
+	}
+	if !r.Passed(true) {
+		t.Errorf("report didn't pass: %v", r.Findings)
+	}
+
+	// a single example eliciting an unexpected status code fails the endpoint
+	op.RequestBody.Value.Content.Get("application/json").Examples["c"] = &openapi3.ExampleRef{Value: openapi3.NewExample("bad")}
+	r, err = ValidateEndpoints(s.URL, paths, "")
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+	if r.Passed(true) {
+		t.Errorf("report passed despite an example eliciting an unexpected status code")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBurstFailed is returned when a request of a burst test doesn't succeed.
+var ErrBurstFailed = errors.New("burst request(s) failed")
+
+// BurstResult holds the outcome of a burst test.
+type BurstResult struct {
+	// Requests is the number of requests sent.
+	Requests int
+
+	// Succeeded is the number of requests that got a 2xx response within the timeout.
+	Succeeded int
+
+	// PeakConcurrency is the highest number of requests observed in flight at once.
+	PeakConcurrency int
+
+	// MaxLatency is the longest time a request took.
+	MaxLatency time.Duration
+
+	// Failures holds the reason each failed request failed.
+	Failures []string
+}
+
+// Burst sends n concurrent GET requests to the root endpoint of the service at the provided URL, released at once to
+// make the service scale out, and checks that they all get a 2xx response within the provided timeout. It returns the
+// observed concurrency and latency along with an error wrapping ErrBurstFailed if any request failed.
+func Burst(serviceURL, identityToken string, n int, timeout time.Duration) (*BurstResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	client := &http.Client{}
+	res := &BurstResult{Requests: n}
+
+	var mu sync.Mutex
+	inFlight := 0
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			mu.Lock()
+			inFlight++
+			if inFlight > res.PeakConcurrency {
+				res.PeakConcurrency = inFlight
+			}
+			mu.Unlock()
+
+			begin := time.Now()
+			err := burstRequest(ctx, client, serviceURL+"/", identityToken)
+			latency := time.Since(begin)
+
+			mu.Lock()
+			defer mu.Unlock()
+			inFlight--
+			if latency > res.MaxLatency {
+				res.MaxLatency = latency
+			}
+			if err != nil {
+				res.Failures = append(res.Failures, err.Error())
+				return
+			}
+			res.Succeeded++
+		}()
+	}
+
+	Infof("Sending burst of %d concurrent request(s)\n", n)
+	close(start)
+	wg.Wait()
+
+	Infof("Burst: %d of %d request(s) succeeded, peak concurrency %d, max latency %v\n", res.Succeeded, n,
+		res.PeakConcurrency, res.MaxLatency)
+	if res.Succeeded < n {
+		return res, fmt.Errorf("%w: %d of %d: first failure: %s", ErrBurstFailed, n-res.Succeeded, n, res.Failures[0])
+	}
+
+	return res, nil
+}
+
+// burstRequest makes a single burst test request to the provided URL, bounded by the provided context. It returns an
+// error if the request fails or the response isn't 2xx.
+func burstRequest(ctx context.Context, client *http.Client, url, identityToken string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext: %w", err)
+	}
+	setAuthorization(req.Header, identityToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http.Client.Do: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyServer returns a test server that holds every request until n requests are in flight at once, or a
+// second has passed, and records the highest number of requests it handled concurrently.
+func concurrencyServer(n int, statusCode func(i int) int) (*httptest.Server, func() int) {
+	var mu sync.Mutex
+	requests, active, peak := 0, 0, 0
+	all := make(chan struct{})
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		i := requests
+		active++
+		if active > peak {
+			peak = active
+		}
+		if active == n {
+			close(all)
+		}
+		mu.Unlock()
+
+		select {
+		case <-all:
+		case <-time.After(time.Second):
+		}
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+
+		w.WriteHeader(statusCode(i))
+	}))
+
+	return s, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return peak
+	}
+}
+
+func TestBurst(t *testing.T) {
+	const n = 8
+	s, peak := concurrencyServer(n, func(int) int { return http.StatusOK })
+	defer s.Close()
+
+	res, err := Burst(s.URL, "", n, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Burst: %v", err)
+	}
+
+	if res.Requests != n || res.Succeeded != n {
+		t.Errorf("request count mismatch\nwant: %d of %d\ngot: %d of %d", n, n, res.Succeeded, res.Requests)
+	}
+	if res.PeakConcurrency != n {
+		t.Errorf("observed concurrency mismatch\nwant: %d\ngot: %d", n, res.PeakConcurrency)
+	}
+	if p := peak(); p != n {
+		t.Errorf("server concurrency mismatch\nwant: %d\ngot: %d", n, p)
+	}
+}
+
+func TestBurstFailures(t *testing.T) {
+	const n = 6
+	// every third request is rejected, like a service that can't scale out far enough
+	s, _ := concurrencyServer(n, func(i int) int {
+		if i%3 == 0 {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusOK
+	})
+	defer s.Close()
+
+	res, err := Burst(s.URL, "", n, 10*time.Second)
+	if !errors.Is(err, ErrBurstFailed) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", ErrBurstFailed, err)
+	}
+
+	if res.Succeeded != 4 || len(res.Failures) != 2 {
+		t.Errorf("result mismatch\nwant: 4 succeeded, 2 failures\ngot: %d succeeded, %d failures", res.Succeeded, len(res.Failures))
+	}
+}
+
+func TestBurstTimeout(t *testing.T) {
+	// the server waits for more requests than are sent, so every request outlives the timeout
+	s, _ := concurrencyServer(100, func(int) int { return http.StatusOK })
+	defer s.Close()
+
+	res, err := Burst(s.URL, "", 2, 100*time.Millisecond)
+	if !errors.Is(err, ErrBurstFailed) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", ErrBurstFailed, err)
+	}
+	if res.Succeeded != 0 {
+		t.Errorf("success count mismatch\nwant: 0\ngot: %d", res.Succeeded)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotRecorded is returned by requests replayed from a cassette that holds no response recorded for them.
+var ErrNotRecorded = errors.New("no recorded response")
+
+// interaction is a request made to a Cloud Run service and the response it elicited, as persisted in a cassette.
+// Requests are identified by their method, URI and body; their headers aren't persisted, so that identity tokens
+// aren't written to disk.
+type interaction struct {
+	Method      string      `json:"method"`
+	URI         string      `json:"uri"`
+	RequestBody []byte      `json:"requestBody,omitempty"`
+	StatusCode  int         `json:"statusCode"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// cassette is an http.RoundTripper that either records the requests it makes, along with their responses, to files in
+// a directory, or replays the responses recorded there without making any request. A request made several times is
+// recorded each time, and replayed in the same order; once all its recorded responses were replayed, the last one is
+// replayed again.
+type cassette struct {
+	dir       string
+	replay    bool
+	transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions map[string][]interaction
+	replayed     map[string]int
+}
+
+// newCassette creates a cassette recording to or replaying from the provided directory.
+func newCassette(dir string, replay bool) *cassette {
+	return &cassette{
+		dir:          dir,
+		replay:       replay,
+		transport:    http.DefaultTransport,
+		interactions: make(map[string][]interaction),
+		replayed:     make(map[string]int),
+	}
+}
+
+// RoundTrip records or replays the provided request.
+func (c *cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("ioutil.ReadAll: reading request body: %w", err)
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	key := req.Method + " " + req.URL.RequestURI() + "\n" + string(reqBody)
+	sum := sha256.Sum256([]byte(key))
+	filename := filepath.Join(c.dir, hex.EncodeToString(sum[:8])+".json")
+
+	if c.replay {
+		return c.replayRequest(req, key, filename)
+	}
+
+	return c.recordRequest(req, reqBody, key, filename)
+}
+
+// replayRequest returns the next response recorded for the provided request in the provided file.
+func (c *cassette) replayRequest(req *http.Request, key, filename string) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	recorded, ok := c.interactions[key]
+	if !ok {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("ioutil.ReadFile: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(b, &recorded); err != nil {
+				return nil, fmt.Errorf("json.Unmarshal: %s: %w", filename, err)
+			}
+		}
+		c.interactions[key] = recorded
+	}
+
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("%w for %s %s in %s", ErrNotRecorded, req.Method, req.URL.RequestURI(), c.dir)
+	}
+
+	i := c.replayed[key]
+	if i >= len(recorded) {
+		i = len(recorded) - 1
+	}
+	c.replayed[key]++
+
+	in := recorded[i]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.StatusCode, http.StatusText(in.StatusCode)),
+		StatusCode:    in.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(in.Body)),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}, nil
+}
+
+// recordRequest makes the provided request and records it, along with its response, in the provided file.
+func (c *cassette) recordRequest(req *http.Request, reqBody []byte, key, filename string) (*http.Response, error) {
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll: reading http.Response.Body: %w", err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions[key] = append(c.interactions[key], interaction{
+		Method:      req.Method,
+		URI:         req.URL.RequestURI(),
+		RequestBody: reqBody,
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		Body:        body,
+	})
+
+	b, err := json.MarshalIndent(c.interactions[key], "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		return nil, fmt.Errorf("ioutil.WriteFile: %w", err)
+	}
+
+	return resp, nil
+}
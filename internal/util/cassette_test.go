@@ -0,0 +1,119 @@
+package util
+
+import (
+	"errors"
+	"github.com/getkin/kin-openapi/openapi3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// replayURL is the service URL replayed requests are made to. It doesn't resolve, so any request reaching the network
+// fails.
+const replayURL = "http://replay.invalid"
+
+// cassettePaths returns openapi3.Paths with a GET and a POST operation on /items, where the POST operation sends a
+// JSON example body, and a GET operation on /broken, which the test server fails.
+func cassettePaths() *openapi3.Paths {
+	post := newTestOperation("201")
+	post.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().WithContent(openapi3.Content{
+			"application/json": &openapi3.MediaType{Example: map[string]interface{}{"name": "widget"}},
+		}),
+	}
+
+	return &openapi3.Paths{
+		"/items":  &openapi3.PathItem{Get: newTestOperation("200"), Post: post},
+		"/broken": &openapi3.PathItem{Get: newTestOperation("200")},
+	}
+}
+
+// sortedResults returns the Report's Results, with the provided service URL trimmed from their endpoints, sorted by
+// endpoint and method, since paths are validated concurrently.
+func sortedResults(r *Report, serviceURL string) []Result {
+	results := append([]Result(nil), r.Results...)
+	for i := range results {
+		results[i].Endpoint = strings.TrimPrefix(results[i].Endpoint, serviceURL)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Endpoint != results[j].Endpoint {
+			return results[i].Endpoint < results[j].Endpoint
+		}
+		return results[i].Method < results[j].Method
+	})
+
+	return results
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodPost:
+			b, _ := ioutil.ReadAll(r.Body)
+			if string(b) != `{"name":"widget"}` {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.Write([]byte("[]"))
+		}
+	}))
+	defer s.Close()
+
+	recorded, err := ValidateEndpoints(s.URL, cassettePaths(), "token", WithRecord(dir))
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: recording: %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("request count mismatch while recording\nwant: 3\ngot: %d", requests)
+	}
+
+	replayed, err := ValidateEndpoints(replayURL, cassettePaths(), "token", WithReplay(dir))
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: replaying: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("replay reached the network: %d request(s) made", requests-3)
+	}
+
+	if want, got := sortedResults(recorded, s.URL), sortedResults(replayed, replayURL); !reflect.DeepEqual(want, got) {
+		t.Errorf("replayed results mismatch\nwant: %+v\ngot: %+v", want, got)
+	}
+	if n := replayed.Count(SeverityError); n != 1 {
+		t.Errorf("replayed error count mismatch\nwant: 1\ngot: %d", n)
+	}
+}
+
+func TestReplayNotRecorded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = ValidateEndpoints(replayURL, newTestPaths("/", newTestOperation("200")), "", WithReplay(dir))
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", ErrNotRecorded, err)
+	}
+}
@@ -16,11 +16,13 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // GcloudCommonFlags is a slice of common flags that should be added as arguments to all executions of the external
@@ -29,27 +31,103 @@ var GcloudCommonFlags = []string{
 	"--quiet",
 }
 
+// GcloudPath is the gcloud executable that all executions of the external gcloud command run, including the gcloud
+// commands parsed from READMEs. It can be a name looked up in the PATH or a path, for environments where gcloud is
+// installed as e.g. `gcloud.cmd` or outside of the PATH.
+var GcloudPath = "gcloud"
+
+// IsGcloud reports whether the provided command name or path is the gcloud executable, ignoring its directory and any
+// Windows executable extension.
+func IsGcloud(name string) bool {
+	base := filepath.Base(name)
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".cmd", ".exe", ".bat":
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	return base == "gcloud"
+}
+
+// CommandOutputTailLines is the number of trailing lines of a failed command's output included in its error.
+const CommandOutputTailLines = 40
+
 // ExecCommand executes an exec.Cmd. If the command exits successfully, its stdout will be returned. If there's an
-// error, the command's combined stdout and stderr will be returned in an error. The command will be run in the provided
-// directory.
+// error, the last CommandOutputTailLines lines of the command's combined stdout and stderr will be returned in an
+// error. The command will be run in the provided directory.
 func ExecCommand(cmd *exec.Cmd, dir string) (string, error) {
+	return ExecCommandContext(context.Background(), cmd, dir)
+}
+
+// ExecCommandContext does the same as ExecCommand, and also kills the command if the provided context is done before
+// it exits, in which case the returned error wraps the context's error.
+func ExecCommandContext(ctx context.Context, cmd *exec.Cmd, dir string) (string, error) {
 	var stderr bytes.Buffer
 	var stdout bytes.Buffer
 	var stdcombined bytes.Buffer
 
 	cmd.Dir = dir
 
-	cmd.Stdout = io.MultiWriter(&stdout, &stdcombined)
-	cmd.Stderr = io.MultiWriter(&stderr, &stdcombined)
+	// exec copies stdout and stderr in separate goroutines, which both write to the combined output
+	combined := &lockedWriter{w: &stdcombined}
+	cmd.Stdout = io.MultiWriter(&stdout, combined)
+	cmd.Stderr = io.MultiWriter(&stderr, combined)
 
-	log.Printf("Executing %v\n", cmd)
+	Infof("Executing %v\n", cmd)
 
-	err := cmd.Run()
+	err := runContext(ctx, cmd)
 	if err != nil {
-		out := strings.TrimSpace(string(stdcombined.Bytes()))
+		out := TailLines(strings.TrimSpace(string(stdcombined.Bytes())), CommandOutputTailLines)
 		return "", fmt.Errorf("exec.Cmd.Run: %v:\n%s\n%w", cmd, out, err)
 	}
 
 	out := strings.TrimSpace(string(stdout.Bytes()))
 	return out, nil
 }
+
+// lockedWriter is an io.Writer that serializes the writes made to the io.Writer it wraps, so that it can be written to
+// from several goroutines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.w.Write(p)
+}
+
+// runContext runs the provided command, killing it if the provided context is done before it exits. Unlike
+// exec.CommandContext, it works with commands that were already created without a context.
+func runContext(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// TailLines returns the last n lines of the provided output, preceded by a note of how many lines were omitted, if any.
+// gcloud and build tools print the cause of a failure last, after possibly thousands of lines of progress.
+func TailLines(output string, n int) string {
+	lines := strings.Split(output, "\n")
+	if len(lines) <= n {
+		return output
+	}
+
+	omitted := len(lines) - n
+	return fmt.Sprintf("... (%d earlier line(s) omitted)\n%s", omitted, strings.Join(lines[omitted:], "\n"))
+}
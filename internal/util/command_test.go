@@ -0,0 +1,110 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tailLinesTest struct {
+	in  string // command output
+	n   int    // number of lines to keep
+	out string // expected result of TailLines
+}
+
+var tailLinesTests = []tailLinesTest{
+	// fewer lines than kept
+	{
+		in:  "a\nb",
+		n:   3,
+		out: "a\nb",
+	},
+
+	// exactly as many lines as kept
+	{
+		in:  "a\nb\nc",
+		n:   3,
+		out: "a\nb\nc",
+	},
+
+	// more lines than kept
+	{
+		in:  "a\nb\nc\nd\ne",
+		n:   2,
+		out: "... (3 earlier line(s) omitted)\nd\ne",
+	},
+}
+
+func TestTailLines(t *testing.T) {
+	for i, tc := range tailLinesTests {
+		if out := TailLines(tc.in, tc.n); out != tc.out {
+			t.Errorf("#%d: result mismatch\nwant: %q\ngot: %q", i, tc.out, out)
+		}
+	}
+}
+
+type isGcloudTest struct {
+	name string // command name or path
+	want bool   // expected result of IsGcloud
+}
+
+var isGcloudTests = []isGcloudTest{
+	{name: "gcloud", want: true},
+	{name: "/opt/google-cloud-sdk/bin/gcloud", want: true},
+	{name: "gcloud.cmd", want: true},
+	{name: "gcloud.exe", want: true},
+	{name: "gcloud.sh", want: false},
+	{name: "gsutil", want: false},
+	{name: "/usr/bin/gcloud-beta", want: false},
+}
+
+func TestIsGcloud(t *testing.T) {
+	for i, tc := range isGcloudTests {
+		if got := IsGcloud(tc.name); got != tc.want {
+			t.Errorf("#%d: result mismatch for %q\nwant: %t\ngot: %t", i, tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestExecCommandFailureOutput(t *testing.T) {
+	// a failing command printing progress to stdout and its cause to stderr last
+	cmd := exec.Command("sh", "-c", "for i in $(seq 1 100); do echo progress $i; done; echo 'ERROR: quota exceeded' >&2; exit 1")
+
+	_, err := ExecCommand(cmd, os.TempDir())
+	if err == nil {
+		t.Fatal("ExecCommand: expected error")
+	}
+
+	for _, want := range []string{"ERROR: quota exceeded", "progress 100", "earlier line(s) omitted", "exit status 1"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%v", want, err)
+		}
+	}
+
+	if strings.Contains(err.Error(), "progress 1\n") {
+		t.Errorf("error holds more than the tail of the output:\n%v", err)
+	}
+}
+
+func TestExecCommandContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := ExecCommandContext(ctx, exec.Command("sleep", "10"), os.TempDir())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command wasn't killed: ran for %v", elapsed)
+	}
+
+	out, err := ExecCommandContext(context.Background(), exec.Command("echo", "hello"), os.TempDir())
+	if err != nil || out != "hello" {
+		t.Errorf("result mismatch\nwant: hello, <nil>\ngot: %s, %v", out, err)
+	}
+}
@@ -15,18 +15,235 @@
 package util
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
 	"github.com/getkin/kin-openapi/openapi3"
-	"log"
+	"github.com/ghodss/yaml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 const passResponseDescription = "PASS"
 
-// LoadTestEndpoints loads a default test endpoint request (a GET / request expecting a 200 status code) into an
-// openapi3.Swagger object (see github.com/getkin/kin-openapi).
-func LoadTestEndpoints() *openapi3.Swagger {
+// swaggerV2 is the value of the swagger field of OpenAPI 2.0 (Swagger 2.0) specs.
+const swaggerV2 = "2.0"
+
+// specFileNames are the names of the OpenAPI spec files LoadTestEndpoints looks for in a sample's directory, in order
+// of preference.
+var specFileNames = []string{
+	"openapi.yaml",
+	"openapi.yml",
+	"openapi.json",
+	"swagger.yaml",
+	"swagger.yml",
+	"swagger.json",
+}
+
+// LoadTestEndpoints loads the test endpoint requests declared in an OpenAPI spec into an openapi3.Swagger object (see
+// github.com/getkin/kin-openapi). The spec is loaded from the provided location, a local file or an http(s) URL, if
+// set, and otherwise from the provided sample directory (see specFileNames). Both OpenAPI 3 and OpenAPI 2.0
+// (Swagger 2.0) specs are supported; the latter are converted to OpenAPI 3. If no location is set and the sample has no
+// spec, a default test endpoint request (a GET / request expecting a 200 status code) is loaded.
+func LoadTestEndpoints(sampleDir, specLocation string) (*openapi3.Swagger, error) {
+	if specLocation != "" {
+		Infof("Using test endpoints from OpenAPI spec %s\n", specLocation)
+		swagger, err := loadSpec(specLocation)
+		if err != nil {
+			return nil, fmt.Errorf("util.loadSpec: %s: %w", specLocation, err)
+		}
+
+		return swagger, nil
+	}
+
+	for _, name := range specFileNames {
+		path := filepath.Join(sampleDir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		Infof("Using test endpoints from OpenAPI spec %s\n", path)
+		swagger, err := loadSpec(path)
+		if err != nil {
+			return nil, fmt.Errorf("util.loadSpec: %s: %w", path, err)
+		}
+
+		return swagger, nil
+	}
+
+	return defaultTestEndpoints(), nil
+}
+
+// loadSpec loads the OpenAPI spec in the YAML or JSON file at the provided location, a local path or an http(s) URL.
+// OpenAPI 2.0 specs, identified by their `swagger: "2.0"` field, are converted to OpenAPI 3, so that both versions
+// are validated the same way.
+func loadSpec(location string) (*openapi3.Swagger, error) {
+	data, specURL, err := readSpec(location)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("yaml.YAMLToJSON: %w", err)
+	}
+
+	var version struct {
+		Swagger string `json:"swagger"`
+	}
+	if err := json.Unmarshal(jsonData, &version); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	var swagger *openapi3.Swagger
+	switch version.Swagger {
+	case "":
+		swagger, err = openapi3.NewSwaggerLoader().LoadSwaggerFromDataWithPath(data, specURL)
+		if err != nil {
+			return nil, fmt.Errorf("openapi3.SwaggerLoader.LoadSwaggerFromDataWithPath: %w", err)
+		}
+
+	case swaggerV2:
+		var v2 openapi2.Swagger
+		if err := json.Unmarshal(jsonData, &v2); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+
+		swagger, err = openapi2conv.ToV3Swagger(&v2)
+		if err != nil {
+			return nil, fmt.Errorf("openapi2conv.ToV3Swagger: %w", err)
+		}
+
+		if err := openapi3.NewSwaggerLoader().ResolveRefsIn(swagger, nil); err != nil {
+			return nil, fmt.Errorf("openapi3.SwaggerLoader.ResolveRefsIn: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported Swagger version %q", version.Swagger)
+	}
+
+	if err := loadExternalValues(swagger, location); err != nil {
+		return nil, fmt.Errorf("util.loadExternalValues: %w", err)
+	}
+	return swagger, nil
+}
+
+// loadExternalValues reads the request body examples whose externalValue field references a file, such as
+// `externalValue: examples/large-order.json`, and sets each example's value to the file's content, so that large
+// payloads needn't be inlined in the spec. The file is sent as is, even if the example also has an inline value.
+// Relative references are resolved against the location of the spec, a local path or an http(s) URL, and references
+// to http(s) URLs are fetched.
+func loadExternalValues(swagger *openapi3.Swagger, specLocation string) error {
+	loaded := make(map[*openapi3.Example]bool)
+	for path, pathItem := range swagger.Paths {
+		if pathItem == nil {
+			continue
+		}
+
+		for method, operation := range pathItem.Operations() {
+			if operation == nil || operation.RequestBody == nil || operation.RequestBody.Value == nil {
+				continue
+			}
+
+			for mimeType, mediaType := range operation.RequestBody.Value.Content {
+				if mediaType == nil {
+					continue
+				}
+
+				for name, ex := range mediaType.Examples {
+					if ex == nil || ex.Value == nil || ex.Value.ExternalValue == "" || loaded[ex.Value] {
+						continue
+					}
+
+					location := externalValueLocation(specLocation, ex.Value.ExternalValue)
+					data, _, err := readSpec(location)
+					if err != nil {
+						return fmt.Errorf("%s %s: %s example %s: externalValue %s: %w", method, path, mimeType, name,
+							location, err)
+					}
+
+					ex.Value.Value = string(data)
+					loaded[ex.Value] = true
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// externalValueLocation resolves the provided externalValue reference against the location of the spec it appears in.
+func externalValueLocation(specLocation, ref string) string {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		return ref
+	}
+
+	if strings.HasPrefix(specLocation, "http://") || strings.HasPrefix(specLocation, "https://") {
+		base, err := url.Parse(specLocation)
+		if err != nil {
+			return ref
+		}
+		r, err := url.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return base.ResolveReference(r).String()
+	}
+
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(specLocation), filepath.FromSlash(ref))
+}
+
+// readSpec reads the OpenAPI spec, or a file it references, at the provided location, fetching it if the location is
+// an http(s) URL. It returns the content along with its location as a URL, against which references in the spec are
+// resolved.
+func readSpec(location string) ([]byte, *url.URL, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		data, err := ioutil.ReadFile(location)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ioutil.ReadFile: %w", err)
+		}
+
+		return data, &url.URL{Path: location}, nil
+	}
+
+	specURL, err := url.Parse(location)
+	if err != nil {
+		return nil, nil, fmt.Errorf("url.Parse: %w", err)
+	}
+
+	client := &http.Client{Timeout: defaultHTTPTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, nil, fmt.Errorf("http.Client.Get: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("fetching spec: unexpected status code %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ioutil.ReadAll: %w", err)
+	}
+
+	return data, specURL, nil
+}
+
+// defaultTestEndpoints loads a default test endpoint request (a GET / request expecting a 200 status code) into an
+// openapi3.Swagger object.
+func defaultTestEndpoints() *openapi3.Swagger {
 	prd := passResponseDescription
 
-	log.Println("Using default test endpoint (GET /)")
+	Infof("Using default test endpoint (GET /)\n")
 	return &openapi3.Swagger{
 		Paths: openapi3.Paths{
 			"/": &openapi3.PathItem{
@@ -0,0 +1,323 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// swaggerV2Spec is an OpenAPI 2.0 spec with a response schema referencing a definition.
+const swaggerV2Spec = `swagger: "2.0"
+info:
+  title: items
+  version: "1.0"
+paths:
+  /items:
+    get:
+      responses:
+        "200":
+          description: PASS
+          schema:
+            $ref: "#/definitions/Item"
+    post:
+      consumes:
+        - application/json
+      parameters:
+        - in: body
+          name: item
+          schema:
+            $ref: "#/definitions/Item"
+      responses:
+        "201":
+          description: PASS
+definitions:
+  Item:
+    type: object
+    properties:
+      name:
+        type: string
+`
+
+// openAPIV3Spec is an OpenAPI 3 spec equivalent to swaggerV2Spec.
+const openAPIV3Spec = `{
+  "openapi": "3.0.0",
+  "info": {"title": "items", "version": "1.0"},
+  "paths": {
+    "/items": {
+      "get": {
+        "responses": {
+          "200": {
+            "description": "PASS",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}
+          }
+        }
+      },
+      "post": {
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+        "responses": {"201": {"description": "PASS"}}
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Item": {"type": "object", "properties": {"name": {"type": "string"}}}
+    }
+  }
+}`
+
+type loadTestEndpointsTest struct {
+	file    string   // name of the spec file written to the sample directory, if any
+	spec    string   // content of the spec file
+	methods []string // expected sorted methods of the /items path, or of / if there's no spec file
+	err     bool     // whether an error is expected
+}
+
+var loadTestEndpointsTests = []loadTestEndpointsTest{
+	// no spec falls back on the default test endpoint
+	{
+		methods: []string{"GET"},
+	},
+
+	// OpenAPI 2.0 spec is converted
+	{
+		file:    "swagger.yaml",
+		spec:    swaggerV2Spec,
+		methods: []string{"GET", "POST"},
+	},
+
+	// OpenAPI 3 spec
+	{
+		file:    "openapi.json",
+		spec:    openAPIV3Spec,
+		methods: []string{"GET", "POST"},
+	},
+
+	// unsupported Swagger version
+	{
+		file: "swagger.json",
+		spec: `{"swagger": "1.2", "paths": {}}`,
+		err:  true,
+	},
+}
+
+func TestLoadTestEndpoints(t *testing.T) {
+	for i, tc := range loadTestEndpointsTests {
+		dir, err := ioutil.TempDir("", "util")
+		if err != nil {
+			t.Fatalf("ioutil.TempDir: %v", err)
+		}
+
+		path := "/"
+		if tc.file != "" {
+			path = "/items"
+			if err := ioutil.WriteFile(filepath.Join(dir, tc.file), []byte(tc.spec), 0644); err != nil {
+				t.Fatalf("ioutil.WriteFile: %v", err)
+			}
+		}
+
+		swagger, err := LoadTestEndpoints(dir, "")
+		os.RemoveAll(dir)
+
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		pathItem := swagger.Paths.Find(path)
+		if pathItem == nil {
+			t.Errorf("#%d: path %s not found", i, path)
+			continue
+		}
+
+		var methods []string
+		for m := range pathItem.Operations() {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+
+		if !reflect.DeepEqual(methods, tc.methods) {
+			t.Errorf("#%d: result mismatch\nwant: %v\ngot: %v", i, tc.methods, methods)
+		}
+	}
+}
+
+func TestLoadTestEndpointsSwaggerV2Schemas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "util")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "swagger.yaml"), []byte(swaggerV2Spec), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	swagger, err := LoadTestEndpoints(dir, "")
+	if err != nil {
+		t.Fatalf("LoadTestEndpoints: %v", err)
+	}
+
+	items := swagger.Paths.Find("/items")
+
+	// the converted response and request body schemas validate the same way as OpenAPI 3 ones
+	resp := items.Get.Responses["200"].Value
+	mediaType := resp.Content.Get("application/json")
+	if mediaType == nil || mediaType.Schema.Value == nil {
+		t.Fatalf("response schema not converted: %+v", resp.Content)
+	}
+	if err := mediaType.Schema.Value.VisitJSON(map[string]interface{}{"name": 1.0}); err == nil {
+		t.Errorf("response schema accepted a non-string name")
+	}
+
+	body := items.Post.RequestBody
+	if body == nil || body.Value.Content.Get("application/json") == nil {
+		t.Errorf("request body not converted: %+v", body)
+	}
+}
+
+type specLocationTest struct {
+	location func(dir, serverURL string) string // location of the spec, given the spec file's directory and the spec server's URL
+	err      bool                               // whether an error is expected
+}
+
+var specLocationTests = []specLocationTest{
+	// local file outside the sample directory
+	{
+		location: func(dir, serverURL string) string { return filepath.Join(dir, "spec.yaml") },
+	},
+
+	// URL
+	{
+		location: func(dir, serverURL string) string { return serverURL + "/spec.yaml" },
+	},
+
+	// missing local file
+	{
+		location: func(dir, serverURL string) string { return filepath.Join(dir, "missing.yaml") },
+		err:      true,
+	},
+
+	// missing URL
+	{
+		location: func(dir, serverURL string) string { return serverURL + "/missing.yaml" },
+		err:      true,
+	},
+}
+
+func TestLoadTestEndpointsSpecLocation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "util")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "spec.yaml"), []byte(swaggerV2Spec), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	s := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer s.Close()
+
+	// the sample directory's own spec is ignored in favor of the provided location
+	sampleDir, err := ioutil.TempDir("", "util")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(sampleDir)
+
+	if err := ioutil.WriteFile(filepath.Join(sampleDir, "openapi.json"), []byte(`{"openapi": "3.0.0", "paths": {}}`), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	for i, tc := range specLocationTests {
+		swagger, err := LoadTestEndpoints(sampleDir, tc.location(dir, s.URL))
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if err == nil && swagger.Paths.Find("/items") == nil {
+			t.Errorf("#%d: path /items not found", i)
+		}
+	}
+}
+
+// externalValueSpec is an OpenAPI 3 spec whose request body examples reference files next to it.
+const externalValueSpec = `openapi: 3.0.0
+info:
+  title: orders
+  version: "1.0"
+paths:
+  /orders:
+    post:
+      requestBody:
+        content:
+          application/json:
+            examples:
+              large:
+                externalValue: examples/large.json
+              inline:
+                value: {"id": 1}
+      responses:
+        "201":
+          description: created
+`
+
+func TestLoadTestEndpointsExternalValue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "util")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const body = `{"id": 2, "items": ["a", "b"]}`
+	if err := os.MkdirAll(filepath.Join(dir, "examples"), 0755); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "examples", "large.json"), []byte(body), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "openapi.yaml"), []byte(externalValueSpec), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	s := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer s.Close()
+
+	for _, location := range []string{filepath.Join(dir, "openapi.yaml"), s.URL + "/openapi.yaml"} {
+		swagger, err := LoadTestEndpoints("", location)
+		if err != nil {
+			t.Errorf("%s: LoadTestEndpoints: %v", location, err)
+			continue
+		}
+
+		v := &validator{}
+		bodies, err := v.requestBodies("application/json",
+			swagger.Paths["/orders"].Post.RequestBody.Value.Content["application/json"])
+		if err != nil {
+			t.Errorf("%s: validator.requestBodies: %v", location, err)
+			continue
+		}
+
+		want := []namedBody{{name: "inline", body: `{"id":1}`}, {name: "large", body: body}}
+		if !reflect.DeepEqual(bodies, want) {
+			t.Errorf("%s: result mismatch\nwant: %v\ngot: %v", location, want, bodies)
+		}
+	}
+
+	// missing file
+	if err := os.Remove(filepath.Join(dir, "examples", "large.json")); err != nil {
+		t.Fatalf("os.Remove: %v", err)
+	}
+	if _, err := LoadTestEndpoints(dir, ""); err == nil {
+		t.Errorf("LoadTestEndpoints accepted a missing externalValue file")
+	}
+}
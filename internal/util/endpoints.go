@@ -16,13 +16,19 @@ package util
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/getkin/kin-openapi/openapi3"
+	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -32,116 +38,672 @@ type test struct {
 	httpMethod string
 }
 
-// httpTimeout is the default timeout that used for HTTP requests made to Cloud Run services.
-const httpTimeout = 10 * time.Second
-
-// ValidateEndpoints tests all paths (represented by openapi3.Paths) with all HTTP methods and given response bodies
-// and make sure they respond with the expected status code. Returns a success bool based on whether all the tests
-// passed.
-func ValidateEndpoints(serviceURL string, paths *openapi3.Paths, identityToken string) (bool, error) {
-	success := true
-	for endpoint, pathItem := range *paths {
-		log.Printf("Testing %s endpoint\n", endpoint)
-		tests := []test{
-			{pathItem.Connect, http.MethodConnect},
-			{pathItem.Delete, http.MethodDelete},
-			{pathItem.Get, http.MethodGet},
-			{pathItem.Head, http.MethodHead},
-			{pathItem.Options, http.MethodOptions},
-			{pathItem.Patch, http.MethodPatch},
-			{pathItem.Post, http.MethodPost},
-			{pathItem.Put, http.MethodPut},
-			{pathItem.Trace, http.MethodTrace},
-		}
-
-		endpointURL := serviceURL + endpoint
-		for _, t := range tests {
-			s, err := validateEndpointOperation(endpointURL, t.operation, t.httpMethod, identityToken)
-			if err != nil {
-				return s, fmt.Errorf("util.validateEndpointOperation: testing %s requests on %s: %w", t.httpMethod, endpointURL, err)
+// defaultHTTPTimeout is the default timeout used for HTTP requests made to Cloud Run services.
+const defaultHTTPTimeout = 10 * time.Second
+
+// validator holds the configuration and state used while validating the endpoints of a Cloud Run service.
+type validator struct {
+	client        *http.Client
+	timeout       time.Duration
+	ctx           context.Context
+	identityToken string
+	report        *Report
+
+	followRedirects bool
+	leakPatterns    []*regexp.Regexp
+
+	successPredicate SuccessPredicate
+
+	retryAttempts int
+	retryDelay    time.Duration
+	maxRetryAfter time.Duration
+
+	onlyTag        string
+	onlyMethods    map[string]bool
+	excludeMethods map[string]bool
+	skipRules      []SkipRule
+
+	out              io.Writer
+	failureVerbosity FailureVerbosity
+	failureBodyLimit int
+	failureDir       string
+
+	checkPathCase bool
+	checkAllow    bool
+
+	generateBodies   bool
+	checkIdempotency bool
+
+	fuzzBodies int
+	fuzzSeed   int64
+
+	transcript *Transcript
+
+	operationHook func(endpoint, method string, passed bool)
+
+	concurrency int
+	logPrefix   string
+
+	allowEmptyPaths bool
+
+	problemDetails bool
+	problemSchema  *openapi3.Schema
+
+	checkContentType bool
+
+	cassette *cassette
+
+	grpcHealth  bool
+	grpcService string
+}
+
+// ErrNoPaths is returned by ValidateEndpoints when the OpenAPI spec defines no paths.
+var ErrNoPaths = errors.New("OpenAPI spec defines no paths")
+
+// EndpointErrors is returned by ValidateEndpoints when some operations couldn't be tested at all, e.g. because their
+// requests couldn't be sent. The other operations are still tested, so it holds every such error, sorted.
+type EndpointErrors []error
+
+// Error lists every error, one per line.
+func (e EndpointErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d endpoint error(s):\n%s", len(e), strings.Join(msgs, "\n"))
+}
+
+// Is reports whether any of the errors matches target, so that errors.Is looks through every error.
+func (e EndpointErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newValidator creates a validator with the default configuration and applies the provided ValidateOptions to it.
+func newValidator(identityToken string, opts ...ValidateOption) *validator {
+	v := &validator{
+		timeout:         defaultHTTPTimeout,
+		identityToken:   identityToken,
+		report:          &Report{},
+		followRedirects: true,
+		retryAttempts:   1,
+		concurrency:     1,
+		maxRetryAfter:   defaultMaxRetryAfter,
+
+		checkContentType: true,
+
+		out:              os.Stdout,
+		failureVerbosity: FailureTruncated,
+		failureBodyLimit: defaultFailureBodyLimit,
+	}
+
+	for _, o := range opts {
+		o(v)
+	}
+
+	// requests time out through their context, so that operations can override the timeout
+	v.client = &http.Client{}
+	if v.cassette != nil {
+		v.client.Transport = v.cassette
+	}
+	if !v.followRedirects {
+		v.client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	return v
+}
+
+// ValidateEndpoints tests all paths (represented by openapi3.Paths) with all HTTP methods and given response bodies and
+// make sure they respond with the expected status code. Requests are authenticated with the provided identity token, or
+// unauthenticated if it's empty. Paths are tested concurrently by a bounded pool of workers. Returns a Report holding
+// the findings of all the tests. Operations that can't be tested at all don't stop the others from being tested:
+// they're recorded as errors in the Report and returned together as EndpointErrors. A spec without any paths is an
+// error wrapping ErrNoPaths, since it's likely misconfigured, unless WithAllowEmptyPaths is set.
+func ValidateEndpoints(serviceURL string, paths *openapi3.Paths, identityToken string, opts ...ValidateOption) (*Report, error) {
+	v := newValidator(identityToken, opts...)
+
+	var errs EndpointErrors
+	if v.grpcHealth {
+		if err := v.validateGRPCHealth(serviceURL, v.grpcService); err != nil {
+			errs = append(errs, v.endpointError(serviceURL+grpcHealthCheckPath, http.MethodPost,
+				fmt.Errorf("util.validateGRPCHealth: %w", err)))
+		}
+
+		// gRPC services don't need to document any paths
+		if paths == nil || len(*paths) == 0 {
+			if len(errs) == 0 {
+				return v.report, nil
 			}
+			return v.report, errs
+		}
+	}
 
-			success = s && success
+	if paths == nil || len(*paths) == 0 {
+		if !v.allowEmptyPaths {
+			return v.report, fmt.Errorf("%w: the OpenAPI spec may be misconfigured", ErrNoPaths)
 		}
+
+		Infof("OpenAPI spec defines no paths: no endpoints to validate, trivially passing\n")
+		return v.report, nil
 	}
 
-	return success, nil
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	endpoints := make(chan string)
+	for i := 0; i < v.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for endpoint := range endpoints {
+				pv := v.forEndpoint(endpoint)
+				pathErrs := pv.validatePath(serviceURL, endpoint, (*paths)[endpoint])
+				v.report.merge(pv.report)
+
+				mu.Lock()
+				errs = append(errs, pathErrs...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for endpoint := range *paths {
+		endpoints <- endpoint
+	}
+	close(endpoints)
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return v.report, nil
+	}
+
+	// paths finish in any order
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return v.report, errs
+}
+
+// forEndpoint returns a copy of the validator for validating a single path concurrently with others. The copy records
+// its findings into its own Report, to be merged into this validator's, and labels its log output with the path.
+func (v *validator) forEndpoint(endpoint string) *validator {
+	pv := *v
+	pv.report = &Report{}
+	if v.concurrency > 1 {
+		pv.logPrefix = "[" + endpoint + "] "
+	}
+
+	return &pv
+}
+
+// validatePath validates every operation of a single path. An operation that can't be tested is recorded as an error
+// finding and doesn't stop the path's other operations from being tested; the errors are returned.
+func (v *validator) validatePath(serviceURL, endpoint string, pathItem *openapi3.PathItem) []error {
+	v.logf("Testing %s endpoint\n", endpoint)
+	tests := []test{
+		{pathItem.Connect, http.MethodConnect},
+		{pathItem.Delete, http.MethodDelete},
+		{pathItem.Get, http.MethodGet},
+		{pathItem.Head, http.MethodHead},
+		{pathItem.Options, http.MethodOptions},
+		{pathItem.Patch, http.MethodPatch},
+		{pathItem.Post, http.MethodPost},
+		{pathItem.Put, http.MethodPut},
+		{pathItem.Trace, http.MethodTrace},
+	}
+
+	var errs []error
+	allowURL := serviceURL + endpoint
+	for _, t := range tests {
+		if t.operation == nil {
+			continue
+		}
+
+		if !v.methodSelected(t.httpMethod) {
+			v.logf("Skipping %s %s: method excluded from validation\n", t.httpMethod, endpoint)
+			continue
+		}
+
+		if v.skipped(t.httpMethod, endpoint) {
+			v.logf("Skipping %s %s: ignored by skip rule\n", t.httpMethod, endpoint)
+			continue
+		}
+
+		params := operationParameters(pathItem.Parameters, t.operation)
+		path, err := expandPathTemplate(endpoint, params)
+		if err != nil {
+			v.logf("Skipping %s %s: %v\n", t.httpMethod, endpoint, err)
+			continue
+		}
+
+		allowURL = serviceURL + path
+		endpointURL, header, err := applyParameters(allowURL, params)
+		if err != nil {
+			errs = append(errs, v.endpointError(endpoint, t.httpMethod,
+				fmt.Errorf("util.applyParameters: %s %s: %w", t.httpMethod, endpoint, err)))
+			continue
+		}
+
+		err = v.validateEndpointOperation(endpointURL, header, t.operation, t.httpMethod)
+		if err != nil {
+			errs = append(errs, v.endpointError(endpointURL, t.httpMethod,
+				fmt.Errorf("util.validateEndpointOperation: testing %s requests on %s: %w", t.httpMethod, endpointURL, err)))
+		}
+	}
+
+	// the Allow header can only be checked if at least one operation's path parameters could be substituted
+	if v.checkAllow && !pathTemplateRegexp.MatchString(allowURL) {
+		if err := v.validateAllow(allowURL, tests); err != nil {
+			errs = append(errs, v.endpointError(allowURL, http.MethodOptions,
+				fmt.Errorf("util.validateAllow: testing OPTIONS Allow header on %s: %w", allowURL, err)))
+		}
+	}
+
+	return errs
+}
+
+// endpointError records an error that kept an operation from being tested as an error finding, so that the Report
+// doesn't pass, and returns it.
+func (v *validator) endpointError(endpoint, method string, err error) error {
+	v.report.AddError(endpoint, method, "%v", err)
+	return err
+}
+
+// logf logs a message labeled with the validator's log prefix.
+func (v *validator) logf(format string, a ...interface{}) {
+	Infof(v.logPrefix+format, a...)
 }
 
 // validateEndpointOperation validates a single endpoint and a single HTTP method, and ensures that the request --
-// including the provided sample request body -- elicits the expected status code.
-func validateEndpointOperation(endpointURL string, operation *openapi3.Operation, httpMethod string, identityToken string) (bool, error) {
+// including the provided sample request body -- elicits the expected status code. Any findings are recorded in the
+// validator's Report.
+func (v *validator) validateEndpointOperation(endpointURL string, header http.Header, operation *openapi3.Operation, httpMethod string) error {
 	if operation == nil {
-		return true, nil
+		return nil
+	}
+
+	if v.onlyTag != "" && !hasTag(operation, v.onlyTag) {
+		v.logf("Skipping %s %s: operation not tagged %s\n", httpMethod, endpointURL, v.onlyTag)
+		return nil
+	}
+	v.report.countTags(operation.Tags)
+
+	timeout, err := operationTimeout(operation)
+	if err != nil {
+		v.report.AddError(endpointURL, httpMethod, "invalid request timeout override: %v", err)
+		return nil
+	}
+	if timeout > 0 {
+		v.logf("Using request timeout %v overriding %v for %s %s\n", timeout, v.timeout, httpMethod, endpointURL)
+		ov := *v
+		ov.timeout = timeout
+		v = &ov
+	}
+
+	if v.operationHook != nil {
+		errCount := v.report.Count(SeverityError)
+		defer func() {
+			v.operationHook(endpointURL, httpMethod, v.report.Count(SeverityError) == errCount)
+		}()
+	}
+
+	v.logf("Executing %s %s\n", httpMethod, endpointURL)
+
+	if expectsSwitchingProtocols(operation) {
+		err := v.validateWebSocketUpgrade(endpointURL)
+		if err != nil {
+			return fmt.Errorf("util.validateWebSocketUpgrade: %s: %w", endpointURL, err)
+		}
+
+		return nil
 	}
-	log.Printf("Executing %s %s\n", httpMethod, endpointURL)
 
 	if operation.RequestBody == nil {
-		log.Println("Sending empty request body")
+		v.logf("Sending empty request body\n")
 		reqBodyReader := strings.NewReader("")
 
-		s, err := makeTestRequest(endpointURL, httpMethod, "", reqBodyReader, operation, identityToken)
+		err := v.makeTestRequest(endpointURL, httpMethod, "", header, reqBodyReader, operation)
 		if err != nil {
-			return s, fmt.Errorf("util.makeTestRequest: testing %s request on %s: %w", httpMethod, endpointURL, err)
+			return fmt.Errorf("util.makeTestRequest: testing %s request on %s: %w", httpMethod, endpointURL, err)
 		}
 
-		return s, nil
+		return nil
 	}
 
 	reqBodies := operation.RequestBody.Value.Content
-	allTestsPassed := true
 	for mimeType, mediaType := range reqBodies {
-		reqBodyStr := mediaType.Example.(string)
-		log.Printf("Sending %s: %s", mimeType, reqBodyStr)
+		bodies, err := v.requestBodies(mimeType, mediaType)
+		if err != nil {
+			v.report.AddError(endpointURL, httpMethod, "building %s request body: %v", mimeType, err)
+			continue
+		}
 
-		reqBodyReader := strings.NewReader(reqBodyStr)
+		// every named example must elicit an expected status code
+		for _, b := range bodies {
+			if b.name != "" {
+				v.logf("Sending %s example %s: %s", mimeType, b.name, b.body)
+			} else {
+				v.logf("Sending %s: %s", mimeType, b.body)
+			}
 
-		s, err := makeTestRequest(endpointURL, httpMethod, mimeType, reqBodyReader, operation, identityToken)
-		if err != nil {
-			return s, fmt.Errorf("util.makeTestRequest: testing %s %s request on %s: %w", httpMethod, mimeType, endpointURL, err)
+			reqBodyReader := strings.NewReader(b.body)
+
+			err = v.makeTestRequest(endpointURL, httpMethod, mimeType, header, reqBodyReader, operation)
+			if err != nil {
+				return fmt.Errorf("util.makeTestRequest: testing %s %s request on %s: %w", httpMethod, mimeType, endpointURL, err)
+			}
+		}
+	}
+
+	if err := v.fuzzOperation(endpointURL, header, operation, httpMethod); err != nil {
+		return fmt.Errorf("util.fuzzOperation: %w", err)
+	}
+
+	return nil
+}
+
+// hasTag reports whether the provided openapi3.Operation carries the provided OpenAPI tag.
+func hasTag(operation *openapi3.Operation, tag string) bool {
+	for _, t := range operation.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// makeTestRequest makes a single test request and records an error-level finding in the validator's Report if the
+// returned status code doesn't match any of the provided openapi3.Operation expected responses, exactly, by range or by
+// default, or if the response is rejected by the validator's SuccessPredicate, when it has one. The request's outcome
+// is recorded as a Result in the validator's Report.
+func (v *validator) makeTestRequest(endpointURL, httpMethod, mimeType string, header http.Header, reqBodyReader *strings.Reader, operation *openapi3.Operation) error {
+	resp, body, err := v.sendTestRequestWithRetries(endpointURL, httpMethod, mimeType, header, reqBodyReader, operation)
+	if err != nil {
+		return err
+	}
+
+	statusCode := strconv.Itoa(resp.StatusCode)
+	v.logf("Status code: %s\n", statusCode)
+	if Logs(LogVerbose) {
+		v.logBodies(reqBodyReader, body)
+	}
+
+	errCount := v.report.Count(SeverityError)
+	defer func() {
+		passed := v.report.Count(SeverityError) == errCount
+		v.report.addResult(Result{
+			Endpoint:            endpointURL,
+			Method:              httpMethod,
+			ContentType:         mimeType,
+			StatusCode:          resp.StatusCode,
+			ExpectedStatusCodes: responseKeys(operation.Responses),
+			Passed:              passed,
+		})
+
+		if !passed && v.failureDir != "" {
+			v.writeFailure(endpointURL, httpMethod, reqBodyReader, resp, body)
+		}
+	}()
+
+	v.scanForLeaks(endpointURL, httpMethod, body)
+
+	if v.checkPathCase && resp.StatusCode == http.StatusNotFound {
+		if err := v.checkLowercasePath(endpointURL, httpMethod, mimeType, header, reqBodyReader, operation); err != nil {
+			return fmt.Errorf("util.checkLowercasePath: %w", err)
+		}
+	}
+
+	if v.successPredicate != nil && !v.successPredicate(resp.StatusCode, body) {
+		v.report.AddError(endpointURL, httpMethod, "status code %s rejected by success predicate", statusCode)
+		v.logf("Rejected by success predicate: FAIL\n")
+		v.dumpFailureBody(body)
+		return nil
+	}
+
+	if val, _, ok := matchResponse(operation.Responses, resp.StatusCode); ok {
+		v.logf("Response description: %s\n", *val.Value.Description)
+
+		if v.checkContentType {
+			v.validateContentType(endpointURL, httpMethod, resp, val.Value)
+		}
+		v.validateResponseBody(endpointURL, httpMethod, resp, body, val.Value)
+
+		if v.problemDetails {
+			v.checkProblemDetails(endpointURL, httpMethod, resp, body)
+		}
+
+		if !v.followRedirects {
+			v.validateLocation(endpointURL, httpMethod, resp, val.Value)
+		}
+
+		if v.checkIdempotency && idempotentMethods[httpMethod] {
+			err := v.repeatIdempotentRequest(endpointURL, httpMethod, mimeType, header, reqBodyReader, operation, resp.StatusCode)
+			if err != nil {
+				return fmt.Errorf("util.repeatIdempotentRequest: %w", err)
+			}
 		}
+		return nil
+	}
+
+	if v.successPredicate != nil {
+		v.logf("Undeclared status code accepted by success predicate\n")
+		return nil
+	}
+
+	v.report.AddError(endpointURL, httpMethod, "unexpected status code %s", statusCode)
+	v.logf("Unknown response description: FAIL\n")
+	v.dumpFailureBody(body)
+
+	return nil
+}
+
+// dumpFailureBody writes the response body of a failed test request to the validator's output, as much of it as the
+// validator's FailureVerbosity allows.
+func (v *validator) dumpFailureBody(body []byte) {
+	switch v.failureVerbosity {
+	case FailureSummary:
+		return
+	case FailureTruncated:
+		if len(body) > v.failureBodyLimit {
+			v.logf("Dumping first %d bytes of response body\n", v.failureBodyLimit)
+			fmt.Fprintf(v.out, "%s\n... (%d more bytes)\n", body[:v.failureBodyLimit], len(body)-v.failureBodyLimit)
+			return
+		}
+	}
+
+	v.logf("Dumping response body\n")
+	fmt.Fprintln(v.out, string(body))
+}
 
-		allTestsPassed = allTestsPassed && s
+// checkLowercasePath diagnoses path case-sensitivity bugs. It's called after a test request returned a 404, and
+// repeats the request with the endpoint's path lowercased. Which of the two forms worked is recorded as a
+// warning-level finding in the validator's Report.
+func (v *validator) checkLowercasePath(endpointURL, httpMethod, mimeType string, header http.Header, reqBodyReader *strings.Reader, operation *openapi3.Operation) error {
+	u, err := url.Parse(endpointURL)
+	if err != nil {
+		return fmt.Errorf("url.Parse: %w", err)
+	}
+
+	lower := strings.ToLower(u.Path)
+	if lower == u.Path {
+		return nil
+	}
+	u.Path = lower
+	u.RawPath = ""
+	lowerURL := u.String()
+
+	if _, err := reqBodyReader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	v.logf("Checking lowercased path: %s %s\n", httpMethod, lowerURL)
+	resp, _, err := v.sendTestRequest(lowerURL, httpMethod, mimeType, header, reqBodyReader)
+	if err != nil {
+		return err
+	}
+
+	if _, _, ok := matchResponse(operation.Responses, resp.StatusCode); ok {
+		v.report.AddWarning(endpointURL, httpMethod, "declared path returned 404 but lowercased path %s returned expected status code %d: path case mismatch", lower, resp.StatusCode)
+		return nil
+	}
+
+	v.report.AddWarning(endpointURL, httpMethod, "declared path returned 404 and lowercased path %s returned status code %d: neither form worked", lower, resp.StatusCode)
+	return nil
+}
+
+// requestContext returns the context a single request to the Cloud Run service is sent under: it's derived from the
+// validator's context, and bounded by the validator's timeout.
+func (v *validator) requestContext() (context.Context, context.CancelFunc) {
+	parent := v.ctx
+	if parent == nil {
+		parent = context.Background()
 	}
 
-	return allTestsPassed, nil
+	return context.WithTimeout(parent, v.timeout)
 }
 
-// makeTestRequest returns a success bool based on whether the returned status code  was included in the provided
-// openapi3.Operation expected responses.
-func makeTestRequest(endpointURL, httpMethod, mimeType string, reqBodyReader *strings.Reader, operation *openapi3.Operation, identityToken string) (bool, error) {
-	// TODO: add user option to configure timeout for each test request
-	ctx, _ := context.WithTimeout(context.Background(), httpTimeout)
+// sendTestRequest sends a single test request with the provided additional headers and returns the response along
+// with its fully read body.
+func (v *validator) sendTestRequest(endpointURL, httpMethod, mimeType string, header http.Header, reqBodyReader *strings.Reader) (*http.Response, []byte, error) {
+	// the timeout covers reading the response body too
+	ctx, cancel := v.requestContext()
+	defer cancel()
+
 	req, err := http.NewRequestWithContext(ctx, httpMethod, endpointURL, reqBodyReader)
 	if err != nil {
-		return false, fmt.Errorf("http.NewRequest: %w", err)
+		return nil, nil, fmt.Errorf("http.NewRequestWithContext: %w", err)
 	}
 
-	req.Header.Add("Authorization", "Bearer "+identityToken)
+	for name, values := range header {
+		for _, val := range values {
+			req.Header.Add(name, val)
+		}
+	}
+	setAuthorization(req.Header, v.identityToken)
 	req.Header.Add("content-type", mimeType)
 
-	resp, err := http.DefaultClient.Do(req)
+	var reqBody []byte
+	if v.transcript != nil {
+		if reqBody, err = ioutil.ReadAll(reqBodyReader); err != nil {
+			return nil, nil, fmt.Errorf("ioutil.ReadAll: reading request body: %w", err)
+		}
+		if _, err = reqBodyReader.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	start := time.Now()
+	resp, err := v.client.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("http.Client.Do: %w", err)
+		return nil, nil, fmt.Errorf("http.Client.Do: %w", err)
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	defer resp.Body.Close()
 	if err != nil {
-		return false, fmt.Errorf("ioutil.ReadAll: reading http.Response.Body: %w", err)
+		return nil, nil, fmt.Errorf("ioutil.ReadAll: reading http.Response.Body: %w", err)
 	}
 
-	statusCode := strconv.Itoa(resp.StatusCode)
-	log.Printf("Status code: %s\n", statusCode)
+	if v.transcript != nil {
+		v.transcript.record(Exchange{
+			Started:      start,
+			Duration:     time.Since(start),
+			Request:      req,
+			RequestBody:  reqBody,
+			Response:     resp,
+			ResponseBody: body,
+		})
+	}
+
+	return resp, body, nil
+}
+
+// logBodies logs the body of a test request and the body of its response, for LogVerbose.
+func (v *validator) logBodies(reqBodyReader *strings.Reader, respBody []byte) {
+	if _, err := reqBodyReader.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	reqBody, err := ioutil.ReadAll(reqBodyReader)
+	if err != nil {
+		return
+	}
+
+	Debugf(v.logPrefix+"Request body: %s\n", reqBody)
+	Debugf(v.logPrefix+"Response body: %s\n", respBody)
+}
+
+// setAuthorization authenticates a request to a Cloud Run service with the provided identity token. An empty token
+// leaves the request unauthenticated, for services that allow unauthenticated invocations.
+func setAuthorization(h http.Header, identityToken string) {
+	if identityToken == "" {
+		return
+	}
+
+	h.Set("Authorization", "Bearer "+identityToken)
+}
+
+// validateLocation checks the Location header of a redirect response against the Location header declared for the
+// matched openapi3.Response, if any. The declared header's example is matched exactly; otherwise, its schema's pattern
+// is matched as a regular expression. Mismatches are recorded as error-level findings in the validator's Report.
+func (v *validator) validateLocation(endpointURL, httpMethod string, resp *http.Response, expected *openapi3.Response) {
+	var header *openapi3.Header
+	for name, h := range expected.Headers {
+		if http.CanonicalHeaderKey(name) == "Location" && h != nil {
+			header = h.Value
+			break
+		}
+	}
+
+	if header == nil {
+		return
+	}
 
-	if val, ok := operation.Responses[statusCode]; ok {
-		log.Printf("Response description: %s\n", *val.Value.Description)
-		return true, nil
+	actual := resp.Header.Get("Location")
+	if actual == "" {
+		v.report.AddError(endpointURL, httpMethod, "declared Location header missing from %d response", resp.StatusCode)
+		return
 	}
 
-	log.Println("Unknown response description: FAIL")
-	log.Println("Dumping response body")
-	fmt.Println(string(body))
+	if example, ok := header.Example.(string); ok {
+		if actual != example {
+			v.report.AddError(endpointURL, httpMethod, "Location header mismatch: want %s, got %s", example, actual)
+		}
+		return
+	}
 
-	return false, nil
+	if header.Schema == nil || header.Schema.Value == nil || header.Schema.Value.Pattern == "" {
+		return
+	}
+
+	pattern := header.Schema.Value.Pattern
+	m, err := regexp.MatchString(pattern, actual)
+	if err != nil {
+		v.report.AddError(endpointURL, httpMethod, "invalid Location header pattern %s: %v", pattern, err)
+		return
+	}
+
+	if !m {
+		v.report.AddError(endpointURL, httpMethod, "Location header mismatch: want match for %s, got %s", pattern, actual)
+	}
+}
+
+// scanForLeaks records an error-level finding in the validator's Report for each of the validator's leak patterns that
+// matches the provided response body.
+func (v *validator) scanForLeaks(endpointURL, httpMethod string, body []byte) {
+	for _, p := range v.leakPatterns {
+		if p.Match(body) {
+			v.report.AddError(endpointURL, httpMethod, "response body matches leak pattern %s", p)
+		}
+	}
 }
@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"time"
+)
+
+// timeoutExtension is the OpenAPI extension overriding the request timeout of the operation it's set on, as a
+// duration string like "2m" or a number of seconds.
+const timeoutExtension = "x-sst-timeout"
+
+// extensionValue returns the decoded value of the provided extension of an OpenAPI object, or nil if it isn't set.
+// Extensions loaded from a spec hold raw JSON.
+func extensionValue(props openapi3.ExtensionProps, name string) (interface{}, error) {
+	val, ok := props.Extensions[name]
+	if !ok {
+		return nil, nil
+	}
+
+	raw, ok := val.(json.RawMessage)
+	if !ok {
+		return val, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %s: %w", name, err)
+	}
+
+	return decoded, nil
+}
+
+// operationTimeout returns the request timeout the provided openapi3.Operation overrides the global one with through
+// its x-sst-timeout extension, or zero if it doesn't.
+func operationTimeout(operation *openapi3.Operation) (time.Duration, error) {
+	val, err := extensionValue(operation.ExtensionProps, timeoutExtension)
+	if err != nil || val == nil {
+		return 0, err
+	}
+
+	var d time.Duration
+	switch t := val.(type) {
+	case string:
+		d, err = time.ParseDuration(t)
+		if err != nil {
+			return 0, fmt.Errorf("time.ParseDuration: %s: %w", timeoutExtension, err)
+		}
+	case float64:
+		d = time.Duration(t * float64(time.Second))
+	default:
+		return 0, fmt.Errorf("%s: expecting a duration string or a number of seconds, got %v", timeoutExtension, val)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("%s: timeout must be positive, got %v", timeoutExtension, val)
+	}
+
+	return d, nil
+}
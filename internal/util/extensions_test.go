@@ -0,0 +1,107 @@
+package util
+
+import (
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type operationTimeoutTest struct {
+	extension interface{}   // value of the x-sst-timeout extension, if any
+	timeout   time.Duration // expected result of operationTimeout
+	err       bool          // whether an error is expected
+}
+
+var operationTimeoutTests = []operationTimeoutTest{
+	// no override
+	{},
+
+	// duration string, as loaded from a spec
+	{
+		extension: json.RawMessage(`"2m"`),
+		timeout:   2 * time.Minute,
+	},
+
+	// number of seconds, as loaded from a spec
+	{
+		extension: json.RawMessage(`1.5`),
+		timeout:   1500 * time.Millisecond,
+	},
+
+	// duration string set programmatically
+	{
+		extension: "30s",
+		timeout:   30 * time.Second,
+	},
+
+	// invalid duration
+	{
+		extension: json.RawMessage(`"forever"`),
+		err:       true,
+	},
+
+	// negative timeout
+	{
+		extension: json.RawMessage(`-1`),
+		err:       true,
+	},
+
+	// unexpected type
+	{
+		extension: json.RawMessage(`true`),
+		err:       true,
+	},
+}
+
+func TestOperationTimeout(t *testing.T) {
+	for i, tc := range operationTimeoutTests {
+		op := newTestOperation("200")
+		if tc.extension != nil {
+			op.Extensions = map[string]interface{}{timeoutExtension: tc.extension}
+		}
+
+		timeout, err := operationTimeout(op)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if timeout != tc.timeout {
+			t.Errorf("#%d: result mismatch\nwant: %v\ngot: %v", i, tc.timeout, timeout)
+		}
+	}
+}
+
+func TestOperationTimeoutOverride(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/batch" {
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer s.Close()
+
+	slow := newTestOperation("200")
+	slow.Extensions = map[string]interface{}{timeoutExtension: json.RawMessage(`"2s"`)}
+	paths := &openapi3.Paths{
+		"/health": &openapi3.PathItem{Get: newTestOperation("200")},
+		"/batch":  &openapi3.PathItem{Post: slow},
+	}
+
+	// the slow operation only passes because of its override
+	report, err := ValidateEndpoints(s.URL, paths, "", WithTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+	if !report.Passed(true) {
+		t.Errorf("slow operation with timeout override failed: %v", report.Findings)
+	}
+
+	// without the override, it times out
+	delete(slow.Extensions, timeoutExtension)
+	if _, err := ValidateEndpoints(s.URL, paths, "", WithTimeout(100*time.Millisecond)); err == nil {
+		t.Errorf("slow operation without timeout override didn't time out")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// failureFileUnsafeRegexp matches the runs of characters that aren't kept in the names of failure files.
+var failureFileUnsafeRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// failureFileName returns the name of the file the failed test requests of the provided endpoint and HTTP method are
+// written to, e.g. GET_items_42.txt for GET requests on /items/42.
+func failureFileName(endpointURL, httpMethod string) string {
+	p := endpointURL
+	if u, err := url.Parse(endpointURL); err == nil {
+		p = u.Path
+	}
+
+	name := strings.Trim(failureFileUnsafeRegexp.ReplaceAllString(p, "_"), "_")
+	if name == "" {
+		name = "root"
+	}
+
+	return httpMethod + "_" + name + ".txt"
+}
+
+// writeFailure appends the provided failed test request and its response to the endpoint's file in the validator's
+// failure directory, so that it can be inspected without digging through the logs. Errors are only logged: they
+// don't change the outcome of the test.
+func (v *validator) writeFailure(endpointURL, httpMethod string, reqBodyReader *strings.Reader, resp *http.Response, respBody []byte) {
+	if err := os.MkdirAll(v.failureDir, 0755); err != nil {
+		log.Printf("Writing failed request: os.MkdirAll: %v\n", err)
+		return
+	}
+
+	filename := filepath.Join(v.failureDir, failureFileName(endpointURL, httpMethod))
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Writing failed request: os.OpenFile: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	reqBody, err := readRequestBody(reqBodyReader)
+	if err != nil {
+		log.Printf("Writing failed request: %v\n", err)
+		return
+	}
+
+	if err := writeExchange(f, endpointURL, httpMethod, reqBody, resp, respBody); err != nil {
+		log.Printf("Writing failed request: %s: %v\n", filename, err)
+		return
+	}
+
+	v.logf("Wrote failed request and response to %s\n", filename)
+}
+
+// readRequestBody reads the whole body of a test request, and rewinds it so that it can be sent again.
+func readRequestBody(r *strings.Reader) ([]byte, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll: reading request body: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// writeExchange writes a test request and its response to w in a form close to HTTP/1.1 messages: the request line,
+// the request headers and body, then the status line, the response headers and body. The values of credential-bearing
+// request headers, like Authorization, are redacted.
+func writeExchange(w io.Writer, endpointURL, httpMethod string, reqBody []byte, resp *http.Response, respBody []byte) error {
+	reqHeader := http.Header{}
+	if resp.Request != nil {
+		endpointURL = resp.Request.URL.String()
+		for name, values := range resp.Request.Header {
+			if redactedHeaders[name] {
+				values = []string{"REDACTED"}
+			}
+			reqHeader[name] = values
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "%s %s\n", httpMethod, endpointURL); err != nil {
+		return err
+	}
+	if err := reqHeader.Write(w); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "\n%s\n\n%s %s\n", reqBody, resp.Proto, resp.Status); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%s\n\n", respBody)
+
+	return err
+}
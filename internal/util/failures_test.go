@@ -0,0 +1,86 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type failureFileNameTest struct {
+	endpointURL string // URL of the test request
+	method      string // HTTP method of the test request
+	name        string // expected file name
+}
+
+var failureFileNameTests = []failureFileNameTest{
+	{endpointURL: "https://hello-abc.a.run.app/items/42?verbose=true", method: http.MethodGet, name: "GET_items_42.txt"},
+	{endpointURL: "https://hello-abc.a.run.app/", method: http.MethodPost, name: "POST_root.txt"},
+	{endpointURL: "https://hello-abc.a.run.app/v1/users:batchGet", method: http.MethodPost, name: "POST_v1_users_batchGet.txt"},
+}
+
+func TestFailureFileName(t *testing.T) {
+	for i, tc := range failureFileNameTests {
+		if name := failureFileName(tc.endpointURL, tc.method); name != tc.name {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.name, name)
+		}
+	}
+}
+
+func TestWithFailureDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failures")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.Header().Set("X-Trace", "abc123")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("stack trace here"))
+		}
+	}))
+	defer s.Close()
+
+	paths := newTestPaths("/broken", newTestOperation("200"))
+	for k, v := range *newTestPaths("/ok", newTestOperation("200")) {
+		(*paths)[k] = v
+	}
+
+	failureDir := filepath.Join(dir, "failures")
+	if _, err := ValidateEndpoints(s.URL, paths, "secret-token", WithFailureDir(failureDir)); err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	files, err := ioutil.ReadDir(failureDir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	if len(files) != 1 || files[0].Name() != "GET_broken.txt" {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Fatalf("failure files mismatch\nwant: [GET_broken.txt]\ngot: %v", names)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(failureDir, "GET_broken.txt"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	dump := string(b)
+
+	for _, want := range []string{"GET " + s.URL + "/broken", "Authorization: REDACTED", "500 Internal Server Error",
+		"X-Trace: abc123", "stack trace here"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("failure file doesn't contain %q:\n%s", want, dump)
+		}
+	}
+	if strings.Contains(dump, "secret-token") {
+		t.Errorf("failure file leaks the identity token:\n%s", dump)
+	}
+}
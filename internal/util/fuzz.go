@@ -0,0 +1,275 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxFuzzAttempts bounds how many random values are generated per fuzz body until one is valid against the schema.
+	maxFuzzAttempts = 10
+
+	// fuzzStringChars are the characters random strings are made of, including ones often mishandled by services.
+	fuzzStringChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 -_.'\"<>&%/\\é漢"
+
+	// fuzzLengthSpread is how much longer than their minimum random strings and arrays can be when no maximum is set.
+	fuzzLengthSpread = 16
+
+	// fuzzNumberSpread is how far from their minimum, or from zero, random numbers can be when no bound is set.
+	fuzzNumberSpread = 1000
+
+	// maxFuzzInteger bounds the magnitude of random integers, so that their range fits in an int64 and they're exactly
+	// representable as float64.
+	maxFuzzInteger = 1 << 53
+)
+
+// fuzzRand returns the source of randomness for fuzzing the provided operation. It's derived from the validator's fuzz
+// seed and the operation's path and method, so that every operation gets the same bodies for a given seed regardless of
+// the service's URL or the order operations are tested in.
+func (v *validator) fuzzRand(endpointURL, httpMethod string) *rand.Rand {
+	path := endpointURL
+	if u, err := url.Parse(endpointURL); err == nil {
+		path = u.Path
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(httpMethod + " " + path))
+
+	return rand.New(rand.NewSource(v.fuzzSeed ^ int64(h.Sum64())))
+}
+
+// fuzzOperation sends the validator's number of fuzz bodies, random but valid against the request body schema, for
+// each JSON media type of the provided openapi3.Operation's request body. Any 5xx response is recorded as an
+// error-level finding holding the offending body, since a service should reject unexpected but valid input gracefully.
+func (v *validator) fuzzOperation(endpointURL string, header http.Header, operation *openapi3.Operation, httpMethod string) error {
+	if v.fuzzBodies < 1 || operation.RequestBody == nil || operation.RequestBody.Value == nil {
+		return nil
+	}
+
+	content := operation.RequestBody.Value.Content
+	mimeTypes := make([]string, 0, len(content))
+	for mimeType := range content {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+
+	r := v.fuzzRand(endpointURL, httpMethod)
+	for _, mimeType := range mimeTypes {
+		mediaType := content[mimeType]
+		if !strings.Contains(mimeType, "json") || mediaType == nil || mediaType.Schema == nil || mediaType.Schema.Value == nil {
+			continue
+		}
+
+		for i := 0; i < v.fuzzBodies; i++ {
+			body, ok := fuzzBody(mediaType.Schema.Value, r)
+			if !ok {
+				v.logf("Could not generate a valid %s fuzz body for %s %s\n", mimeType, httpMethod, endpointURL)
+				break
+			}
+			v.logf("Sending %s fuzz body %d of %d: %s\n", mimeType, i+1, v.fuzzBodies, body)
+
+			resp, _, err := v.sendTestRequest(endpointURL, httpMethod, mimeType, header, strings.NewReader(body))
+			if err != nil {
+				return fmt.Errorf("util.sendTestRequest: fuzzing %s %s request on %s: %w", httpMethod, mimeType, endpointURL, err)
+			}
+
+			if resp.StatusCode >= http.StatusInternalServerError {
+				v.report.AddError(endpointURL, httpMethod, "fuzz body returned status code %d: %s", resp.StatusCode, body)
+			}
+		}
+	}
+
+	return nil
+}
+
+// fuzzBody generates a random JSON body valid against the provided openapi3.Schema. It reports false if no valid body
+// was generated within maxFuzzAttempts, for example because the schema has a pattern random strings don't match.
+func fuzzBody(schema *openapi3.Schema, r *rand.Rand) (string, bool) {
+	for attempt := 0; attempt < maxFuzzAttempts; attempt++ {
+		body, err := marshalBody(randomValue(schema, r, 0))
+		if err != nil {
+			continue
+		}
+
+		// validate the body as the service will decode it
+		var value interface{}
+		if json.Unmarshal([]byte(body), &value) != nil || schema.VisitJSON(value) != nil {
+			continue
+		}
+
+		return body, true
+	}
+
+	return "", false
+}
+
+// randomValue synthesizes a random value meant to be valid against the provided openapi3.Schema, like generateValue
+// does for minimal values: a random enum value, an object with its required properties and a random subset of its
+// optional ones, an array of random length, or a random value of the schema's type within its bounds.
+func randomValue(schema *openapi3.Schema, r *rand.Rand, depth int) interface{} {
+	if len(schema.Enum) > 0 {
+		return schema.Enum[r.Intn(len(schema.Enum))]
+	}
+
+	if depth > maxGeneratedBodyDepth {
+		return nil
+	}
+
+	if len(schema.AllOf) > 0 {
+		merged := make(map[string]interface{})
+		for _, s := range schema.AllOf {
+			if s == nil || s.Value == nil {
+				continue
+			}
+			if obj, ok := randomValue(s.Value, r, depth+1).(map[string]interface{}); ok {
+				for k, v := range obj {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+
+	for _, alternatives := range [][]*openapi3.SchemaRef{schema.OneOf, schema.AnyOf} {
+		if len(alternatives) > 0 {
+			if s := alternatives[r.Intn(len(alternatives))]; s != nil && s.Value != nil {
+				return randomValue(s.Value, r, depth+1)
+			}
+		}
+	}
+
+	switch schema.Type {
+	case "object":
+		required := make(map[string]bool)
+		for _, name := range schema.Required {
+			required[name] = true
+		}
+
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		obj := make(map[string]interface{})
+		for _, name := range names {
+			p := schema.Properties[name]
+			if p == nil || p.Value == nil || (!required[name] && r.Intn(2) == 0) {
+				continue
+			}
+			obj[name] = randomValue(p.Value, r, depth+1)
+		}
+		return obj
+	case "array":
+		n := randomLength(r, schema.MinItems, schema.MaxItems)
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n && schema.Items != nil && schema.Items.Value != nil; i++ {
+			items = append(items, randomValue(schema.Items.Value, r, depth+1))
+		}
+		return items
+	case "string":
+		if e, ok := formatExamples[schema.Format]; ok {
+			return e
+		}
+		if schema.Pattern != "" && schema.Example != nil {
+			return schema.Example
+		}
+
+		chars := []rune(fuzzStringChars)
+		s := make([]rune, randomLength(r, schema.MinLength, schema.MaxLength))
+		for i := range s {
+			s[i] = chars[r.Intn(len(chars))]
+		}
+		return string(s)
+	case "integer":
+		min, max := randomBounds(schema)
+		return randomInteger(r, min, max)
+	case "number":
+		min, max := randomBounds(schema)
+		return min + r.Float64()*(max-min)
+	case "boolean":
+		return r.Intn(2) == 0
+	default:
+		return nil
+	}
+}
+
+// randomLength returns a random length between the provided minimum and maximum, or up to fuzzLengthSpread more than
+// the minimum if there's no maximum.
+func randomLength(r *rand.Rand, min uint64, max *uint64) uint64 {
+	hi := min + fuzzLengthSpread
+	if max != nil && *max < hi {
+		hi = *max
+	}
+	if hi <= min {
+		return min
+	}
+
+	return min + uint64(r.Int63n(int64(hi-min)+1))
+}
+
+// randomInteger returns a random integer between the provided bounds, clamped to ±maxFuzzInteger. If no integer lies
+// between them, such as between 1.5 and 1.7, it returns the minimum rounded up: there's no valid value to generate.
+func randomInteger(r *rand.Rand, min, max float64) int64 {
+	lo := math.Max(math.Ceil(min), -maxFuzzInteger)
+	hi := math.Min(math.Floor(max), maxFuzzInteger)
+	if lo > maxFuzzInteger {
+		lo = maxFuzzInteger
+	}
+	if hi < lo {
+		return int64(lo)
+	}
+
+	return int64(lo) + r.Int63n(int64(hi-lo)+1)
+}
+
+// randomBounds returns the range random numbers valid against the provided openapi3.Schema are drawn from. Exclusive
+// bounds are narrowed by one, which is exact for integers and good enough for fuzzing numbers.
+func randomBounds(schema *openapi3.Schema) (float64, float64) {
+	min, max := -float64(fuzzNumberSpread), float64(fuzzNumberSpread)
+	if schema.Min != nil {
+		min = *schema.Min
+		if schema.ExclusiveMin {
+			min++
+		}
+		if schema.Max == nil {
+			max = min + fuzzNumberSpread
+		}
+	}
+	if schema.Max != nil {
+		max = *schema.Max
+		if schema.ExclusiveMax {
+			max--
+		}
+		if schema.Min == nil {
+			min = max - fuzzNumberSpread
+		}
+	}
+	if max < min {
+		max = min
+	}
+
+	return min, max
+}
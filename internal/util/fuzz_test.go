@@ -0,0 +1,215 @@
+package util
+
+import (
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// orderSchema is an object schema with bounded properties of various types.
+var orderSchema = &openapi3.Schema{
+	Type:     "object",
+	Required: []string{"item", "quantity"},
+	Properties: map[string]*openapi3.SchemaRef{
+		"item":     openapi3.NewSchemaRef("", openapi3.NewStringSchema().WithMinLength(1).WithMaxLength(8)),
+		"quantity": openapi3.NewSchemaRef("", openapi3.NewIntegerSchema().WithMin(1).WithMax(5)),
+		"price":    openapi3.NewSchemaRef("", openapi3.NewFloat64Schema().WithMin(0)),
+		"size":     openapi3.NewSchemaRef("", openapi3.NewStringSchema().WithEnum("small", "large")),
+		"gift":     openapi3.NewSchemaRef("", openapi3.NewBoolSchema()),
+		"notes":    openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()).WithMaxItems(3)),
+	},
+}
+
+func TestFuzzBodyValid(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		body, ok := fuzzBody(orderSchema, r)
+		if !ok {
+			t.Fatalf("#%d: no valid fuzz body generated", i)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(body), &value); err != nil {
+			t.Fatalf("#%d: json.Unmarshal: %v", i, err)
+		}
+		if err := orderSchema.VisitJSON(value); err != nil {
+			t.Errorf("#%d: fuzz body %s doesn't match schema: %v", i, body, err)
+		}
+	}
+}
+
+func TestFuzzBodySeeded(t *testing.T) {
+	generate := func(seed int64) []string {
+		r := rand.New(rand.NewSource(seed))
+		var bodies []string
+		for i := 0; i < 5; i++ {
+			body, _ := fuzzBody(orderSchema, r)
+			bodies = append(bodies, body)
+		}
+		return bodies
+	}
+
+	a, b, c := generate(7), generate(7), generate(8)
+	if strings.Join(a, "\n") != strings.Join(b, "\n") {
+		t.Errorf("fuzz bodies generated with the same seed differ:\n%v\n%v", a, b)
+	}
+	if strings.Join(a, "\n") == strings.Join(c, "\n") {
+		t.Errorf("fuzz bodies generated with different seeds are identical:\n%v", a)
+	}
+}
+
+// fuzzTestPaths creates openapi3.Paths with a single POST operation on / taking an order body.
+func fuzzTestPaths() *openapi3.Paths {
+	op := newTestOperation("201")
+	op.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().WithContent(openapi3.Content{
+			"application/json": &openapi3.MediaType{
+				Example: map[string]interface{}{"item": "apple", "quantity": 1},
+				Schema:  openapi3.NewSchemaRef("", orderSchema),
+			},
+		}),
+	}
+
+	return &openapi3.Paths{"/": &openapi3.PathItem{Post: op}}
+}
+
+type randomIntegerTest struct {
+	min, max float64 // input bounds
+	lo, hi   int64   // expected range of the result
+}
+
+var randomIntegerTests = []randomIntegerTest{
+	// bounded range
+	{
+		min: 1,
+		max: 5,
+		lo:  1,
+		hi:  5,
+	},
+
+	// single integer
+	{
+		min: 2,
+		max: 2,
+		lo:  2,
+		hi:  2,
+	},
+
+	// no integer between fractional bounds
+	{
+		min: 1.5,
+		max: 1.7,
+		lo:  2,
+		hi:  2,
+	},
+
+	// empty range after narrowing exclusive bounds
+	{
+		min: 3,
+		max: 2,
+		lo:  3,
+		hi:  3,
+	},
+
+	// bounds near the limits of int64
+	{
+		min: -math.MaxInt64,
+		max: math.MaxInt64,
+		lo:  -maxFuzzInteger,
+		hi:  maxFuzzInteger,
+	},
+}
+
+func TestRandomInteger(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i, tc := range randomIntegerTests {
+		for j := 0; j < 20; j++ {
+			if got := randomInteger(r, tc.min, tc.max); got < tc.lo || got > tc.hi {
+				t.Errorf("#%d: result out of range\nwant: [%d, %d]\ngot: %d", i, tc.lo, tc.hi, got)
+				break
+			}
+		}
+	}
+}
+
+func TestFuzzBodyEmptyIntegerRange(t *testing.T) {
+	schema := openapi3.NewIntegerSchema().WithMin(1.5).WithMax(1.7)
+
+	// an integer schema no value is valid against can't yield a body, but mustn't panic either
+	if _, ok := fuzzBody(schema, rand.New(rand.NewSource(1))); ok {
+		t.Errorf("fuzz body generated for a schema without valid values")
+	}
+}
+
+type fuzzTest struct {
+	fuzz   int  // number of fuzz bodies per operation
+	failed bool // whether error-level findings are expected
+}
+
+var fuzzTests = []fuzzTest{
+	// fuzzing disabled: only the example body is sent
+	{
+		fuzz: 0,
+	},
+
+	// fuzz bodies reach the input the service fails on
+	{
+		fuzz:   20,
+		failed: true,
+	},
+}
+
+func TestFuzz(t *testing.T) {
+	// the stub fails on large orders of more than one item
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+
+		var order struct {
+			Quantity int
+			Size     string
+		}
+		json.Unmarshal(b, &order)
+
+		if order.Size == "large" && order.Quantity > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+
+	for i, tc := range fuzzTests {
+		report, err := ValidateEndpoints(s.URL, fuzzTestPaths(), "", WithFuzz(tc.fuzz, 42))
+		if err != nil {
+			t.Fatalf("#%d: ValidateEndpoints: %v", i, err)
+		}
+
+		if failed := report.Count(SeverityError) > 0; failed != tc.failed {
+			t.Errorf("#%d: result mismatch\nwant failed: %t\ngot: %v", i, tc.failed, report.Findings)
+		}
+
+		for _, f := range report.Findings {
+			if !strings.Contains(f.Message, `"size":"large"`) {
+				t.Errorf("#%d: finding doesn't hold the failing body: %s", i, f.Message)
+			}
+		}
+	}
+
+	// the same seed finds the same failing bodies
+	r1, _ := ValidateEndpoints(s.URL, fuzzTestPaths(), "", WithFuzz(20, 42))
+	r2, _ := ValidateEndpoints(s.URL, fuzzTestPaths(), "", WithFuzz(20, 42))
+	if len(r1.Findings) != len(r2.Findings) {
+		t.Fatalf("findings of runs with the same seed differ:\n%v\n%v", r1.Findings, r2.Findings)
+	}
+	for i := range r1.Findings {
+		if r1.Findings[i].Message != r2.Findings[i].Message {
+			t.Errorf("findings of runs with the same seed differ:\n%v\n%v", r1.Findings[i], r2.Findings[i])
+		}
+	}
+}
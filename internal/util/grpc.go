@@ -0,0 +1,234 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// grpcExtension is the top-level OpenAPI extension marking the Cloud Run service as a gRPC one, whose health is checked
+// through the grpc.health.v1 protocol. It's either true, to check the health of the whole server, or the name of the
+// gRPC service whose health is checked.
+const grpcExtension = "x-sst-grpc"
+
+// grpcHealthCheckPath is the HTTP/2 path of the grpc.health.v1.Health/Check method.
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// grpcServingStatuses are the names of the grpc.health.v1.HealthCheckResponse.ServingStatus values.
+var grpcServingStatuses = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// grpcServing is the grpc.health.v1.HealthCheckResponse.ServingStatus of a healthy service.
+const grpcServing = 1
+
+// GRPCHealthService reports whether the provided OpenAPI spec marks the Cloud Run service as a gRPC one through its
+// x-sst-grpc extension, along with the name of the gRPC service whose health should be checked, which is empty for the
+// whole server.
+func GRPCHealthService(swagger *openapi3.Swagger) (string, bool, error) {
+	val, err := extensionValue(swagger.ExtensionProps, grpcExtension)
+	if err != nil || val == nil {
+		return "", false, err
+	}
+
+	switch t := val.(type) {
+	case bool:
+		return "", t, nil
+	case string:
+		return t, true, nil
+	default:
+		return "", false, fmt.Errorf("%s: expecting a boolean or a gRPC service name, got %v", grpcExtension, val)
+	}
+}
+
+// validateGRPCHealth performs a grpc.health.v1 health check of the provided gRPC service against the Cloud Run service
+// at serviceURL, authenticated with the validator's identity token, and records an error-level finding in the
+// validator's Report unless the service is reported as SERVING. The check's outcome is recorded as a Result in the
+// validator's Report. gRPC requires HTTP/2, which is only negotiated over HTTPS.
+func (v *validator) validateGRPCHealth(serviceURL, service string) error {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return fmt.Errorf("url.Parse: %w", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("gRPC health check needs an https service URL to negotiate HTTP/2, got %s", serviceURL)
+	}
+	endpointURL := strings.TrimSuffix(serviceURL, "/") + grpcHealthCheckPath
+
+	if service == "" {
+		v.logf("Checking gRPC health of %s\n", serviceURL)
+	} else {
+		v.logf("Checking gRPC health of service %s at %s\n", service, serviceURL)
+	}
+
+	ctx, cancel := v.requestContext()
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointURL, bytes.NewReader(grpcFrame(grpcHealthCheckRequest(service))))
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext: %w", err)
+	}
+
+	setAuthorization(req.Header, v.identityToken)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http.Client.Do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// the trailers holding the gRPC status are only available once the body is fully read
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ioutil.ReadAll: %w", err)
+	}
+
+	v.logf("Status code: %d\n", resp.StatusCode)
+
+	errCount := v.report.Count(SeverityError)
+	defer func() {
+		v.report.addResult(Result{
+			Endpoint:            endpointURL,
+			Method:              http.MethodPost,
+			ContentType:         "application/grpc",
+			StatusCode:          resp.StatusCode,
+			ExpectedStatusCodes: []string{"200"},
+			Passed:              v.report.Count(SeverityError) == errCount,
+		})
+	}()
+
+	if resp.ProtoMajor != 2 {
+		v.report.AddError(endpointURL, http.MethodPost, "gRPC health check failed: response used %s, gRPC requires HTTP/2", resp.Proto)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		v.report.AddError(endpointURL, http.MethodPost, "gRPC health check failed: unexpected status code %d", resp.StatusCode)
+		return nil
+	}
+
+	// responses without a message carry their status in the headers rather than the trailers
+	grpcStatus, grpcMessage := resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	if grpcStatus == "" {
+		grpcStatus, grpcMessage = resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	}
+	if grpcStatus != "0" {
+		v.report.AddError(endpointURL, http.MethodPost, "gRPC health check failed: gRPC status %q: %s", grpcStatus, grpcMessage)
+		return nil
+	}
+
+	status, err := grpcHealthCheckStatus(body)
+	if err != nil {
+		v.report.AddError(endpointURL, http.MethodPost, "gRPC health check failed: invalid response: %v", err)
+		return nil
+	}
+	if status != grpcServing {
+		name, ok := grpcServingStatuses[status]
+		if !ok {
+			name = fmt.Sprint(status)
+		}
+		v.report.AddError(endpointURL, http.MethodPost, "gRPC health check failed: service is %s", name)
+		return nil
+	}
+
+	v.logf("gRPC service is SERVING\n")
+	return nil
+}
+
+// grpcHealthCheckRequest encodes a grpc.health.v1.HealthCheckRequest for the provided gRPC service as a protobuf
+// message.
+func grpcHealthCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+
+	// field 1 (service), wire type 2 (length-delimited)
+	msg := []byte{0x0a}
+	msg = appendUvarint(msg, uint64(len(service)))
+	return append(msg, service...)
+}
+
+// appendUvarint appends the protobuf varint encoding of x to b.
+func appendUvarint(b []byte, x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, x)
+	return append(b, buf[:n]...)
+}
+
+// grpcFrame prefixes the provided protobuf message with the gRPC length-prefixed message header: an uncompressed flag
+// followed by the message's length as a big-endian uint32.
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// errGRPCFrame is returned when a gRPC response body isn't a single uncompressed length-prefixed message.
+var errGRPCFrame = errors.New("malformed gRPC message")
+
+// grpcHealthCheckStatus decodes the status of the grpc.health.v1.HealthCheckResponse framed in the provided gRPC
+// response body. A status left out of the message is the default, UNKNOWN.
+func grpcHealthCheckStatus(body []byte) (uint64, error) {
+	if len(body) < 5 || body[0] != 0 {
+		return 0, errGRPCFrame
+	}
+	msg := body[5:]
+	if uint32(len(msg)) != binary.BigEndian.Uint32(body[1:5]) {
+		return 0, errGRPCFrame
+	}
+
+	var status uint64
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errGRPCFrame
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case 0: // varint
+			val, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errGRPCFrame
+			}
+			msg = msg[n:]
+			if key>>3 == 1 {
+				status = val
+			}
+		case 2: // length-delimited
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return 0, errGRPCFrame
+			}
+			msg = msg[n+int(l):]
+		default:
+			return 0, fmt.Errorf("%w: unexpected wire type %d", errGRPCFrame, key&7)
+		}
+	}
+
+	return status, nil
+}
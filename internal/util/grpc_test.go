@@ -0,0 +1,234 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// grpcHealthHandler serves grpc.health.v1.Health/Check, reporting the provided status for the gRPC service named
+// hello or the whole server, and SERVICE_UNKNOWN for any other service. The gRPC status is sent in the trailers.
+func grpcHealthHandler(status byte, grpcStatus string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != grpcHealthCheckPath || r.Header.Get("Content-Type") != "application/grpc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s := status
+		if !bytes.Equal(body, grpcFrame(grpcHealthCheckRequest("hello"))) && !bytes.Equal(body, grpcFrame(nil)) {
+			s = 3
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		w.Write(grpcFrame([]byte{0x08, s}))
+		w.Header().Set("Grpc-Status", grpcStatus)
+		if grpcStatus != "0" {
+			w.Header().Set("Grpc-Message", "unimplemented")
+		}
+	}
+}
+
+type validateGRPCHealthTest struct {
+	handler http.Handler // test server handler
+	service string       // gRPC service whose health is checked
+	http2   bool         // whether the test server speaks HTTP/2
+	errors  int          // expected number of error-level findings
+}
+
+var validateGRPCHealthTests = []validateGRPCHealthTest{
+	// whole server is serving
+	{
+		handler: grpcHealthHandler(1, "0"),
+		http2:   true,
+	},
+
+	// named service is serving
+	{
+		handler: grpcHealthHandler(1, "0"),
+		service: "hello",
+		http2:   true,
+	},
+
+	// unknown service
+	{
+		handler: grpcHealthHandler(1, "0"),
+		service: "goodbye",
+		http2:   true,
+		errors:  1,
+	},
+
+	// service not serving
+	{
+		handler: grpcHealthHandler(2, "0"),
+		http2:   true,
+		errors:  1,
+	},
+
+	// health service not implemented
+	{
+		handler: grpcHealthHandler(1, "12"),
+		http2:   true,
+		errors:  1,
+	},
+
+	// server only speaks HTTP/1
+	{
+		handler: grpcHealthHandler(1, "0"),
+		errors:  1,
+	},
+}
+
+func TestValidateGRPCHealth(t *testing.T) {
+	for i, tc := range validateGRPCHealthTests {
+		s := httptest.NewUnstartedServer(tc.handler)
+		s.EnableHTTP2 = tc.http2
+		s.StartTLS()
+
+		v := newValidator("")
+		v.client = s.Client()
+		err := v.validateGRPCHealth(s.URL, tc.service)
+		s.Close()
+
+		if err != nil {
+			t.Errorf("#%d: validateGRPCHealth: %v", i, err)
+			continue
+		}
+
+		if n := v.report.Count(SeverityError); n != tc.errors {
+			t.Errorf("#%d: error count mismatch\nwant: %d\ngot: %d", i, tc.errors, n)
+		}
+		if len(v.report.Results) != 1 {
+			t.Errorf("#%d: result count mismatch\nwant: 1\ngot: %d", i, len(v.report.Results))
+		}
+	}
+}
+
+func TestValidateGRPCHealthPlainHTTP(t *testing.T) {
+	v := newValidator("")
+	if err := v.validateGRPCHealth("http://localhost", ""); err == nil {
+		t.Errorf("validateGRPCHealth: no error for a plain HTTP service URL")
+	}
+}
+
+func TestValidateEndpointsGRPCWithoutPaths(t *testing.T) {
+	r, err := ValidateEndpoints("http://localhost", &openapi3.Paths{}, "", WithGRPCHealthCheck(""))
+	if _, ok := err.(EndpointErrors); !ok {
+		t.Errorf("error mismatch\nwant: EndpointErrors\ngot: %v", err)
+	}
+	if r.Passed(false) {
+		t.Errorf("report passed despite a failed gRPC health check")
+	}
+}
+
+type grpcHealthServiceTest struct {
+	extension string // raw JSON value of the x-sst-grpc extension, or empty to leave it out
+	service   string // expected gRPC service
+	ok        bool   // whether the spec should be marked as gRPC
+	err       bool   // whether GRPCHealthService should return an error
+}
+
+var grpcHealthServiceTests = []grpcHealthServiceTest{
+	// no extension
+	{},
+
+	// whole server
+	{
+		extension: `true`,
+		ok:        true,
+	},
+
+	// explicitly not gRPC
+	{
+		extension: `false`,
+	},
+
+	// named service
+	{
+		extension: `"helloworld.Greeter"`,
+		service:   "helloworld.Greeter",
+		ok:        true,
+	},
+
+	// invalid value
+	{
+		extension: `42`,
+		err:       true,
+	},
+}
+
+func TestGRPCHealthService(t *testing.T) {
+	for i, tc := range grpcHealthServiceTests {
+		swagger := &openapi3.Swagger{}
+		if tc.extension != "" {
+			swagger.Extensions = map[string]interface{}{grpcExtension: json.RawMessage(tc.extension)}
+		}
+
+		service, ok, err := GRPCHealthService(swagger)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if service != tc.service || ok != tc.ok {
+			t.Errorf("#%d: result mismatch\nwant: %q, %t\ngot: %q, %t", i, tc.service, tc.ok, service, ok)
+		}
+	}
+}
+
+type grpcHealthCheckStatusTest struct {
+	body   []byte // gRPC response body
+	status uint64 // expected status
+	err    bool   // whether grpcHealthCheckStatus should return an error
+}
+
+var grpcHealthCheckStatusTests = []grpcHealthCheckStatusTest{
+	// SERVING
+	{
+		body:   grpcFrame([]byte{0x08, 0x01}),
+		status: 1,
+	},
+
+	// empty message defaults to UNKNOWN
+	{
+		body: grpcFrame(nil),
+	},
+
+	// unknown length-delimited field is skipped
+	{
+		body:   grpcFrame([]byte{0x12, 0x02, 'h', 'i', 0x08, 0x02}),
+		status: 2,
+	},
+
+	// truncated frame
+	{
+		body: []byte{0, 0, 0, 0, 2, 0x08},
+		err:  true,
+	},
+
+	// compressed message
+	{
+		body: []byte{1, 0, 0, 0, 0},
+		err:  true,
+	},
+}
+
+func TestGRPCHealthCheckStatus(t *testing.T) {
+	for i, tc := range grpcHealthCheckStatusTests {
+		status, err := grpcHealthCheckStatus(tc.body)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if status != tc.status {
+			t.Errorf("#%d: result mismatch\nwant: %d\ngot: %d", i, tc.status, status)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// The types below model the subset of the HTTP Archive (HAR) 1.2 format written by WriteHAR. See
+// http://www.softwareishard.com/blog/har-12-spec/ for the full format.
+
+type har struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harCreatorName is the name this program records itself under in HAR files.
+const harCreatorName = "serverless-sample-tester"
+
+// redactedHeaders are the request headers whose values are redacted in HAR files, since those files are meant to be
+// shared.
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+}
+
+// WriteHAR writes the Exchanges of the provided Transcript to w as an HTTP Archive (HAR) 1.2 document. The values of
+// credential-bearing request headers, like Authorization, are redacted.
+func WriteHAR(w io.Writer, t *Transcript) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := har{
+		Log: harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: harCreatorName, Version: "1.0"},
+			Entries: []harEntry{},
+		},
+	}
+
+	for _, e := range t.Exchanges {
+		h.Log.Entries = append(h.Log.Entries, harEntryFromExchange(e))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(h); err != nil {
+		return fmt.Errorf("json.Encoder.Encode: %w", err)
+	}
+
+	return nil
+}
+
+// harEntryFromExchange converts an Exchange into a HAR entry.
+func harEntryFromExchange(e Exchange) harEntry {
+	ms := float64(e.Duration) / float64(time.Millisecond)
+
+	req := harRequest{
+		Method:      e.Request.Method,
+		URL:         e.Request.URL.String(),
+		HTTPVersion: e.Request.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(e.Request.Header, redactedHeaders),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(e.RequestBody),
+	}
+
+	for name, values := range e.Request.URL.Query() {
+		for _, v := range values {
+			req.QueryString = append(req.QueryString, harNameValue{Name: name, Value: v})
+		}
+	}
+
+	if len(e.RequestBody) > 0 {
+		req.PostData = &harPostData{
+			MimeType: e.Request.Header.Get("Content-Type"),
+			Text:     string(e.RequestBody),
+		}
+	}
+
+	resp := harResponse{
+		Status:      e.Response.StatusCode,
+		StatusText:  http.StatusText(e.Response.StatusCode),
+		HTTPVersion: e.Response.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(e.Response.Header, nil),
+		Content: harContent{
+			Size:     len(e.ResponseBody),
+			MimeType: e.Response.Header.Get("Content-Type"),
+			Text:     string(e.ResponseBody),
+		},
+		RedirectURL: e.Response.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(e.ResponseBody),
+	}
+
+	return harEntry{
+		StartedDateTime: e.Started.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request:         req,
+		Response:        resp,
+		Timings:         harTimings{Send: 0, Wait: ms, Receive: 0},
+	}
+}
+
+// harHeaders converts an http.Header into HAR name/value pairs sorted by name, redacting the values of the provided
+// headers.
+func harHeaders(header http.Header, redact map[string]bool) []harNameValue {
+	nvs := []harNameValue{}
+	for name, values := range header {
+		for _, v := range values {
+			if redact[name] {
+				v = "REDACTED"
+			}
+			nvs = append(nvs, harNameValue{Name: name, Value: v})
+		}
+	}
+
+	sort.Slice(nvs, func(i, j int) bool {
+		return nvs[i].Name < nvs[j].Name
+	})
+	return nvs
+}
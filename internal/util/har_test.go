@@ -0,0 +1,76 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteHAR(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	defer s.Close()
+
+	post := newTestOperation("200")
+	post.RequestBody = &openapi3.RequestBodyRef{
+		Value: openapi3.NewRequestBody().WithContent(openapi3.Content{
+			"application/json": &openapi3.MediaType{Example: `{"name": "world"}`},
+		}),
+	}
+
+	paths := &openapi3.Paths{
+		"/a": &openapi3.PathItem{Get: newTestOperation("200"), Post: post},
+		"/b": &openapi3.PathItem{Get: newTestOperation("200")},
+	}
+
+	transcript := &Transcript{}
+	if _, err := ValidateEndpoints(s.URL, paths, "secret-token", WithTranscript(transcript)); err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHAR(&buf, transcript); err != nil {
+		t.Fatalf("WriteHAR: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Errorf("HAR contains unredacted identity token")
+	}
+
+	var h har
+	if err := json.Unmarshal(buf.Bytes(), &h); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	if h.Log.Version != "1.2" {
+		t.Errorf("version mismatch\nwant: %s\ngot: %s", "1.2", h.Log.Version)
+	}
+
+	if len(h.Log.Entries) != 3 {
+		t.Fatalf("entry count mismatch\nwant: %d\ngot: %d", 3, len(h.Log.Entries))
+	}
+
+	var posts int
+	for _, e := range h.Log.Entries {
+		if e.Response.Status != http.StatusOK {
+			t.Errorf("%s %s: status mismatch\nwant: %d\ngot: %d", e.Request.Method, e.Request.URL, http.StatusOK, e.Response.Status)
+		}
+
+		if e.Request.Method == http.MethodPost {
+			posts++
+			if e.Request.PostData == nil || e.Request.PostData.Text != `{"name": "world"}` {
+				t.Errorf("POST entry missing request body: %+v", e.Request.PostData)
+			}
+		}
+	}
+
+	if posts != 1 {
+		t.Errorf("POST entry count mismatch\nwant: %d\ngot: %d", 1, posts)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// idempotentMethods are the HTTP methods whose idempotency is checked.
+var idempotentMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+}
+
+// repeatIdempotentRequest repeats a PUT or DELETE test request whose first response had the provided expected status
+// code. An error-level finding is recorded in the validator's Report if the repeated request's status code isn't
+// expected by the provided openapi3.Operation, and a warning-level finding if it's expected but differs from the first
+// one.
+func (v *validator) repeatIdempotentRequest(endpointURL, httpMethod, mimeType string, header http.Header, reqBodyReader *strings.Reader, operation *openapi3.Operation, firstStatusCode int) error {
+	if _, err := reqBodyReader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	v.logf("Repeating %s %s to check idempotency\n", httpMethod, endpointURL)
+	resp, _, err := v.sendTestRequestWithRetries(endpointURL, httpMethod, mimeType, header, reqBodyReader, operation)
+	if err != nil {
+		return err
+	}
+
+	if _, _, ok := matchResponse(operation.Responses, resp.StatusCode); !ok {
+		v.report.AddError(endpointURL, httpMethod, "not idempotent: repeated request returned unexpected status code %d after %d", resp.StatusCode, firstStatusCode)
+		return nil
+	}
+
+	if resp.StatusCode != firstStatusCode {
+		v.report.AddWarning(endpointURL, httpMethod, "repeated request returned status code %d, differing from the first request's %d", resp.StatusCode, firstStatusCode)
+	}
+
+	return nil
+}
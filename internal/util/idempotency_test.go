@@ -0,0 +1,80 @@
+package util
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type checkIdempotencyTest struct {
+	statusCodes []int    // status codes returned by the test server for successive requests
+	declared    []string // declared response status codes
+	errors      int      // expected number of error-level findings
+	warnings    int      // expected number of warning-level findings
+	requests    int      // expected number of requests
+}
+
+var checkIdempotencyTests = []checkIdempotencyTest{
+	// idempotent server
+	{
+		statusCodes: []int{200, 200},
+		declared:    []string{"200"},
+		requests:    2,
+	},
+
+	// server failing the repeated request
+	{
+		statusCodes: []int{200, 409},
+		declared:    []string{"200"},
+		errors:      1,
+		requests:    2,
+	},
+
+	// repeated request returns a different but expected status code
+	{
+		statusCodes: []int{204, 404},
+		declared:    []string{"204", "404"},
+		warnings:    1,
+		requests:    2,
+	},
+
+	// first request fails, so it isn't repeated
+	{
+		statusCodes: []int{500},
+		declared:    []string{"200"},
+		errors:      1,
+		requests:    1,
+	},
+}
+
+func TestCheckIdempotency(t *testing.T) {
+	for i, tc := range checkIdempotencyTests {
+		requests := 0
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.statusCodes[requests])
+			requests++
+		}))
+
+		op := &openapi3.Operation{Responses: newTestResponses(tc.declared...)}
+		r, err := ValidateEndpoints(s.URL, &openapi3.Paths{"/": &openapi3.PathItem{Put: op}}, "", WithCheckIdempotency(true))
+		s.Close()
+
+		if err != nil {
+			t.Errorf("#%d: ValidateEndpoints: %v", i, err)
+			continue
+		}
+
+		if n := r.Count(SeverityError); n != tc.errors {
+			t.Errorf("#%d: error count mismatch\nwant: %d\ngot: %d", i, tc.errors, n)
+		}
+
+		if n := r.Count(SeverityWarning); n != tc.warnings {
+			t.Errorf("#%d: warning count mismatch\nwant: %d\ngot: %d", i, tc.warnings, n)
+		}
+
+		if requests != tc.requests {
+			t.Errorf("#%d: request count mismatch\nwant: %d\ngot: %d", i, tc.requests, requests)
+		}
+	}
+}
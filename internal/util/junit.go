@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// junitTestSuites is the root element of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite groups the test cases of a single run.
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is the outcome of testing a single endpoint with a single HTTP method.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitFailure holds the findings that failed a test case.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the Report to the provided writer as a JUnit XML report, for CI systems that aggregate test
+// results. Each endpoint and HTTP method is a test case of a test suite with the provided name, failed by its
+// error-level findings, and by its warnings if failOnWarning is set. The status codes of its test requests are
+// recorded as its output.
+func (r *Report) WriteJUnit(w io.Writer, name string, failOnWarning bool) error {
+	s := r.Summary(failOnWarning)
+
+	// test cases are listed in the order their first result or finding was recorded
+	var keys []string
+	results := make(map[string][]Result)
+	findings := make(map[string][]Finding)
+	for _, res := range s.Results {
+		k := res.Method + " " + res.Endpoint
+		if _, ok := results[k]; !ok {
+			keys = append(keys, k)
+		}
+		results[k] = append(results[k], res)
+	}
+	for _, f := range s.Findings {
+		k := f.Method + " " + f.Endpoint
+		if _, ok := results[k]; !ok && findings[k] == nil {
+			keys = append(keys, k)
+		}
+		findings[k] = append(findings[k], f)
+	}
+
+	suite := junitTestSuite{Name: name, Tests: len(keys)}
+	for _, k := range keys {
+		c := junitTestCase{Name: k, ClassName: name}
+
+		var out []string
+		for _, res := range results[k] {
+			out = append(out, fmt.Sprintf("status code %d, expected %s", res.StatusCode, strings.Join(res.ExpectedStatusCodes, ", ")))
+		}
+
+		var failures []string
+		for _, f := range findings[k] {
+			msg := fmt.Sprintf("%s: %s", f.Severity, f.Message)
+			if f.Severity == SeverityError || failOnWarning {
+				failures = append(failures, msg)
+			} else {
+				out = append(out, msg)
+			}
+		}
+		for _, res := range results[k] {
+			if !res.Passed && len(failures) == 0 {
+				failures = append(failures, fmt.Sprintf("error: unexpected status code %d", res.StatusCode))
+			}
+		}
+
+		if len(failures) > 0 {
+			c.Failure = &junitFailure{Message: failures[0], Text: strings.Join(failures, "\n")}
+			suite.Failures++
+		}
+		c.SystemOut = strings.Join(out, "\n")
+
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return fmt.Errorf("xml.Encoder.Encode: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+// junitTestReport returns a Report with a passing operation, a warning, a failing operation and an operation that
+// couldn't be tested.
+func junitTestReport() *Report {
+	r := &Report{}
+	r.addResult(Result{Endpoint: "/", Method: "GET", StatusCode: 200, ExpectedStatusCodes: []string{"200"}, Passed: true})
+	r.AddWarning("/", "GET", "content-type mismatch")
+	r.AddError("/items", "POST", "unexpected status code 500")
+	r.addResult(Result{Endpoint: "/items", Method: "POST", StatusCode: 500, ExpectedStatusCodes: []string{"201", "4XX"}})
+	r.AddError("/broken", "GET", "connection reset")
+	return r
+}
+
+type writeJUnitTest struct {
+	failOnWarning bool   // failOnWarning passed to WriteJUnit
+	xml           string // expected output
+}
+
+var writeJUnitTests = []writeJUnitTest{
+	// warnings are output
+	{
+		xml: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="sample" tests="3" failures="2">
+    <testcase name="GET /" classname="sample">
+      <system-out>status code 200, expected 200&#xA;warning: content-type mismatch</system-out>
+    </testcase>
+    <testcase name="POST /items" classname="sample">
+      <failure message="error: unexpected status code 500">error: unexpected status code 500</failure>
+      <system-out>status code 500, expected 201, 4XX</system-out>
+    </testcase>
+    <testcase name="GET /broken" classname="sample">
+      <failure message="error: connection reset">error: connection reset</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`,
+	},
+	// warnings are failures
+	{
+		failOnWarning: true,
+		xml: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="sample" tests="3" failures="3">
+    <testcase name="GET /" classname="sample">
+      <failure message="warning: content-type mismatch">warning: content-type mismatch</failure>
+      <system-out>status code 200, expected 200</system-out>
+    </testcase>
+    <testcase name="POST /items" classname="sample">
+      <failure message="error: unexpected status code 500">error: unexpected status code 500</failure>
+      <system-out>status code 500, expected 201, 4XX</system-out>
+    </testcase>
+    <testcase name="GET /broken" classname="sample">
+      <failure message="error: connection reset">error: connection reset</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`,
+	},
+}
+
+func TestReportWriteJUnit(t *testing.T) {
+	for i, tc := range writeJUnitTests {
+		var buf bytes.Buffer
+		if err := junitTestReport().WriteJUnit(&buf, "sample", tc.failOnWarning); err != nil {
+			t.Fatalf("#%d: Report.WriteJUnit: %v", i, err)
+		}
+
+		if got := buf.String(); got != tc.xml {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.xml, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// LogLevel controls how much detail is logged through Infof and Debugf. Failures and final results are always logged.
+type LogLevel int32
+
+const (
+	// LogQuiet only logs failures and final results.
+	LogQuiet LogLevel = iota
+	// LogNormal also logs the progress of a run. It's the default.
+	LogNormal
+	// LogVerbose also logs the bodies of test requests and their responses.
+	LogVerbose
+)
+
+// logLevel is the current LogLevel, accessed atomically since samples may be tested concurrently.
+var logLevel = int32(LogNormal)
+
+// SetLogLevel sets the level of detail logged by this package and the packages that log through it.
+func SetLogLevel(l LogLevel) {
+	atomic.StoreInt32(&logLevel, int32(l))
+}
+
+// Logs reports whether messages of the provided LogLevel are currently logged.
+func Logs(l LogLevel) bool {
+	return LogLevel(atomic.LoadInt32(&logLevel)) >= l
+}
+
+// Infof logs a progress message with log.Printf unless the LogLevel is LogQuiet.
+func Infof(format string, a ...interface{}) {
+	if Logs(LogNormal) {
+		log.Printf(format, a...)
+	}
+}
+
+// Debugf logs a detailed message with log.Printf if the LogLevel is LogVerbose.
+func Debugf(format string, a ...interface{}) {
+	if Logs(LogVerbose) {
+		log.Printf(format, a...)
+	}
+}
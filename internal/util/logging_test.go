@@ -0,0 +1,92 @@
+package util
+
+import (
+	"bytes"
+	"github.com/getkin/kin-openapi/openapi3"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type logLevelTest struct {
+	level LogLevel // level passed to SetLogLevel
+	info  bool     // whether Infof messages are expected to be logged
+	debug bool     // whether Debugf messages are expected to be logged
+}
+
+var logLevelTests = []logLevelTest{
+	// quiet
+	{
+		level: LogQuiet,
+	},
+	// default
+	{
+		level: LogNormal,
+		info:  true,
+	},
+	// verbose
+	{
+		level: LogVerbose,
+		info:  true,
+		debug: true,
+	},
+}
+
+func TestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetLogLevel(LogNormal)
+
+	for i, tc := range logLevelTests {
+		buf.Reset()
+		SetLogLevel(tc.level)
+
+		Infof("info message\n")
+		Debugf("debug message\n")
+
+		if got := strings.Contains(buf.String(), "info message"); got != tc.info {
+			t.Errorf("#%d: Infof logged mismatch\nwant: %t\ngot: %t", i, tc.info, got)
+		}
+		if got := strings.Contains(buf.String(), "debug message"); got != tc.debug {
+			t.Errorf("#%d: Debugf logged mismatch\nwant: %t\ngot: %t", i, tc.debug, got)
+		}
+	}
+}
+
+func TestVerboseBodies(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response payload"))
+	}))
+	defer s.Close()
+
+	op := newTestOperation("200")
+	op.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithJSONSchema(openapi3.NewStringSchema())}
+	op.RequestBody.Value.Content.Get("application/json").Example = "request payload"
+	paths := &openapi3.Paths{"/": &openapi3.PathItem{Post: op}}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetLogLevel(LogNormal)
+
+	for _, level := range []LogLevel{LogNormal, LogVerbose} {
+		buf.Reset()
+		SetLogLevel(level)
+
+		if _, err := ValidateEndpoints(s.URL, paths, ""); err != nil {
+			t.Fatalf("ValidateEndpoints: %v", err)
+		}
+
+		want := level == LogVerbose
+		if got := strings.Contains(buf.String(), "Request body: request payload"); got != want {
+			t.Errorf("level %d: request body logged mismatch\nwant: %t\ngot: %t", level, want, got)
+		}
+		if got := strings.Contains(buf.String(), "Response body: response payload"); got != want {
+			t.Errorf("level %d: response body logged mismatch\nwant: %t\ngot: %t", level, want, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// httpMethods are the HTTP methods an OpenAPI path item can define operations for.
+var httpMethods = map[string]bool{
+	http.MethodConnect: true,
+	http.MethodDelete:  true,
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPatch:   true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodTrace:   true,
+}
+
+// ParseMethods uppercases the provided HTTP method names, such as the values of a command-line flag, for WithMethods
+// and WithExcludeMethods. It returns an error for any name that isn't a method an OpenAPI path item can define
+// operations for.
+func ParseMethods(names []string) ([]string, error) {
+	var methods []string
+	for _, n := range names {
+		m := strings.ToUpper(strings.TrimSpace(n))
+		if !httpMethods[m] {
+			return nil, fmt.Errorf("unknown HTTP method %q", n)
+		}
+
+		methods = append(methods, m)
+	}
+
+	return methods, nil
+}
+
+// methodSet returns the set of the provided uppercased HTTP methods.
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		set[strings.ToUpper(m)] = true
+	}
+
+	return set
+}
+
+// methodSelected reports whether operations of the provided HTTP method are tested, according to WithMethods and
+// WithExcludeMethods.
+func (v *validator) methodSelected(method string) bool {
+	if len(v.onlyMethods) > 0 && !v.onlyMethods[method] {
+		return false
+	}
+
+	return !v.excludeMethods[method]
+}
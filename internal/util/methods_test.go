@@ -0,0 +1,102 @@
+package util
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type parseMethodsTest struct {
+	names   []string // input method names
+	methods []string // expected result of ParseMethods
+	err     bool     // whether ParseMethods should return an error
+}
+
+var parseMethodsTests = []parseMethodsTest{
+	// uppercased
+	{
+		names:   []string{"get", " Trace ", "POST"},
+		methods: []string{"GET", "TRACE", "POST"},
+	},
+
+	// unknown method
+	{
+		names: []string{"GET", "FETCH"},
+		err:   true,
+	},
+}
+
+func TestParseMethods(t *testing.T) {
+	for i, tc := range parseMethodsTests {
+		methods, err := ParseMethods(tc.names)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(methods, tc.methods) {
+			t.Errorf("#%d: result mismatch\nwant: %v\ngot: %v", i, tc.methods, methods)
+		}
+	}
+}
+
+type methodFilterTest struct {
+	opts      []ValidateOption // options passed to ValidateEndpoints
+	requested map[string]int   // expected number of requests by method
+}
+
+var methodFilterTests = []methodFilterTest{
+	// every method defined by the spec
+	{
+		requested: map[string]int{"GET": 1, "POST": 1, "TRACE": 1},
+	},
+
+	// excluded method
+	{
+		opts:      []ValidateOption{WithExcludeMethods("TRACE")},
+		requested: map[string]int{"GET": 1, "POST": 1},
+	},
+
+	// allowlist
+	{
+		opts:      []ValidateOption{WithMethods("GET", "TRACE")},
+		requested: map[string]int{"GET": 1, "TRACE": 1},
+	},
+
+	// denylist takes precedence over allowlist
+	{
+		opts:      []ValidateOption{WithMethods("GET", "TRACE"), WithExcludeMethods("TRACE")},
+		requested: map[string]int{"GET": 1},
+	},
+}
+
+func TestMethodFilter(t *testing.T) {
+	for i, tc := range methodFilterTests {
+		requested := make(map[string]int)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested[r.Method]++
+		}))
+
+		paths := &openapi3.Paths{
+			"/": &openapi3.PathItem{
+				Get:   newTestOperation("200"),
+				Post:  newTestOperation("200"),
+				Trace: newTestOperation("200"),
+			},
+		}
+
+		_, err := ValidateEndpoints(s.URL, paths, "", tc.opts...)
+		s.Close()
+
+		if err != nil {
+			t.Errorf("#%d: ValidateEndpoints: %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(requested, tc.requested) {
+			t.Errorf("#%d: requested methods mismatch\nwant: %v\ngot: %v", i, tc.requested, requested)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"regexp"
+	"time"
+)
+
+// FailureVerbosity controls how much of a failed test request's response body is dumped.
+type FailureVerbosity int
+
+const (
+	// FailureSummary only logs a summary of the failure without dumping the response body.
+	FailureSummary FailureVerbosity = iota
+
+	// FailureTruncated dumps the response body, truncated to a maximum number of bytes.
+	FailureTruncated
+
+	// FailureFull dumps the full response body.
+	FailureFull
+)
+
+// defaultFailureBodyLimit is the default number of response body bytes dumped with FailureTruncated.
+const defaultFailureBodyLimit = 1024
+
+// failureVerbosityNames maps the names accepted by ParseFailureVerbosity to their FailureVerbosity.
+var failureVerbosityNames = map[string]FailureVerbosity{
+	"summary":   FailureSummary,
+	"truncated": FailureTruncated,
+	"full":      FailureFull,
+}
+
+// ParseFailureVerbosity parses a FailureVerbosity from its name: summary, truncated, or full.
+func ParseFailureVerbosity(name string) (FailureVerbosity, error) {
+	fv, ok := failureVerbosityNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown failure verbosity %q: expecting summary, truncated, or full", name)
+	}
+
+	return fv, nil
+}
+
+// DefaultLeakPatterns are the patterns response bodies are scanned for when scanning for leaked sensitive data is
+// enabled without providing any patterns: stack traces from common runtimes, private keys, Google API keys, and
+// internal hostnames.
+var DefaultLeakPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`Traceback \(most recent call last\)`),
+	regexp.MustCompile(`\bat [\w$.<>]+\([\w$]+\.java:\d+\)`),
+	regexp.MustCompile(`\bat .+ \(.+\.js:\d+:\d+\)`),
+	regexp.MustCompile(`goroutine \d+ \[running\]`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`),
+	regexp.MustCompile(`\b[\w.-]+\.internal\b`),
+}
+
+// ValidateOption configures optional behavior of ValidateEndpoints.
+type ValidateOption func(*validator)
+
+// WithFollowRedirects sets whether redirects returned by the Cloud Run service are followed. When redirects aren't
+// followed, the Location header of a redirect response is checked against the one declared in the OpenAPI spec.
+// Redirects are followed by default.
+func WithFollowRedirects(follow bool) ValidateOption {
+	return func(v *validator) {
+		v.followRedirects = follow
+	}
+}
+
+// WithTimeout sets the timeout of each HTTP request made to the Cloud Run service, including reading its response
+// body. Defaults to 10s; slow-starting containers may need more.
+func WithTimeout(d time.Duration) ValidateOption {
+	return func(v *validator) {
+		v.timeout = d
+	}
+}
+
+// WithContext sets the context test requests are sent under: once it's done, in-flight and later requests fail
+// immediately instead of running to their timeout.
+func WithContext(ctx context.Context) ValidateOption {
+	return func(v *validator) {
+		v.ctx = ctx
+	}
+}
+
+// WithGRPCHealthCheck makes ValidateEndpoints perform a grpc.health.v1 health check of the provided gRPC service, or of
+// the whole server if it's empty, against the Cloud Run service before testing its paths. The check fails unless the
+// service is reported as SERVING. A spec without any paths isn't an error then.
+func WithGRPCHealthCheck(service string) ValidateOption {
+	return func(v *validator) {
+		v.grpcHealth = true
+		v.grpcService = service
+	}
+}
+
+// WithLeakPatterns enables scanning response bodies for leaked sensitive data. An endpoint fails if its response body
+// matches any of the provided patterns.
+func WithLeakPatterns(patterns []*regexp.Regexp) ValidateOption {
+	return func(v *validator) {
+		v.leakPatterns = patterns
+	}
+}
+
+// WithRetries enables retrying test requests that fail with a transport error or an unexpected 429 or 5xx status
+// code. Each request is attempted up to attempts times, waiting an exponentially increasing delay starting at
+// baseDelay between attempts. A 429 response's Retry-After header is honored in place of the backoff delay.
+func WithRetries(attempts int, baseDelay time.Duration) ValidateOption {
+	return func(v *validator) {
+		v.retryAttempts = attempts
+		v.retryDelay = baseDelay
+	}
+}
+
+// WithMaxRetryAfter caps how long a 429 response's Retry-After header can make a retry wait. Defaults to 30s.
+func WithMaxRetryAfter(d time.Duration) ValidateOption {
+	return func(v *validator) {
+		v.maxRetryAfter = d
+	}
+}
+
+// WithOnlyTag restricts validation to the operations carrying the provided OpenAPI tag. Operations without it,
+// including untagged ones, are skipped.
+func WithOnlyTag(tag string) ValidateOption {
+	return func(v *validator) {
+		v.onlyTag = tag
+	}
+}
+
+// WithMethods restricts validation to the operations of the provided HTTP methods, e.g. GET and POST. Operations of
+// other methods are skipped even if the OpenAPI spec defines them. All methods are tested by default.
+func WithMethods(methods ...string) ValidateOption {
+	return func(v *validator) {
+		v.onlyMethods = methodSet(methods)
+	}
+}
+
+// WithExcludeMethods skips the operations of the provided HTTP methods, e.g. TRACE and CONNECT, which few Cloud Run
+// services implement, even if the OpenAPI spec defines them. It takes precedence over WithMethods.
+func WithExcludeMethods(methods ...string) ValidateOption {
+	return func(v *validator) {
+		v.excludeMethods = methodSet(methods)
+	}
+}
+
+// WithSkipRules skips the operations selected by any of the provided SkipRules, e.g. ones a shared OpenAPI spec
+// declares but the sample doesn't implement. Skipped operations are logged, and neither pass nor fail.
+func WithSkipRules(rules ...SkipRule) ValidateOption {
+	return func(v *validator) {
+		v.skipRules = append(v.skipRules, rules...)
+	}
+}
+
+// WithFailureVerbosity sets how much of a failed test request's response body is dumped. With FailureTruncated, at
+// most limit bytes are dumped. Defaults to FailureTruncated with a limit of 1024 bytes.
+func WithFailureVerbosity(fv FailureVerbosity, limit int) ValidateOption {
+	return func(v *validator) {
+		v.failureVerbosity = fv
+		v.failureBodyLimit = limit
+	}
+}
+
+// WithFailureDir makes each failed test request and its response -- method, URL, headers and bodies -- be written to
+// a file per endpoint and HTTP method under the provided directory, created if needed. Successful requests write
+// nothing.
+func WithFailureDir(dir string) ValidateOption {
+	return func(v *validator) {
+		v.failureDir = dir
+	}
+}
+
+// WithCheckPathCase enables diagnosing path case-sensitivity bugs. When a test request returns a 404, it's repeated
+// with the endpoint's path lowercased, and which form worked is reported as a warning.
+func WithCheckPathCase(check bool) ValidateOption {
+	return func(v *validator) {
+		v.checkPathCase = check
+	}
+}
+
+// WithCheckAllow enables checking that each path answers an OPTIONS request with an Allow header listing exactly the
+// methods the OpenAPI spec defines for it.
+func WithCheckAllow(check bool) ValidateOption {
+	return func(v *validator) {
+		v.checkAllow = check
+	}
+}
+
+// WithGenerateBodies enables generating a minimal JSON request body from the request body's schema when no example is
+// declared: only required properties are included, with type-appropriate default values.
+func WithGenerateBodies(generate bool) ValidateOption {
+	return func(v *validator) {
+		v.generateBodies = generate
+	}
+}
+
+// WithCheckIdempotency enables checking that PUT and DELETE operations are idempotent. Each such request that returns
+// an expected status code is sent a second time, and the second response must also have an expected status code.
+func WithCheckIdempotency(check bool) ValidateOption {
+	return func(v *validator) {
+		v.checkIdempotency = check
+	}
+}
+
+// WithSuccessPredicate makes the provided SuccessPredicate decide whether each test request passed, instead of
+// requiring its status code to match one of the responses declared for the operation. Responses whose status code does
+// match a declared response are still checked against it, e.g. for their body and Content-Type.
+func WithSuccessPredicate(p SuccessPredicate) ValidateOption {
+	return func(v *validator) {
+		v.successPredicate = p
+	}
+}
+
+// WithTranscript records every test request made and the response it elicited into the provided Transcript.
+func WithTranscript(t *Transcript) ValidateOption {
+	return func(v *validator) {
+		v.transcript = t
+	}
+}
+
+// WithOperationHook calls the provided function after each operation is validated, reporting whether it passed
+// without any error-level findings. With a concurrency above 1, the function must be safe for concurrent use.
+func WithOperationHook(hook func(endpoint, method string, passed bool)) ValidateOption {
+	return func(v *validator) {
+		v.operationHook = hook
+	}
+}
+
+// WithConcurrency sets the number of paths validated concurrently. Log output of concurrently validated paths is
+// labeled with the path. Defaults to 1, validating paths one at a time.
+func WithConcurrency(n int) ValidateOption {
+	return func(v *validator) {
+		if n < 1 {
+			n = 1
+		}
+		v.concurrency = n
+	}
+}
+
+// WithFuzz makes ValidateEndpoints send n random JSON request bodies, valid against the request body schema, to each
+// operation on top of its example body, and record an error-level finding for each one the service responds to with a
+// 5xx status code. Bodies are generated from the provided seed, so a run can be reproduced.
+func WithFuzz(n int, seed int64) ValidateOption {
+	return func(v *validator) {
+		v.fuzzBodies = n
+		v.fuzzSeed = seed
+	}
+}
+
+// WithAllowEmptyPaths sets whether an OpenAPI spec that defines no paths passes trivially instead of making
+// ValidateEndpoints return an error wrapping ErrNoPaths.
+func WithAllowEmptyPaths(allow bool) ValidateOption {
+	return func(v *validator) {
+		v.allowEmptyPaths = allow
+	}
+}
+
+// WithProblemDetails sets whether expected error responses, with a status code of 400 or above, are checked to be RFC
+// 7807 problem details: an application/problem+json response whose body matches the provided schema, or
+// ProblemDetailsSchema if it's nil.
+func WithProblemDetails(check bool, schema *openapi3.Schema) ValidateOption {
+	return func(v *validator) {
+		v.problemDetails = check
+		v.problemSchema = schema
+		if schema == nil {
+			v.problemSchema = ProblemDetailsSchema
+		}
+	}
+}
+
+// WithCheckContentType sets whether the Content-Type of responses is checked against the content types declared for
+// the matched response. Enabled by default; disable it for specs that don't declare response content accurately.
+func WithCheckContentType(check bool) ValidateOption {
+	return func(v *validator) {
+		v.checkContentType = check
+	}
+}
+
+// WithRecord makes ValidateEndpoints record every test request, along with its response, to files in the provided
+// directory, for replaying them later with WithReplay. Requests are identified by their method, path, query and body.
+func WithRecord(dir string) ValidateOption {
+	return func(v *validator) {
+		v.cassette = newCassette(dir, false)
+	}
+}
+
+// WithReplay makes ValidateEndpoints serve every test request from the responses recorded in the provided directory
+// with WithRecord, without making any network request, for fast, hermetic test runs. A request without a recorded
+// response fails with an error wrapping ErrNotRecorded. WebSocket handshakes aren't replayed.
+func WithReplay(dir string) ValidateOption {
+	return func(v *validator) {
+		v.cassette = newCassette(dir, true)
+	}
+}
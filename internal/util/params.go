@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// errNoParameterExample is returned when a path parameter has no example value to substitute into a path template.
+var errNoParameterExample = errors.New("no example value declared for path parameter")
+
+// pathTemplateRegexp matches a parameter in an OpenAPI path template, like {id} in /items/{id}.
+var pathTemplateRegexp = regexp.MustCompile(`{([^{}]+)}`)
+
+// operationParameters returns the parameters that apply to the provided openapi3.Operation: the ones declared for
+// its path, overridden by the ones declared for the operation itself with the same location and name.
+func operationParameters(pathParams openapi3.Parameters, operation *openapi3.Operation) []*openapi3.Parameter {
+	var params []*openapi3.Parameter
+	for _, p := range pathParams {
+		if p == nil || p.Value == nil {
+			continue
+		}
+		if operation.Parameters.GetByInAndName(p.Value.In, p.Value.Name) == nil {
+			params = append(params, p.Value)
+		}
+	}
+
+	for _, p := range operation.Parameters {
+		if p != nil && p.Value != nil {
+			params = append(params, p.Value)
+		}
+	}
+
+	return params
+}
+
+// parameterExample returns the example value declared for the provided openapi3.Parameter: its example, the first of
+// its named examples, or its schema's example, in that order.
+func parameterExample(p *openapi3.Parameter) (string, bool) {
+	if p.Example != nil {
+		return fmt.Sprint(p.Example), true
+	}
+
+	var names []string
+	for name := range p.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if e := p.Examples[name]; e != nil && e.Value != nil && e.Value.Value != nil {
+			return fmt.Sprint(e.Value.Value), true
+		}
+	}
+
+	if p.Schema != nil && p.Schema.Value != nil && p.Schema.Value.Example != nil {
+		return fmt.Sprint(p.Schema.Value.Example), true
+	}
+
+	return "", false
+}
+
+// expandPathTemplate substitutes the example values of the provided path parameters into the provided OpenAPI path
+// template. Returns an error wrapping errNoParameterExample if a templated parameter has no example value.
+func expandPathTemplate(endpoint string, params []*openapi3.Parameter) (string, error) {
+	examples := make(map[string]string)
+	for _, p := range params {
+		if p.In != openapi3.ParameterInPath {
+			continue
+		}
+		if e, ok := parameterExample(p); ok {
+			examples[p.Name] = e
+		}
+	}
+
+	var missing []string
+	expanded := pathTemplateRegexp.ReplaceAllStringFunc(endpoint, func(m string) string {
+		name := m[1 : len(m)-1]
+		e, ok := examples[name]
+		if !ok {
+			missing = append(missing, name)
+			return m
+		}
+
+		return url.PathEscape(e)
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", errNoParameterExample, strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
+
+// applyParameters adds the example values of the provided query parameters to the provided endpoint URL's query string
+// and returns them along with the example values of the provided header parameters as request headers. Parameters
+// without an example value are left out; required ones are logged, since the request will likely fail without them.
+func applyParameters(endpointURL string, params []*openapi3.Parameter) (string, http.Header, error) {
+	u, err := url.Parse(endpointURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("url.Parse: %w", err)
+	}
+
+	q := u.Query()
+	header := make(http.Header)
+	for _, p := range params {
+		if p.In != openapi3.ParameterInQuery && p.In != openapi3.ParameterInHeader {
+			continue
+		}
+
+		e, ok := parameterExample(p)
+		if !ok {
+			if p.Required {
+				Infof("No example value declared for required %s parameter %s\n", p.In, p.Name)
+			}
+			continue
+		}
+
+		if p.In == openapi3.ParameterInQuery {
+			q.Add(p.Name, e)
+		} else {
+			header.Add(p.Name, e)
+		}
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String(), header, nil
+}
@@ -0,0 +1,167 @@
+package util
+
+import (
+	"errors"
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newTestParameter creates an openapi3.Parameter with the provided location, name and example value.
+func newTestParameter(in, name string, example interface{}) *openapi3.ParameterRef {
+	return &openapi3.ParameterRef{
+		Value: &openapi3.Parameter{In: in, Name: name, Example: example},
+	}
+}
+
+type expandPathTemplateTest struct {
+	endpoint   string              // OpenAPI path template
+	pathParams openapi3.Parameters // parameters declared for the path
+	opParams   openapi3.Parameters // parameters declared for the operation
+	out        string              // expected expanded path
+	err        error               // expected error
+}
+
+var expandPathTemplateTests = []expandPathTemplateTest{
+	// no path parameters
+	{
+		endpoint: "/items",
+		out:      "/items",
+	},
+
+	// operation path parameter
+	{
+		endpoint: "/items/{id}",
+		opParams: openapi3.Parameters{newTestParameter("path", "id", 42)},
+		out:      "/items/42",
+	},
+
+	// path-level parameter overridden by operation parameter
+	{
+		endpoint:   "/users/{user}/items/{id}",
+		pathParams: openapi3.Parameters{newTestParameter("path", "user", "alice"), newTestParameter("path", "id", 1)},
+		opParams:   openapi3.Parameters{newTestParameter("path", "id", 2)},
+		out:        "/users/alice/items/2",
+	},
+
+	// example value needing escaping
+	{
+		endpoint: "/files/{name}",
+		opParams: openapi3.Parameters{newTestParameter("path", "name", "a b/c")},
+		out:      "/files/a%20b%2Fc",
+	},
+
+	// example from schema
+	{
+		endpoint: "/items/{id}",
+		opParams: openapi3.Parameters{{
+			Value: openapi3.NewPathParameter("id").WithSchema(&openapi3.Schema{Type: "string", Example: "abc"}),
+		}},
+		out: "/items/abc",
+	},
+
+	// query parameter with the same name isn't substituted
+	{
+		endpoint: "/items/{id}",
+		opParams: openapi3.Parameters{newTestParameter("query", "id", 42)},
+		err:      errNoParameterExample,
+	},
+
+	// path parameter without example
+	{
+		endpoint: "/items/{id}",
+		opParams: openapi3.Parameters{{Value: openapi3.NewPathParameter("id")}},
+		err:      errNoParameterExample,
+	},
+}
+
+func TestExpandPathTemplate(t *testing.T) {
+	for i, tc := range expandPathTemplateTests {
+		op := &openapi3.Operation{Parameters: tc.opParams}
+		out, err := expandPathTemplate(tc.endpoint, operationParameters(tc.pathParams, op))
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if out != tc.out {
+			t.Errorf("#%d: result mismatch\nwant: %s\ngot: %s", i, tc.out, out)
+		}
+	}
+}
+
+func TestValidateEndpointsPathParameters(t *testing.T) {
+	var requested []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Method+" "+r.URL.Path)
+	}))
+	defer s.Close()
+
+	withExample := newTestOperation("200")
+	withExample.Parameters = openapi3.Parameters{newTestParameter("path", "id", 42)}
+
+	paths := &openapi3.Paths{
+		"/items/{id}": &openapi3.PathItem{Get: withExample, Delete: newTestOperation("200")},
+	}
+
+	r, err := ValidateEndpoints(s.URL, paths, "")
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	want := []string{"GET /items/42"}
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested mismatch\nwant: %v\ngot: %v", want, requested)
+	}
+
+	if n := r.Count(SeverityError); n != 0 {
+		t.Errorf("error count mismatch\nwant: %d\ngot: %d", 0, n)
+	}
+}
+
+type requestParametersTest struct {
+	params openapi3.Parameters // parameters declared for the operation
+	errors int                 // expected number of error-level findings
+}
+
+var requestParametersTests = []requestParametersTest{
+	// query and header parameters with examples
+	{
+		params: openapi3.Parameters{newTestParameter("query", "lang", "en"), newTestParameter("header", "X-Api-Version", 2)},
+	},
+
+	// required header parameter without example
+	{
+		params: openapi3.Parameters{
+			newTestParameter("query", "lang", "en"),
+			{Value: openapi3.NewHeaderParameter("X-Api-Version").WithRequired(true)},
+		},
+		errors: 1,
+	},
+}
+
+func TestRequestParameters(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("lang") != "en" || r.Header.Get("X-Api-Version") != "2" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer s.Close()
+
+	for i, tc := range requestParametersTests {
+		op := newTestOperation("200")
+		op.Parameters = tc.params
+
+		r, err := ValidateEndpoints(s.URL, newTestPaths("/", op), "")
+		if err != nil {
+			t.Errorf("#%d: ValidateEndpoints: %v", i, err)
+			continue
+		}
+
+		if n := r.Count(SeverityError); n != tc.errors {
+			t.Errorf("#%d: error count mismatch\nwant: %d\ngot: %d", i, tc.errors, n)
+		}
+	}
+}
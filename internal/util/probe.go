@@ -0,0 +1,155 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultStartupProbeInterval is the default time waited between startup probe attempts.
+const DefaultStartupProbeInterval = time.Second
+
+// ErrStartupProbeTimeout is returned when a service doesn't respond successfully before the startup probe's deadline.
+var ErrStartupProbeTimeout = errors.New("service did not respond successfully before startup probe deadline")
+
+// ErrNotReady is returned when a service keeps failing to respond, or responding with 5xx status codes, until the
+// readiness wait's timeout.
+var ErrNotReady = errors.New("service did not become ready before timeout")
+
+// ProbeAttempt is a single request made by a startup probe or readiness wait.
+type ProbeAttempt struct {
+	// Elapsed is the time from the start of the probe to the end of the attempt.
+	Elapsed time.Duration
+
+	// StatusCode is the response's status code, or zero if the request failed.
+	StatusCode int
+
+	// Err is the reason the request failed, if it did.
+	Err error
+}
+
+// Succeeded reports whether the attempt got a 2xx response.
+func (a ProbeAttempt) Succeeded() bool {
+	return a.Err == nil && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// Ready reports whether the attempt got a response that isn't a 5xx, meaning the service is serving requests.
+func (a ProbeAttempt) Ready() bool {
+	return a.Err == nil && a.StatusCode < 500
+}
+
+// StartupProbe holds the timing of the requests made to a freshly deployed service until its first successful response.
+type StartupProbe struct {
+	Attempts []ProbeAttempt
+
+	// TimeToFirstSuccess is the time from the start of the probe to the end of the first successful attempt, or zero
+	// if no attempt succeeded.
+	TimeToFirstSuccess time.Duration
+}
+
+// ProbeStartup repeatedly requests the root endpoint of the service at the provided URL, waiting interval between
+// attempts, until it gets a 2xx response, and measures how long that took. Each attempt's outcome and timing is logged.
+// It returns an error wrapping ErrStartupProbeTimeout, along with every attempt made, if no attempt succeeds within the
+// deadline. Unlike test requests, failed attempts aren't findings: they're expected while the service starts.
+func ProbeStartup(serviceURL, identityToken string, interval, deadline time.Duration) (*StartupProbe, error) {
+	attempts, ok := poll("Startup probe", serviceURL+"/", identityToken, interval, deadline, ProbeAttempt.Succeeded)
+	probe := &StartupProbe{Attempts: attempts}
+	if !ok {
+		return probe, fmt.Errorf("%w: %d attempt(s) in %v", ErrStartupProbeTimeout, len(attempts), deadline)
+	}
+
+	probe.TimeToFirstSuccess = attempts[len(attempts)-1].Elapsed
+	return probe, nil
+}
+
+// WaitReady repeatedly requests the provided path of the service at the provided URL, waiting interval between
+// attempts, until it gets a response that isn't a 5xx, so that endpoint validation doesn't start while the service is
+// still warming up. Each attempt's outcome is logged. It returns an error wrapping ErrNotReady if no attempt gets such
+// a response within the timeout.
+func WaitReady(serviceURL, path, identityToken string, interval, timeout time.Duration) error {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	attempts, ok := poll("Readiness check", serviceURL+path, identityToken, interval, timeout, ProbeAttempt.Ready)
+	if !ok {
+		return fmt.Errorf("%w: %s: %d attempt(s) in %v", ErrNotReady, path, len(attempts), timeout)
+	}
+
+	return nil
+}
+
+// poll repeatedly requests the provided URL, waiting interval between attempts, until an attempt satisfies done or
+// the deadline passes. Each attempt's outcome and timing is logged, labeled with the provided name. It returns every
+// attempt made and whether the last one satisfied done.
+func poll(name, url, identityToken string, interval, deadline time.Duration, done func(ProbeAttempt) bool) ([]ProbeAttempt, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	var attempts []ProbeAttempt
+	client := &http.Client{}
+	start := time.Now()
+
+	for {
+		a := probeAttempt(ctx, client, url, identityToken)
+		a.Elapsed = time.Since(start)
+		attempts = append(attempts, a)
+
+		if done(a) {
+			Infof("%s attempt %d at +%v: status code %d: done\n", name, len(attempts), a.Elapsed, a.StatusCode)
+			return attempts, true
+		}
+
+		if a.Err != nil {
+			Infof("%s attempt %d at +%v: %v\n", name, len(attempts), a.Elapsed, a.Err)
+		} else {
+			Infof("%s attempt %d at +%v: status code %d\n", name, len(attempts), a.Elapsed, a.StatusCode)
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempts, false
+		case <-time.After(interval):
+		}
+	}
+}
+
+// probeAttempt makes a single probe request to the provided URL, bounded by the provided context.
+func probeAttempt(ctx context.Context, client *http.Client, url, identityToken string) ProbeAttempt {
+	reqCtx, cancel := context.WithTimeout(ctx, defaultHTTPTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return ProbeAttempt{Err: fmt.Errorf("http.NewRequestWithContext: %w", err)}
+	}
+	setAuthorization(req.Header, identityToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ProbeAttempt{Err: fmt.Errorf("http.Client.Do: %w", err)}
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return ProbeAttempt{StatusCode: resp.StatusCode}
+}
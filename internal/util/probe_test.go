@@ -0,0 +1,133 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbeStartup(t *testing.T) {
+	const interval = 50 * time.Millisecond
+
+	// the server fails its first three requests, like a service whose container is still starting
+	var mu sync.Mutex
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		if n <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+
+	probe, err := ProbeStartup(s.URL, "", interval, 5*time.Second)
+	if err != nil {
+		t.Fatalf("ProbeStartup: %v", err)
+	}
+
+	if len(probe.Attempts) != 4 {
+		t.Errorf("attempt count mismatch\nwant: 4\ngot: %d", len(probe.Attempts))
+	}
+	for i, a := range probe.Attempts[:len(probe.Attempts)-1] {
+		if a.Succeeded() || a.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("attempt %d: unexpected outcome: %+v", i, a)
+		}
+	}
+
+	if probe.TimeToFirstSuccess < 3*interval || probe.TimeToFirstSuccess > 3*time.Second {
+		t.Errorf("measured startup time %v not in [%v, 3s]", probe.TimeToFirstSuccess, 3*interval)
+	}
+	if last := probe.Attempts[len(probe.Attempts)-1]; last.Elapsed != probe.TimeToFirstSuccess {
+		t.Errorf("startup time %v doesn't match last attempt's elapsed time %v", probe.TimeToFirstSuccess, last.Elapsed)
+	}
+}
+
+func TestProbeStartupTimeout(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	probe, err := ProbeStartup(s.URL, "", 20*time.Millisecond, 200*time.Millisecond)
+	if !errors.Is(err, ErrStartupProbeTimeout) {
+		t.Errorf("error mismatch\nwant: %v\ngot: %v", ErrStartupProbeTimeout, err)
+	}
+
+	if len(probe.Attempts) < 2 || probe.TimeToFirstSuccess != 0 {
+		t.Errorf("unexpected probe result: %+v", probe)
+	}
+}
+
+type waitReadyTest struct {
+	path   string // path passed to WaitReady
+	status int    // status code returned by the test server once warmed up
+	err    error  // expected error
+}
+
+var waitReadyTests = []waitReadyTest{
+	// success
+	{
+		path:   "/",
+		status: http.StatusOK,
+	},
+	// client errors mean the service is serving requests
+	{
+		path:   "/healthz",
+		status: http.StatusNotFound,
+	},
+	// path without a leading slash
+	{
+		path:   "healthz",
+		status: http.StatusOK,
+	},
+	// still failing after warming up
+	{
+		path:   "/",
+		status: http.StatusBadGateway,
+		err:    ErrNotReady,
+	},
+}
+
+func TestWaitReady(t *testing.T) {
+	for i, tc := range waitReadyTests {
+		// the server responds 503 to its first two requests, like a service that's still warming up
+		var mu sync.Mutex
+		requests := 0
+		var paths []string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests++
+			n := requests
+			paths = append(paths, r.URL.Path)
+			mu.Unlock()
+
+			if n <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(tc.status)
+		}))
+
+		err := WaitReady(s.URL, tc.path, "", 10*time.Millisecond, 500*time.Millisecond)
+		s.Close()
+		if !errors.Is(err, tc.err) {
+			t.Errorf("#%d: error mismatch\nwant: %v\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if tc.err == nil && requests != 3 {
+			t.Errorf("#%d: request count mismatch\nwant: 3\ngot: %d", i, requests)
+		}
+		if want := "/" + strings.TrimPrefix(tc.path, "/"); paths[0] != want {
+			t.Errorf("#%d: path mismatch\nwant: %s\ngot: %s", i, want, paths[0])
+		}
+	}
+}
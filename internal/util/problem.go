@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/ghodss/yaml"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+// problemMediaType is the media type of RFC 7807 problem details responses.
+const problemMediaType = "application/problem+json"
+
+// ProblemDetailsSchema is the default schema error response bodies are checked against by WithProblemDetails: an RFC
+// 7807 problem details object with a string type, a string title and an integer status.
+var ProblemDetailsSchema = &openapi3.Schema{
+	Type:     "object",
+	Required: []string{"type", "title", "status"},
+	Properties: map[string]*openapi3.SchemaRef{
+		"type":   openapi3.NewSchemaRef("", openapi3.NewStringSchema()),
+		"title":  openapi3.NewSchemaRef("", openapi3.NewStringSchema()),
+		"status": openapi3.NewSchemaRef("", openapi3.NewIntegerSchema()),
+		"detail": openapi3.NewSchemaRef("", openapi3.NewStringSchema()),
+	},
+}
+
+// LoadSchema loads a JSON schema, in the OpenAPI 3 Schema Object dialect, from the provided YAML or JSON file, such as
+// a custom problem details schema for WithProblemDetails.
+func LoadSchema(filename string) (*openapi3.Schema, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile: %w", err)
+	}
+
+	b, err = yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, fmt.Errorf("yaml.YAMLToJSON: %s: %w", filename, err)
+	}
+
+	schema := &openapi3.Schema{}
+	if err := json.Unmarshal(b, schema); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %s: %w", filename, err)
+	}
+
+	return schema, nil
+}
+
+// checkProblemDetails records an error-level finding in the validator's Report if the provided expected error
+// response, with a status code of 400 or above, isn't an application/problem+json response whose body matches the
+// validator's problem details schema.
+func (v *validator) checkProblemDetails(endpointURL, httpMethod string, resp *http.Response, body []byte) {
+	if resp.StatusCode < 400 {
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != problemMediaType {
+		v.report.AddError(endpointURL, httpMethod, "error response content type %q isn't %s", contentType, problemMediaType)
+		v.logf("Error response isn't problem details: FAIL\n")
+		return
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		v.report.AddError(endpointURL, httpMethod, "problem details body isn't valid JSON: %v", err)
+		v.logf("Error response isn't problem details: FAIL\n")
+		return
+	}
+
+	if err := v.problemSchema.VisitJSON(value); err != nil {
+		v.report.AddError(endpointURL, httpMethod, "problem details body doesn't match schema: %v", err)
+		v.logf("Error response isn't problem details: FAIL\n")
+	}
+}
@@ -0,0 +1,156 @@
+package util
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type problemDetailsTest struct {
+	statusCode  int              // status code returned by the test server
+	contentType string           // Content-Type returned by the test server
+	body        string           // response body returned by the test server
+	schema      *openapi3.Schema // custom problem details schema, if any
+	errors      int              // expected number of error-level findings
+}
+
+var problemDetailsTests = []problemDetailsTest{
+	// conforming problem details
+	{
+		statusCode:  http.StatusNotFound,
+		contentType: "application/problem+json",
+		body:        `{"type": "about:blank", "title": "Not Found", "status": 404, "detail": "no such item"}`,
+	},
+
+	// conforming problem details with parameters in the content type
+	{
+		statusCode:  http.StatusBadRequest,
+		contentType: "application/problem+json; charset=utf-8",
+		body:        `{"type": "https://example.com/bad", "title": "Bad Request", "status": 400}`,
+	},
+
+	// plain JSON content type
+	{
+		statusCode:  http.StatusNotFound,
+		contentType: "application/json",
+		body:        `{"type": "about:blank", "title": "Not Found", "status": 404}`,
+		errors:      1,
+	},
+
+	// missing title
+	{
+		statusCode:  http.StatusNotFound,
+		contentType: "application/problem+json",
+		body:        `{"type": "about:blank", "status": 404}`,
+		errors:      1,
+	},
+
+	// status of the wrong type
+	{
+		statusCode:  http.StatusNotFound,
+		contentType: "application/problem+json",
+		body:        `{"type": "about:blank", "title": "Not Found", "status": "404"}`,
+		errors:      1,
+	},
+
+	// invalid JSON
+	{
+		statusCode:  http.StatusNotFound,
+		contentType: "application/problem+json",
+		body:        `{"type": `,
+		errors:      1,
+	},
+
+	// success responses aren't checked
+	{
+		statusCode:  http.StatusOK,
+		contentType: "text/plain",
+		body:        "ok",
+	},
+
+	// custom schema
+	{
+		statusCode:  http.StatusNotFound,
+		contentType: "application/problem+json",
+		body:        `{"code": "NOT_FOUND"}`,
+		schema:      newObjectSchema("code", openapi3.NewStringSchema()),
+	},
+
+	// custom schema, non-conforming body
+	{
+		statusCode:  http.StatusNotFound,
+		contentType: "application/problem+json",
+		body:        `{"type": "about:blank", "title": "Not Found", "status": 404}`,
+		schema:      newObjectSchema("code", openapi3.NewStringSchema()),
+		errors:      1,
+	},
+}
+
+func TestProblemDetails(t *testing.T) {
+	for i, tc := range problemDetailsTests {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tc.contentType)
+			w.WriteHeader(tc.statusCode)
+			w.Write([]byte(tc.body))
+		}))
+
+		r, err := ValidateEndpoints(s.URL, newTestPaths("/", newTestOperation("default")), "",
+			WithProblemDetails(true, tc.schema))
+		s.Close()
+
+		if err != nil {
+			t.Errorf("#%d: ValidateEndpoints: %v", i, err)
+			continue
+		}
+
+		if n := r.Count(SeverityError); n != tc.errors {
+			t.Errorf("#%d: error count mismatch\nwant: %d\ngot: %d\nfindings: %v", i, tc.errors, n, r.Findings)
+		}
+	}
+}
+
+func TestProblemDetailsDisabled(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	r, err := ValidateEndpoints(s.URL, newTestPaths("/", newTestOperation("404")), "")
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	if n := r.Count(SeverityError); n != 0 {
+		t.Errorf("error count mismatch\nwant: 0\ngot: %d", n)
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "problem.yaml")
+	schema := "type: object\nrequired: [code]\nproperties:\n  code:\n    type: string\n"
+	if err := ioutil.WriteFile(filename, []byte(schema), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	s, err := LoadSchema(filename)
+	if err != nil {
+		t.Fatalf("LoadSchema: %v", err)
+	}
+
+	if err := s.VisitJSON(map[string]interface{}{"code": "NOT_FOUND"}); err != nil {
+		t.Errorf("conforming value rejected: %v", err)
+	}
+	if err := s.VisitJSON(map[string]interface{}{}); err == nil {
+		t.Errorf("non-conforming value accepted")
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Severity is the severity level of a Finding.
+type Severity int
+
+const (
+	// SeverityWarning findings are reported but don't fail a run unless warnings are promoted to failures.
+	SeverityWarning Severity = iota
+
+	// SeverityError findings always fail a run.
+	SeverityError
+)
+
+// String returns the lowercase name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the severity as its lowercase name, so it reads naturally in JSON output.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Finding is a single issue found while validating a Cloud Run service's endpoints.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Endpoint string   `json:"endpoint"`
+	Method   string   `json:"method"`
+	Message  string   `json:"message"`
+}
+
+// Result is the outcome of a single test request made to a Cloud Run service's endpoint.
+type Result struct {
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+
+	// ContentType is the content type of the request body, if any.
+	ContentType string `json:"contentType,omitempty"`
+
+	StatusCode int `json:"statusCode"`
+
+	// ExpectedStatusCodes are the keys of the responses the OpenAPI spec declares for the operation, including
+	// ranges like 2XX and default.
+	ExpectedStatusCodes []string `json:"expectedStatusCodes"`
+
+	// Passed reports whether the request elicited an expected response without any error-level findings.
+	Passed bool `json:"passed"`
+}
+
+// Report holds the findings collected while validating a Cloud Run service's endpoints. It's safe for concurrent use.
+type Report struct {
+	mu sync.Mutex
+
+	Findings []Finding
+
+	// Results holds the outcome of each test request, in the order they completed.
+	Results []Result
+
+	// TagCounts maps each OpenAPI tag to the number of tested operations carrying it.
+	TagCounts map[string]int
+}
+
+// addFinding records a finding with the given severity for the given endpoint and HTTP method and logs it.
+func (r *Report) addFinding(sev Severity, endpoint, method, format string, a ...interface{}) {
+	f := Finding{
+		Severity: sev,
+		Endpoint: endpoint,
+		Method:   method,
+		Message:  fmt.Sprintf(format, a...),
+	}
+
+	log.Printf("%s %s: %s: %s\n", f.Method, f.Endpoint, f.Severity, f.Message)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Findings = append(r.Findings, f)
+}
+
+// addResult records the outcome of a single test request.
+func (r *Report) addResult(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Results = append(r.Results, res)
+}
+
+// countTags increments the tested operation count of each of the provided OpenAPI tags.
+func (r *Report) countTags(tags []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.TagCounts == nil {
+		r.TagCounts = make(map[string]int)
+	}
+
+	for _, t := range tags {
+		r.TagCounts[t]++
+	}
+}
+
+// merge adds the findings, results and tag counts of the provided Report to this one.
+func (r *Report) merge(other *Report) {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Findings = append(r.Findings, other.Findings...)
+	r.Results = append(r.Results, other.Results...)
+	for t, n := range other.TagCounts {
+		if r.TagCounts == nil {
+			r.TagCounts = make(map[string]int)
+		}
+		r.TagCounts[t] += n
+	}
+}
+
+// AddWarning records a warning-level finding for the given endpoint and HTTP method.
+func (r *Report) AddWarning(endpoint, method, format string, a ...interface{}) {
+	r.addFinding(SeverityWarning, endpoint, method, format, a...)
+}
+
+// AddError records an error-level finding for the given endpoint and HTTP method.
+func (r *Report) AddError(endpoint, method, format string, a ...interface{}) {
+	r.addFinding(SeverityError, endpoint, method, format, a...)
+}
+
+// Count returns the number of findings with the given severity.
+func (r *Report) Count(sev Severity) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, f := range r.Findings {
+		if f.Severity == sev {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Passed reports whether the run should be considered successful. Error-level findings always fail the run.
+// Warning-level findings only fail the run if failOnWarning is set.
+func (r *Report) Passed(failOnWarning bool) bool {
+	if r.Count(SeverityError) > 0 {
+		return false
+	}
+
+	return !failOnWarning || r.Count(SeverityWarning) == 0
+}
+
+// ReportSummary is a snapshot of a Report along with whether the run should be considered successful. It's the model
+// exposed to report templates and written as JSON.
+type ReportSummary struct {
+	Passed    bool           `json:"passed"`
+	Findings  []Finding      `json:"findings"`
+	Results   []Result       `json:"results"`
+	TagCounts map[string]int `json:"tagCounts,omitempty"`
+}
+
+// Summary returns a snapshot of the Report along with whether the run should be considered successful (see Passed).
+// Its slices are never nil.
+func (r *Report) Summary(failOnWarning bool) ReportSummary {
+	passed := r.Passed(failOnWarning)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := ReportSummary{
+		Passed:    passed,
+		Findings:  append([]Finding{}, r.Findings...),
+		Results:   append([]Result{}, r.Results...),
+		TagCounts: r.TagCounts,
+	}
+
+	return s
+}
+
+// WriteJSON writes the Report to the provided writer as indented JSON, along with whether the run should be
+// considered successful (see Passed), for consumption by CI dashboards and other tools.
+func (r *Report) WriteJSON(w io.Writer, failOnWarning bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r.Summary(failOnWarning)); err != nil {
+		return fmt.Errorf("json.Encoder.Encode: %w", err)
+	}
+
+	return nil
+}
+
+// reportTemplateFuncs are the functions available to report templates on top of text/template's builtins.
+var reportTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// ParseReportTemplate parses the provided text/template text for rendering with WriteTemplate. On top of the builtin
+// functions, templates can use join, which joins a slice of strings with a separator like strings.Join.
+func ParseReportTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(reportTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template.Template.Parse: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// WriteTemplate renders the provided template with the Report's ReportSummary to the provided writer, for custom
+// report formats.
+func (r *Report) WriteTemplate(w io.Writer, tmpl *template.Template, failOnWarning bool) error {
+	if err := tmpl.Execute(w, r.Summary(failOnWarning)); err != nil {
+		return fmt.Errorf("template.Template.Execute: %w", err)
+	}
+
+	return nil
+}
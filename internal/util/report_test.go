@@ -0,0 +1,134 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type reportPassedTest struct {
+	findings      []Finding // findings recorded in the report
+	failOnWarning bool      // whether warnings are promoted to failures
+	passed        bool      // expected result of Report.Passed
+}
+
+var reportPassedTests = []reportPassedTest{
+	// no findings
+	{
+		passed: true,
+	},
+
+	// warning-only run with default settings
+	{
+		findings: []Finding{
+			{Severity: SeverityWarning, Endpoint: "/", Method: "GET", Message: "content-type mismatch"},
+		},
+		passed: true,
+	},
+
+	// warning-only run with warnings promoted to failures
+	{
+		findings: []Finding{
+			{Severity: SeverityWarning, Endpoint: "/", Method: "GET", Message: "content-type mismatch"},
+		},
+		failOnWarning: true,
+		passed:        false,
+	},
+
+	// error finding with default settings
+	{
+		findings: []Finding{
+			{Severity: SeverityError, Endpoint: "/", Method: "GET", Message: "unexpected status code 500"},
+		},
+		passed: false,
+	},
+
+	// error and warning findings with warnings promoted to failures
+	{
+		findings: []Finding{
+			{Severity: SeverityWarning, Endpoint: "/", Method: "GET", Message: "content-type mismatch"},
+			{Severity: SeverityError, Endpoint: "/", Method: "GET", Message: "unexpected status code 500"},
+		},
+		failOnWarning: true,
+		passed:        false,
+	},
+}
+
+func TestReportPassed(t *testing.T) {
+	for i, tc := range reportPassedTests {
+		r := &Report{}
+		for _, f := range tc.findings {
+			r.addFinding(f.Severity, f.Endpoint, f.Method, "%s", f.Message)
+		}
+
+		if p := r.Passed(tc.failOnWarning); p != tc.passed {
+			t.Errorf("#%d: result mismatch\nwant: %t\ngot: %t", i, tc.passed, p)
+		}
+	}
+}
+
+func TestReportWriteJSON(t *testing.T) {
+	r := &Report{}
+	r.AddWarning("/", "GET", "content-type mismatch")
+	r.addResult(Result{Endpoint: "/", Method: "GET", StatusCode: 200, ExpectedStatusCodes: []string{"200"}, Passed: true})
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf, true); err != nil {
+		t.Fatalf("Report.WriteJSON: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v\n%s", err, buf.String())
+	}
+
+	want := map[string]interface{}{
+		"passed": false,
+		"findings": []interface{}{
+			map[string]interface{}{"severity": "warning", "endpoint": "/", "method": "GET", "message": "content-type mismatch"},
+		},
+		"results": []interface{}{
+			map[string]interface{}{
+				"endpoint":            "/",
+				"method":              "GET",
+				"statusCode":          float64(200),
+				"expectedStatusCodes": []interface{}{"200"},
+				"passed":              true,
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result mismatch\nwant: %v\ngot: %v", want, got)
+	}
+}
+
+func TestReportWriteTemplate(t *testing.T) {
+	r := &Report{}
+	r.AddError("/items", "POST", "unexpected status code 500")
+	r.addResult(Result{Endpoint: "/", Method: "GET", StatusCode: 200, ExpectedStatusCodes: []string{"200"}, Passed: true})
+	r.addResult(Result{Endpoint: "/items", Method: "POST", ContentType: "application/json", StatusCode: 500,
+		ExpectedStatusCodes: []string{"201"}, Passed: false})
+
+	tmpl, err := ParseReportTemplate("report", `{{if .Passed}}PASS{{else}}FAIL{{end}}
+{{range .Results}}{{.Method}} {{.Endpoint}} {{.StatusCode}} {{if .Passed}}ok{{else}}want {{join .ExpectedStatusCodes ","}}{{end}}
+{{end}}{{range .Findings}}{{.Severity}}: {{.Message}}
+{{end}}`)
+	if err != nil {
+		t.Fatalf("ParseReportTemplate: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteTemplate(&buf, tmpl, false); err != nil {
+		t.Fatalf("Report.WriteTemplate: %v", err)
+	}
+
+	want := `FAIL
+GET / 200 ok
+POST /items 500 want 201
+error: unexpected status code 500
+`
+	if got := buf.String(); got != want {
+		t.Errorf("result mismatch\nwant: %q\ngot: %q", want, got)
+	}
+}
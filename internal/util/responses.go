@@ -0,0 +1,108 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultResponseKey is the key of the openapi3.Responses entry that applies to status codes without their own entry.
+const defaultResponseKey = "default"
+
+// SuccessPredicate decides whether a test request passed from the status code and body of its response, in place of
+// matching the status code against the responses declared in the OpenAPI spec.
+type SuccessPredicate func(statusCode int, body []byte) bool
+
+// matchResponse looks up the openapi3.Response declared for the provided status code the way OpenAPI resolves it: the
+// exact status code first, then its range (2XX, 3XX, etc.), then the default response. It returns the key of the
+// matched response along with it.
+func matchResponse(responses openapi3.Responses, statusCode int) (*openapi3.ResponseRef, string, bool) {
+	code := strconv.Itoa(statusCode)
+
+	// range keys are uppercase in the OpenAPI spec, but lowercase ones are accepted too
+	for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", defaultResponseKey} {
+		if r, ok := responses[key]; ok && r != nil {
+			return r, key, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// responseKeys returns the sorted keys of the provided responses.
+func responseKeys(responses openapi3.Responses) []string {
+	keys := make([]string, 0, len(responses))
+	for k := range responses {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// validateContentType records an error-level finding in the validator's Report if the response's Content-Type isn't
+// one of the content types declared in the matched openapi3.Response, such as a text/html error page returned where
+// application/json is declared. Wildcards like application/* are honored. Responses declaring no content aren't
+// checked.
+func (v *validator) validateContentType(endpointURL, httpMethod string, resp *http.Response, expected *openapi3.Response) {
+	if len(expected.Content) == 0 {
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if expected.Content.Get(contentType) != nil {
+		return
+	}
+
+	declared := make([]string, 0, len(expected.Content))
+	for k := range expected.Content {
+		declared = append(declared, k)
+	}
+	sort.Strings(declared)
+
+	v.report.AddError(endpointURL, httpMethod, "response content type %q isn't any of the declared %s", contentType, strings.Join(declared, ", "))
+	v.logf("Response content type: FAIL\n")
+}
+
+// validateResponseBody checks a JSON response body against the schema declared for its content type in the matched
+// openapi3.Response, if any. Schemas composed with oneOf, anyOf and allOf are resolved the way OpenAPI defines them:
+// the body must match exactly one oneOf branch, at least one anyOf branch, and every allOf branch. Mismatches are
+// recorded as error-level findings in the validator's Report.
+func (v *validator) validateResponseBody(endpointURL, httpMethod string, resp *http.Response, body []byte, expected *openapi3.Response) {
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "json") {
+		return
+	}
+
+	mediaType := expected.Content.Get(contentType)
+	if mediaType == nil || mediaType.Schema == nil || mediaType.Schema.Value == nil {
+		return
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		v.report.AddError(endpointURL, httpMethod, "response body isn't valid JSON: %v", err)
+		return
+	}
+
+	if err := mediaType.Schema.Value.VisitJSON(value); err != nil {
+		v.report.AddError(endpointURL, httpMethod, "response body doesn't match declared schema: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package util
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestResponses creates openapi3.Responses with an entry for each of the provided keys.
+func newTestResponses(keys ...string) openapi3.Responses {
+	r := make(openapi3.Responses)
+	for _, k := range keys {
+		r[k] = &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription(k)}
+	}
+
+	return r
+}
+
+type matchResponseTest struct {
+	responses  openapi3.Responses // declared responses
+	statusCode int                // returned status code
+	key        string             // expected matched key
+	ok         bool               // expected match success
+}
+
+var matchResponseTests = []matchResponseTest{
+	// exact match
+	{
+		responses:  newTestResponses("200"),
+		statusCode: 200,
+		key:        "200",
+		ok:         true,
+	},
+
+	// range match
+	{
+		responses:  newTestResponses("2XX"),
+		statusCode: 201,
+		key:        "2XX",
+		ok:         true,
+	},
+
+	// lowercase range match
+	{
+		responses:  newTestResponses("2xx"),
+		statusCode: 204,
+		key:        "2xx",
+		ok:         true,
+	},
+
+	// exact match takes precedence over range and default
+	{
+		responses:  newTestResponses("default", "4XX", "404"),
+		statusCode: 404,
+		key:        "404",
+		ok:         true,
+	},
+
+	// range match takes precedence over default
+	{
+		responses:  newTestResponses("default", "4XX"),
+		statusCode: 418,
+		key:        "4XX",
+		ok:         true,
+	},
+
+	// default match
+	{
+		responses:  newTestResponses("200", "default"),
+		statusCode: 500,
+		key:        "default",
+		ok:         true,
+	},
+
+	// no match
+	{
+		responses:  newTestResponses("200", "3XX"),
+		statusCode: 404,
+	},
+}
+
+func TestMatchResponse(t *testing.T) {
+	for i, tc := range matchResponseTests {
+		_, key, ok := matchResponse(tc.responses, tc.statusCode)
+		if key != tc.key || ok != tc.ok {
+			t.Errorf("#%d: result mismatch\nwant: %s, %t\ngot: %s, %t", i, tc.key, tc.ok, key, ok)
+		}
+	}
+}
+
+// newObjectSchema creates an object openapi3.Schema requiring a single property with the provided name and schema.
+func newObjectSchema(property string, schema *openapi3.Schema) *openapi3.Schema {
+	return &openapi3.Schema{
+		Type:       "object",
+		Required:   []string{property},
+		Properties: map[string]*openapi3.SchemaRef{property: openapi3.NewSchemaRef("", schema)},
+	}
+}
+
+var (
+	// catSchema matches objects with a string meow property.
+	catSchema = newObjectSchema("meow", openapi3.NewStringSchema())
+
+	// dogSchema matches objects with a boolean bark property.
+	dogSchema = newObjectSchema("bark", openapi3.NewBoolSchema())
+
+	// namedSchema matches objects with a string name property.
+	namedSchema = newObjectSchema("name", openapi3.NewStringSchema())
+)
+
+type validateResponseBodyTest struct {
+	schema *openapi3.Schema // declared response schema
+	body   string           // response body returned by the test server
+	errors int              // expected number of error-level findings
+}
+
+var validateResponseBodyTests = []validateResponseBodyTest{
+	// oneOf, body matching first branch
+	{
+		schema: openapi3.NewOneOfSchema(catSchema, dogSchema),
+		body:   `{"meow": "purr"}`,
+	},
+
+	// oneOf, body matching second branch
+	{
+		schema: openapi3.NewOneOfSchema(catSchema, dogSchema),
+		body:   `{"bark": true}`,
+	},
+
+	// oneOf, body matching no branch
+	{
+		schema: openapi3.NewOneOfSchema(catSchema, dogSchema),
+		body:   `{"moo": 1}`,
+		errors: 1,
+	},
+
+	// oneOf, body matching both branches
+	{
+		schema: openapi3.NewOneOfSchema(catSchema, dogSchema),
+		body:   `{"meow": "purr", "bark": true}`,
+		errors: 1,
+	},
+
+	// anyOf, body matching both branches
+	{
+		schema: openapi3.NewAnyOfSchema(catSchema, dogSchema),
+		body:   `{"meow": "purr", "bark": true}`,
+	},
+
+	// anyOf, body matching no branch
+	{
+		schema: openapi3.NewAnyOfSchema(catSchema, dogSchema),
+		body:   `{"bark": "woof"}`,
+		errors: 1,
+	},
+
+	// allOf, body matching every branch
+	{
+		schema: openapi3.NewAllOfSchema(catSchema, namedSchema),
+		body:   `{"meow": "purr", "name": "tom"}`,
+	},
+
+	// allOf, body missing a branch
+	{
+		schema: openapi3.NewAllOfSchema(catSchema, namedSchema),
+		body:   `{"meow": "purr"}`,
+		errors: 1,
+	},
+
+	// invalid JSON
+	{
+		schema: catSchema,
+		body:   `{"meow": `,
+		errors: 1,
+	},
+}
+
+func TestValidateResponseBody(t *testing.T) {
+	for i, tc := range validateResponseBodyTests {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(tc.body))
+		}))
+
+		op := newTestOperation("200")
+		op.Responses["200"].Value.Content = openapi3.NewContentWithJSONSchema(tc.schema)
+
+		r, err := ValidateEndpoints(s.URL, newTestPaths("/", op), "")
+		s.Close()
+
+		if err != nil {
+			t.Errorf("#%d: ValidateEndpoints: %v", i, err)
+			continue
+		}
+
+		if n := r.Count(SeverityError); n != tc.errors {
+			t.Errorf("#%d: error count mismatch\nwant: %d\ngot: %d", i, tc.errors, n)
+		}
+	}
+}
+
+type validateContentTypeTest struct {
+	declared    []string // content types declared for the response
+	contentType string   // Content-Type returned by the test server
+	disabled    bool     // whether the check is disabled
+	errors      int      // expected number of error-level findings
+}
+
+var validateContentTypeTests = []validateContentTypeTest{
+	// matching content type
+	{
+		declared:    []string{"application/json"},
+		contentType: "application/json",
+	},
+
+	// matching content type with parameters
+	{
+		declared:    []string{"application/json"},
+		contentType: "application/json; charset=utf-8",
+	},
+
+	// one of several declared content types
+	{
+		declared:    []string{"application/json", "text/plain"},
+		contentType: "text/plain; charset=utf-8",
+	},
+
+	// wildcard
+	{
+		declared:    []string{"text/*"},
+		contentType: "text/csv",
+	},
+
+	// HTML instead of JSON
+	{
+		declared:    []string{"application/json"},
+		contentType: "text/html; charset=utf-8",
+		errors:      1,
+	},
+
+	// HTML instead of JSON, check disabled
+	{
+		declared:    []string{"application/json"},
+		contentType: "text/html; charset=utf-8",
+		disabled:    true,
+	},
+
+	// no declared content
+	{
+		contentType: "text/html; charset=utf-8",
+	},
+}
+
+func TestValidateContentType(t *testing.T) {
+	for i, tc := range validateContentTypeTests {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tc.contentType)
+			w.Write([]byte("ok"))
+		}))
+
+		op := newTestOperation("200")
+		if len(tc.declared) > 0 {
+			op.Responses["200"].Value.Content = openapi3.Content{}
+			for _, ct := range tc.declared {
+				op.Responses["200"].Value.Content[ct] = openapi3.NewMediaType()
+			}
+		}
+
+		var opts []ValidateOption
+		if tc.disabled {
+			opts = append(opts, WithCheckContentType(false))
+		}
+
+		r, err := ValidateEndpoints(s.URL, newTestPaths("/", op), "", opts...)
+		s.Close()
+
+		if err != nil {
+			t.Errorf("#%d: ValidateEndpoints: %v", i, err)
+			continue
+		}
+
+		if n := r.Count(SeverityError); n != tc.errors {
+			t.Errorf("#%d: error count mismatch\nwant: %d\ngot: %d", i, tc.errors, n)
+		}
+	}
+}
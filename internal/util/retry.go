@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"github.com/getkin/kin-openapi/openapi3"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxRetryAfter is the default cap on how long a Retry-After header can make a retry wait.
+const defaultMaxRetryAfter = 30 * time.Second
+
+// sendTestRequestWithRetries sends a test request, retrying it with exponential backoff if endpoint retries are
+// enabled and the request fails with a transport error or an unexpected 429 or 5xx status code. A 429 response's
+// Retry-After header, capped to the validator's maxRetryAfter, is honored in place of the normal backoff. Once the
+// validator's context is done, it stops waiting and returns the last attempt's result.
+func (v *validator) sendTestRequestWithRetries(endpointURL, httpMethod, mimeType string, header http.Header, reqBodyReader *strings.Reader, operation *openapi3.Operation) (*http.Response, []byte, error) {
+	var done <-chan struct{}
+	if v.ctx != nil {
+		done = v.ctx.Done()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if _, err := reqBodyReader.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+
+		resp, body, err := v.sendTestRequest(endpointURL, httpMethod, mimeType, header, reqBodyReader)
+		if attempt >= v.retryAttempts || !retryable(resp, err, operation) {
+			return resp, body, err
+		}
+
+		delay := v.retryDelay * time.Duration(1<<uint(attempt-1))
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = d
+				if delay > v.maxRetryAfter {
+					delay = v.maxRetryAfter
+				}
+			}
+		}
+
+		if err != nil {
+			v.logf("%s %s failed: %v\n", httpMethod, endpointURL, err)
+		} else {
+			v.logf("%s %s returned status code %d\n", httpMethod, endpointURL, resp.StatusCode)
+		}
+		v.logf("Retrying in %v (attempt %d of %d)\n", delay, attempt+1, v.retryAttempts)
+		select {
+		case <-time.After(delay):
+		case <-done:
+			return resp, body, err
+		}
+	}
+}
+
+// retryable reports whether a test request that returned the provided response and error should be retried. Requests
+// are retried on transport errors other than a cancelled or timed out context, and on 429 and 5xx status codes that the
+// openapi3.Operation doesn't expect, either exactly or by range. A default response doesn't count as expecting them.
+func retryable(resp *http.Response, err error, operation *openapi3.Operation) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return false
+	}
+
+	_, key, expected := matchResponse(operation.Responses, resp.StatusCode)
+	return !expected || key == defaultResponseKey
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP-date, into the
+// duration to wait from now. It returns false if the value can't be parsed.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
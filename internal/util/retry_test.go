@@ -0,0 +1,204 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type retryAfterTest struct {
+	value string        // Retry-After header value
+	delay time.Duration // expected result of retryAfter
+	ok    bool          // expected parse success
+}
+
+// retryAfterNow is the current time used when parsing HTTP-date Retry-After header values.
+var retryAfterNow = time.Date(2020, time.July, 1, 12, 0, 0, 0, time.UTC)
+
+var retryAfterTests = []retryAfterTest{
+	// delay in seconds
+	{
+		value: "120",
+		delay: 2 * time.Minute,
+		ok:    true,
+	},
+
+	// HTTP-date in the future
+	{
+		value: "Wed, 01 Jul 2020 12:00:30 GMT",
+		delay: 30 * time.Second,
+		ok:    true,
+	},
+
+	// HTTP-date in the past
+	{
+		value: "Wed, 01 Jul 2020 11:00:00 GMT",
+		delay: 0,
+		ok:    true,
+	},
+
+	// missing header
+	{
+		value: "",
+	},
+
+	// malformed header
+	{
+		value: "soon",
+	},
+}
+
+func TestRetryAfter(t *testing.T) {
+	for i, tc := range retryAfterTests {
+		d, ok := retryAfter(tc.value, retryAfterNow)
+		if ok != tc.ok || d != tc.delay {
+			t.Errorf("#%d: result mismatch\nwant: %v, %t\ngot: %v, %t", i, tc.delay, tc.ok, d, ok)
+		}
+	}
+}
+
+// newTooManyRequestsServer creates a test server that returns a 429 with the provided Retry-After header on the first
+// request and a 200 on every request after that.
+func newTooManyRequestsServer(retryAfter string) (*httptest.Server, *int) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return s, &requests
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	s, requests := newTooManyRequestsServer("1")
+	defer s.Close()
+
+	start := time.Now()
+	r, err := ValidateEndpoints(s.URL, newTestPaths("/", newTestOperation("200")), "", WithRetries(2, time.Millisecond))
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	if *requests != 2 {
+		t.Errorf("request count mismatch\nwant: %d\ngot: %d", 2, *requests)
+	}
+
+	if n := r.Count(SeverityError); n != 0 {
+		t.Errorf("error count mismatch\nwant: %d\ngot: %d", 0, n)
+	}
+
+	if elapsed < time.Second {
+		t.Errorf("retry did not wait for Retry-After: elapsed %v", elapsed)
+	}
+}
+
+func TestRetryCapsRetryAfter(t *testing.T) {
+	s, requests := newTooManyRequestsServer("3600")
+	defer s.Close()
+
+	start := time.Now()
+	_, err := ValidateEndpoints(s.URL, newTestPaths("/", newTestOperation("200")), "",
+		WithRetries(2, time.Millisecond), WithMaxRetryAfter(10*time.Millisecond))
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	if *requests != 2 {
+		t.Errorf("request count mismatch\nwant: %d\ngot: %d", 2, *requests)
+	}
+
+	if elapsed > 5*time.Second {
+		t.Errorf("retry did not cap Retry-After: elapsed %v", elapsed)
+	}
+}
+
+func TestNoRetryByDefault(t *testing.T) {
+	s, requests := newTooManyRequestsServer("0")
+	defer s.Close()
+
+	r, err := ValidateEndpoints(s.URL, newTestPaths("/", newTestOperation("200")), "")
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	if *requests != 1 {
+		t.Errorf("request count mismatch\nwant: %d\ngot: %d", 1, *requests)
+	}
+
+	if n := r.Count(SeverityError); n != 1 {
+		t.Errorf("error count mismatch\nwant: %d\ngot: %d", 1, n)
+	}
+}
+
+type retryableTest struct {
+	err       error // error returned by the test request
+	retryable bool  // expected result of retryable
+}
+
+var retryableTests = []retryableTest{
+	// transport error
+	{
+		err:       errors.New("connection reset by peer"),
+		retryable: true,
+	},
+
+	// cancelled context
+	{
+		err: fmt.Errorf("Get: %w", context.Canceled),
+	},
+
+	// timed out context
+	{
+		err: fmt.Errorf("Get: %w", context.DeadlineExceeded),
+	},
+}
+
+func TestRetryable(t *testing.T) {
+	for i, tc := range retryableTests {
+		if got := retryable(nil, tc.err, newTestOperation("200")); got != tc.retryable {
+			t.Errorf("#%d: result mismatch\nwant: %t\ngot: %t", i, tc.retryable, got)
+		}
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := ValidateEndpoints(s.URL, newTestPaths("/", newTestOperation("200")), "",
+		WithRetries(3, time.Minute), WithContext(ctx))
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	if requests != 1 {
+		t.Errorf("request count mismatch\nwant: %d\ngot: %d", 1, requests)
+	}
+
+	if elapsed > 10*time.Second {
+		t.Errorf("retry kept waiting after the context was done: elapsed %v", elapsed)
+	}
+}
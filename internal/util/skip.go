@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SkipFileName is the name of the optional file in a sample's directory listing the operations of its OpenAPI spec
+// that aren't tested, one SkipRule per line. Blank lines and lines starting with `#` are ignored.
+const SkipFileName = ".sstignore"
+
+// SkipRule selects the operations skipped during endpoint validation: those of a path of the OpenAPI spec, as it's
+// written in the spec, e.g. /items/{id}, and of an HTTP method, or of every method if it's empty. The path may hold
+// `*` wildcards matching a single path segment, as in /admin/*.
+type SkipRule struct {
+	Method string
+	Path   string
+}
+
+// ParseSkipRule parses a SkipRule from either a path, such as `/items/{id}`, or an HTTP method followed by a path,
+// such as `DELETE /items/{id}`.
+func ParseSkipRule(s string) (SkipRule, error) {
+	fields := strings.Fields(s)
+
+	var r SkipRule
+	switch len(fields) {
+	case 1:
+		r.Path = fields[0]
+	case 2:
+		methods, err := ParseMethods(fields[:1])
+		if err != nil {
+			return SkipRule{}, fmt.Errorf("%q: %w", s, err)
+		}
+		r.Method, r.Path = methods[0], fields[1]
+	default:
+		return SkipRule{}, fmt.Errorf("%q: expecting a path, optionally preceded by an HTTP method", s)
+	}
+
+	if !strings.HasPrefix(r.Path, "/") {
+		return SkipRule{}, fmt.Errorf("%q: path must start with /", s)
+	}
+	if _, err := path.Match(r.Path, ""); err != nil {
+		return SkipRule{}, fmt.Errorf("%q: path.Match: %w", s, err)
+	}
+
+	return r, nil
+}
+
+// LoadSkipFile parses the SkipRules listed in the SkipFileName file of the provided sample directory. It returns no
+// rules if the sample has no such file.
+func LoadSkipFile(sampleDir string) ([]SkipRule, error) {
+	filename := filepath.Join(sampleDir, SkipFileName)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	var rules []SkipRule
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+
+		r, err := ParseSkipRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, line, err)
+		}
+		rules = append(rules, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("bufio.Scanner: %s: %w", filename, err)
+	}
+
+	return rules, nil
+}
+
+// matches reports whether the rule selects the operation of the provided HTTP method on the provided OpenAPI path.
+func (r SkipRule) matches(method, endpoint string) bool {
+	if r.Method != "" && r.Method != method {
+		return false
+	}
+
+	ok, _ := path.Match(r.Path, endpoint)
+	return ok
+}
+
+// skipped reports whether the operation of the provided HTTP method on the provided OpenAPI path is skipped according
+// to WithSkipRules.
+func (v *validator) skipped(method, endpoint string) bool {
+	for _, r := range v.skipRules {
+		if r.matches(method, endpoint) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type parseSkipRuleTest struct {
+	in   string   // skip rule as written
+	rule SkipRule // expected result of ParseSkipRule
+	err  bool     // whether ParseSkipRule should return an error
+}
+
+var parseSkipRuleTests = []parseSkipRuleTest{
+	{in: "/items/{id}", rule: SkipRule{Path: "/items/{id}"}},
+	{in: "delete  /items/{id}", rule: SkipRule{Method: http.MethodDelete, Path: "/items/{id}"}},
+	{in: "/admin/*", rule: SkipRule{Path: "/admin/*"}},
+	{in: "FETCH /items", err: true},
+	{in: "items", err: true},
+	{in: "GET /items extra", err: true},
+	{in: "/items/[", err: true},
+}
+
+func TestParseSkipRule(t *testing.T) {
+	for i, tc := range parseSkipRuleTests {
+		r, err := ParseSkipRule(tc.in)
+		if (err != nil) != tc.err {
+			t.Errorf("#%d: error mismatch\nwant error: %t\ngot: %v", i, tc.err, err)
+			continue
+		}
+
+		if r != tc.rule {
+			t.Errorf("#%d: result mismatch\nwant: %+v\ngot: %+v", i, tc.rule, r)
+		}
+	}
+}
+
+func TestLoadSkipFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skip")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rules, err := LoadSkipFile(dir)
+	if err != nil || rules != nil {
+		t.Errorf("LoadSkipFile without a skip file: %v, %v", rules, err)
+	}
+
+	content := "# not implemented\n\n/admin/*\nDELETE /items/{id}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, SkipFileName), []byte(content), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	rules, err = LoadSkipFile(dir)
+	if err != nil {
+		t.Fatalf("LoadSkipFile: %v", err)
+	}
+	want := []SkipRule{{Path: "/admin/*"}, {Method: http.MethodDelete, Path: "/items/{id}"}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("result mismatch\nwant: %+v\ngot: %+v", want, rules)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, SkipFileName), []byte("/ok\nnot-a-path\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	if _, err := LoadSkipFile(dir); err == nil {
+		t.Errorf("LoadSkipFile: no error for an invalid rule")
+	}
+}
+
+func TestValidateEndpointsSkipRules(t *testing.T) {
+	var requested []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	defer s.Close()
+
+	paths := &openapi3.Paths{
+		"/admin/users": &openapi3.PathItem{Get: newTestOperation("200")},
+		"/items":       &openapi3.PathItem{Get: newTestOperation("501"), Delete: newTestOperation("200")},
+	}
+
+	r, err := ValidateEndpoints(s.URL, paths, "", WithSkipRules(SkipRule{Path: "/admin/*"},
+		SkipRule{Method: http.MethodDelete, Path: "/items"}))
+	if err != nil {
+		t.Fatalf("ValidateEndpoints: %v", err)
+	}
+
+	if want := []string{"GET /items"}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("requests mismatch\nwant: %v\ngot: %v", want, requested)
+	}
+	if !r.Passed(false) {
+		t.Errorf("report failed despite the failing operations being skipped")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Exchange is a single test request made to a Cloud Run service along with the response it elicited.
+type Exchange struct {
+	Started      time.Time
+	Duration     time.Duration
+	Request      *http.Request
+	RequestBody  []byte
+	Response     *http.Response
+	ResponseBody []byte
+}
+
+// Transcript holds every Exchange made while validating a Cloud Run service's endpoints, in the order they were made.
+type Transcript struct {
+	mu        sync.Mutex
+	Exchanges []Exchange
+}
+
+// record appends an Exchange to the Transcript.
+func (t *Transcript) record(e Exchange) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Exchanges = append(t.Exchanges, e)
+}
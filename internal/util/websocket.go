@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// webSocketAcceptGUID is the GUID a WebSocket server appends to the client's Sec-WebSocket-Key when computing the
+// Sec-WebSocket-Accept header of its handshake response (see RFC 6455, section 1.3).
+const webSocketAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// expectsSwitchingProtocols reports whether the provided openapi3.Operation documents a 101 Switching Protocols
+// response, as WebSocket endpoints do.
+func expectsSwitchingProtocols(operation *openapi3.Operation) bool {
+	_, ok := operation.Responses[strconv.Itoa(http.StatusSwitchingProtocols)]
+	return ok
+}
+
+// validateWebSocketUpgrade attempts a WebSocket opening handshake with the provided endpoint and records an error-level
+// finding in the validator's Report if the connection isn't upgraded. The handshake's outcome is recorded as a Result
+// in the validator's Report.
+func (v *validator) validateWebSocketUpgrade(endpointURL string) error {
+	v.logf("Attempting WebSocket handshake with %s\n", endpointURL)
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return fmt.Errorf("crypto/rand.Read: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	ctx, cancel := v.requestContext()
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURL, nil)
+	if err != nil {
+		return fmt.Errorf("http.NewRequestWithContext: %w", err)
+	}
+
+	setAuthorization(req.Header, v.identityToken)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http.Client.Do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	v.logf("Status code: %d\n", resp.StatusCode)
+
+	errCount := v.report.Count(SeverityError)
+	defer func() {
+		v.report.addResult(Result{
+			Endpoint:            endpointURL,
+			Method:              http.MethodGet,
+			StatusCode:          resp.StatusCode,
+			ExpectedStatusCodes: []string{strconv.Itoa(http.StatusSwitchingProtocols)},
+			Passed:              v.report.Count(SeverityError) == errCount,
+		})
+	}()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		v.report.AddError(endpointURL, http.MethodGet, "WebSocket upgrade failed: unexpected status code %d", resp.StatusCode)
+		return nil
+	}
+
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		v.report.AddError(endpointURL, http.MethodGet, "WebSocket upgrade failed: unexpected Upgrade header %q", resp.Header.Get("Upgrade"))
+		return nil
+	}
+
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != webSocketAccept(key) {
+		v.report.AddError(endpointURL, http.MethodGet, "WebSocket upgrade failed: unexpected Sec-WebSocket-Accept header %q", accept)
+		return nil
+	}
+
+	v.logf("WebSocket upgrade succeeded\n")
+	return nil
+}
+
+// webSocketAccept computes the Sec-WebSocket-Accept header value a WebSocket server should respond with for the
+// provided Sec-WebSocket-Key.
+func webSocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + webSocketAcceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// webSocketEchoHandler performs the server side of a WebSocket opening handshake and then echoes back everything it
+// receives on the hijacked connection.
+func webSocketEchoHandler(accept func(key string) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		buf.WriteString("Upgrade: websocket\r\n")
+		buf.WriteString("Connection: Upgrade\r\n")
+		buf.WriteString("Sec-WebSocket-Accept: " + accept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		buf.Flush()
+
+		io.Copy(conn, buf)
+	}
+}
+
+type validateWebSocketUpgradeTest struct {
+	handler http.Handler // test server handler
+	errors  int          // expected number of error-level findings
+}
+
+var validateWebSocketUpgradeTests = []validateWebSocketUpgradeTest{
+	// WebSocket echo server upgrades the connection
+	{
+		handler: webSocketEchoHandler(webSocketAccept),
+	},
+
+	// server responds with the wrong Sec-WebSocket-Accept header
+	{
+		handler: webSocketEchoHandler(func(string) string { return "bogus" }),
+		errors:  1,
+	},
+
+	// server doesn't upgrade the connection
+	{
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		errors:  1,
+	},
+}
+
+func TestValidateWebSocketUpgrade(t *testing.T) {
+	for i, tc := range validateWebSocketUpgradeTests {
+		s := httptest.NewServer(tc.handler)
+		r, err := ValidateEndpoints(s.URL, newTestPaths("/ws", newTestOperation("101")), "")
+		s.Close()
+
+		if err != nil {
+			t.Errorf("#%d: ValidateEndpoints: %v", i, err)
+			continue
+		}
+
+		if n := r.Count(SeverityError); n != tc.errors {
+			t.Errorf("#%d: error count mismatch\nwant: %d\ngot: %d", i, tc.errors, n)
+		}
+	}
+}
@@ -16,8 +16,13 @@ package main
 
 import (
 	"github.com/GoogleCloudPlatform/serverless-sample-tester/cmd"
+	"log"
+	"os"
 )
 
 func main() {
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		log.Printf("Error: %v\n", err)
+		os.Exit(cmd.ExitCode(err))
+	}
 }